@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/database"
 	"github.com/massnetorg/mass-core/logging"
@@ -35,6 +36,8 @@ type AddrIndexer struct {
 	sync.Mutex
 
 	stateBindingDb state.Database
+	utxoIndex      bool
+	params         consensus.DeploymentChecker
 }
 
 type shTxLoc map[[txIndexKeyLen]byte]struct{}
@@ -103,15 +106,28 @@ func mustDecodeGtxSpentIndexKey(key [btxSpentIndexKeyLen]byte) ([ripemd160.Size]
 
 // newAddrIndexer creates a new block address indexer.
 // Use Start to begin processing incoming index jobs.
-func NewAddrIndexer(db database.Db, stateBindingDb state.Database) (*AddrIndexer, error) {
+// If utxoIndex is true, the index of unspent outputs is built if not exists,
+// otherwise it is removed.  Blocks are indexed by the deployments of params.
+func NewAddrIndexer(params consensus.DeploymentChecker, db database.Db, stateBindingDb state.Database, utxoIndex bool) (*AddrIndexer, error) {
 	_, _, err := db.FetchAddrIndexTip()
 	if err != nil && err != database.ErrAddrIndexDoesNotExist {
 		return nil, err
 	}
 
+	if utxoIndex {
+		err = db.EnableUtxoIndex()
+	} else {
+		err = db.DisableUtxoIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	ai := &AddrIndexer{
 		db:             db,
 		stateBindingDb: stateBindingDb,
+		utxoIndex:      utxoIndex,
+		params:         params,
 		// server:         server,
 		blockLogger: NewBlockProgressLogger("process"),
 	}
@@ -149,6 +165,9 @@ func (a *AddrIndexer) SyncAttachBlock(bindingState state.Trie, block *massutil.B
 			BindingTxIndex:      btxAddrIndex,
 			BindingTxSpentIndex: btxSpentIndex,
 		}
+		if a.utxoIndex {
+			addrIndexData.UtxoIndex = indexBlockUtxos(block, txStore)
+		}
 		err = a.db.SubmitAddrIndex(sha, height, addrIndexData)
 		if err != nil {
 			logging.CPrint(logging.PANIC, "Unable to write index for block",
@@ -314,7 +333,7 @@ func (a *AddrIndexer) indexBlockAddrs(bindingState state.Trie, blk *massutil.Blo
 	}
 	oldNetworkBinding := networkBinding
 
-	enforceMassIp2WarmUp := forks.EnforceMASSIP0002WarmUp(blk.Height())
+	enforceMassIp2WarmUp := forks.EnforceMASSIP0002WarmUp(a.params, blk.Height())
 
 	txRecord := make(map[wire.Hash]int)
 	for txIdx, tx := range blk.Transactions() {
@@ -357,7 +376,7 @@ func (a *AddrIndexer) indexBlockAddrs(bindingState state.Trie, blk *massutil.Blo
 					TxLen:   txLenBefore,
 				}
 
-				if !forks.EnforceMASSIP0002WarmUp(blkHeightBefore) {
+				if !forks.EnforceMASSIP0002WarmUp(a.params, blkHeightBefore) {
 					err = indexScriptPubKeyForTxIn(txAddrIndex, btxSpentIndex, txD.Tx.MsgTx().TxOut[prevOut.Index].PkScript, locInBlock, blkHeightBefore, txBeforeLoc, prevOut.Index)
 					if err != nil {
 						// TODO: Assess the risk of this error
@@ -441,6 +460,39 @@ func (a *AddrIndexer) indexBlockAddrs(bindingState state.Trie, blk *massutil.Blo
 	return addrIndex, bindingTxAddrIndex, bindingTxSpentIndex, nil
 }
 
+// indexBlockUtxos returns outputs created by block and previous outputs
+// spent by block.
+func indexBlockUtxos(blk *massutil.Block, txStore TxStore) *database.UtxoIndexData {
+	data := &database.UtxoIndexData{}
+	for _, tx := range blk.Transactions() {
+		coinbase := IsCoinBase(tx)
+		if !coinbase {
+			for _, txIn := range tx.MsgTx().TxIn {
+				prevOut := txIn.PreviousOutPoint
+				// existence is checked by indexBlockAddrs
+				txD := txStore[prevOut.Hash]
+				data.Spent = append(data.Spent, &database.UtxoIndexOutput{
+					OutPoint:    prevOut,
+					PkScript:    txD.Tx.MsgTx().TxOut[prevOut.Index].PkScript,
+					Value:       txD.Tx.MsgTx().TxOut[prevOut.Index].Value,
+					BlockHeight: txD.BlockHeight,
+					Coinbase:    IsCoinBase(txD.Tx),
+				})
+			}
+		}
+		for i, txOut := range tx.MsgTx().TxOut {
+			data.Created = append(data.Created, &database.UtxoIndexOutput{
+				OutPoint:    wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)},
+				PkScript:    txOut.PkScript,
+				Value:       txOut.Value,
+				BlockHeight: blk.Height(),
+				Coinbase:    coinbase,
+			})
+		}
+	}
+	return data
+}
+
 func (a *AddrIndexer) SyncDetachBlock(block *massutil.Block) error {
 	a.Lock()
 	defer a.Unlock()
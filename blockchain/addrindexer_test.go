@@ -209,7 +209,7 @@ func TestAddrIndexer(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Zero(t, len(mp))
 
-	node := NewBlockNode(&blks[21].MsgBlock().Header, blks[21].Hash(), BFNone)
+	node := NewBlockNode(bc.chainParams, &blks[21].MsgBlock().Header, blks[21].Hash(), BFNone)
 	txStore, err := bc.fetchInputTransactions(node, blks[21])
 	assert.Nil(t, err)
 
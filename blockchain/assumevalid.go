@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"sync/atomic"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// ScriptCheckStats are the numbers of blocks checked before connecting them
+// to the best chain, by how their scripts were validated.
+type ScriptCheckStats struct {
+	// Checked is the number of blocks whose scripts were validated.
+	Checked uint64
+	// CheckpointSkipped is the number of blocks which skipped script
+	// validation since they are before the latest checkpoint or imported.
+	CheckpointSkipped uint64
+	// AssumeValidSkipped is the number of blocks which skipped script
+	// validation since they are ancestors of the assume-valid block.
+	AssumeValidSkipped uint64
+}
+
+// AssumeValid returns the assume-valid block, nil if assume-valid is
+// disabled.
+//
+// This function is safe for concurrent access.
+func (chain *Blockchain) AssumeValid() *config.Checkpoint {
+	return chain.assumeValid
+}
+
+// AddHeaderChain records the ancestors of the assume-valid block from a
+// chain of headers ordered by height, such as the one requested by netsync
+// before requesting its blocks, and returns whether the headers lead to the
+// assume-valid block.  Since the hash of the assume-valid block is known, a
+// linked chain of headers ending with it can't be forged, so the blocks of
+// the headers skip script validation when they are connected.  Headers which
+// don't lead to the assume-valid block are ignored, and the headers never
+// affect chain selection.
+//
+// This function is safe for concurrent access.
+func (chain *Blockchain) AddHeaderChain(headers []*wire.BlockHeader) bool {
+	av := chain.assumeValid
+	if av == nil || len(headers) == 0 {
+		return false
+	}
+	base := headers[0].Height
+	if base > av.Height || base+uint64(len(headers)) <= av.Height {
+		return false
+	}
+	hashes := make([]wire.Hash, av.Height-base+1)
+	for i := range hashes {
+		header := headers[i]
+		if i > 0 && (header.Height != base+uint64(i) || header.Previous != hashes[i-1]) {
+			return false
+		}
+		hashes[i] = header.BlockHash()
+	}
+	if hashes[len(hashes)-1] != *av.Hash {
+		return false
+	}
+
+	chain.assumeValidLock.Lock()
+	chain.assumeValidBase = base
+	chain.assumeValidHeaders = hashes
+	chain.assumeValidLock.Unlock()
+	return true
+}
+
+// isAssumedValid returns whether node is the assume-valid block or one of its
+// ancestors, which are known from the header chain added by AddHeaderChain,
+// so that it is decided before the block is in the block tree.
+func (chain *Blockchain) isAssumedValid(node *BlockNode) bool {
+	av := chain.assumeValid
+	if av == nil || node.Hash == nil || node.Height > av.Height {
+		return false
+	}
+	if node.Height == av.Height {
+		return node.Hash.IsEqual(av.Hash)
+	}
+
+	chain.assumeValidLock.Lock()
+	defer chain.assumeValidLock.Unlock()
+	if node.Height < chain.assumeValidBase || node.Height-chain.assumeValidBase >= uint64(len(chain.assumeValidHeaders)) {
+		return false
+	}
+	return chain.assumeValidHeaders[node.Height-chain.assumeValidBase] == *node.Hash
+}
+
+// ScriptCheckStats returns the numbers of blocks checked before connecting
+// them to the best chain since the chain was created, by how their scripts
+// were validated.
+func (chain *Blockchain) ScriptCheckStats() ScriptCheckStats {
+	return ScriptCheckStats{
+		Checked:            atomic.LoadUint64(&chain.scriptStats.Checked),
+		CheckpointSkipped:  atomic.LoadUint64(&chain.scriptStats.CheckpointSkipped),
+		AssumeValidSkipped: atomic.LoadUint64(&chain.scriptStats.AssumeValidSkipped),
+	}
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func blockHeaders(blks []*massutil.Block) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, len(blks))
+	for _, blk := range blks {
+		headers = append(headers, &blk.MsgBlock().Header)
+	}
+	return headers
+}
+
+func TestIsAssumedValid(t *testing.T) {
+	// blks[32:35] are a side chain of heights [31, 33]
+	blks := loadBlks("./data/beforestaking.dat")
+	headers := blockHeaders(blks[:32])
+	node := func(blk *massutil.Block) *BlockNode {
+		return &BlockNode{Height: blk.Height(), Hash: blk.Hash()}
+	}
+
+	chain := &Blockchain{}
+	require.False(t, chain.AddHeaderChain(headers), "disabled")
+	require.False(t, chain.isAssumedValid(node(blks[1])), "disabled")
+
+	chain.assumeValid = &config.Checkpoint{Height: 20, Hash: blks[20].Hash()}
+	require.True(t, chain.isAssumedValid(node(blks[20])), "assume-valid block")
+	require.False(t, chain.isAssumedValid(node(blks[10])), "no header chain")
+
+	require.False(t, chain.AddHeaderChain(headers[:20]), "below assume-valid")
+	require.False(t, chain.AddHeaderChain(headers[21:]), "above assume-valid")
+	require.False(t, chain.AddHeaderChain(append(blockHeaders(blks[5:20]), headers[21])), "not linked")
+	require.False(t, chain.AddHeaderChain(append(blockHeaders(blks[30:32]), blockHeaders(blks[32:35])...)), "side chain")
+	require.False(t, chain.isAssumedValid(node(blks[10])), "ignored header chains")
+
+	require.True(t, chain.AddHeaderChain(headers[5:25]))
+	require.True(t, chain.isAssumedValid(node(blks[5])))
+	require.True(t, chain.isAssumedValid(node(blks[19])))
+	require.False(t, chain.isAssumedValid(node(blks[4])), "before header chain")
+	require.False(t, chain.isAssumedValid(node(blks[21])), "descendant")
+	require.False(t, chain.isAssumedValid(&BlockNode{Height: 10, Hash: blks[9].Hash()}), "not an ancestor")
+	require.False(t, chain.isAssumedValid(&BlockNode{Height: 10}), "template")
+
+	atomic.AddUint64(&chain.scriptStats.AssumeValidSkipped, 2)
+	atomic.AddUint64(&chain.scriptStats.Checked, 1)
+	require.Equal(t, ScriptCheckStats{Checked: 1, AssumeValidSkipped: 2}, chain.ScriptCheckStats())
+}
+
+func TestAssumeValidSync(t *testing.T) {
+	blks := loadBlks("./data/beforestaking.dat")
+	genesis := config.ChainParams.GenesisBlock.Header
+	genesisHash := config.ChainParams.GenesisHash
+	defer func() {
+		config.ChainParams.GenesisBlock.Header = genesis
+		config.ChainParams.GenesisHash = genesisHash
+	}()
+	copy(config.ChainParams.GenesisHash[:], blks[0].Hash()[:])
+	copy(config.ChainParams.GenesisBlock.Header.Challenge[:], blks[0].MsgBlock().Header.Challenge[:])
+	copy(config.ChainParams.GenesisBlock.Header.ChainID[:], blks[0].MsgBlock().Header.ChainID[:])
+	config.ChainParams.GenesisBlock.Header.Timestamp = blks[0].MsgBlock().Header.Timestamp
+	config.ChainParams.GenesisBlock.Header.Target = blks[0].MsgBlock().Header.Target
+
+	bc, closeChain := newReorgTestChain(blks[0], "assumevalid")
+	defer closeChain()
+	bc.assumeValid = &config.Checkpoint{Height: 20, Hash: blks[20].Hash()}
+
+	process := func(from, to int) {
+		for i := from; i <= to; i++ {
+			isOrphan, err := bc.processBlock(blks[i], BFNone)
+			require.NoError(t, err, i)
+			require.False(t, isOrphan, i)
+		}
+	}
+
+	// blocks synced before the headers leading to the assume-valid block
+	// are checked
+	process(1, 5)
+	require.Equal(t, ScriptCheckStats{Checked: 5}, bc.ScriptCheckStats())
+
+	require.True(t, bc.AddHeaderChain(blockHeaders(blks[5:26])))
+	process(6, 31)
+	require.Equal(t, uint64(31), bc.BestBlockHeight())
+	require.Equal(t, ScriptCheckStats{Checked: 16, AssumeValidSkipped: 15}, bc.ScriptCheckStats())
+}
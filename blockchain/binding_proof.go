@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/txscript"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// BindingProof is the binding info of a script at a block, along with the
+// Merkle proof of it against the binding root of the block.
+type BindingProof struct {
+	BlockHash   wire.Hash
+	Height      uint64
+	BindingRoot common.Hash
+	Script      []byte
+	// Info is nil if the script is not bound at the block, Proof then
+	// proves the absence of it.
+	Info  *state.BindingInfo
+	Proof [][]byte
+}
+
+// Verify verifies the proof, it returns the binding info proved.
+func (bp *BindingProof) Verify() (*state.BindingInfo, error) {
+	return state.VerifyBindingProof(bp.BindingRoot, bp.Script, bp.Proof)
+}
+
+// GetBindingProof returns the binding info of script at the main chain block
+// of height, along with the Merkle proof of it, which can be verified by
+// state.VerifyBindingProof against the BindingRoot in the block header.
+func (chain *Blockchain) GetBindingProof(script []byte, height uint64) (*BindingProof, error) {
+	if len(script) != txscript.OP_DATA_22 {
+		return nil, fmt.Errorf("invalid new binding script length %d", len(script))
+	}
+	hash, root, err := chain.bindingRootAt(height)
+	if err != nil {
+		return nil, err
+	}
+	bst, err := chain.bindingStateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	data, err := bst.TryGet(script)
+	if err != nil {
+		return nil, err
+	}
+	var proof trie.ProofList
+	if err = bst.Prove(script, 0, &proof); err != nil {
+		return nil, err
+	}
+
+	bp := &BindingProof{
+		BlockHash:   *hash,
+		Height:      height,
+		BindingRoot: root,
+		Script:      script,
+		Proof:       proof,
+	}
+	if len(data) != 0 {
+		bp.Info = state.DecodeBindingInfo(data)
+	}
+	return bp, nil
+}
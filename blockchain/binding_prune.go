@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/consensus/forks"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+)
+
+const (
+	// DefaultBindingCacheSize is the default memory budget in bytes for
+	// dirty binding state nodes when binding state pruning is enabled.
+	DefaultBindingCacheSize = 256 * 1024 * 1024
+
+	// bindingFlushInterval is the number of blocks between writing the
+	// binding state of the best block to disk when pruning is enabled.
+	bindingFlushInterval = 1000
+)
+
+// bindingRoot is the binding state root of a block.
+type bindingRoot struct {
+	height uint64
+	root   common.Hash
+}
+
+// bindingPruner keeps the binding states of recent blocks in the memory of
+// the trie database, and dereferences those lower than (best - depth), so
+// their nodes replaced by later blocks are garbage collected without being
+// written to disk.  Dirty nodes are flushed to disk when they exceed the
+// memory budget, and the binding state of the best block is flushed every
+// bindingFlushInterval blocks and by Blockchain.Stop.
+//
+// Only roots kept in memory are pruned, roots once flushed stay on disk.  The
+// binding states of blocks connected after the last flush are lost if the
+// process exits without Stop, they are rebuilt by recoverBindingState.
+type bindingPruner struct {
+	triedb    *trie.Database
+	depth     uint64
+	limit     common.StorageSize
+	roots     []bindingRoot // referenced roots, in the order of attaching
+	lastFlush uint64
+}
+
+func newBindingPruner(triedb *trie.Database, depth, cacheSize uint64) *bindingPruner {
+	if cacheSize == 0 {
+		cacheSize = DefaultBindingCacheSize
+	}
+	return &bindingPruner{
+		triedb: triedb,
+		depth:  depth,
+		limit:  common.StorageSize(cacheSize),
+	}
+}
+
+// attach references the binding state root of the block attached to the main
+// chain at height, and prunes roots lower than (height - depth).
+func (bp *bindingPruner) attach(height uint64, root common.Hash) error {
+	bp.triedb.Reference(root, common.Hash{})
+	bp.roots = append(bp.roots, bindingRoot{height: height, root: root})
+	for len(bp.roots) > 0 && bp.roots[0].height+bp.depth < height {
+		bp.triedb.Dereference(bp.roots[0].root)
+		bp.roots = bp.roots[1:]
+	}
+
+	if height >= bp.lastFlush+bindingFlushInterval {
+		if err := bp.flush(height, root); err != nil {
+			return err
+		}
+	}
+	if bp.triedb.Size() > bp.limit {
+		if err := bp.triedb.Cap(bp.limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the binding state root of the block at height to disk.
+func (bp *bindingPruner) flush(height uint64, root common.Hash) error {
+	if err := bp.triedb.Commit(root); err != nil {
+		return err
+	}
+	bp.lastFlush = height
+	stats := bp.triedb.GCStats()
+	logging.CPrint(logging.INFO, "binding state flushed", logging.LogFormat{
+		"height":     height,
+		"root":       root,
+		"dirtyNodes": stats.DirtyNodes,
+		"dirtySize":  stats.DirtySize,
+		"gcNodes":    stats.GCNodes,
+		"gcSize":     stats.GCSize,
+		"flushNodes": stats.FlushNodes,
+		"flushSize":  stats.FlushSize,
+	})
+	return nil
+}
+
+// pruneBindingState prunes binding states after node is attached to the main
+// chain when pruning is enabled, failure is only logged since dirty nodes are
+// kept in memory.
+func (chain *Blockchain) pruneBindingState(node *BlockNode) {
+	if chain.bindingPruner == nil || !forks.EnforceMASSIP0002WarmUp(chain, node.Height) {
+		return
+	}
+	if err := chain.bindingPruner.attach(node.Height, node.blockHeader.BindingRoot); err != nil {
+		logging.CPrint(logging.ERROR, "failed to prune binding state", logging.LogFormat{
+			"height": node.Height,
+			"err":    err,
+		})
+	}
+}
+
+// FlushBindingState writes the binding state of the best block to disk when
+// binding state pruning is enabled.  It is called by Stop, otherwise binding
+// states of recent blocks kept in memory are rebuilt on next start.
+func (chain *Blockchain) FlushBindingState() error {
+	return chain.execProcessFunc(chain.flushBindingState)
+}
+
+func (chain *Blockchain) flushBindingState() error {
+	if chain.bindingPruner == nil {
+		return nil
+	}
+	best := chain.blockTree.bestBlockNode()
+	if !forks.EnforceMASSIP0002WarmUp(chain, best.Height) {
+		return nil
+	}
+	return chain.bindingPruner.flush(best.Height, best.blockHeader.BindingRoot)
+}
+
+// recoverBindingState rebuilds the binding states lost when the process
+// exited without flushing them.  The blocks above the highest block of the
+// main chain whose binding state is on disk are disconnected and connected
+// again.
+func (chain *Blockchain) recoverBindingState() error {
+	var (
+		nodes []*BlockNode
+		node  = chain.blockTree.bestBlockNode()
+	)
+	for forks.EnforceMASSIP0002WarmUp(chain, node.Height) {
+		if _, err := chain.stateBindingDb.OpenBindingTrie(node.blockHeader.BindingRoot); err == nil {
+			break
+		}
+		if node.Parent == nil {
+			return errBindingStateLost
+		}
+		nodes = append(nodes, node)
+		node = node.Parent
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	logging.CPrint(logging.WARN, "binding state lost, reconnecting blocks", logging.LogFormat{
+		"from": node.Height + 1,
+		"to":   nodes[0].Height,
+	})
+	blocks := make([]*massutil.Block, len(nodes))
+	for i, n := range nodes {
+		block, err := chain.db.FetchBlockBySha(n.Hash)
+		if err != nil {
+			return err
+		}
+		blocks[i] = block
+	}
+	for i, n := range nodes {
+		if err := chain.disconnectBlock(n, blocks[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if err := chain.connectBlock(nodes[i], blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BindingStateGCStats returns the statistics of garbage collection and
+// flushing of the binding state database.
+func (chain *Blockchain) BindingStateGCStats() trie.GCStats {
+	return chain.stateBindingDb.TrieDB().GCStats()
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/database/memdb"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb/memorydb"
+	"github.com/massnetorg/mass-core/trie/rawdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindingPruner(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := trie.NewDatabaseWithConfig(rawdb.NewDatabase(diskdb), &trie.Config{TrackDirties: true})
+	bp := newBindingPruner(triedb, 3, 0)
+
+	tr, err := trie.New(common.Hash{}, triedb)
+	require.NoError(t, err)
+	var roots []common.Hash
+	for height := uint64(1); height <= 10; height++ {
+		for i := 0; i < 20; i++ {
+			key := make([]byte, 22)
+			binary.BigEndian.PutUint64(key, height*100+uint64(i))
+			require.NoError(t, tr.TryUpdate(key, key[:8]))
+		}
+		root, err := tr.Commit()
+		require.NoError(t, err)
+		require.NoError(t, bp.attach(height, root))
+		roots = append(roots, root)
+	}
+
+	// roots lower than (10 - 3) are pruned without being written to disk
+	require.Equal(t, 0, diskdb.Len())
+	for i, root := range roots {
+		_, err := trie.New(root, triedb)
+		if uint64(i+1)+3 < 10 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	stats := triedb.GCStats()
+	require.NotZero(t, stats.GCNodes)
+	require.NotZero(t, stats.DirtyNodes)
+
+	// dirty nodes over the memory budget are flushed
+	bp.limit = triedb.Size() / 2
+	require.NoError(t, bp.attach(10, roots[9]))
+	require.True(t, triedb.Size() <= bp.limit)
+	require.NotZero(t, diskdb.Len())
+
+	// flushed root is kept after dereferenced
+	require.NoError(t, bp.flush(10, roots[9]))
+	require.Equal(t, uint64(10), bp.lastFlush)
+	for height := uint64(11); height <= 14; height++ {
+		require.NoError(t, bp.attach(height, roots[9]))
+	}
+	_, err = trie.New(roots[9], trie.NewDatabase(rawdb.NewDatabase(diskdb)))
+	require.NoError(t, err)
+}
+
+func TestBindingStateRestart(t *testing.T) {
+	db, err := memdb.NewMemDb()
+	require.NoError(t, err)
+	defer db.Close()
+	teardown, err := mkTmpDir(dbpath)
+	require.NoError(t, err)
+	defer teardown()
+	bindingDb, err := rawdb.NewLevelDBDatabase(filepath.Join(dbpath, "bindingstate"), 0, 0, "", false)
+	require.NoError(t, err)
+	defer bindingDb.Close()
+
+	newChain := func() *Blockchain {
+		bc, err := NewBlockchain(&Config{
+			DB:                db,
+			StateBindingDb:    state.NewDatabaseWithConfig(bindingDb, &trie.Config{TrackDirties: true}),
+			ChainParams:       &config.RegressionNetParams,
+			CachePath:         filepath.Join(dbpath, BlockCacheFileName),
+			BindingPruneDepth: MinPruneDepth,
+		})
+		require.NoError(t, err)
+		return bc
+	}
+
+	bc := newChain()
+	payout, err := massutil.NewAddressWitnessScriptHash(make([]byte, 32), &config.RegressionNetParams)
+	require.NoError(t, err)
+	hashes, err := bc.GenerateBlocks(3, payout)
+	require.NoError(t, err)
+	require.NoError(t, bc.Stop())
+
+	// the binding state of the best block is on disk after Stop
+	bc = newChain()
+	defer bc.Stop()
+	require.Equal(t, hashes[2], bc.BestBlockHash())
+	_, err = bc.blockTree.bestBlockNode().BindingState(bc.stateBindingDb)
+	require.NoError(t, err)
+}
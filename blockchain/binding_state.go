@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/consensus/forks"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/txscript"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// bindingStateCacheSize is the max number of binding states opened by
+// BindingStateAt kept in memory.
+const bindingStateCacheSize = 16
+
+// bindingRootAt returns the hash and the binding state root of the main chain
+// block of height, the root is zero if binding state is not enforced yet.
+func (chain *Blockchain) bindingRootAt(height uint64) (*wire.Hash, common.Hash, error) {
+	hash, err := chain.db.FetchBlockShaByHeight(height)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	header, err := chain.GetHeaderByHash(hash)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	// binding state is empty before MASSIP0002 warms up
+	if !forks.EnforceMASSIP0002WarmUp(chain, height) {
+		return hash, common.Hash{}, nil
+	}
+	return hash, header.BindingRoot, nil
+}
+
+// BindingStateAt returns a copy of the binding state at the main chain block
+// of height, it works for blocks no longer kept in memory as long as their
+// binding states are not pruned.  Recently opened binding states are cached.
+//
+// This function is safe for concurrent access.
+func (chain *Blockchain) BindingStateAt(height uint64) (state.Trie, error) {
+	_, root, err := chain.bindingRootAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return chain.bindingStateAt(root)
+}
+
+// bindingStateAt returns a copy of the binding state of root, opening it if
+// not cached.
+func (chain *Blockchain) bindingStateAt(root common.Hash) (state.Trie, error) {
+	chain.bindingStatesLock.Lock()
+	defer chain.bindingStatesLock.Unlock()
+
+	if cached, ok := chain.bindingStates.Get(root); ok {
+		return chain.stateBindingDb.CopyTrie(cached.(state.Trie)), nil
+	}
+	bst, err := chain.stateBindingDb.OpenBindingTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	chain.bindingStates.Add(root, bst)
+	return chain.stateBindingDb.CopyTrie(bst), nil
+}
+
+// BindingsAt returns an iterator over all the bindings at the main chain
+// block of height.
+//
+// This function is safe for concurrent access.
+func (chain *Blockchain) BindingsAt(height uint64) (*BindingIterator, error) {
+	bst, err := chain.BindingStateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return NewBindingIterator(bst), nil
+}
+
+// BindingIterator iterates over the bindings in a binding state, in the
+// order of binding scripts.  Other entries of the binding state, like the
+// coinbase of pool keys, are skipped.
+type BindingIterator struct {
+	it *trie.Iterator
+
+	Script []byte             // binding script of the current binding
+	Info   *state.BindingInfo // binding info of the current binding
+}
+
+// NewBindingIterator returns an iterator over the bindings in bst.
+func NewBindingIterator(bst state.Trie) *BindingIterator {
+	return &BindingIterator{it: trie.NewIterator(bst.NodeIterator(nil))}
+}
+
+// Next moves the iterator to the next binding, it returns false when no
+// binding is left or an error occurs.
+func (it *BindingIterator) Next() bool {
+	for it.it.Next() {
+		if len(it.it.Key) != txscript.OP_DATA_22 || len(it.it.Value) == 0 {
+			continue
+		}
+		it.Script = it.it.Key
+		it.Info = state.DecodeBindingInfo(it.it.Value)
+		return true
+	}
+	it.Script = nil
+	it.Info = nil
+	return false
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *BindingIterator) Err() error {
+	return it.it.Err
+}
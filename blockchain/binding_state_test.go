@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindingStateAt(t *testing.T) {
+	bc, teardown, err := newBlockChain()
+	require.NoError(t, err)
+	defer teardown()
+
+	// binding state is empty before MASSIP0002 warms up
+	bst, err := bc.BindingStateAt(bc.BestBlockHeight())
+	require.NoError(t, err)
+	it, err := bc.BindingsAt(bc.BestBlockHeight())
+	require.NoError(t, err)
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	scripts := make([][]byte, 5)
+	for i := range scripts {
+		scripts[i] = bytes.Repeat([]byte{byte(5 - i)}, 22)
+		info := &state.BindingInfo{Amount: int64(i+1) * 1e8}
+		require.NoError(t, bst.TryUpdate(scripts[i], state.EncodeBindingInfo(info)))
+	}
+	amt, err := massutil.NewAmountFromInt(15e8)
+	require.NoError(t, err)
+	require.NoError(t, PutNetworkBinding(bst, amt))
+	require.NoError(t, bst.TryUpdate(makePoolPkKey(bytes.Repeat([]byte{0x01}, 48)), []byte{0x01}))
+	root, err := bst.Commit()
+	require.NoError(t, err)
+
+	// opened binding states are cached, callers get copies
+	bst, err = bc.bindingStateAt(root)
+	require.NoError(t, err)
+	require.Equal(t, 2, bc.bindingStates.Len())
+	require.NoError(t, bst.TryDelete(scripts[0]))
+	bst, err = bc.bindingStateAt(root)
+	require.NoError(t, err)
+	require.Equal(t, 2, bc.bindingStates.Len())
+	require.Equal(t, root, bst.Hash())
+
+	// bindings are iterated in the order of scripts
+	it = NewBindingIterator(bst)
+	for i := len(scripts) - 1; i >= 0; i-- {
+		require.True(t, it.Next())
+		require.Equal(t, scripts[i], it.Script)
+		require.Equal(t, int64(i+1)*1e8, it.Info.Amount)
+	}
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	_, err = bc.bindingStateAt(common.Hash{0x01})
+	require.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/groupcache/lru"
@@ -26,6 +27,10 @@ const (
 	sigCacheMaxSize       = 50000
 	hashCacheMaxSize      = sigCacheMaxSize
 	blockErrCacheSize     = 500
+
+	// MinPruneDepth is the minimum number of recent blocks that a pruned
+	// node keeps on disk, which covers nodes kept in memory by BlockTree.
+	MinPruneDepth = minMemoryNodes
 )
 
 type chainInfo struct {
@@ -43,20 +48,44 @@ type processBlockResponse struct {
 type processBlockMsg struct {
 	block *massutil.Block
 	flags BehaviorFlags
+	fn    func() error // run instead of processing block if not nil
 	reply chan processBlockResponse
 }
 
-type Listener interface {
-	OnBlockConnected(*wire.MsgBlock) error
-	OnTransactionReceived(tx *wire.MsgTx) error
-}
-
 type Config struct {
 	DB             database.Db
 	StateBindingDb state.Database
 	ChainParams    *chaincfg.Params
 	Checkpoints    []chaincfg.Checkpoint
 	CachePath      string
+	// PruneDepth enables pruning of block files lower than (best - PruneDepth)
+	// if non-zero, it must be no less than MinPruneDepth and greater than a
+	// non-zero MaxReorgDepth, so that blocks which may be detached are kept.
+	PruneDepth uint64
+	// UtxoIndex enables the index of unspent outputs by script hash.
+	UtxoIndex bool
+	// MaxReorgDepth is the max number of blocks that can be detached from
+	// the best chain by a reorganization, 0 means no limit.
+	MaxReorgDepth uint64
+	// BindingPruneDepth enables pruning of binding states lower than
+	// (best - BindingPruneDepth) if non-zero, it must be no less than
+	// MinPruneDepth.  StateBindingDb must be created by
+	// state.NewDatabaseWithConfig with dirty nodes tracked.  Only binding
+	// states kept in memory are pruned, those flushed to disk are kept.
+	BindingPruneDepth uint64
+	// BindingCacheSize is the memory budget in bytes for dirty binding
+	// state nodes when pruning, DefaultBindingCacheSize is used if zero.
+	BindingCacheSize uint64
+	// AssumeValid is the block whose ancestors skip script validation once
+	// they are known from a header chain added by AddHeaderChain, nil
+	// disables it.
+	AssumeValid *chaincfg.Checkpoint
+	// MempoolPath is the file the transaction pool is loaded from by
+	// NewBlockchain and saved to by Stop, empty disables it.
+	MempoolPath string
+	// FeeEstimatesPath is the file the fee estimator is loaded from by
+	// NewBlockchain and saved to by Stop, empty disables it.
+	FeeEstimatesPath string
 }
 
 type Blockchain struct {
@@ -69,6 +98,13 @@ type Blockchain struct {
 	db                  database.Db
 	stateBindingDb      state.Database
 	info                *chainInfo
+	pruneDepth          uint64
+	maxReorgDepth       uint64               // accessed atomically
+	bindingPruner       *bindingPruner       // nil if binding state pruning is disabled
+	assumeValid         *chaincfg.Checkpoint // nil if assume-valid is disabled
+	scriptStats         ScriptCheckStats     // accessed atomically
+	mempoolPath         string
+	feeEstimatesPath    string
 
 	l              sync.RWMutex
 	cond           sync.Cond
@@ -79,12 +115,29 @@ type Blockchain struct {
 	addrIndexer    *AddrIndexer          // address indexer
 	dmd            *DoubleMiningDetector // double mining detector
 	processBlockCh chan *processBlockMsg
-	listeners      map[Listener]struct{}
+	notifier       *notifier
+	shutdown       int32
+	invalidBlocks  map[wire.Hash]struct{} // blocks invalidated manually
 
 	errCache  *lru.Cache
 	sigCache  *txscript.SigCache
 	hashCache *txscript.HashCache
 
+	bindingStatesLock sync.Mutex
+	bindingStates     *lru.Cache // binding states opened by BindingStateAt
+
+	// deploymentStates caches the threshold states of signalled deployments
+	// for the period after a block, by the hash of the last block of each
+	// period.
+	deploymentStatesLock sync.Mutex
+	deploymentStates     map[wire.Hash]map[string]ThresholdState
+
+	// assumeValidHeaders are the hashes of the ancestors of the assume-valid
+	// block by height, starting from assumeValidBase.
+	assumeValidLock    sync.Mutex
+	assumeValidBase    uint64
+	assumeValidHeaders []wire.Hash
+
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
 	nextCheckpoint *config.Checkpoint
@@ -92,6 +145,15 @@ type Blockchain struct {
 }
 
 func NewBlockchain(config *Config) (*Blockchain, error) {
+	if config.PruneDepth != 0 && config.PruneDepth < MinPruneDepth {
+		return nil, errPruneDepthTooSmall
+	}
+	if config.PruneDepth != 0 && (config.MaxReorgDepth == 0 || config.PruneDepth <= config.MaxReorgDepth) {
+		return nil, errPruneDepthReorg
+	}
+	if config.BindingPruneDepth != 0 && config.BindingPruneDepth < MinPruneDepth {
+		return nil, errPruneDepthTooSmall
+	}
 
 	// Generate a checkpoint by height map from the provided checkpoints
 	// and assert the provided checkpoints are sorted by height as required.
@@ -116,15 +178,28 @@ func NewBlockchain(config *Config) (*Blockchain, error) {
 		db:                  config.DB,
 		chainParams:         config.ChainParams,
 		stateBindingDb:      config.StateBindingDb,
+		pruneDepth:          config.PruneDepth,
+		maxReorgDepth:       config.MaxReorgDepth,
+		assumeValid:         config.AssumeValid,
+		mempoolPath:         config.MempoolPath,
+		feeEstimatesPath:    config.FeeEstimatesPath,
 
 		blockTree:      NewBlockTree(),
 		dmd:            NewDoubleMiningDetector(config.DB),
 		processBlockCh: make(chan *processBlockMsg, maxProcessBlockChSize),
 		errCache:       lru.New(blockErrCacheSize),
+		bindingStates:  lru.New(bindingStateCacheSize),
 		hashCache:      txscript.NewHashCache(hashCacheMaxSize),
-		listeners:      make(map[Listener]struct{}),
+		notifier:       newNotifier(),
+		invalidBlocks:  make(map[wire.Hash]struct{}),
+
+		deploymentStates: make(map[wire.Hash]map[string]ThresholdState),
 	}
 	chain.cond.L = &sync.Mutex{}
+	if config.BindingPruneDepth != 0 {
+		chain.bindingPruner = newBindingPruner(config.StateBindingDb.TrieDB(),
+			config.BindingPruneDepth, config.BindingCacheSize)
+	}
 
 	var err error
 	if chain.blockCache, err = initBlockCache(config.CachePath); err != nil {
@@ -139,10 +214,6 @@ func NewBlockchain(config *Config) (*Blockchain, error) {
 		return nil, err
 	}
 
-	if chain.addrIndexer, err = NewAddrIndexer(chain.db, chain.stateBindingDb); err != nil {
-		return nil, err
-	}
-
 	var genesisBlock *massutil.Block
 	genesisHash, err := chain.db.FetchBlockShaByHeight(0)
 	if err != nil {
@@ -155,7 +226,11 @@ func NewBlockchain(config *Config) (*Blockchain, error) {
 		}
 		genesisHash = genesisBlock.Hash()
 	} else {
-		if genesisBlock, err = chain.db.FetchBlockBySha(genesisHash); err != nil {
+		genesisBlock, err = chain.db.FetchBlockBySha(genesisHash)
+		if err == database.ErrBlockPruned && genesisHash.IsEqual(config.ChainParams.GenesisHash) {
+			genesisBlock, err = massutil.NewBlock(config.ChainParams.GenesisBlock), nil
+		}
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -169,9 +244,28 @@ func NewBlockchain(config *Config) (*Blockchain, error) {
 		chainID:      genesisBlock.MsgBlock().Header.ChainID,
 	}
 
+	if chain.addrIndexer, err = NewAddrIndexer(chain, chain.db, chain.stateBindingDb, config.UtxoIndex); err != nil {
+		return nil, err
+	}
+
 	if err := chain.generateInitialIndex(); err != nil {
 		return nil, err
 	}
+	if err := chain.recoverBindingState(); err != nil {
+		return nil, err
+	}
+
+	// Restore the pool of the last run, corrupted files are ignored.
+	if chain.feeEstimatesPath != "" {
+		if err := chain.txPool.LoadFeeEstimates(chain.feeEstimatesPath); err != nil {
+			logging.CPrint(logging.WARN, "fee estimates ignored", logging.LogFormat{"err": err})
+		}
+	}
+	if chain.mempoolPath != "" {
+		if err := chain.txPool.LoadFromFile(chain.mempoolPath); err != nil {
+			logging.CPrint(logging.WARN, "mempool file ignored", logging.LogFormat{"err": err})
+		}
+	}
 
 	go chain.blockProcessor()
 
@@ -184,6 +278,15 @@ func (chain *Blockchain) generateInitialIndex() error {
 		return errIndexAlreadyInitialized
 	}
 
+	// Load invalidated blocks, so that nodes are marked when loaded.
+	invalidBlocks, err := chain.db.FetchInvalidBlocks()
+	if err != nil {
+		return err
+	}
+	for _, hash := range invalidBlocks {
+		chain.invalidBlocks[*hash] = struct{}{}
+	}
+
 	// Grab the latest block height for the main chain from the database.
 	_, endHeight, err := chain.db.NewestSha()
 	if err != nil {
@@ -232,7 +335,9 @@ func (chain *Blockchain) generateInitialIndex() error {
 		start += uint64(len(hashList))
 	}
 
-	return nil
+	// Blocks might be invalidated without being disconnected from the best
+	// chain if the node was interrupted.
+	return chain.disconnectInvalidBlocks()
 }
 
 func (chain *Blockchain) blockExists(hash *wire.Hash) bool {
@@ -255,35 +360,37 @@ func (chain *Blockchain) loadBlockNode(hash *wire.Hash) (*BlockNode, error) {
 		return nil, err
 	}
 
-	node := NewBlockNode(blockHeader, hash, BFNone)
+	// Signalled deployments are resolved by loading ancestors, so nodes
+	// loaded from the database only follow the deployments by height.  The
+	// deployments they depend on can't be signalled, see config.ParamsFile.
+	node := NewBlockNode(chain.chainParams, blockHeader, hash, BFNone)
 	node.InMainChain = true
 
+	switch root := chain.blockTree.rootBlockNode(); {
 	// deal with leaf node
-	if chain.blockTree.nodeExists(&node.Previous) {
-		if err := chain.blockTree.attachBlockNode(node); err != nil {
-			return nil, err
-		}
-		return node, nil
-	}
+	case chain.blockTree.nodeExists(&node.Previous):
+		err = chain.blockTree.attachBlockNode(node)
 
 	// deal with expand root
-	if root := chain.blockTree.rootBlockNode(); root != nil && node.Hash.IsEqual(&root.Previous) {
-		if err := chain.blockTree.expandRootBlockNode(node); err != nil {
-			return nil, err
-		}
-		return node, nil
-	}
+	case root != nil && node.Hash.IsEqual(&root.Previous):
+		err = chain.blockTree.expandRootBlockNode(node)
 
 	// deal with set root
-	if root := chain.blockTree.rootBlockNode(); root == nil {
-		if err := chain.blockTree.setRootBlockNode(node); err != nil {
-			return nil, err
-		}
-		return node, nil
-	}
+	case root == nil:
+		err = chain.blockTree.setRootBlockNode(node)
 
 	// deal with orphan node
-	return nil, errExpandOrphanRootBlockNode
+	default:
+		err = errExpandOrphanRootBlockNode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := chain.invalidBlocks[*hash]; ok || (node.Parent != nil && node.Parent.Invalid) {
+		chain.blockTree.invalidateBlockNode(node)
+	}
+	return node, nil
 }
 
 func (chain *Blockchain) getPrevNodeFromBlock(block *massutil.Block) (*BlockNode, error) {
@@ -335,11 +442,45 @@ func (chain *Blockchain) getPrevNodeFromNode(node *BlockNode) (*BlockNode, error
 
 func (chain *Blockchain) blockProcessor() {
 	for msg := range chain.processBlockCh {
+		if msg.fn != nil {
+			msg.reply <- processBlockResponse{err: msg.fn()}
+			continue
+		}
 		isOrphan, err := chain.processBlock(msg.block, msg.flags)
 		msg.reply <- processBlockResponse{isOrphan: isOrphan, err: err}
 	}
 }
 
+// Stop waits for the block being processed, flushes the binding state of the
+// best block, saves the transaction pool and fee estimates if their paths are
+// configured, and stops delivering events to listeners once the queued ones
+// are delivered.  The chain must not process blocks or transactions after
+// Stop.
+func (chain *Blockchain) Stop() error {
+	if atomic.AddInt32(&chain.shutdown, 1) != 1 {
+		logging.CPrint(logging.WARN, "Blockchain is already in the process of shutting down")
+		return nil
+	}
+
+	logging.CPrint(logging.INFO, "Blockchain shutting down")
+	err := chain.execProcessFunc(func() error {
+		err := chain.flushBindingState()
+		if chain.mempoolPath != "" {
+			if perr := chain.txPool.SaveToFile(chain.mempoolPath); err == nil {
+				err = perr
+			}
+		}
+		if chain.feeEstimatesPath != "" {
+			if ferr := chain.txPool.SaveFeeEstimates(chain.feeEstimatesPath); err == nil {
+				err = ferr
+			}
+		}
+		return err
+	})
+	chain.notifier.stop()
+	return err
+}
+
 // processBlock is the entry for handle block insert
 func (chain *Blockchain) execProcessBlock(block *massutil.Block, flags BehaviorFlags) (bool, error) {
 	reply := make(chan processBlockResponse, 1)
@@ -348,6 +489,13 @@ func (chain *Blockchain) execProcessBlock(block *massutil.Block, flags BehaviorF
 	return response.isOrphan, response.err
 }
 
+// execProcessFunc runs fn in the same goroutine as processing blocks.
+func (chain *Blockchain) execProcessFunc(fn func() error) error {
+	reply := make(chan processBlockResponse, 1)
+	chain.processBlockCh <- &processBlockMsg{fn: fn, reply: reply}
+	return (<-reply).err
+}
+
 func (chain *Blockchain) BestBlockNode() *BlockNode {
 	return chain.blockTree.bestBlockNode()
 }
@@ -365,7 +513,7 @@ func (chain *Blockchain) BestBlockHash() *wire.Hash {
 }
 
 func (chain *Blockchain) GetBlockByHash(hash *wire.Hash) (*massutil.Block, error) {
-	return chain.db.FetchBlockBySha(hash)
+	return chain.fetchBlockBySha(hash)
 }
 
 func (chain *Blockchain) GetBlockByHeight(height uint64) (*massutil.Block, error) {
@@ -373,7 +521,63 @@ func (chain *Blockchain) GetBlockByHeight(height uint64) (*massutil.Block, error
 	if err != nil {
 		return nil, err
 	}
-	return chain.db.FetchBlockBySha(hash)
+	return chain.fetchBlockBySha(hash)
+}
+
+// fetchBlockBySha returns block from database, genesis block is always
+// available even if it has been pruned.
+func (chain *Blockchain) fetchBlockBySha(hash *wire.Hash) (*massutil.Block, error) {
+	block, err := chain.db.FetchBlockBySha(hash)
+	if err == database.ErrBlockPruned && hash.IsEqual(&chain.info.genesisHash) {
+		return chain.info.genesisBlock, nil
+	}
+	return block, err
+}
+
+// IsPruned returns whether pruning is enabled or any block has been pruned.
+func (chain *Blockchain) IsPruned() bool {
+	return chain.pruneDepth > 0 || chain.db.FetchPrunedHeight() > 0
+}
+
+// PrunedHeight returns the height below which raw blocks may have been pruned.
+func (chain *Blockchain) PrunedHeight() uint64 {
+	return chain.db.FetchPrunedHeight()
+}
+
+// MaxReorgDepth returns the max number of blocks that can be detached from
+// the best chain by a reorganization, 0 means no limit.
+func (chain *Blockchain) MaxReorgDepth() uint64 {
+	return atomic.LoadUint64(&chain.maxReorgDepth)
+}
+
+// SetMaxReorgDepth overrides the max reorg depth at runtime, 0 means no
+// limit. The chain is reorganized to the best valid tip if it was rejected by
+// the previous limit, ErrReorgTooDeep is returned if it is still rejected.
+// The depth must be non-zero and less than the prune depth if pruning is
+// enabled.
+func (chain *Blockchain) SetMaxReorgDepth(depth uint64) error {
+	if chain.pruneDepth != 0 && (depth == 0 || chain.pruneDepth <= depth) {
+		return errPruneDepthReorg
+	}
+	return chain.execProcessFunc(func() error {
+		atomic.StoreUint64(&chain.maxReorgDepth, depth)
+		logging.CPrint(logging.INFO, "max reorg depth changed", logging.LogFormat{"depth": depth})
+		return chain.activateBestValidChain()
+	})
+}
+
+// pruneBlockFiles removes old block files when pruning is enabled, failure
+// is only logged since it does not affect the chain state.
+func (chain *Blockchain) pruneBlockFiles() {
+	if chain.pruneDepth == 0 {
+		return
+	}
+	if _, err := chain.db.PruneBlockFiles(chain.pruneDepth); err != nil {
+		logging.CPrint(logging.ERROR, "failed to prune block files", logging.LogFormat{
+			"depth": chain.pruneDepth,
+			"err":   err,
+		})
+	}
 }
 
 func (chain *Blockchain) GetHeaderByHash(hash *wire.Hash) (*wire.BlockHeader, error) {
@@ -438,6 +642,11 @@ func (chain *Blockchain) ProcessTx(tx *massutil.Tx) (bool, error) {
 	return chain.txPool.ProcessTransaction(tx, true, false)
 }
 
+// ProcessPeerTx processes the transaction received from the peer of peerID.
+func (chain *Blockchain) ProcessPeerTx(tx *massutil.Tx, peerID string) (bool, error) {
+	return chain.txPool.ProcessPeerTransaction(tx, true, false, peerID)
+}
+
 func (chain *Blockchain) ChainID() *wire.Hash {
 	return wire.NewHashFromHash(chain.info.chainID)
 }
@@ -473,46 +682,6 @@ func (chain *Blockchain) BlockWaiter(height uint64) (<-chan *BlockNode, error) {
 	return ch, nil
 }
 
-func (chain *Blockchain) RegisterListener(listener Listener) {
-	chain.l.Lock()
-	defer chain.l.Unlock()
-
-	chain.listeners[listener] = struct{}{}
-}
-
-func (chain *Blockchain) UnregisterListener(listener Listener) {
-	chain.l.Lock()
-	defer chain.l.Unlock()
-
-	delete(chain.listeners, listener)
-}
-
-func (chain *Blockchain) notifyBlockConnected(block *massutil.Block) error {
-	if block == nil {
-		return errNilArgument
-	}
-	for listener := range chain.listeners {
-		err := listener.OnBlockConnected(block.MsgBlock())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (chain *Blockchain) notifyTransactionReceived(tx *massutil.Tx) error {
-	if tx == nil {
-		return errNilArgument
-	}
-	for listener := range chain.listeners {
-		err := listener.OnTransactionReceived(tx.MsgTx())
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (chain *Blockchain) CurrentIndexHeight() uint64 {
 	return chain.blockTree.bestBlockNode().Height
 }
@@ -520,14 +689,14 @@ func (chain *Blockchain) CurrentIndexHeight() uint64 {
 // GetBlockStakingRewardRankOnList returns staking reward list at any height.
 func (chain *Blockchain) GetBlockStakingRewardRankOnList(height uint64) ([]database.Rank, error) {
 	if height == chain.BestBlockHeight() {
-		return chain.db.FetchUnexpiredStakingRank(height, true)
+		return chain.db.FetchUnexpiredStakingRank(chain, height, true)
 	}
-	return chain.db.FetchStakingRank(height, true)
+	return chain.db.FetchStakingRank(chain, height, true)
 }
 
 // GetUnexpiredStakingRank returns all the unexpired staking rank.
 func (chain *Blockchain) GetUnexpiredStakingRank(height uint64) ([]database.Rank, error) {
-	return chain.db.FetchUnexpiredStakingRank(height, false)
+	return chain.db.FetchUnexpiredStakingRank(chain, height, false)
 }
 
 func (chain *Blockchain) FetchOldBinding(scriptHash []byte) ([]*database.BindingTxReply, error) {
@@ -585,7 +754,7 @@ func (chain *Blockchain) GetNetworkBinding(height uint64) (massutil.Amount, erro
 	}
 
 	var trie state.Trie
-	if !forks.EnforceMASSIP0002WarmUp(block.Height()) {
+	if !forks.EnforceMASSIP0002WarmUp(chain, block.Height()) {
 		trie, err = chain.stateBindingDb.OpenBindingTrie(common.Hash{})
 	} else {
 		trie, err = chain.stateBindingDb.OpenBindingTrie(block.MsgBlock().Header.BindingRoot)
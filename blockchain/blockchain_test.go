@@ -115,3 +115,16 @@ func TestBlockchain_ProcessBlock2(t *testing.T) {
 	// block 7 already arrived
 	assert.Equal(t, uint64(7), bc.BestBlockHeight())
 }
+
+func TestNewBlockchainPruneDepth(t *testing.T) {
+	_, err := NewBlockchain(&Config{PruneDepth: MinPruneDepth - 1, MaxReorgDepth: 1})
+	assert.Equal(t, errPruneDepthTooSmall, err)
+	_, err = NewBlockchain(&Config{PruneDepth: MinPruneDepth})
+	assert.Equal(t, errPruneDepthReorg, err, "unlimited reorg depth")
+	_, err = NewBlockchain(&Config{PruneDepth: MinPruneDepth, MaxReorgDepth: MinPruneDepth})
+	assert.Equal(t, errPruneDepthReorg, err)
+
+	chain := &Blockchain{pruneDepth: MinPruneDepth}
+	assert.Equal(t, errPruneDepthReorg, chain.SetMaxReorgDepth(0))
+	assert.Equal(t, errPruneDepthReorg, chain.SetMaxReorgDepth(MinPruneDepth))
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/interfaces"
 	"github.com/massnetorg/mass-core/trie/common"
@@ -23,6 +24,7 @@ const (
 
 type BlockNode struct {
 	InMainChain     bool
+	Invalid         bool // block or its ancestor has been invalidated
 	Parent          *BlockNode
 	Hash            *wire.Hash
 	CapSum          *big.Int
@@ -40,9 +42,14 @@ type BlockNode struct {
 	blockHeader     *wire.BlockHeader
 
 	bindingState state.Trie
+	// enforceBinding is whether the block commits to a binding state, which
+	// is the case since the warm-up of MASSIP0002.
+	enforceBinding bool
 }
 
-func NewBlockNode(header *wire.BlockHeader, blockHash *wire.Hash, flags BehaviorFlags) *BlockNode {
+// NewBlockNode returns a node of header, the consensus rules of the node follow
+// the deployments of params.
+func NewBlockNode(params consensus.DeploymentChecker, header *wire.BlockHeader, blockHash *wire.Hash, flags BehaviorFlags) *BlockNode {
 	if flags.isFlagSet(BFNoPoCCheck) {
 		return &BlockNode{
 			ChainID:         header.ChainID,
@@ -54,6 +61,7 @@ func NewBlockNode(header *wire.BlockHeader, blockHash *wire.Hash, flags Behavior
 			WitnessRoot:     header.WitnessRoot,
 			ProposalRoot:    header.ProposalRoot,
 			blockHeader:     header,
+			enforceBinding:  forks.EnforceMASSIP0002WarmUp(params, header.Height),
 		}
 	}
 	return &BlockNode{
@@ -69,8 +77,9 @@ func NewBlockNode(header *wire.BlockHeader, blockHash *wire.Hash, flags Behavior
 		ProposalRoot:    header.ProposalRoot,
 		Target:          header.Target,
 		Challenge:       header.Challenge,
-		Quality:         header.Quality(),
+		Quality:         header.QualityAt(forks.EnforceMASSIP0002(params, header.Height)),
 		blockHeader:     header,
+		enforceBinding:  forks.EnforceMASSIP0002WarmUp(params, header.Height),
 	}
 }
 
@@ -125,7 +134,7 @@ func (node *BlockNode) BitLength() int {
 
 // Set nil to clear state
 func (node *BlockNode) SetBindingState(state state.Trie) error {
-	if !forks.EnforceMASSIP0002WarmUp(node.Height) {
+	if !node.enforceBinding {
 		return nil
 	}
 	if state != nil && state.Hash() != node.blockHeader.BindingRoot {
@@ -138,7 +147,7 @@ func (node *BlockNode) SetBindingState(state state.Trie) error {
 func (node *BlockNode) BindingState(stateDb state.Database) (state.Trie, error) {
 	var err error
 	if node.bindingState == nil {
-		if !forks.EnforceMASSIP0002WarmUp(node.Height) {
+		if !node.enforceBinding {
 			node.bindingState, err = stateDb.OpenBindingTrie(common.Hash{})
 		} else {
 			if (node.blockHeader.BindingRoot == common.Hash{}) {
@@ -163,7 +172,7 @@ func (node *BlockNode) ParentBindingState(stateDb state.Database) (state.Trie, e
 	}
 	var err error
 	if node.Parent.bindingState == nil {
-		if !forks.EnforceMASSIP0002WarmUp(node.Parent.Height) {
+		if !node.Parent.enforceBinding {
 			node.Parent.bindingState, err = stateDb.OpenBindingTrie(common.Hash{})
 		} else {
 			if (node.Parent.blockHeader.BindingRoot == common.Hash{}) {
@@ -231,6 +240,17 @@ func (tree *BlockTree) getBlockNode(hash *wire.Hash) (*BlockNode, bool) {
 	return node, exists
 }
 
+// parentBlockNode returns the parent of node in the tree, if it exists.
+func (tree *BlockTree) parentBlockNode(node *BlockNode) (*BlockNode, bool) {
+	tree.RLock()
+	defer tree.RUnlock()
+	if node.Parent != nil {
+		return node.Parent, true
+	}
+	parent, exists := tree.index[node.Previous]
+	return parent, exists
+}
+
 func (tree *BlockTree) blockNode(hash *wire.Hash) *BlockNode {
 	tree.RLock()
 	defer tree.RUnlock()
@@ -294,6 +314,66 @@ func (tree *BlockTree) detachBlockNode(node *BlockNode) error {
 	return nil
 }
 
+// markSubtreeInvalid marks node and all its descendants as invalid.
+func markSubtreeInvalid(tree *BlockTree, node *BlockNode) {
+	node.Invalid = true
+	for _, childNode := range tree.children[*node.Hash] {
+		markSubtreeInvalid(tree, childNode)
+	}
+}
+
+// invalidateBlockNode marks node and all its descendants as invalid.
+func (tree *BlockTree) invalidateBlockNode(node *BlockNode) {
+	tree.Lock()
+	defer tree.Unlock()
+	markSubtreeInvalid(tree, node)
+}
+
+// resetInvalidBlockNodes marks nodes invalidated or descending from any
+// invalidated one as invalid, and the others as valid.
+func (tree *BlockTree) resetInvalidBlockNodes(invalidated map[wire.Hash]struct{}) {
+	tree.Lock()
+	defer tree.Unlock()
+	for _, node := range tree.index {
+		node.Invalid = false
+	}
+	for hash := range invalidated {
+		if node, exists := tree.index[hash]; exists {
+			markSubtreeInvalid(tree, node)
+		}
+	}
+}
+
+// bestValidBlockNode returns the best node which is not invalid, it returns
+// nil if there is no valid node.
+func (tree *BlockTree) bestValidBlockNode() *BlockNode {
+	tree.RLock()
+	defer tree.RUnlock()
+	var best *BlockNode
+	for _, node := range tree.index {
+		if node.Invalid {
+			continue
+		}
+		if best == nil || isBetterChain(node, best) {
+			best = node
+		}
+	}
+	return best
+}
+
+// leafBlockNodes returns nodes that have no children.
+func (tree *BlockTree) leafBlockNodes() []*BlockNode {
+	tree.RLock()
+	defer tree.RUnlock()
+	leaves := make([]*BlockNode, 0)
+	for hash, node := range tree.index {
+		if len(tree.children[hash]) == 0 {
+			leaves = append(leaves, node)
+		}
+	}
+	return leaves
+}
+
 // recursiveAddChildrenCapSum recursively add certain cap number to children
 func recursiveAddChildrenCapSum(tree *BlockTree, hash *wire.Hash, cap *big.Int) {
 	for _, childNode := range tree.children[*hash] {
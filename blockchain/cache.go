@@ -82,3 +82,10 @@ func (cache *blockCache) getBlock(hash *wire.Hash) (*massutil.Block, error) {
 
 	return massutil.NewBlockFromBytes(bs, wire.Packet)
 }
+
+func (cache *blockCache) hasBlock(hash *wire.Hash) bool {
+	cache.RLock()
+	defer cache.RUnlock()
+	_, exists := cache.index[*hash]
+	return exists
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
-	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/wire"
@@ -247,9 +246,9 @@ func (chain *Blockchain) getReorganizeNodes(node *BlockNode) (*list.List, *list.
 	return detachNodes, attachNodes
 }
 
-func (chain *Blockchain) connectState(parentBindingState state.Trie, block *massutil.Block) (err error) {
+func (chain *Blockchain) connectState(node *BlockNode, parentBindingState state.Trie, block *massutil.Block) (err error) {
 
-	if !forks.EnforceMASSIP0002WarmUp(block.Height()) {
+	if !node.enforceBinding {
 		// fast return
 		return nil
 	}
@@ -344,7 +343,7 @@ func (chain *Blockchain) connectBlock(node *BlockNode, block *massutil.Block) (e
 	if err = chain.addrIndexer.SyncAttachBlock(bindingState, block, txInputStore); err != nil {
 		return err
 	}
-	if forks.EnforceMASSIP0002WarmUp(node.Height) {
+	if node.enforceBinding {
 		root := bindingState.Hash()
 		if root != block.MsgBlock().Header.BindingRoot {
 			logging.CPrint(logging.ERROR, "wrong binding state root", logging.LogFormat{
@@ -410,9 +409,18 @@ func (chain *Blockchain) connectBlock(node *BlockNode, block *massutil.Block) (e
 		}
 	}
 
+	// Notify before attaching block to other modules, so that listeners
+	// see the block before mempool evictions it causes.
+	if !block.IsImport() {
+		chain.notifyBlockConnected(block)
+	}
+
 	// wait for other modules to attach block
 	chain.attachBlock(block)
 
+	chain.pruneBlockFiles()
+	chain.pruneBindingState(node)
+
 	return nil
 }
 
@@ -449,6 +457,8 @@ func (chain *Blockchain) disconnectBlock(node *BlockNode, block *massutil.Block)
 	// This node's Parent is now the end of the best chain.
 	chain.blockTree.setBestBlockNode(node.Parent)
 
+	chain.notifyBlockDisconnected(block)
+
 	// detach block from other modules
 	chain.detachBlock(block)
 
@@ -510,13 +520,17 @@ func (chain *Blockchain) reorganizeChain(detachNodes, attachNodes *list.List, fl
 		if err := chain.checkConnectBlock(n, block, flags, parentBindingState); err != nil {
 			return err
 		}
-		if err = chain.connectState(parentBindingState, block); err != nil {
+		if err = chain.connectState(n, parentBindingState, block); err != nil {
 			return fmt.Errorf("failed to connect state: %v", err)
 		}
 	}
 
 	chain.l.Lock()
 	defer chain.l.Unlock()
+	info := &ReorgInfo{
+		Detached: make([]wire.Hash, 0, detachNodes.Len()),
+		Attached: make([]wire.Hash, 0, attachNodes.Len()),
+	}
 	// Disconnect blocks from the main chain.
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*BlockNode)
@@ -528,6 +542,7 @@ func (chain *Blockchain) reorganizeChain(detachNodes, attachNodes *list.List, fl
 		if err != nil {
 			return err
 		}
+		info.Detached = append(info.Detached, *n.Hash)
 	}
 
 	// Connect the new best chain blocks.
@@ -537,6 +552,7 @@ func (chain *Blockchain) reorganizeChain(detachNodes, attachNodes *list.List, fl
 		if err := chain.connectBlock(n, block); err != nil {
 			return err
 		}
+		info.Attached = append(info.Attached, *n.Hash)
 		// Do not delete, there's no need for this
 		// chain.blockCache.delete(n.Hash)
 	}
@@ -553,8 +569,12 @@ func (chain *Blockchain) reorganizeChain(detachNodes, attachNodes *list.List, fl
 		return err
 	}
 
-	// Log the old and new best chain heads.
-	firstDetachNode := detachNodes.Front().Value.(*BlockNode)
+	// Log the old and new best chain heads, there is nothing detached when
+	// the new best chain extends the old one.
+	firstDetachNode := forkNode
+	if detachNodes.Len() > 0 {
+		firstDetachNode = detachNodes.Front().Value.(*BlockNode)
+	}
 	lastAttachNode := attachNodes.Back().Value.(*BlockNode)
 	logging.CPrint(logging.INFO, "REORGANIZE: Chain forks", logging.LogFormat{
 		"fork_hash":       forkNode.Hash,
@@ -565,6 +585,13 @@ func (chain *Blockchain) reorganizeChain(detachNodes, attachNodes *list.List, fl
 		"new_best_height": lastAttachNode.Height,
 	})
 
+	// Extending the best chain is not a reorganization.
+	if len(info.Detached) > 0 {
+		info.ForkHash = *forkNode.Hash
+		info.ForkHeight = forkNode.Height
+		chain.notifyReorganize(info)
+	}
+
 	return nil
 }
 
@@ -596,11 +623,6 @@ func (chain *Blockchain) connectBestChain(node *BlockNode, block *massutil.Block
 		if !block.IsImport() {
 			// Broadcast new block on best chain
 			chain.cond.Broadcast()
-
-			err = chain.notifyBlockConnected(block)
-			if err != nil {
-				return err
-			}
 		}
 
 		return nil
@@ -618,7 +640,11 @@ func (chain *Blockchain) connectBestChain(node *BlockNode, block *massutil.Block
 
 	// We're extending (or creating) a side chain, but
 	// this new side chain is not enough to make it the new chain.
-	if ok, _ := chain.isPotentialNewBestChain(node); !ok {
+	ok, err := chain.isPotentialNewBestChain(node)
+	if err == ErrReorgTooDeep {
+		return err
+	}
+	if !ok {
 		// Find the fork point.
 		fork := node
 		for ; fork.Parent != nil; fork = fork.Parent {
@@ -682,7 +708,7 @@ func (chain *Blockchain) connectBestChain(node *BlockNode, block *massutil.Block
 	logging.CPrint(logging.INFO, "reorganize: block is causing a reorganize.", logging.LogFormat{
 		"block": node.Hash,
 	})
-	err := chain.reorganizeChain(detachNodes, attachNodes, flags)
+	err = chain.reorganizeChain(detachNodes, attachNodes, flags)
 	if err != nil {
 		return err
 	}
@@ -690,18 +716,15 @@ func (chain *Blockchain) connectBestChain(node *BlockNode, block *massutil.Block
 	if !block.IsImport() {
 		// Broadcast new block on best chain
 		chain.cond.Broadcast()
-
-		err = chain.notifyBlockConnected(block)
-		if err != nil {
-			return err
-		}
 	}
 
 	return nil
 }
 
 // isPotentialNewBestChain returns whether or not the side chain can be a new
-// best chain. The Boolean is valid only when error is nil.
+// best chain. The Boolean is valid only when error is nil. It returns
+// ErrReorgTooDeep if the side chain is better but reorganizing to it would
+// detach more blocks than max reorg depth.
 func (chain *Blockchain) isPotentialNewBestChain(sideChain *BlockNode) (bool, error) {
 	// Create a copy of bestChain pointer
 	bestChain := chain.blockTree.bestBlockNode()
@@ -709,32 +732,67 @@ func (chain *Blockchain) isPotentialNewBestChain(sideChain *BlockNode) (bool, er
 	if sideChain == nil || bestChain == nil {
 		return false, fmt.Errorf("figure potential best chain: Cannot decide invalid chain")
 	}
+	if !isBetterChain(sideChain, bestChain) {
+		return false, nil
+	}
+	if err := chain.checkReorgDepth(sideChain); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkReorgDepth returns ErrReorgTooDeep if reorganizing to the side chain
+// ends at node would detach more blocks than max reorg depth.
+func (chain *Blockchain) checkReorgDepth(node *BlockNode) error {
+	maxDepth := chain.MaxReorgDepth()
+	if maxDepth == 0 {
+		return nil
+	}
+	fork := node
+	for fork.Parent != nil && !fork.InMainChain {
+		fork = fork.Parent
+	}
+	best := chain.blockTree.bestBlockNode()
+	if depth := best.Height - fork.Height; depth > maxDepth {
+		logging.CPrint(logging.WARN, "reorganization is too deep", logging.LogFormat{
+			"depth":     depth,
+			"max_depth": maxDepth,
+			"new_best":  node.Hash,
+		})
+		return ErrReorgTooDeep
+	}
+	return nil
+}
+
+// isBetterChain returns whether or not the chain ends at node is better than
+// the one ends at than.
+func isBetterChain(node, than *BlockNode) bool {
 	// Step 1: Check CapSum, the larger the better
-	if sideChain.CapSum.Cmp(bestChain.CapSum) != 0 {
-		if sideChain.CapSum.Cmp(bestChain.CapSum) < 0 {
-			return false, nil
+	if node.CapSum.Cmp(than.CapSum) != 0 {
+		if node.CapSum.Cmp(than.CapSum) < 0 {
+			return false
 		}
-		return true, nil
+		return true
 	}
 	// Step 2: Check timestamp, the earlier the better
-	if sideChain.Timestamp.Unix() != bestChain.Timestamp.Unix() {
-		if sideChain.Timestamp.Unix() > bestChain.Timestamp.Unix() {
-			return false, nil
+	if node.Timestamp.Unix() != than.Timestamp.Unix() {
+		if node.Timestamp.Unix() > than.Timestamp.Unix() {
+			return false
 		}
-		return true, nil
+		return true
 	}
 	// Step 3: Check quality, choose the better one.
-	if sideChain.Quality.Cmp(bestChain.Quality) != 0 {
-		if sideChain.Quality.Cmp(bestChain.Quality) > 0 {
-			return true, nil
+	if node.Quality.Cmp(than.Quality) != 0 {
+		if node.Quality.Cmp(than.Quality) > 0 {
+			return true
 		}
-		return false, nil
+		return false
 	}
 	// Step 4: Tie Break, choose small block hash.
-	if new(big.Int).SetBytes(sideChain.Hash.Bytes()).Cmp(new(big.Int).SetBytes(bestChain.Hash.Bytes())) < 0 {
-		return true, nil
+	if new(big.Int).SetBytes(node.Hash.Bytes()).Cmp(new(big.Int).SetBytes(than.Hash.Bytes())) < 0 {
+		return true
 	}
-	return false, nil
+	return false
 }
 
 // RetrievePunishment retrieves faultPks from database, sending them to memPool.
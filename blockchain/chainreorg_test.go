@@ -583,3 +583,49 @@ func SumBlkFileSize(t *testing.T, blks ...*massutil.Block) (sum uint64) {
 	}
 	return sum
 }
+
+func TestMaxReorgDepth(t *testing.T) {
+	// height: 0(main)... -> 30(main) -> 31(main) -> 31(fork) -> 32(fork) -> 33(fork) -> 32(main) -> 33(main) -> ...49(main)
+	// i:      0      ...    30          31          32          33          34          35          36          ...52
+	blks := loadBlks("./data/beforestaking.dat")
+	assert.Equal(t, 53, len(blks))
+
+	copy(config.ChainParams.GenesisHash[:], blks[0].Hash()[:])
+	copy(config.ChainParams.GenesisBlock.Header.Challenge[:], blks[0].MsgBlock().Header.Challenge[:])
+	copy(config.ChainParams.GenesisBlock.Header.ChainID[:], blks[0].MsgBlock().Header.ChainID[:])
+	config.ChainParams.GenesisBlock.Header.Timestamp = blks[0].MsgBlock().Header.Timestamp
+	config.ChainParams.GenesisBlock.Header.Target = blks[0].MsgBlock().Header.Target
+
+	bc, closeFunc := newReorgTestChain(blks[0], "maxreorgdepth")
+	defer closeFunc()
+
+	for i := 1; i < 36; i++ {
+		if i >= 32 && i <= 34 {
+			continue
+		}
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, blks[35].Hash(), bc.BestBlockHash())
+
+	// the fork requires detaching 2 blocks
+	assert.Nil(t, bc.SetMaxReorgDepth(1))
+	assert.Equal(t, uint64(1), bc.MaxReorgDepth())
+	for i := 32; i < 34; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+	_, err := bc.processBlock(blks[34], BFNone)
+	assert.Equal(t, ErrReorgTooDeep, err)
+	assert.Equal(t, blks[35].Hash(), bc.BestBlockHash())
+
+	// rejected blocks are not cached as invalid
+	_, ok := bc.errCache.Get(blks[34].Hash().String())
+	assert.False(t, ok)
+	assert.Equal(t, ErrReorgTooDeep, bc.ReconsiderBlock(blks[34].Hash()))
+	assert.Equal(t, blks[35].Hash(), bc.BestBlockHash())
+
+	// raising the limit reorganizes to the better chain
+	assert.Nil(t, bc.SetMaxReorgDepth(2))
+	assert.Equal(t, blks[34].Hash(), bc.BestBlockHash())
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// ChainTipStatus describes the status of a chain tip.
+type ChainTipStatus string
+
+const (
+	// ChainTipActive is the tip of the best chain.
+	ChainTipActive ChainTipStatus = "active"
+
+	// ChainTipValidFork is the tip of a side chain whose blocks are all
+	// available and not invalidated.
+	ChainTipValidFork ChainTipStatus = "valid-fork"
+
+	// ChainTipHeadersOnly is the tip of a side chain which has blocks not
+	// available, so it can't become the best chain for now.
+	ChainTipHeadersOnly ChainTipStatus = "headers-only"
+
+	// ChainTipInvalid is the tip of a chain containing invalidated blocks.
+	ChainTipInvalid ChainTipStatus = "invalid"
+)
+
+// ChainTip describes a leaf in the block tree.
+type ChainTip struct {
+	Hash   wire.Hash
+	Height uint64
+	// BranchLen is the number of blocks from the fork point on the best
+	// chain to the tip, it is 0 for the active tip.
+	BranchLen uint64
+	// CapSum is the cumulative capacity of the chain ending at the tip.
+	CapSum *big.Int
+	Status ChainTipStatus
+}
+
+// ChainTips returns all leaves of the block tree, as well as the tip of the
+// best chain, sorted by height in descending order.
+func (chain *Blockchain) ChainTips() []*ChainTip {
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+
+	best := chain.blockTree.bestBlockNode()
+	nodes := chain.blockTree.leafBlockNodes()
+	if !containsBlockNode(nodes, best) {
+		nodes = append(nodes, best)
+	}
+
+	tips := make([]*ChainTip, 0, len(nodes))
+	for _, node := range nodes {
+		tip := &ChainTip{
+			Hash:   *node.Hash,
+			Height: node.Height,
+			CapSum: new(big.Int).Set(node.CapSum),
+			Status: ChainTipActive,
+		}
+		if node != best {
+			tip.Status = ChainTipValidFork
+			// the root node is always on the best chain
+			for n := node; !n.InMainChain && n.Parent != nil; n = n.Parent {
+				tip.BranchLen++
+				if !chain.blockCache.hasBlock(n.Hash) {
+					tip.Status = ChainTipHeadersOnly
+				}
+			}
+			if node.Invalid {
+				tip.Status = ChainTipInvalid
+			}
+		}
+		tips = append(tips, tip)
+	}
+
+	sort.SliceStable(tips, func(i, j int) bool {
+		return tips[i].Height > tips[j].Height
+	})
+	return tips
+}
+
+func containsBlockNode(nodes []*BlockNode, node *BlockNode) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
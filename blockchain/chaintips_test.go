@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainTips(t *testing.T) {
+	// height: 0(main)... -> 30(main) -> 31(main) -> 31(fork) -> 32(fork) -> 33(fork) -> 32(main) -> 33(main) -> ...49(main)
+	// i:      0      ...    30          31          32          33          34          35          36          ...52
+	blks := loadBlks("./data/beforestaking.dat")
+	assert.Equal(t, 53, len(blks))
+
+	copy(config.ChainParams.GenesisHash[:], blks[0].Hash()[:])
+	copy(config.ChainParams.GenesisBlock.Header.Challenge[:], blks[0].MsgBlock().Header.Challenge[:])
+	copy(config.ChainParams.GenesisBlock.Header.ChainID[:], blks[0].MsgBlock().Header.ChainID[:])
+	config.ChainParams.GenesisBlock.Header.Timestamp = blks[0].MsgBlock().Header.Timestamp
+	config.ChainParams.GenesisBlock.Header.Target = blks[0].MsgBlock().Header.Target
+
+	bc, closeFunc := newReorgTestChain(blks[0], "chaintips")
+	defer closeFunc()
+
+	tips := bc.ChainTips()
+	assert.Equal(t, 1, len(tips))
+	assert.Equal(t, ChainTipActive, tips[0].Status)
+
+	for i := 1; i < 42; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+
+	tips = bc.ChainTips()
+	assert.Equal(t, 2, len(tips))
+	assert.Equal(t, *blks[41].Hash(), tips[0].Hash)
+	assert.Equal(t, uint64(38), tips[0].Height)
+	assert.Equal(t, uint64(0), tips[0].BranchLen)
+	assert.Equal(t, ChainTipActive, tips[0].Status)
+	assert.Equal(t, bc.BestBlockNode().CapSum, tips[0].CapSum)
+	assert.Equal(t, *blks[34].Hash(), tips[1].Hash)
+	assert.Equal(t, uint64(33), tips[1].Height)
+	assert.Equal(t, uint64(3), tips[1].BranchLen)
+	assert.Equal(t, ChainTipValidFork, tips[1].Status)
+
+	// the active tip is listed even if it has invalid children
+	assert.Nil(t, bc.InvalidateBlock(blks[41].Hash()))
+	assert.Nil(t, bc.InvalidateBlock(blks[33].Hash()))
+	tips = bc.ChainTips()
+	assert.Equal(t, 3, len(tips))
+	assert.Equal(t, *blks[41].Hash(), tips[0].Hash)
+	assert.Equal(t, uint64(1), tips[0].BranchLen)
+	assert.Equal(t, ChainTipInvalid, tips[0].Status)
+	assert.Equal(t, *blks[40].Hash(), tips[1].Hash)
+	assert.Equal(t, ChainTipActive, tips[1].Status)
+	assert.Equal(t, ChainTipInvalid, tips[2].Status)
+}
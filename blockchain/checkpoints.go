@@ -177,7 +177,7 @@ func lookupBestChainNode(b *Blockchain, hash *wire.Hash) (*BlockNode, error) {
 				return nil, err
 			}
 		} else {
-			node = NewBlockNode(blockHeader, hash, BFNone)
+			node = NewBlockNode(b.chainParams, blockHeader, hash, BFNone)
 		}
 	}
 	return node, nil
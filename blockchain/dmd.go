@@ -175,7 +175,7 @@ func (chain *Blockchain) submitFaultPubKeyFromHash(hash0, hash1 *wire.Hash) erro
 		return errFaultPubKeyGetBlockHeader
 	}
 
-	if err := checkFaultPkSanity(fpk, chain.info.chainID); err != nil {
+	if err := checkFaultPkSanity(chain, fpk, chain.info.chainID); err != nil {
 		return err
 	}
 
@@ -8,6 +8,12 @@ var (
 	errConnectMainChain        = errors.New("connectBlock must be called with a block that extends the main chain")
 	errDisconnectMainChain     = errors.New("disconnectBlock must be called with the block at the end of the main chain")
 	errWaitForOldBlockHeight   = errors.New("blockWaiter wait for old block height")
+	errPruneDepthTooSmall      = errors.New("prune depth is less than MinPruneDepth")
+	errPruneDepthReorg         = errors.New("prune depth must be greater than a non-zero max reorg depth")
+	errNotRegressionNet        = errors.New("only available on the regression test network")
+	errBindingStateLost        = errors.New("no binding state of the main chain is on disk")
+	ErrUnknownDeployment       = errors.New("unknown deployment")
+	ErrNotSignalledDeployment  = errors.New("deployment is not signalled by block versions")
 
 	// BlockTree
 	errExpandOrphanRootBlockNode = errors.New("can not expand orphan block on root of blockTree")
@@ -56,6 +62,7 @@ var (
 	ErrCheckpointTimeTooOld      = errors.New("ErrCheckpointTimeTooOld")
 	ErrBadCheckpoint             = errors.New("ErrBadCheckpoint")
 	ErrForkTooOld                = errors.New("ErrForkTooOld")
+	ErrReorgTooDeep              = errors.New("reorganization is deeper than max reorg depth")
 
 	// BanList
 	ErrBannedPk      = errors.New("block builder puKey has been banned")
@@ -64,12 +71,30 @@ var (
 	ErrCheckBannedPk = errors.New("invalid faultPk")
 
 	// TxPool
-	ErrTxPoolNil           = errors.New("the txpool is nil")
-	ErrTxExsit             = errors.New("transaction is not in the pool")
-	ErrFindTxByAddr        = errors.New("address does not have any transactions in the pool")
-	ErrCoinbaseTx          = errors.New("transaction is an individual coinbase")
-	ErrProhibitionOrphanTx = errors.New("Do not accept orphan transactions")
-	ErrInvalidTxVersion    = errors.New("transaction version is invalid")
+	ErrTxPoolNil            = errors.New("the txpool is nil")
+	ErrTxExsit              = errors.New("transaction is not in the pool")
+	ErrFindTxByAddr         = errors.New("address does not have any transactions in the pool")
+	ErrCoinbaseTx           = errors.New("transaction is an individual coinbase")
+	ErrProhibitionOrphanTx  = errors.New("Do not accept orphan transactions")
+	ErrInvalidTxVersion     = errors.New("transaction version is invalid")
+	ErrTxPoolFull           = errors.New("transaction pool is full")
+	ErrInvalidMempoolFile   = errors.New("invalid mempool file")
+	ErrMempoolFileVersion   = errors.New("unsupported mempool file version")
+	ErrInvalidPackage       = errors.New("package is empty, not sorted or has duplicate transactions")
+	ErrPackageTooLarge      = errors.New("package has too many transactions or is too large")
+	ErrPackageMissingInputs = errors.New("transaction in package has missing inputs")
+
+	// FeeEstimator
+	ErrFeeEstimateBlocks       = errors.New("fee estimate target blocks out of range")
+	ErrNoFeeEstimate           = errors.New("insufficient data to estimate fee")
+	ErrInvalidFeeEstimatesFile = errors.New("invalid fee estimates file")
+	ErrFeeEstimatesFileVersion = errors.New("unsupported fee estimates file version")
+
+	// Replacement
+	ErrReplacementFeeRate        = errors.New("replacement transaction pays lower fee rate than conflicting transaction")
+	ErrReplacementFee            = errors.New("replacement transaction pays insufficient fee")
+	ErrTooManyReplacements       = errors.New("replacement transaction evicts too many transactions")
+	ErrReplacementSpendsConflict = errors.New("replacement transaction spends output of conflicting transaction")
 
 	// Coinbase
 	ErrCoinbaseTxInWitness = errors.New("coinbaseTx txIn`s witness size must be 0")
@@ -89,6 +114,7 @@ var (
 	ErrBindingInputMissing   = errors.New("input of binding missing")
 	ErrDuplicateStaking      = errors.New("duplicate staking")
 	ErrPlotPKAlreadyBound    = errors.New("plot pk already bound")
+	ErrBindingTargetInPool   = errors.New("binding target already in pool")
 	ErrPlotPKNotBound        = errors.New("plot pk not bound")
 	ErrBindingValueNotEnough = errors.New("binding value not enough")
 	ErrInvalidBindingScript  = errors.New("invalid binding script")
@@ -138,6 +164,12 @@ var (
 	ErrScriptValidation    = errors.New("failed to validate signature")
 	ErrWitnessLength       = errors.New("invalid witness length")
 
-	// Listener
-	errNilArgument = errors.New("nil argument")
+	// Subscription
+	ErrSubscribeHeight = errors.New("subscribe height is higher than best height + 1")
+	ErrUnknownCursor   = errors.New("cursor block is unknown")
+
+	// Invalidate
+	ErrInvalidatedBlock  = errors.New("block or its ancestor has been invalidated")
+	errInvalidateGenesis = errors.New("can not invalidate genesis block")
+	errInvalidateTooDeep = errors.New("can not invalidate block lower than root of blockTree")
 )
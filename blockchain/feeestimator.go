@@ -0,0 +1,371 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+const (
+	// MaxFeeEstimateBlocks is the max number of blocks a fee estimate can
+	// target.
+	MaxFeeEstimateBlocks = 48
+
+	// minFeeBucket and maxFeeBucket are the lower bounds in Maxwell/kB of the
+	// first and the last fee rate bucket, buckets are spaced exponentially
+	// by feeBucketSpacing.
+	minFeeBucket     = 1000.0
+	maxFeeBucket     = 1e13
+	feeBucketSpacing = 1.2
+
+	// feeEstimatorDecay is the factor by which the stats decay on each
+	// block, so that recent blocks count more than old ones.
+	feeEstimatorDecay = 0.998
+
+	// sufficientFeeTxs is the min decayed number of transactions a range of
+	// buckets must contain to be used for an estimate.
+	sufficientFeeTxs = 2.0
+
+	// feeEstimatesFileVersion is the current version of fee estimates file.
+	feeEstimatesFileVersion = uint32(1)
+)
+
+// FeeEstimatesFileName is the conventional name of fee estimates file in the
+// chain store directory.
+const FeeEstimatesFileName = "fee_estimates.dat"
+
+var feeEstimatesFileMagic = []byte("MASSFEES")
+
+// FeeConfidence is the min probability required for a transaction paying the
+// estimated fee rate to be confirmed within the target number of blocks.
+type FeeConfidence float64
+
+const (
+	FeeConfidenceLow    FeeConfidence = 0.6
+	FeeConfidenceMedium FeeConfidence = 0.85
+	FeeConfidenceHigh   FeeConfidence = 0.95
+)
+
+// FeeEstimate is the fee rate estimated to confirm a transaction within
+// Blocks blocks.
+type FeeEstimate struct {
+	Blocks     uint32
+	Confidence FeeConfidence
+	// FeeRate is the estimated fee rate in Maxwell/kB.
+	FeeRate massutil.Amount
+	// SuccessRate is the observed rate of transactions paying FeeRate
+	// being confirmed within Blocks blocks.
+	SuccessRate float64
+}
+
+// feeEstimator estimates fee rates from how long the transactions of the pool
+// wait before being confirmed.  Transactions are grouped into buckets by fee
+// rate, and for each bucket it tracks the decayed number of transactions
+// confirmed within every target number of blocks, and those leaving the pool
+// unconfirmed.
+type feeEstimator struct {
+	bestHeight uint64
+	buckets    []float64 // lower bounds of fee rate buckets in Maxwell/kB
+	txCount    []float64 // confirmed transactions in each bucket
+	feeSum     []float64 // sum of fee rates of confirmed transactions in each bucket
+
+	// confirmed[i][j] is the number of transactions in bucket j confirmed
+	// within i+1 blocks, failed[i][j] is the number of transactions in
+	// bucket j leaving the pool unconfirmed after waiting at least i+1
+	// blocks.
+	confirmed [][]float64
+	failed    [][]float64
+}
+
+func newFeeEstimator() *feeEstimator {
+	var buckets []float64
+	for rate := minFeeBucket; rate <= maxFeeBucket; rate *= feeBucketSpacing {
+		buckets = append(buckets, rate)
+	}
+	fe := &feeEstimator{
+		buckets:   buckets,
+		txCount:   make([]float64, len(buckets)),
+		feeSum:    make([]float64, len(buckets)),
+		confirmed: make([][]float64, MaxFeeEstimateBlocks),
+		failed:    make([][]float64, MaxFeeEstimateBlocks),
+	}
+	for i := 0; i < MaxFeeEstimateBlocks; i++ {
+		fe.confirmed[i] = make([]float64, len(buckets))
+		fe.failed[i] = make([]float64, len(buckets))
+	}
+	return fe
+}
+
+// bucketIndex returns the index of the bucket that feePerKB falls in.
+func (fe *feeEstimator) bucketIndex(feePerKB float64) int {
+	i := sort.SearchFloat64s(fe.buckets, feePerKB)
+	if i == len(fe.buckets) || fe.buckets[i] > feePerKB {
+		i--
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// waitedBlocks returns the number of blocks the transaction has waited in the
+// pool since its entry at txD.Height when block of height is connected.
+func waitedBlocks(txD *TxDesc, height uint64) int {
+	if height <= txD.Height {
+		return 0
+	}
+	return int(height - txD.Height)
+}
+
+// processBlock records the transactions of the pool confirmed in the block of
+// height.  Blocks not higher than the best one seen, which are connected again
+// in a reorganization, are ignored.
+func (fe *feeEstimator) processBlock(height uint64, confirmed []*TxDesc) {
+	if height <= fe.bestHeight {
+		return
+	}
+	fe.bestHeight = height
+
+	for j := range fe.buckets {
+		fe.txCount[j] *= feeEstimatorDecay
+		fe.feeSum[j] *= feeEstimatorDecay
+		for i := 0; i < MaxFeeEstimateBlocks; i++ {
+			fe.confirmed[i][j] *= feeEstimatorDecay
+			fe.failed[i][j] *= feeEstimatorDecay
+		}
+	}
+
+	for _, txD := range confirmed {
+		blocks := waitedBlocks(txD, height)
+		if blocks == 0 {
+			continue
+		}
+		feePerKB := txD.feePerKB()
+		j := fe.bucketIndex(feePerKB)
+		fe.txCount[j]++
+		fe.feeSum[j] += feePerKB
+		for i := blocks - 1; i < MaxFeeEstimateBlocks; i++ {
+			fe.confirmed[i][j]++
+		}
+	}
+}
+
+// removeUnconfirmed records the transaction leaving the pool without being
+// confirmed, which fails all the targets it has waited for.
+func (fe *feeEstimator) removeUnconfirmed(txD *TxDesc) {
+	blocks := waitedBlocks(txD, fe.bestHeight)
+	if blocks > MaxFeeEstimateBlocks {
+		blocks = MaxFeeEstimateBlocks
+	}
+	j := fe.bucketIndex(txD.feePerKB())
+	for i := 0; i < blocks; i++ {
+		fe.failed[i][j]++
+	}
+}
+
+// estimate returns the lowest fee rate at which transactions are confirmed
+// within blocks at least at the confidence rate.  Transactions still in the
+// pool after waiting for blocks are counted as failures.  Starting from the
+// highest fee rate, buckets are grouped into ranges of sufficient
+// transactions, and the result is the average fee rate of the last range
+// passing the confidence.
+func (fe *feeEstimator) estimate(blocks uint32, confidence FeeConfidence, pool map[wire.Hash]*TxDesc) (*FeeEstimate, bool) {
+	pending := make([]float64, len(fe.buckets))
+	for _, txD := range pool {
+		if waitedBlocks(txD, fe.bestHeight) >= int(blocks) {
+			pending[fe.bucketIndex(txD.feePerKB())]++
+		}
+	}
+
+	var (
+		confirmed = fe.confirmed[blocks-1]
+		failed    = fe.failed[blocks-1]
+
+		nConf, total, extra, feeSum float64
+		result                      *FeeEstimate
+	)
+	for j := len(fe.buckets) - 1; j >= 0; j-- {
+		nConf += confirmed[j]
+		total += fe.txCount[j]
+		extra += failed[j] + pending[j]
+		feeSum += fe.feeSum[j]
+		if total < sufficientFeeTxs {
+			continue
+		}
+		successRate := nConf / (total + extra)
+		if successRate < float64(confidence) {
+			break
+		}
+		feeRate, err := massutil.NewAmountFromInt(int64(math.Round(feeSum / total)))
+		if err != nil {
+			break
+		}
+		result = &FeeEstimate{
+			Blocks:      blocks,
+			Confidence:  confidence,
+			FeeRate:     feeRate,
+			SuccessRate: successRate,
+		}
+		nConf, total, extra, feeSum = 0, 0, 0, 0
+	}
+	return result, result != nil
+}
+
+// serialize writes the state of the estimator to w, all integers are
+// little-endian:
+//
+//	magic "MASSFEES" (8 bytes) | version (4 bytes) | best height (8 bytes) |
+//	bucket count (4 bytes) | max blocks (4 bytes) | txCount | feeSum | confirmed | failed
+func (fe *feeEstimator) serialize(w io.Writer) error {
+	if _, err := w.Write(feeEstimatesFileMagic); err != nil {
+		return err
+	}
+	for _, v := range []interface{}{feeEstimatesFileVersion, fe.bestHeight,
+		uint32(len(fe.buckets)), uint32(MaxFeeEstimateBlocks), fe.txCount, fe.feeSum} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	for _, stats := range [][][]float64{fe.confirmed, fe.failed} {
+		for _, row := range stats {
+			if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deserializeFeeEstimator reads the state of an estimator written by
+// serialize.
+func deserializeFeeEstimator(r io.Reader) (*feeEstimator, error) {
+	magic := make([]byte, len(feeEstimatesFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, feeEstimatesFileMagic) {
+		return nil, ErrInvalidFeeEstimatesFile
+	}
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != feeEstimatesFileVersion {
+		return nil, ErrFeeEstimatesFileVersion
+	}
+
+	fe := newFeeEstimator()
+	var numBuckets, maxBlocks uint32
+	for _, v := range []interface{}{&fe.bestHeight, &numBuckets, &maxBlocks} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if int(numBuckets) != len(fe.buckets) || maxBlocks != MaxFeeEstimateBlocks {
+		logging.CPrint(logging.WARN, "fee estimates file does not match current buckets", logging.LogFormat{
+			"buckets":   numBuckets,
+			"maxBlocks": maxBlocks,
+		})
+		return nil, ErrInvalidFeeEstimatesFile
+	}
+	for _, v := range []interface{}{fe.txCount, fe.feeSum} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, stats := range [][][]float64{fe.confirmed, fe.failed} {
+		for _, row := range stats {
+			if err := binary.Read(r, binary.LittleEndian, row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fe, nil
+}
+
+// EstimateFee returns the fee rate for a transaction to be confirmed within
+// blocks at the confidence level.  The estimate is never lower than the
+// minimum fee required by the pool.  ErrNoFeeEstimate is returned if there
+// is not enough data yet.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) EstimateFee(blocks uint32, confidence FeeConfidence) (*FeeEstimate, error) {
+	if blocks == 0 || blocks > MaxFeeEstimateBlocks {
+		return nil, ErrFeeEstimateBlocks
+	}
+
+	tp.Lock()
+	defer tp.Unlock()
+
+	estimate, ok := tp.feeEstimator.estimate(blocks, confidence, tp.pool)
+	if !ok {
+		logging.CPrint(logging.DEBUG, "insufficient data to estimate fee", logging.LogFormat{
+			"blocks":     blocks,
+			"confidence": confidence,
+		})
+		return nil, ErrNoFeeEstimate
+	}
+	minFee, err := massutil.NewAmountFromInt(int64(math.Ceil(tp.rollingMinFee())))
+	if err != nil {
+		return nil, err
+	}
+	if static := massutil.MinRelayTxFee(); minFee.Cmp(static) < 0 {
+		minFee = static
+	}
+	if estimate.FeeRate.Cmp(minFee) < 0 {
+		estimate.FeeRate = minFee
+	}
+	return estimate, nil
+}
+
+// SaveFeeEstimates writes the state of the fee estimator to path, so that it
+// can be restored by LoadFeeEstimates after restart.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) SaveFeeEstimates(path string) error {
+	tp.RLock()
+	defer tp.RUnlock()
+
+	return writeFileAtomic(path, tp.feeEstimator.serialize)
+}
+
+// LoadFeeEstimates restores the state of the fee estimator saved by
+// SaveFeeEstimates.  It does nothing if the file does not exist.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) LoadFeeEstimates(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	fe, err := deserializeFeeEstimator(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		logging.CPrint(logging.ERROR, "failed to read fee estimates file", logging.LogFormat{
+			"path": path,
+			"err":  err,
+		})
+		return err
+	}
+
+	tp.Lock()
+	defer tp.Unlock()
+
+	tp.feeEstimator = fe
+	logging.CPrint(logging.INFO, "fee estimates loaded", logging.LogFormat{
+		"path":       path,
+		"bestHeight": fe.bestHeight,
+	})
+	return nil
+}
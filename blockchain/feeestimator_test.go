@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeEstimator(t *testing.T) {
+	fe := newFeeEstimator()
+
+	// newTxDesc returns a transaction entering the pool at height and
+	// paying feePerKB.
+	lockTime := uint64(0)
+	newTxDesc := func(height uint64, feePerKB int64) *TxDesc {
+		lockTime++
+		msgTx := wire.NewMsgTx()
+		msgTx.LockTime = lockTime
+		fee, err := massutil.NewAmountFromInt(feePerKB)
+		assert.Nil(t, err)
+		return &TxDesc{Tx: massutil.NewTx(msgTx), Height: height, Fee: fee, size: 1000}
+	}
+
+	// High fee transactions are confirmed in the next block, low fee ones
+	// wait for 5 blocks.
+	height := uint64(100)
+	fe.processBlock(height, nil)
+	var waiting []*TxDesc
+	for i := 0; i < 30; i++ {
+		height++
+		confirmed := []*TxDesc{newTxDesc(height-1, 1000000), newTxDesc(height-1, 1000000)}
+		if i >= 4 {
+			confirmed = append(confirmed, waiting[i-4])
+		}
+		waiting = append(waiting, newTxDesc(height-1, 20000))
+		fe.processBlock(height, confirmed)
+	}
+
+	estimate, ok := fe.estimate(1, FeeConfidenceHigh, nil)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1000000), estimate.FeeRate.IntValue())
+	estimate, ok = fe.estimate(5, FeeConfidenceHigh, nil)
+	assert.True(t, ok)
+	assert.Equal(t, int64(20000), estimate.FeeRate.IntValue())
+	assert.Equal(t, 1.0, estimate.SuccessRate)
+
+	// Low fee transactions stuck in the pool fail the target.
+	pool := make(map[wire.Hash]*TxDesc)
+	for i := 0; i < 10; i++ {
+		txD := newTxDesc(height-10, 20000)
+		pool[*txD.Tx.Hash()] = txD
+	}
+	estimate, ok = fe.estimate(5, FeeConfidenceHigh, pool)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1000000), estimate.FeeRate.IntValue())
+
+	// Blocks connected again in a reorganization are ignored.
+	before := fe.txCount[fe.bucketIndex(1000000)]
+	fe.processBlock(height, []*TxDesc{newTxDesc(height-1, 1000000)})
+	assert.Equal(t, before, fe.txCount[fe.bucketIndex(1000000)])
+
+	// Evicted transactions fail the targets they have waited for.
+	fe.removeUnconfirmed(newTxDesc(height-3, 20000))
+	j := fe.bucketIndex(20000)
+	assert.Equal(t, 1.0, fe.failed[2][j])
+	assert.Equal(t, 0.0, fe.failed[3][j])
+
+	// no data for low confidence on empty estimator
+	_, ok = newFeeEstimator().estimate(1, FeeConfidenceLow, nil)
+	assert.False(t, ok)
+
+	var buf bytes.Buffer
+	assert.Nil(t, fe.serialize(&buf))
+	restored, err := deserializeFeeEstimator(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, fe, restored)
+
+	bs := buf.Bytes()
+	bs[0] = 'X'
+	_, err = deserializeFeeEstimator(bytes.NewReader(bs))
+	assert.Equal(t, ErrInvalidFeeEstimatesFile, err)
+}
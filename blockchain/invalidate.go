@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// InvalidateBlock marks the block and its descendants as invalid, and
+// reorganizes the chain to the best valid tip if the best chain contains
+// the block. The mark persists across restarts until ReconsiderBlock is
+// called, blocks that are not known yet can also be invalidated.
+func (chain *Blockchain) InvalidateBlock(hash *wire.Hash) error {
+	return chain.execProcessFunc(func() error {
+		return chain.invalidateBlock(hash)
+	})
+}
+
+// ReconsiderBlock removes the invalid marks of the block, as well as its
+// ancestors and descendants, and reorganizes the chain to the best valid tip.
+func (chain *Blockchain) ReconsiderBlock(hash *wire.Hash) error {
+	return chain.execProcessFunc(func() error {
+		return chain.reconsiderBlock(hash)
+	})
+}
+
+func (chain *Blockchain) invalidateBlock(hash *wire.Hash) error {
+	if hash.IsEqual(&chain.info.genesisHash) {
+		return errInvalidateGenesis
+	}
+	node, exists := chain.blockTree.getBlockNode(hash)
+	if (exists && node.Parent == nil) || (!exists && chain.blockExists(hash)) {
+		return errInvalidateTooDeep
+	}
+
+	if err := chain.db.InsertInvalidBlock(hash); err != nil {
+		return err
+	}
+	chain.invalidBlocks[*hash] = struct{}{}
+	logging.CPrint(logging.INFO, "block invalidated", logging.LogFormat{
+		"hash":  hash,
+		"known": exists,
+	})
+	if !exists {
+		return nil
+	}
+
+	chain.blockTree.invalidateBlockNode(node)
+	return chain.activateBestValidChain()
+}
+
+func (chain *Blockchain) reconsiderBlock(hash *wire.Hash) error {
+	node, exists := chain.blockTree.getBlockNode(hash)
+	for invalid := range chain.invalidBlocks {
+		if !invalid.IsEqual(hash) {
+			if !exists {
+				continue
+			}
+			other, ok := chain.blockTree.getBlockNode(&invalid)
+			if !ok || !onSameBranch(node, other) {
+				continue
+			}
+		}
+		if err := chain.db.DeleteInvalidBlock(&invalid); err != nil {
+			return err
+		}
+		delete(chain.invalidBlocks, invalid)
+		logging.CPrint(logging.INFO, "block reconsidered", logging.LogFormat{"hash": invalid})
+	}
+
+	chain.blockTree.resetInvalidBlockNodes(chain.invalidBlocks)
+	return chain.activateBestValidChain()
+}
+
+// onSameBranch returns whether or not a is an ancestor or a descendant of b.
+func onSameBranch(a, b *BlockNode) bool {
+	if a.Height > b.Height {
+		a, b = b, a
+	}
+	return b.Ancestor(a.Height) == a
+}
+
+// disconnectInvalidBlocks disconnects invalid blocks from the end of the
+// best chain.
+func (chain *Blockchain) disconnectInvalidBlocks() error {
+	chain.l.Lock()
+	defer chain.l.Unlock()
+
+	for node := chain.blockTree.bestBlockNode(); node.Invalid; node = chain.blockTree.bestBlockNode() {
+		if node.Parent == nil {
+			return errInvalidateTooDeep
+		}
+		block, err := chain.db.FetchBlockBySha(node.Hash)
+		if err != nil {
+			return err
+		}
+		if err = chain.disconnectBlock(node, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activateBestValidChain makes the best valid tip the end of the best chain.
+func (chain *Blockchain) activateBestValidChain() error {
+	if err := chain.disconnectInvalidBlocks(); err != nil {
+		return err
+	}
+
+	best := chain.blockTree.bestValidBlockNode()
+	if best == nil || best == chain.blockTree.bestBlockNode() {
+		return nil
+	}
+	// Keep current best chain until max reorg depth is raised, the depth
+	// check logs the rejected tip.
+	if err := chain.checkReorgDepth(best); err != nil {
+		return err
+	}
+	detachNodes, attachNodes := chain.getReorganizeNodes(best)
+	if err := chain.reorganizeChain(detachNodes, attachNodes, BFNone); err != nil {
+		logging.CPrint(logging.ERROR, "failed to reorganize to best valid tip", logging.LogFormat{
+			"hash":   best.Hash,
+			"height": best.Height,
+			"err":    err,
+		})
+		return err
+	}
+	chain.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"os"
+	"testing"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidateBlock(t *testing.T) {
+	// height: 0(main)... -> 30(main) -> 31(main) -> 31(fork) -> 32(fork) -> 33(fork) -> 32(main) -> 33(main) -> ...49(main)
+	// i:      0      ...    30          31          32          33          34          35          36          ...52
+	blks := loadBlks("./data/beforestaking.dat")
+	assert.Equal(t, 53, len(blks))
+
+	copy(config.ChainParams.GenesisHash[:], blks[0].Hash()[:])
+	copy(config.ChainParams.GenesisBlock.Header.Challenge[:], blks[0].MsgBlock().Header.Challenge[:])
+	copy(config.ChainParams.GenesisBlock.Header.ChainID[:], blks[0].MsgBlock().Header.ChainID[:])
+	config.ChainParams.GenesisBlock.Header.Timestamp = blks[0].MsgBlock().Header.Timestamp
+	config.ChainParams.GenesisBlock.Header.Target = blks[0].MsgBlock().Header.Target
+
+	bc, closeFunc := newReorgTestChain(blks[0], "invalidate")
+	defer closeFunc()
+
+	for i := 1; i < 42; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, blks[41].Hash(), bc.BestBlockHash())
+
+	assert.Equal(t, errInvalidateGenesis, bc.InvalidateBlock(blks[0].Hash()))
+
+	// best chain switches to the fork
+	assert.Nil(t, bc.InvalidateBlock(blks[35].Hash()))
+	assert.Equal(t, blks[34].Hash(), bc.BestBlockHash())
+	for _, blk := range blks[35:42] {
+		assert.True(t, bc.blockTree.blockNode(blk.Hash()).Invalid)
+		assert.False(t, bc.InMainChain(*blk.Hash()))
+	}
+	_, err := bc.processBlock(blks[42], BFNone)
+	assert.Equal(t, ErrInvalidatedBlock, err)
+
+	// reconsidering a descendant also clears the mark of the ancestor
+	assert.Nil(t, bc.ReconsiderBlock(blks[38].Hash()))
+	assert.Equal(t, blks[41].Hash(), bc.BestBlockHash())
+	assert.False(t, bc.blockTree.blockNode(blks[35].Hash()).Invalid)
+	_, err = bc.processBlock(blks[42], BFNone)
+	assert.Nil(t, err)
+	assert.Equal(t, blks[42].Hash(), bc.BestBlockHash())
+
+	// invalidating a side chain does not change best chain
+	assert.Nil(t, bc.InvalidateBlock(blks[33].Hash()))
+	assert.Equal(t, blks[42].Hash(), bc.BestBlockHash())
+	assert.True(t, bc.blockTree.blockNode(blks[34].Hash()).Invalid)
+	assert.False(t, bc.blockTree.blockNode(blks[32].Hash()).Invalid)
+
+	// invalidate an unknown block
+	assert.Nil(t, bc.InvalidateBlock(blks[44].Hash()))
+	_, err = bc.processBlock(blks[43], BFNone)
+	assert.Nil(t, err)
+	_, err = bc.processBlock(blks[44], BFNone)
+	assert.Equal(t, ErrInvalidatedBlock, err)
+	assert.Equal(t, blks[43].Hash(), bc.BestBlockHash())
+
+	// marks persist across restarts
+	restart := func() *Blockchain {
+		cachePath := "./reorgtest/invalidate/restart.dat"
+		os.RemoveAll(cachePath)
+		assert.Nil(t, os.MkdirAll(cachePath, 0700))
+		chain, err := NewBlockchain(&Config{
+			DB:             bc.db,
+			StateBindingDb: bc.stateBindingDb,
+			ChainParams:    &config.ChainParams,
+			CachePath:      cachePath,
+		})
+		assert.Nil(t, err)
+		chain.GetTxPool().SetNewTxCh(make(chan *massutil.Tx, 2000)) // prevent deadlock
+		return chain
+	}
+	bc2 := restart()
+	assert.Equal(t, blks[43].Hash(), bc2.BestBlockHash())
+	_, err = bc2.processBlock(blks[44], BFNone)
+	assert.Equal(t, ErrInvalidatedBlock, err)
+	assert.Nil(t, bc2.ReconsiderBlock(blks[44].Hash()))
+	_, err = bc2.processBlock(blks[44], BFNone)
+	assert.Nil(t, err)
+	assert.Equal(t, blks[44].Hash(), bc2.BestBlockHash())
+
+	// blocks marked but not disconnected are disconnected at startup
+	assert.Nil(t, bc2.db.InsertInvalidBlock(blks[43].Hash()))
+	bc3 := restart()
+	assert.Equal(t, blks[42].Hash(), bc3.BestBlockHash())
+	assert.False(t, bc3.InMainChain(*blks[43].Hash()))
+}
@@ -0,0 +1,312 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// Listener receives chain and mempool events. All methods are called
+// sequentially from a single goroutine, in the order the events happened,
+// and never with the chain lock held. A slow listener delays the delivery
+// of later events but does not block the chain. Returned errors are logged.
+//
+// A Listener may also implement BlockDisconnectedListener,
+// ReorganizeListener and TransactionEvictedListener to receive those events.
+type Listener interface {
+	OnBlockConnected(*wire.MsgBlock) error
+	OnTransactionReceived(tx *wire.MsgTx) error
+}
+
+// BlockDisconnectedListener is implemented by a Listener receiving the blocks
+// disconnected from the main chain.
+type BlockDisconnectedListener interface {
+	OnBlockDisconnected(*wire.MsgBlock) error
+}
+
+// ReorganizeListener is implemented by a Listener receiving reorganizations.
+// OnReorganize is called after all the OnBlockDisconnected and
+// OnBlockConnected events of a reorganization were delivered.
+type ReorganizeListener interface {
+	OnReorganize(*ReorgInfo) error
+}
+
+// TransactionEvictedListener is implemented by a Listener receiving the
+// transactions removed from the pool without being mined.
+type TransactionEvictedListener interface {
+	OnTransactionEvicted(tx *wire.MsgTx, reason EvictReason) error
+}
+
+// ReorgInfo summarizes a chain reorganization.
+type ReorgInfo struct {
+	ForkHash   wire.Hash
+	ForkHeight uint64
+	// Detached lists the blocks removed from the main chain, from the
+	// old best block down to the child of the fork point.
+	Detached []wire.Hash
+	// Attached lists the blocks added to the main chain, from the child
+	// of the fork point up to the new best block.
+	Attached []wire.Hash
+}
+
+// EvictReason describes why a transaction was removed from the pool
+// without being mined.
+type EvictReason int
+
+const (
+	// EvictConflict means the transaction double spends a transaction in
+	// a connected block, or depends on such a transaction.
+	EvictConflict EvictReason = iota
+
+	// EvictReorg means the transaction became invalid after its block was
+	// disconnected, or depends on such a transaction.
+	EvictReorg
+
+	// EvictSizeLimit means the transaction pays the lowest fee rate when
+	// the pool exceeds its size limit, or depends on such a transaction.
+	EvictSizeLimit
+
+	// EvictExpired means the transaction stayed in the pool for too long,
+	// or depends on such a transaction.
+	EvictExpired
+
+	// EvictReplaced means the transaction is replaced by a conflicting
+	// transaction paying a higher fee, or depends on such a transaction.
+	EvictReplaced
+)
+
+var evictReasonStrings = map[EvictReason]string{
+	EvictConflict:  "conflict",
+	EvictReorg:     "reorg",
+	EvictSizeLimit: "size limit",
+	EvictExpired:   "expired",
+	EvictReplaced:  "replaced",
+}
+
+// String returns the EvictReason in human-readable form.
+func (r EvictReason) String() string {
+	if s, ok := evictReasonStrings[r]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+type notificationType int
+
+const (
+	ntfnBlockConnected notificationType = iota
+	ntfnBlockDisconnected
+	ntfnReorganize
+	ntfnTransactionReceived
+	ntfnTransactionEvicted
+
+	// ntfnRegister registers a listener in queue order, so that it receives
+	// only the events sent after it.
+	ntfnRegister
+
+	// ntfnUnregister unregisters a listener in queue order.
+	ntfnUnregister
+)
+
+type notification struct {
+	typ      notificationType
+	block    *wire.MsgBlock
+	tx       *wire.MsgTx
+	reorg    *ReorgInfo
+	reason   EvictReason
+	listener Listener
+}
+
+// notifier delivers notifications to listeners asynchronously. It keeps an
+// unbounded queue so that senders, which usually hold the chain or mempool
+// lock, never block.
+type notifier struct {
+	mtx       sync.Mutex
+	cond      *sync.Cond
+	queue     []*notification
+	pending   int // queued or being delivered
+	listeners map[Listener]struct{}
+	lmtx      sync.RWMutex
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+func newNotifier() *notifier {
+	n := &notifier{
+		listeners: make(map[Listener]struct{}),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	n.cond = sync.NewCond(&n.mtx)
+	go n.handler()
+	return n
+}
+
+func (n *notifier) register(listener Listener) {
+	n.lmtx.Lock()
+	n.listeners[listener] = struct{}{}
+	n.lmtx.Unlock()
+}
+
+func (n *notifier) unregister(listener Listener) {
+	n.lmtx.Lock()
+	delete(n.listeners, listener)
+	n.lmtx.Unlock()
+}
+
+func (n *notifier) send(ntfn *notification) {
+	n.mtx.Lock()
+	if n.stopped() {
+		n.mtx.Unlock()
+		return
+	}
+	n.queue = append(n.queue, ntfn)
+	n.pending++
+	n.mtx.Unlock()
+	n.cond.Broadcast()
+}
+
+// wait blocks until all queued notifications are delivered.
+func (n *notifier) wait() {
+	n.mtx.Lock()
+	for n.pending > 0 {
+		n.cond.Wait()
+	}
+	n.mtx.Unlock()
+}
+
+// stopped returns whether stop was called, n.mtx must be held.
+func (n *notifier) stopped() bool {
+	select {
+	case <-n.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop delivers the queued notifications, drops later ones and waits for the
+// handler to exit.
+func (n *notifier) stop() {
+	n.mtx.Lock()
+	if !n.stopped() {
+		close(n.quit)
+	}
+	n.mtx.Unlock()
+	n.cond.Broadcast()
+	<-n.done
+}
+
+func (n *notifier) handler() {
+	defer close(n.done)
+	for {
+		n.mtx.Lock()
+		for len(n.queue) == 0 {
+			if n.stopped() {
+				n.mtx.Unlock()
+				return
+			}
+			n.cond.Wait()
+		}
+		batch := n.queue
+		n.queue = nil
+		n.mtx.Unlock()
+
+		for _, ntfn := range batch {
+			n.dispatch(ntfn)
+		}
+
+		n.mtx.Lock()
+		n.pending -= len(batch)
+		n.mtx.Unlock()
+		n.cond.Broadcast()
+	}
+}
+
+func (n *notifier) dispatch(ntfn *notification) {
+	switch ntfn.typ {
+	case ntfnRegister:
+		n.register(ntfn.listener)
+		return
+	case ntfnUnregister:
+		n.unregister(ntfn.listener)
+		return
+	}
+
+	// Listeners are called without the lock, they may register or
+	// unregister listeners.
+	n.lmtx.RLock()
+	listeners := make([]Listener, 0, len(n.listeners))
+	for listener := range n.listeners {
+		listeners = append(listeners, listener)
+	}
+	n.lmtx.RUnlock()
+
+	for _, listener := range listeners {
+		var err error
+		switch ntfn.typ {
+		case ntfnBlockConnected:
+			err = listener.OnBlockConnected(ntfn.block)
+		case ntfnBlockDisconnected:
+			if l, ok := listener.(BlockDisconnectedListener); ok {
+				err = l.OnBlockDisconnected(ntfn.block)
+			}
+		case ntfnReorganize:
+			if l, ok := listener.(ReorganizeListener); ok {
+				err = l.OnReorganize(ntfn.reorg)
+			}
+		case ntfnTransactionReceived:
+			err = listener.OnTransactionReceived(ntfn.tx)
+		case ntfnTransactionEvicted:
+			if l, ok := listener.(TransactionEvictedListener); ok {
+				err = l.OnTransactionEvicted(ntfn.tx, ntfn.reason)
+			}
+		}
+		if err != nil {
+			logging.CPrint(logging.WARN, "listener failed to handle notification", logging.LogFormat{
+				"type": ntfn.typ,
+				"err":  err,
+			})
+		}
+	}
+}
+
+// RegisterListener registers listener in queue order, so that it receives
+// only the events sent after it.
+func (chain *Blockchain) RegisterListener(listener Listener) {
+	chain.notifier.send(&notification{typ: ntfnRegister, listener: listener})
+}
+
+// UnregisterListener unregisters listener in queue order, so that it still
+// receives the events sent before it.
+func (chain *Blockchain) UnregisterListener(listener Listener) {
+	chain.notifier.send(&notification{typ: ntfnUnregister, listener: listener})
+}
+
+// WaitNotifications blocks until all events generated so far have been
+// delivered to listeners.
+func (chain *Blockchain) WaitNotifications() {
+	chain.notifier.wait()
+}
+
+func (chain *Blockchain) notifyBlockConnected(block *massutil.Block) {
+	chain.notifier.send(&notification{typ: ntfnBlockConnected, block: block.MsgBlock()})
+}
+
+func (chain *Blockchain) notifyBlockDisconnected(block *massutil.Block) {
+	chain.notifier.send(&notification{typ: ntfnBlockDisconnected, block: block.MsgBlock()})
+}
+
+func (chain *Blockchain) notifyReorganize(info *ReorgInfo) {
+	chain.notifier.send(&notification{typ: ntfnReorganize, reorg: info})
+}
+
+func (chain *Blockchain) notifyTransactionReceived(tx *massutil.Tx) {
+	chain.notifier.send(&notification{typ: ntfnTransactionReceived, tx: tx.MsgTx()})
+}
+
+func (chain *Blockchain) notifyTransactionEvicted(tx *massutil.Tx, reason EvictReason) {
+	chain.notifier.send(&notification{typ: ntfnTransactionEvicted, tx: tx.MsgTx(), reason: reason})
+}
@@ -0,0 +1,207 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/massnetorg/mass-core/wire"
+)
+
+type recordListener struct {
+	delay  time.Duration
+	events []notificationType
+	blocks []*wire.MsgBlock
+}
+
+func (l *recordListener) record(typ notificationType, block *wire.MsgBlock) error {
+	time.Sleep(l.delay)
+	l.events = append(l.events, typ)
+	l.blocks = append(l.blocks, block)
+	return nil
+}
+
+func (l *recordListener) OnBlockConnected(block *wire.MsgBlock) error {
+	return l.record(ntfnBlockConnected, block)
+}
+
+func (l *recordListener) OnBlockDisconnected(block *wire.MsgBlock) error {
+	return l.record(ntfnBlockDisconnected, block)
+}
+
+func (l *recordListener) OnReorganize(*ReorgInfo) error {
+	return l.record(ntfnReorganize, nil)
+}
+
+func (l *recordListener) OnTransactionReceived(*wire.MsgTx) error {
+	return l.record(ntfnTransactionReceived, nil)
+}
+
+func (l *recordListener) OnTransactionEvicted(*wire.MsgTx, EvictReason) error {
+	return l.record(ntfnTransactionEvicted, nil)
+}
+
+func TestNotifierOrder(t *testing.T) {
+	n := newNotifier()
+	l := &recordListener{delay: 10 * time.Millisecond}
+	n.register(l)
+
+	blocks := make([]*wire.MsgBlock, 10)
+	for i := range blocks {
+		blocks[i] = &wire.MsgBlock{Header: wire.BlockHeader{Height: uint64(i)}}
+	}
+	expected := []notificationType{
+		ntfnBlockDisconnected, ntfnBlockDisconnected, ntfnBlockConnected,
+		ntfnBlockConnected, ntfnBlockConnected, ntfnReorganize, ntfnTransactionEvicted,
+		ntfnTransactionReceived, ntfnBlockConnected, ntfnBlockConnected,
+	}
+
+	// sending must not wait for the slow listener
+	start := time.Now()
+	for i, typ := range expected {
+		n.send(&notification{typ: typ, block: blocks[i], tx: &wire.MsgTx{}, reorg: &ReorgInfo{}})
+	}
+	if elapsed := time.Since(start); elapsed >= l.delay*time.Duration(len(expected)) {
+		t.Fatalf("send blocked on listener for %v", elapsed)
+	}
+
+	n.wait()
+	if len(l.events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(l.events))
+	}
+	for i, typ := range expected {
+		if l.events[i] != typ {
+			t.Errorf("event %d: expected type %d, got %d", i, typ, l.events[i])
+		}
+		if l.blocks[i] != nil && l.blocks[i].Header.Height != uint64(i) {
+			t.Errorf("event %d: out of order block %d", i, l.blocks[i].Header.Height)
+		}
+	}
+
+	// unregistered listener receives nothing
+	n.unregister(l)
+	n.send(&notification{typ: ntfnBlockConnected, block: blocks[0]})
+	n.wait()
+	if len(l.events) != len(expected) {
+		t.Fatalf("unregistered listener received %d events", len(l.events)-len(expected))
+	}
+}
+
+// baseListener implements only the required methods of Listener.
+type baseListener struct {
+	connected int
+}
+
+func (l *baseListener) OnBlockConnected(*wire.MsgBlock) error {
+	l.connected++
+	return nil
+}
+
+func (l *baseListener) OnTransactionReceived(*wire.MsgTx) error {
+	return nil
+}
+
+// unregisterListener unregisters itself on the first connected block.
+type unregisterListener struct {
+	baseListener
+	n *notifier
+}
+
+func (l *unregisterListener) OnBlockConnected(block *wire.MsgBlock) error {
+	l.n.unregister(l)
+	return l.baseListener.OnBlockConnected(block)
+}
+
+func TestNotifierOptionalListeners(t *testing.T) {
+	n := newNotifier()
+	defer n.stop()
+	base := &baseListener{}
+	self := &unregisterListener{n: n}
+	n.register(base)
+	n.register(self)
+
+	block := &wire.MsgBlock{}
+	for _, typ := range []notificationType{
+		ntfnBlockDisconnected, ntfnReorganize, ntfnTransactionEvicted,
+		ntfnBlockConnected, ntfnBlockConnected,
+	} {
+		n.send(&notification{typ: typ, block: block, tx: &wire.MsgTx{}, reorg: &ReorgInfo{}})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener unregistering itself deadlocked")
+	}
+	if base.connected != 2 {
+		t.Errorf("expected 2 connected blocks, got %d", base.connected)
+	}
+	if self.connected != 1 {
+		t.Errorf("expected 1 connected block before unregistering, got %d", self.connected)
+	}
+}
+
+func TestNotifierStop(t *testing.T) {
+	n := newNotifier()
+	l := &recordListener{delay: 10 * time.Millisecond}
+	n.register(l)
+	for i := 0; i < 3; i++ {
+		n.send(&notification{typ: ntfnBlockConnected, block: &wire.MsgBlock{}})
+	}
+
+	// queued notifications are delivered before the handler exits
+	n.stop()
+	if len(l.events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(l.events))
+	}
+	select {
+	case <-n.done:
+	default:
+		t.Fatal("handler is still running")
+	}
+
+	// later notifications are dropped
+	n.send(&notification{typ: ntfnBlockConnected, block: &wire.MsgBlock{}})
+	n.wait()
+	n.stop()
+	if len(l.events) != 3 {
+		t.Fatalf("notification delivered after stop")
+	}
+}
+
+// blockingListener blocks on connected blocks until released.
+type blockingListener struct {
+	baseListener
+	release chan struct{}
+}
+
+func (l *blockingListener) OnBlockConnected(*wire.MsgBlock) error {
+	<-l.release
+	return nil
+}
+
+func TestRegisterListenerOrder(t *testing.T) {
+	chain := &Blockchain{notifier: newNotifier()}
+	defer chain.notifier.stop()
+	blocking := &blockingListener{release: make(chan struct{})}
+	chain.RegisterListener(blocking)
+
+	// the handler blocks on the first event while the second is queued
+	chain.notifier.send(&notification{typ: ntfnBlockConnected, block: &wire.MsgBlock{}})
+	chain.notifier.send(&notification{typ: ntfnBlockConnected, block: &wire.MsgBlock{}})
+	l := &recordListener{}
+	chain.RegisterListener(l)
+	chain.notifier.send(&notification{typ: ntfnBlockDisconnected, block: &wire.MsgBlock{}})
+	chain.UnregisterListener(l)
+	chain.notifier.send(&notification{typ: ntfnBlockConnected, block: &wire.MsgBlock{}})
+	close(blocking.release)
+
+	chain.WaitNotifications()
+	if len(l.events) != 1 || l.events[0] != ntfnBlockDisconnected {
+		t.Fatalf("expected only the event sent while registered, got %v", l.events)
+	}
+}
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/orphanpool"
 	"github.com/massnetorg/mass-core/logging"
@@ -14,39 +15,58 @@ const (
 	// defaultMaxOrphanTransactions is the default maximum number of orphan transactions
 	// that can be queued.
 	defaultMaxOrphanTransactions = 1000
+
+	// defaultMaxOrphansPerPeer is the default maximum number of orphan
+	// transactions from a single peer that can be queued.
+	defaultMaxOrphansPerPeer = 100
+
+	// defaultOrphanTTL is the default time an orphan transaction stays in the
+	// pool before it expires.
+	defaultOrphanTTL = 15 * time.Minute
+
+	// orphanExpireScanInterval is the min time between scans of the orphan
+	// pool for expired orphans.
+	orphanExpireScanInterval = 5 * time.Minute
 )
 
 type OrphanTxPool struct {
 	maxOrphanTransactions int
+	maxOrphansPerPeer     int
+	orphanTTL             time.Duration
+	nextExpireScan        time.Time
 	pool                  *orphanpool.AbstractOrphanPool
+	peerOrphans           map[string]map[wire.Hash]struct{} // maps peer ID to orphans from it
 }
 
 func newOrphanTxPool() *OrphanTxPool {
 	return &OrphanTxPool{
 		maxOrphanTransactions: defaultMaxOrphanTransactions,
+		maxOrphansPerPeer:     defaultMaxOrphansPerPeer,
+		orphanTTL:             defaultOrphanTTL,
+		nextExpireScan:        time.Now().Add(orphanExpireScanInterval),
 		pool:                  orphanpool.NewAbstractOrphanPool(),
+		peerOrphans:           make(map[string]map[wire.Hash]struct{}),
 	}
 }
 
-type orphanTx massutil.Tx
-
-func newOrphanTx(tx *massutil.Tx) *orphanTx {
-	return (*orphanTx)(tx)
+// orphanTx is a transaction that we don't yet have the parents for, tagged
+// with the ID of the peer it comes from, which is empty for transactions not
+// from peers.  It expires at expiration to prevent caching the orphan forever.
+type orphanTx struct {
+	tx         *massutil.Tx
+	peerID     string
+	expiration time.Time
 }
 
-func (tx *orphanTx) OrphanPoolID() string {
-	return (*massutil.Tx)(tx).Hash().String()
-}
-
-func (tx *orphanTx) Tx() *massutil.Tx {
-	return (*massutil.Tx)(tx)
+func (orphan *orphanTx) OrphanPoolID() string {
+	return orphan.tx.Hash().String()
 }
 
 func (otp *OrphanTxPool) orphans() []*massutil.Tx {
 	entries := otp.pool.Items()
 	orphans := make([]*massutil.Tx, 0, len(entries))
 	for _, e := range entries {
-		orphans = append(orphans, e.(*orphanTx).Tx())
+		orphans = append(orphans, e.(*orphanTx).tx)
 	}
 	return orphans
 }
@@ -56,36 +76,112 @@ func (otp *OrphanTxPool) orphans() []*massutil.Tx {
 //
 // This function MUST be called with the txPool lock held (for writes).
 func (otp *OrphanTxPool) removeOrphan(txHash *wire.Hash) {
-	otp.pool.Fetch(txHash.String())
+	entry, exists := otp.pool.Fetch(txHash.String())
+	if !exists {
+		return
+	}
+	peerID := entry.(*orphanTx).peerID
+	if orphans, ok := otp.peerOrphans[peerID]; ok {
+		delete(orphans, *txHash)
+		if len(orphans) == 0 {
+			delete(otp.peerOrphans, peerID)
+		}
+	}
 }
 
-// limitNumOrphans limits the number of orphan transactions by evicting a random
-// orphan if adding a new one would cause it to overflow the max allowed.
+// getOrphan returns the orphan transaction of hash in the pool.
+//
+// This function MUST be called with the txPool RLock held (for reads).
+func (otp *OrphanTxPool) getOrphan(hash *wire.Hash) (*orphanTx, bool) {
+	entry, exists := otp.pool.Read(hash.String())
+	if !exists {
+		return nil, false
+	}
+	return entry.(*orphanTx), true
+}
+
+// removeOrphansByPeer removes all the orphan transactions from the peer.
+//
+// This function MUST be called with the txPool lock held (for writes).
+func (otp *OrphanTxPool) removeOrphansByPeer(peerID string) int {
+	orphans := otp.peerOrphans[peerID]
+	count := len(orphans)
+	for hash := range orphans {
+		otp.removeOrphan(&hash)
+	}
+	return count
+}
+
+// expireOrphans removes the orphan transactions that have expired, the pool
+// is scanned at most once per orphanExpireScanInterval.
 //
 // This function MUST be called with the txPool lock held (for writes).
-func (otp *OrphanTxPool) limitNumOrphans() error {
-	if otp.pool.Count()+1 > otp.maxOrphanTransactions {
-		ids := otp.pool.IDs()
+func (otp *OrphanTxPool) expireOrphans() {
+	now := time.Now()
+	if now.Before(otp.nextExpireScan) {
+		return
+	}
+	otp.nextExpireScan = now.Add(orphanExpireScanInterval)
+
+	var expired int
+	for _, entry := range otp.pool.Items() {
+		orphan := entry.(*orphanTx)
+		if now.After(orphan.expiration) {
+			otp.removeOrphan(orphan.tx.Hash())
+			expired++
+		}
+	}
+	if expired > 0 {
+		logging.CPrint(logging.DEBUG, "expired orphan transactions", logging.LogFormat{
+			"expired": expired,
+			"remains": otp.pool.Count(),
+		})
+	}
+}
 
-		var randNum [4]byte
-		if _, err := rand.Read(randNum[:]); err != nil {
-			return err
+// limitNumOrphans limits the number of orphan transactions by evicting a random
+// orphan if adding a new one would cause it to overflow the max allowed.  If
+// the peer would overflow the max allowed per peer, a random orphan from the
+// peer is evicted instead.
+//
+// This function MUST be called with the txPool lock held (for writes).
+func (otp *OrphanTxPool) limitNumOrphans(peerID string) error {
+	var ids []string
+	if peerOrphans := otp.peerOrphans[peerID]; peerID != "" && len(peerOrphans)+1 > otp.maxOrphansPerPeer {
+		ids = make([]string, 0, len(peerOrphans))
+		for hash := range peerOrphans {
+			ids = append(ids, hash.String())
 		}
+	} else if otp.pool.Count()+1 > otp.maxOrphanTransactions {
+		ids = otp.pool.IDs()
+	}
+	if len(ids) == 0 {
+		return nil
+	}
 
-		index := int(binary.LittleEndian.Uint32(randNum[:])) % len(ids)
+	var randNum [4]byte
+	if _, err := rand.Read(randNum[:]); err != nil {
+		return err
+	}
 
-		removeHash, err := wire.NewHashFromStr(ids[index])
-		if err != nil {
-			return err
-		}
-		otp.removeOrphan(removeHash)
+	index := int(binary.LittleEndian.Uint32(randNum[:])) % len(ids)
+
+	removeHash, err := wire.NewHashFromStr(ids[index])
+	if err != nil {
+		return err
 	}
+	otp.removeOrphan(removeHash)
 
 	return nil
 }
 
-func (otp *OrphanTxPool) addOrphan(tx *massutil.Tx) {
-	if err := otp.limitNumOrphans(); err != nil {
+// addOrphan adds the orphan transaction from the peer to the pool, peerID is
+// empty if the transaction does not come from a peer.
+//
+// This function MUST be called with the txPool lock held (for writes).
+func (otp *OrphanTxPool) addOrphan(tx *massutil.Tx, peerID string) {
+	otp.expireOrphans()
+	if err := otp.limitNumOrphans(peerID); err != nil {
 		logging.CPrint(logging.ERROR, "fail on limitNumOrphans", logging.LogFormat{"err": err, "txid": tx.Hash()})
 	}
 
@@ -95,15 +191,24 @@ func (otp *OrphanTxPool) addOrphan(tx *massutil.Tx) {
 		parents = append(parents, originTxHash.String())
 	}
 
-	otp.pool.Put(newOrphanTx(tx), parents)
+	otp.pool.Put(&orphanTx{
+		tx:         tx,
+		peerID:     peerID,
+		expiration: time.Now().Add(otp.orphanTTL),
+	}, parents)
+	if otp.peerOrphans[peerID] == nil {
+		otp.peerOrphans[peerID] = make(map[wire.Hash]struct{})
+	}
+	otp.peerOrphans[peerID][*tx.Hash()] = struct{}{}
 
 	logging.CPrint(logging.DEBUG, "stored orphan transaction", logging.LogFormat{
 		"orphan transaction":     tx.Hash(),
+		"peer":                   peerID,
 		"total orphan tx number": otp.pool.Count(),
 	})
 }
 
-func (otp *OrphanTxPool) maybeAddOrphan(tx *massutil.Tx) error {
+func (otp *OrphanTxPool) maybeAddOrphan(tx *massutil.Tx, peerID string) error {
 	serializedLen := tx.MsgTx().PlainSize()
 	if serializedLen > maxOrphanTxSize {
 		logging.CPrint(logging.WARN, "orphan transaction is larger than maximum allowed",
@@ -111,7 +216,7 @@ func (otp *OrphanTxPool) maybeAddOrphan(tx *massutil.Tx) error {
 		return ErrTxTooBig
 	}
 
-	otp.addOrphan(tx)
+	otp.addOrphan(tx, peerID)
 
 	return nil
 }
@@ -124,12 +229,12 @@ func (otp *OrphanTxPool) isOrphanInPool(hash *wire.Hash) bool {
 	return otp.pool.Has(hash.String())
 }
 
-func (otp *OrphanTxPool) getOrphansByPrevious(hash *wire.Hash) []*massutil.Tx {
+func (otp *OrphanTxPool) getOrphansByPrevious(hash *wire.Hash) []*orphanTx {
 	subs := otp.pool.ReadSubs(hash.String())
-	orphans := make([]*massutil.Tx, len(subs))
+	orphans := make([]*orphanTx, len(subs))
 
 	for i, sub := range subs {
-		orphans[i] = sub.(*orphanTx).Tx()
+		orphans[i] = sub.(*orphanTx)
 	}
 
 	return orphans
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/wire"
@@ -45,7 +46,7 @@ func TestAddOrphan(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		pool.addOrphan(massutil.NewTx(&test.tx))
+		pool.addOrphan(massutil.NewTx(&test.tx), "")
 		if i+1 >= pool.maxOrphanTransactions {
 			assert.Equal(t, pool.maxOrphanTransactions, pool.pool.Count())
 		} else {
@@ -69,7 +70,7 @@ func TestMaybeAddOrphan(t *testing.T) {
 	}
 
 	tx := massutil.NewTx(&msgtx)
-	err := pool.maybeAddOrphan(tx)
+	err := pool.maybeAddOrphan(tx, "")
 	assert.Equal(t, ErrTxTooBig, err)
 
 	pool.removeOrphan(tx.Hash())
@@ -100,7 +101,7 @@ func TestIsOrphanInPool(t *testing.T) {
 	}
 
 	tx := massutil.NewTx(&msgtx)
-	err := pool.maybeAddOrphan(tx)
+	err := pool.maybeAddOrphan(tx, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -110,3 +111,69 @@ func TestIsOrphanInPool(t *testing.T) {
 	exists = pool.isOrphanInPool(massutil.NewTx(&msgtx2).Hash())
 	assert.False(t, exists)
 }
+
+func TestOrphansByPeer(t *testing.T) {
+	pool := newOrphanTxPool()
+	pool.maxOrphansPerPeer = 2
+
+	newOrphan := func(lockTime uint64) *massutil.Tx {
+		return massutil.NewTx(&wire.MsgTx{
+			Version:  1,
+			TxIn:     []*wire.TxIn{wire.NewTxIn(&wire.OutPoint{Index: uint32(lockTime)}, nil)},
+			TxOut:    []*wire.TxOut{},
+			LockTime: lockTime,
+			Payload:  []byte{},
+		})
+	}
+
+	// orphans from a peer are capped
+	for i := uint64(0); i < 3; i++ {
+		pool.addOrphan(newOrphan(i), "peer1")
+	}
+	assert.Equal(t, 2, pool.pool.Count())
+	assert.Equal(t, 2, len(pool.peerOrphans["peer1"]))
+
+	// others are not affected
+	local := newOrphan(10)
+	pool.addOrphan(local, "")
+	pool.addOrphan(newOrphan(11), "")
+	pool.addOrphan(newOrphan(12), "")
+	pool.addOrphan(newOrphan(20), "peer2")
+	assert.Equal(t, 6, pool.pool.Count())
+
+	orphan, exists := pool.getOrphan(local.Hash())
+	assert.True(t, exists)
+	assert.Equal(t, "", orphan.peerID)
+
+	assert.Equal(t, 2, pool.removeOrphansByPeer("peer1"))
+	assert.Equal(t, 4, pool.pool.Count())
+	_, exists = pool.peerOrphans["peer1"]
+	assert.False(t, exists)
+	assert.Equal(t, 0, pool.removeOrphansByPeer("peer1"))
+
+	pool.removeOrphan(local.Hash())
+	assert.Equal(t, 2, len(pool.peerOrphans[""]))
+}
+
+func TestExpireOrphans(t *testing.T) {
+	pool := newOrphanTxPool()
+	pool.orphanTTL = -time.Second
+
+	for i := uint64(0); i < 3; i++ {
+		pool.addOrphan(massutil.NewTx(&wire.MsgTx{
+			Version:  1,
+			TxIn:     []*wire.TxIn{},
+			TxOut:    []*wire.TxOut{},
+			LockTime: i,
+			Payload:  []byte{},
+		}), "peer1")
+	}
+	// expired orphans stay until next scan
+	assert.Equal(t, 3, pool.pool.Count())
+
+	pool.nextExpireScan = time.Now()
+	pool.expireOrphans()
+	assert.Equal(t, 0, pool.pool.Count())
+	assert.Equal(t, 0, len(pool.peerOrphans))
+	assert.True(t, pool.nextExpireScan.After(time.Now()))
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/massutil"
@@ -208,7 +209,7 @@ func checkInputsStandard(tx *massutil.Tx, txStore TxStore) error {
 	return nil
 }
 
-func checkParsePkScriptNew(nextBlockHeight uint64, bindingState state.Trie,
+func checkParsePkScriptNew(params consensus.DeploymentChecker, nextBlockHeight uint64, bindingState state.Trie,
 	bindingExistInPool func([]byte) bool, txStore TxStore, txs ...*massutil.Tx) error {
 	// To simplify this check, we don't distinguish between old binding and new binding.
 	ensureTxInNoBinding := func(tx *massutil.Tx) error {
@@ -240,7 +241,7 @@ func checkParsePkScriptNew(nextBlockHeight uint64, bindingState state.Trie,
 		return nil
 	}
 
-	enforeIp2WarmUp := forks.EnforceMASSIP0002WarmUp(nextBlockHeight)
+	enforeIp2WarmUp := forks.EnforceMASSIP0002WarmUp(params, nextBlockHeight)
 
 	newBindingTargetCache := make(map[string]struct{})
 	networkBinding := massutil.ZeroAmount()
@@ -290,7 +291,7 @@ func checkParsePkScriptNew(nextBlockHeight uint64, bindingState state.Trie,
 								"tx":     tx.Hash(),
 								"output": j,
 							})
-							return ErrPlotPKAlreadyBound
+							return ErrBindingTargetInPool
 						}
 					}
 
@@ -307,7 +308,7 @@ func checkParsePkScriptNew(nextBlockHeight uint64, bindingState state.Trie,
 						logging.CPrint(logging.ERROR, "invalid bitlength", logging.LogFormat{"type": proofType, "size": proofSize})
 						return ErrInvalidBitLength
 					}
-					requiredBinding, err := forks.GetRequiredBinding(nextBlockHeight, poc.PlotSize(proofType, proofSize), -1, networkBinding)
+					requiredBinding, err := forks.GetRequiredBinding(params, nextBlockHeight, poc.PlotSize(proofType, proofSize), -1, networkBinding)
 					if err != nil {
 						logging.CPrint(logging.ERROR, "failed to get required binding price", logging.LogFormat{"err": err})
 						return err
@@ -464,7 +465,7 @@ func isDust(txOut *wire.TxOut, minRelayTxFee massutil.Amount) (bool, error) {
 // finalized, conforming to more stringent size constraints, having scripts
 // of recognized forms, and not containing "dust" outputs (those that are
 // so small it costs more to process them than they are worth).
-func checkTransactionStandard(bst state.Trie, tx *massutil.Tx, nextBlockHeight uint64, minRelayTxFee massutil.Amount, txStore TxStore, bindingExistInPool func([]byte) bool) error {
+func checkTransactionStandard(params consensus.DeploymentChecker, bst state.Trie, tx *massutil.Tx, nextBlockHeight uint64, minRelayTxFee massutil.Amount, txStore TxStore, bindingExistInPool func([]byte) bool) error {
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
 	if msgTx.Version > wire.TxVersion || msgTx.Version < 1 {
@@ -525,7 +526,7 @@ func checkTransactionStandard(bst state.Trie, tx *massutil.Tx, nextBlockHeight u
 		}
 	}
 
-	err := checkParsePkScriptNew(nextBlockHeight, bst, bindingExistInPool, txStore, tx)
+	err := checkParsePkScriptNew(params, nextBlockHeight, bst, bindingExistInPool, txStore, tx)
 	if err != nil {
 		// Attempt to extract a reject code from the error so
 		// it can be retained.  When not possible, fall back to
@@ -832,7 +832,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 
 		t.Run(test.name, func(t *testing.T) {
 			// Ensure standardness is as expected.
-			err := checkTransactionStandard(trie, massutil.NewTx(&test.tx),
+			err := checkTransactionStandard(&config.ChainParams, trie, massutil.NewTx(&test.tx),
 				test.height, massutil.MinRelayTxFee(), txStore, nil)
 			assert.Equal(t, test.err, err)
 		})
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/massutil"
@@ -35,6 +36,9 @@ func (chain *Blockchain) maybeAcceptBlock(block *massutil.Block, flags BehaviorF
 			})
 		return fmt.Errorf("prev node not found")
 	}
+	if _, ok := chain.invalidBlocks[*block.Hash()]; ok || prevNode.Invalid {
+		return ErrInvalidatedBlock
+	}
 
 	// // The height of this block is one more than the referenced previous
 	// // block.
@@ -61,7 +65,7 @@ func (chain *Blockchain) maybeAcceptBlock(block *massutil.Block, flags BehaviorF
 	// 	return chain.checkConnectBlock(NewBlockNode(blockHeader, nil, BFNoPoCCheck), block)
 	// }
 
-	newNode := NewBlockNode(blockHeader, block.Hash(), BFNone)
+	newNode := NewBlockNode(chain.deploymentsAt(prevNode), blockHeader, block.Hash(), BFNone)
 	newNode.Parent = prevNode
 
 	// Connect the passed block to the chain while respecting proper chain
@@ -75,6 +79,13 @@ func (chain *Blockchain) maybeAcceptBlock(block *massutil.Block, flags BehaviorF
 	return nil
 }
 
+// cacheableBlockError returns whether a block rejected by err is always
+// rejected.  Blocks that are too new, invalidated or too deep to reorganize
+// to might be accepted later.
+func cacheableBlockError(err error) bool {
+	return err != ErrTimeTooNew && err != ErrInvalidatedBlock && err != ErrReorgTooDeep
+}
+
 func (chain *Blockchain) processOrphans(hash *wire.Hash, flags BehaviorFlags) error {
 	for _, orphan := range chain.blockTree.orphanBlockPool.getOrphansByPrevious(hash) {
 		logging.CPrint(logging.INFO, "process orphan",
@@ -83,12 +94,24 @@ func (chain *Blockchain) processOrphans(hash *wire.Hash, flags BehaviorFlags) er
 				"child_hash":   orphan.block.Hash(),
 				"child_height": orphan.block.Height(),
 			})
-		if err := chain.maybeAcceptBlock(orphan.block, BFNone); err != nil {
+		// Orphans were checked by height, check them again against the
+		// deployments of the chain they extend.
+		deployments, err := chain.sanityDeployments(orphan.block)
+		if err == nil {
+			err = checkBlockSanity(deployments, orphan.block, chain.info.chainID, chain.chainParams.PocLimit, BFNone)
+		}
+		if err != nil {
 			if err != ErrTimeTooNew {
 				chain.errCache.Add(orphan.block.Hash().String(), err)
 			}
 			return err
 		}
+		if err := chain.maybeAcceptBlock(orphan.block, BFNone); err != nil {
+			if cacheableBlockError(err) {
+				chain.errCache.Add(orphan.block.Hash().String(), err)
+			}
+			return err
+		}
 
 		chain.blockTree.orphanBlockPool.removeOrphanBlock(orphan)
 
@@ -100,6 +123,20 @@ func (chain *Blockchain) processOrphans(hash *wire.Hash, flags BehaviorFlags) er
 	return nil
 }
 
+// sanityDeployments returns the deployments block is checked for sanity with,
+// which are the ones of the chain it extends, or the ones by height if its
+// parent is unknown.
+func (chain *Blockchain) sanityDeployments(block *massutil.Block) (consensus.DeploymentChecker, error) {
+	if !chain.blockExists(&block.MsgBlock().Header.Previous) {
+		return chain.chainParams, nil
+	}
+	prevNode, err := chain.getPrevNodeFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return chain.deploymentsAt(prevNode), nil
+}
+
 // for importchain
 func (chain *Blockchain) InsertChain(block *massutil.Block) (isOrphan bool, err error) {
 	return chain.processBlock(block, BFNone)
@@ -155,7 +192,11 @@ func (chain *Blockchain) processBlock(block *massutil.Block, flags BehaviorFlags
 	}
 
 	// Perform preliminary sanity checks on the block and its transactions.
-	err = checkBlockSanity(block, chain.info.chainID, chain.chainParams.PocLimit, flags)
+	deployments, err := chain.sanityDeployments(block)
+	if err != nil {
+		return false, err
+	}
+	err = checkBlockSanity(deployments, block, chain.info.chainID, chain.chainParams.PocLimit, flags)
 	if err != nil {
 		if err != ErrTimeTooNew {
 			chain.errCache.Add(blockHash.String(), err)
@@ -198,7 +239,7 @@ func (chain *Blockchain) processBlock(block *massutil.Block, flags BehaviorFlags
 	// The block has passed all context independent checks and appears sane
 	// enough to potentially accept it into the block chain.
 	if err := chain.maybeAcceptBlock(block, flags); err != nil {
-		if err != ErrTimeTooNew {
+		if cacheableBlockError(err) {
 			chain.errCache.Add(blockHash.String(), err)
 		}
 		return false, err
@@ -229,7 +270,7 @@ func (chain *Blockchain) checkConnectBlockTemplate(block *massutil.Block, flags
 			"instead got %v", tip.Hash, block.MsgBlock().Header.Previous)
 	}
 
-	err := checkBlockSanity(block, chain.info.chainID, chain.chainParams.PocLimit, flags)
+	err := checkBlockSanity(chain.deploymentsAt(tip), block, chain.info.chainID, chain.chainParams.PocLimit, flags)
 	if err != nil {
 		logging.CPrint(logging.ERROR, "checkBlockSanity failed for block template", logging.LogFormat{"err": err, "height": block.Height()})
 		return err
@@ -250,12 +291,14 @@ func (chain *Blockchain) checkConnectBlockTemplate(block *massutil.Block, flags
 	// Create a new block node for the block and add it to the in-memory
 	// block chain (could be either a side chain or the main chain).
 	blockHeader := &block.MsgBlock().Header
-	node := NewBlockNode(blockHeader, nil, BFNoPoCCheck)
-	if node.Parent, err = chain.getPrevNodeFromBlock(block); err != nil {
+	parent, err := chain.getPrevNodeFromBlock(block)
+	if err != nil {
 		logging.CPrint(logging.ERROR, "failed to load parent node for block template", logging.LogFormat{"err": err, "height": block.Height()})
 		return err
 	}
-	if forks.EnforceMASSIP0002WarmUp(block.Height()) {
+	node := NewBlockNode(chain.deploymentsAt(parent), blockHeader, nil, BFNoPoCCheck)
+	node.Parent = parent
+	if node.enforceBinding {
 		txInputStore, err := chain.fetchInputTransactions(node, block)
 		if err != nil {
 			logging.CPrint(logging.ERROR, "failed to load inputs for block template", logging.LogFormat{"err": err, "height": block.Height()})
@@ -326,7 +369,7 @@ func (chain *Blockchain) buildBlockTemplateBindingRoot(parent *BlockNode, newBlo
 
 				prevTx := prevTxData.Tx.MsgTx()
 
-				if !forks.EnforceMASSIP0002WarmUp(prevTxData.BlockHeight) {
+				if !forks.EnforceMASSIP0002WarmUp(chain, prevTxData.BlockHeight) {
 					continue
 				}
 
@@ -0,0 +1,287 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/consensus/challenge"
+	"github.com/massnetorg/mass-core/consensus/forks"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/poc"
+	"github.com/massnetorg/mass-core/poc/pocutil"
+	"github.com/massnetorg/mass-core/pocec"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// regtestBitLength is the bit length of the plots used by GenerateBlocks, the
+// smallest one allowed for a DefaultProof.
+const regtestBitLength = poc.MinValidDefaultBitLength
+
+// regtestPlots are the in-memory plots used by GenerateBlocks, they are shared
+// by all chains since plotting is expensive.
+var regtestPlots = &memPlots{}
+
+// regtestKey returns the i-th deterministic PoC key of the regression test
+// network.
+func regtestKey(i int) *pocec.PrivateKey {
+	seed := sha256.Sum256([]byte(fmt.Sprintf("mass regtest poc key %d", i)))
+	key, _ := pocec.PrivKeyFromBytes(pocec.S256(), seed[:])
+	return key
+}
+
+// memPlot is a plot of DefaultProof kept in memory.  It has a proof for about
+// 63% of the challenges.
+type memPlot struct {
+	key        *pocec.PrivateKey
+	pubKeyHash pocutil.Hash
+	bl         int
+	xByY       []uint32 // x+1 indexed by P(x), zero if none
+	xByZ       []uint32 // x+1 indexed by F(x, x'), zero if none
+}
+
+func newMemPlot(key *pocec.PrivateKey, bl int) *memPlot {
+	start := time.Now()
+	pubKeyHash := pocutil.PubKeyHash(key.PubKey())
+	size := 1 << uint(bl)
+	p := &memPlot{
+		key:        key,
+		pubKeyHash: pubKeyHash,
+		bl:         bl,
+		xByY:       make([]uint32, size),
+		xByZ:       make([]uint32, size),
+	}
+
+	// values[x] is P(x) at first, then F(x, x') or size if x has no x'.
+	values := make([]uint32, size)
+	parallelRange(size, func(x int) {
+		values[x] = uint32(pocutil.P(pocutil.PoCValue(x), bl, pubKeyHash))
+	})
+	for x, y := range values {
+		p.xByY[y] = uint32(x) + 1
+	}
+	parallelRange(size, func(x int) {
+		xp := p.xByY[pocutil.FlipValue(pocutil.PoCValue(values[x]), bl)]
+		if xp == 0 {
+			values[x] = uint32(size)
+			return
+		}
+		values[x] = uint32(pocutil.F(pocutil.PoCValue(x), pocutil.PoCValue(xp-1), bl, pubKeyHash))
+	})
+	for x, z := range values {
+		if z != uint32(size) {
+			p.xByZ[z] = uint32(x) + 1
+		}
+	}
+
+	logging.CPrint(logging.DEBUG, "created in-memory plot", logging.LogFormat{
+		"pubKeyHash": pubKeyHash,
+		"bl":         bl,
+		"elapsed":    time.Since(start),
+	})
+	return p
+}
+
+// parallelRange calls fn for each integer in [0, n) on all CPUs.
+func parallelRange(n int, fn func(i int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			for i := from; i < to; i++ {
+				fn(i)
+			}
+		}(n*w/workers, n*(w+1)/workers)
+	}
+	wg.Wait()
+}
+
+// prove returns the proof for challenge, or nil if the plot has none.
+func (p *memPlot) prove(challenge wire.Hash) *poc.DefaultProof {
+	z := pocutil.CutHash(pocutil.Hash(challenge), p.bl)
+	x := p.xByZ[z]
+	if x == 0 {
+		return nil
+	}
+	y := pocutil.P(pocutil.PoCValue(x-1), p.bl, p.pubKeyHash)
+	xp := p.xByY[pocutil.FlipValue(y, p.bl)]
+	return poc.NewDefaultProof(pocutil.PoCValue2Bytes(pocutil.PoCValue(x-1), p.bl),
+		pocutil.PoCValue2Bytes(pocutil.PoCValue(xp-1), p.bl), p.bl)
+}
+
+// memPlots are the in-memory plots of the regtest keys, a plot is added for
+// the next key when no plot has a proof for a challenge.
+type memPlots struct {
+	sync.Mutex
+	plots []*memPlot
+}
+
+// prove returns a plot and its proof for challenge, plotting more keys if
+// necessary.
+func (m *memPlots) prove(challenge wire.Hash) (*memPlot, *poc.DefaultProof) {
+	m.Lock()
+	defer m.Unlock()
+	for i := 0; ; i++ {
+		if i == len(m.plots) {
+			m.plots = append(m.plots, newMemPlot(regtestKey(i), regtestBitLength))
+		}
+		if proof := m.plots[i].prove(challenge); proof != nil {
+			return m.plots[i], proof
+		}
+	}
+}
+
+// canProve returns whether any existing plot has a proof for challenge.
+func (m *memPlots) canProve(challenge wire.Hash) bool {
+	m.Lock()
+	defer m.Unlock()
+	for _, p := range m.plots {
+		if p.xByZ[pocutil.CutHash(pocutil.Hash(challenge), p.bl)] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// memPlotProof implements Proof for a proof of memPlot.
+type memPlotProof struct {
+	pubKey *pocec.PublicKey
+	proof  *poc.DefaultProof
+}
+
+func (p *memPlotProof) PlotPublicKey() []byte {
+	return p.pubKey.SerializeCompressed()
+}
+
+func (p *memPlotProof) ProofType() poc.ProofType {
+	return poc.ProofTypeDefault
+}
+
+func (p *memPlotProof) ProofBitLength() int {
+	return p.proof.BL
+}
+
+func (p *memPlotProof) ChiaPoolPublicKey() []byte {
+	return nil
+}
+
+func (p *memPlotProof) ChiaPlotID() [32]byte {
+	return [32]byte{}
+}
+
+// GenerateBlocks mines n blocks on top of the best chain paying to payout,
+// and returns their hashes.  It is only available on the regression test
+// network.
+//
+// Each block is built from a template of NewBlockTemplate, solved with a
+// DefaultProof of deterministic in-memory keys and submitted by ProcessBlock.
+// Plotting a key takes seconds and hundreds of MB of memory, it is done
+// once for the first block and later only if no existing plot can solve a
+// challenge.
+func (chain *Blockchain) GenerateBlocks(n int, payout massutil.Address) ([]*wire.Hash, error) {
+	if chain.chainParams.Name != config.RegressionNetParams.Name {
+		return nil, errNotRegressionNet
+	}
+	hashes := make([]*wire.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		block, err := chain.generateBlock(payout)
+		if err != nil {
+			return hashes, err
+		}
+		isOrphan, err := chain.ProcessBlock(block)
+		if err != nil {
+			return hashes, err
+		}
+		if isOrphan {
+			return hashes, fmt.Errorf("generated block %s is an orphan", block.Hash())
+		}
+		hashes = append(hashes, block.Hash())
+	}
+	return hashes, nil
+}
+
+// generateBlock builds a block template and solves it.
+func (chain *Blockchain) generateBlock(payout massutil.Address) (*massutil.Block, error) {
+	templateCh := make(chan interface{}, 2)
+	if err := chain.NewBlockTemplate([]massutil.Address{payout}, templateCh); err != nil {
+		return nil, err
+	}
+	pocTemplate := (<-templateCh).(*PoCTemplate)
+	if pocTemplate.Err != nil {
+		return nil, pocTemplate.Err
+	}
+	blockTemplate := (<-templateCh).(*BlockTemplate)
+	if blockTemplate.Err != nil {
+		return nil, blockTemplate.Err
+	}
+
+	plot, proof := regtestPlots.prove(pocTemplate.Challenge)
+	plotProof := &memPlotProof{pubKey: plot.key.PubKey(), proof: proof}
+	if !pocTemplate.PassBinding(plotProof) {
+		return nil, fmt.Errorf("regtest plot %x is not bound", plotProof.PlotPublicKey())
+	}
+	coinbase, err := pocTemplate.GetCoinbase(plotProof, blockTemplate.TotalFee)
+	if err != nil {
+		return nil, err
+	}
+
+	msgBlock := blockTemplate.Block
+	msgBlock.Transactions[0] = coinbase.MsgTx()
+	merkles := wire.BuildMerkleTreeStoreTransactions(msgBlock.Transactions, false)
+	witnessMerkles := wire.BuildMerkleTreeStoreTransactions(msgBlock.Transactions, true)
+
+	header := &msgBlock.Header
+	header.TransactionRoot = *merkles[len(merkles)-1]
+	header.WitnessRoot = *witnessMerkles[len(witnessMerkles)-1]
+	header.Challenge = pocTemplate.Challenge
+	header.PubKey = plot.key.PubKey()
+	header.Proof = proof
+	header.Timestamp = pocTemplate.Timestamp
+	for {
+		header.Target = pocTemplate.GetTarget(header.Timestamp)
+		slot := uint64(header.Timestamp.Unix()) / poc.PoCSlot
+		solved := proof.QualityAt(slot, header.Height, forks.EnforceMASSIP0002(chain, header.Height)).Cmp(header.Target) >= 0
+		if solved {
+			if err = signBlockHeader(header, plot.key); err != nil {
+				return nil, err
+			}
+			// The challenges of the first blocks are derived from the
+			// hash of their parents, prefer a block whose next challenge
+			// can be solved without plotting another key.
+			hash := header.BlockHash()
+			next := wire.HashH(hash.Bytes())
+			if header.Height >= challenge.ChallengeInterval || regtestPlots.canProve(next) {
+				break
+			}
+		}
+		if !header.Timestamp.Add(poc.PoCSlot * time.Second).Before(time.Now()) {
+			if !solved {
+				return nil, ErrLowQuality
+			}
+			break
+		}
+		header.Timestamp = header.Timestamp.Add(poc.PoCSlot * time.Second)
+	}
+	return massutil.NewBlock(msgBlock), nil
+}
+
+// signBlockHeader signs header with key.
+func signBlockHeader(header *wire.BlockHeader, key *pocec.PrivateKey) error {
+	pocHash, err := header.PoCHash()
+	if err != nil {
+		return err
+	}
+	data := wire.HashH(pocHash[:])
+	sig, err := key.Sign(data[:])
+	if err != nil {
+		return err
+	}
+	header.Signature = sig
+	return nil
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/database/memdb"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/trie/rawdb"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegtestChain(t *testing.T, params *config.Params) (*Blockchain, func()) {
+	db, err := memdb.NewMemDb()
+	require.NoError(t, err)
+	teardown, err := mkTmpDir(dbpath)
+	require.NoError(t, err)
+	bindingDb, err := rawdb.NewLevelDBDatabase(filepath.Join(dbpath, "bindingstate"), 0, 0, "", false)
+	require.NoError(t, err)
+
+	bc, err := NewBlockchain(&Config{
+		DB:             db,
+		StateBindingDb: state.NewDatabase(bindingDb),
+		ChainParams:    params,
+		CachePath:      filepath.Join(dbpath, BlockCacheFileName),
+	})
+	require.NoError(t, err)
+	require.Equal(t, params.GenesisHash, bc.BestBlockHash())
+	return bc, func() {
+		bindingDb.Close()
+		teardown()
+		db.Close()
+	}
+}
+
+func TestGenerateBlocks(t *testing.T) {
+	bc, closeChain := newRegtestChain(t, &config.RegressionNetParams)
+	defer closeChain()
+
+	payout, err := massutil.NewAddressWitnessScriptHash(make([]byte, 32), &config.RegressionNetParams)
+	require.NoError(t, err)
+	hashes, err := bc.GenerateBlocks(5, payout)
+	require.NoError(t, err)
+	require.Len(t, hashes, 5)
+	require.Equal(t, uint64(5), bc.BestBlockHeight())
+	require.Equal(t, hashes[4], bc.BestBlockHash())
+	for i, hash := range hashes {
+		block, err := bc.GetBlockByHash(hash)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), block.Height())
+		require.NoError(t, checkProofOfCapacity(&config.RegressionNetParams, &block.MsgBlock().Header, config.RegressionNetParams.PocLimit))
+	}
+
+	// only available on the regression test network
+	_, err = (&Blockchain{chainParams: &config.ChainParams}).GenerateBlocks(1, payout)
+	require.Equal(t, errNotRegressionNet, err)
+}
+
+func TestGenerateBlocksMASSIP0002(t *testing.T) {
+	params := config.NewRegressionNetParams(3)
+	require.False(t, config.RegressionNetParams.IsActive(consensus.DeploymentMASSIP0002, 3))
+	require.True(t, params.IsActive(consensus.DeploymentMASSIP0002, 3))
+
+	bc, closeChain := newRegtestChain(t, params)
+	defer closeChain()
+	payout, err := massutil.NewAddressWitnessScriptHash(make([]byte, 32), params)
+	require.NoError(t, err)
+
+	// minting requires the plot to be bound once MASSIP0002 is active
+	hashes, err := bc.GenerateBlocks(5, payout)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not bound")
+	require.Len(t, hashes, 2)
+	require.Equal(t, uint64(2), bc.BestBlockHeight())
+}
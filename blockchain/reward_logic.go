@@ -14,17 +14,19 @@ var (
 	baseSubsidy                = safetype.NewUint128FromUint(consensus.BaseSubsidy)
 	minHalvedSubsidy           = safetype.NewUint128FromUint(consensus.MinHalvedSubsidy)     //0.0625
 	minHalvedSubsidyForMASSIP2 = safetype.NewUint128FromUint(consensus.MinHalvedSubsidy * 4) // 0.25
-
-	fakeMASSIP2SubsidyStartHeight = uint64(0)
 )
 
-func init() {
-	if consensus.MASSIP0002Height > 846720 && consensus.MASSIP0002Height <= 1706880 { // mainnet, period 7
-		height := consensus.MASSIP0002Height - 846720   // 846720 is last block of period 6
-		height *= 215040                                // 215040 is total blocks in period 5
-		height /= 860160                                // 860160 is total blocks in period 7
-		fakeMASSIP2SubsidyStartHeight = 201601 + height // 201601 is start block of period 5
-	}
+// calcFakeMASSIP2SubsidyStartHeight returns the height the subsidy schedule
+// restarts from at the activation height of MASSIP0002, or zero if it does
+// not restart.
+func calcFakeMASSIP2SubsidyStartHeight(ip2Height uint64) uint64 {
+	if ip2Height > 846720 && ip2Height <= 1706880 { // mainnet, period 7
+		height := ip2Height - 846720 // 846720 is last block of period 6
+		height *= 215040             // 215040 is total blocks in period 5
+		height /= 860160             // 860160 is total blocks in period 7
+		return 201601 + height       // 201601 is start block of period 5
+	}
+	return 0
 }
 
 // CalcBlockSubsidy returns the subsidy amount a block at the provided height
@@ -38,9 +40,9 @@ func init() {
 // At the Target block generation rate for the main network, this is
 // approximately every 4 years.
 func CalcBlockSubsidy(height uint64, chainParams *config.Params, hasValidBinding, hasStaking bool) (miner, superNode massutil.Amount, err error) {
-	if !forks.EnforceMASSIP0002(height) {
+	if !forks.EnforceMASSIP0002(chainParams, height) {
 		hasGameReward := true
-		if forks.EnforceMASSIP0002WarmUp(height) {
+		if forks.EnforceMASSIP0002WarmUp(chainParams, height) {
 			hasValidBinding = false
 			hasGameReward = false
 		}
@@ -156,12 +158,14 @@ func calcBlockSubsidy(height uint64, chainParams *config.Params, hasStaking bool
 
 	subsidy := baseSubsidy
 	if chainParams.SubsidyHalvingInterval != 0 {
-		if fakeMASSIP2SubsidyStartHeight != 0 {
+		// only called once MASSIP0002 is active, which requires its deployment
+		ip2Height := chainParams.Deployment(consensus.DeploymentMASSIP0002).Height
+		if fakeMASSIP2SubsidyStartHeight := calcFakeMASSIP2SubsidyStartHeight(ip2Height); fakeMASSIP2SubsidyStartHeight != 0 {
 			// for mainnet
-			if height < consensus.MASSIP0002Height {
+			if height < ip2Height {
 				return massutil.ZeroAmount(), massutil.ZeroAmount(), fmt.Errorf("unexpected height in calcBlockSubsidy")
 			}
-			height = fakeMASSIP2SubsidyStartHeight + height - consensus.MASSIP0002Height
+			height = fakeMASSIP2SubsidyStartHeight + height - ip2Height
 		}
 		n := calcRshNumBeforeIp2(height)
 		subsidy = baseSubsidy.Rsh(n)
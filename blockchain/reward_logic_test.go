@@ -137,6 +137,8 @@ func TestMASSIP2CalcBlockSubsidy(t *testing.T) {
 	amount22500000, _ := massutil.NewAmountFromInt(22500000)
 	amount2500000, _ := massutil.NewAmountFromInt(2500000)
 
+	ip2Height := config.ChainParams.Deployment(consensus.DeploymentMASSIP0002).Height
+	fakeMASSIP2SubsidyStartHeight := calcFakeMASSIP2SubsidyStartHeight(ip2Height)
 	assert.True(t, fakeMASSIP2SubsidyStartHeight == uint64(341121), fakeMASSIP2SubsidyStartHeight)
 
 	tests := []struct {
@@ -149,54 +151,54 @@ func TestMASSIP2CalcBlockSubsidy(t *testing.T) {
 	}{
 		{
 			name:      "fork start - 1",
-			height:    uint64(consensus.MASSIP0002Height - 1),
+			height:    uint64(ip2Height - 1),
 			expectErr: "unexpected height in calcBlockSubsidy",
 		},
 		{
 			name:      "fork start",
-			height:    uint64(consensus.MASSIP0002Height),
+			height:    uint64(ip2Height),
 			numRank:   0,
 			miner:     amount5760000000, // 90%
 			superNode: amount0,          // 0%
 		},
 		{
 			name:      "fake period 5 end",
-			height:    uint64(consensus.MASSIP0002Height + 416640 - fakeMASSIP2SubsidyStartHeight), // 416640 is last block of period 5
+			height:    uint64(ip2Height + 416640 - fakeMASSIP2SubsidyStartHeight), // 416640 is last block of period 5
 			numRank:   0,
 			miner:     amount5760000000, // 90%
 			superNode: amount0,          // 0%
 		},
 		{
 			name:      "after fake period 5 end",
-			height:    uint64(consensus.MASSIP0002Height + 416640 - fakeMASSIP2SubsidyStartHeight + 1),
+			height:    uint64(ip2Height + 416640 - fakeMASSIP2SubsidyStartHeight + 1),
 			numRank:   0,
 			miner:     amount2880000000, // 90%
 			superNode: amount0,          // 0%
 		},
 		{
 			name:      "fake period 12 end with staking",
-			height:    uint64(consensus.MASSIP0002Height + 55036800 - fakeMASSIP2SubsidyStartHeight), // 55036800 is last block of period 12
+			height:    uint64(ip2Height + 55036800 - fakeMASSIP2SubsidyStartHeight), // 55036800 is last block of period 12
 			numRank:   1,
 			miner:     amount45000000, // 90%
 			superNode: amount5000000,  // 10%
 		},
 		{
 			name:      "fake period 13 end",
-			height:    uint64(consensus.MASSIP0002Height + 110087040 - fakeMASSIP2SubsidyStartHeight), // 110087040 is last block of period 13
+			height:    uint64(ip2Height + 110087040 - fakeMASSIP2SubsidyStartHeight), // 110087040 is last block of period 13
 			numRank:   0,
 			miner:     amount22500000, // 90%
 			superNode: amount0,        // 0%
 		},
 		{
 			name:      "fake period 13 end with staking",
-			height:    uint64(consensus.MASSIP0002Height + 110087040 - fakeMASSIP2SubsidyStartHeight),
+			height:    uint64(ip2Height + 110087040 - fakeMASSIP2SubsidyStartHeight),
 			numRank:   1,
 			miner:     amount22500000, // 90%
 			superNode: amount2500000,  // 10%
 		},
 		{
 			name:      "after fake period 13 end",
-			height:    uint64(consensus.MASSIP0002Height + 110087040 - fakeMASSIP2SubsidyStartHeight + 1),
+			height:    uint64(ip2Height + 110087040 - fakeMASSIP2SubsidyStartHeight + 1),
 			numRank:   0,
 			miner:     amount0,
 			superNode: amount0,
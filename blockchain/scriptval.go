@@ -4,6 +4,7 @@ import (
 	"math"
 	"runtime"
 
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/consensus/forks"
 	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/massutil"
@@ -30,6 +31,7 @@ type txValidator struct {
 	flags        txscript.ScriptFlags
 	sigCache     *txscript.SigCache
 	hashCache    *txscript.HashCache
+	params       consensus.DeploymentChecker
 }
 
 // sendResult sends the result of a script pair validation on the internal
@@ -90,7 +92,7 @@ out:
 			inputAmount := originMsgTx.TxOut[originTxIndex].Value
 
 			scriptFlags := v.flags
-			if forks.EnforceMASSIP0002WarmUp(originTx.BlockHeight) {
+			if forks.EnforceMASSIP0002WarmUp(v.params, originTx.BlockHeight) {
 				scriptFlags |= txscript.ScriptMASSip2
 			}
 			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
@@ -181,8 +183,9 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 }
 
 // newTxValidator returns a new instance of txValidator to be used for
-// validating transaction scripts asynchronously.
-func newTxValidator(txStore TxStore, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
+// validating transaction scripts asynchronously.  The script flags of each
+// input follow the deployments of params.
+func newTxValidator(params consensus.DeploymentChecker, txStore TxStore, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
 	return &txValidator{
 		validateChan: make(chan *txValidateItem),
 		quitChan:     make(chan struct{}),
@@ -191,6 +194,7 @@ func newTxValidator(txStore TxStore, flags txscript.ScriptFlags, sigCache *txscr
 		sigCache:     sigCache,
 		hashCache:    hashCache,
 		flags:        flags,
+		params:       params,
 	}
 }
 
@@ -228,7 +232,7 @@ func ValidateTransactionScripts(bc *Blockchain, tx *massutil.Tx, txStore TxStore
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(txStore, flags, sigCache, hashCache)
+	validator := newTxValidator(bc, txStore, flags, sigCache, hashCache)
 	if err := validator.Validate(txValItems); err != nil {
 		return err
 	}
@@ -238,7 +242,7 @@ func ValidateTransactionScripts(bc *Blockchain, tx *massutil.Tx, txStore TxStore
 
 // checkBlockScripts executes and validates the scripts for all transactions in
 // the passed block.
-func checkBlockScripts(block *massutil.Block, txStore TxStore,
+func checkBlockScripts(params consensus.DeploymentChecker, block *massutil.Block, txStore TxStore,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) error {
 
 	// Collect all of the transaction inputs and required information for
@@ -287,7 +291,7 @@ func checkBlockScripts(block *massutil.Block, txStore TxStore,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(txStore, scriptFlags, sigCache, hashCache)
+	validator := newTxValidator(params, txStore, scriptFlags, sigCache, hashCache)
 	//start := time.Now()
 	if err := validator.Validate(txValItems); err != nil {
 		return err
@@ -0,0 +1,25 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+)
+
+// VerifyBindingProof verifies the Merkle proof of the binding info of script
+// against the binding root, it returns nil BindingInfo if the proof proves
+// that script is not bound.
+func VerifyBindingProof(root common.Hash, script []byte, proof [][]byte) (*BindingInfo, error) {
+	data, err := trie.VerifyProof(root, script, trie.ProofList(proof).Store())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) != 8 {
+		return nil, fmt.Errorf("invalid binding info length %d", len(data))
+	}
+	return DecodeBindingInfo(data), nil
+}
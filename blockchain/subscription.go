@@ -0,0 +1,326 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+const (
+	// subscriptionReplayBatch is the number of historic blocks read from
+	// database while holding the chain lock.
+	subscriptionReplayBatch = 100
+
+	// defaultSubscriptionBuffer is the default size of Events channel.
+	defaultSubscriptionBuffer = 64
+)
+
+// Cursor identifies the last main chain block a subscriber has processed.
+// It can be persisted and later passed to SubscribeFromCursor to resume.
+type Cursor struct {
+	Height uint64
+	Hash   wire.Hash
+}
+
+// SubscriptionEventType is the type of a SubscriptionEvent.
+type SubscriptionEventType int
+
+const (
+	// EventBlockConnected means Block is connected to the main chain.
+	EventBlockConnected SubscriptionEventType = iota
+
+	// EventBlockDisconnected means Block is removed from the main chain.
+	EventBlockDisconnected
+)
+
+// SubscriptionEvent is a connected or disconnected block delivered by a
+// Subscription, Cursor is the position after applying the event.
+type SubscriptionEvent struct {
+	Type   SubscriptionEventType
+	Block  *wire.MsgBlock
+	Cursor Cursor
+}
+
+// Subscription delivers historic main chain blocks replayed from database,
+// followed by live block events, in order and without gaps or duplicates.
+type Subscription struct {
+	chain       *Blockchain
+	cursor      Cursor
+	fromGenesis bool // cursor is not set, replay from genesis
+	events      chan *SubscriptionEvent
+	quit        chan struct{}
+
+	mtx        sync.Mutex
+	cond       *sync.Cond
+	closed     bool
+	registered bool
+	pending    []*SubscriptionEvent // live events received but not delivered
+	err        error
+}
+
+// SubscribeFromHeight returns a Subscription that delivers main chain blocks
+// starting from height, which must be no greater than best height + 1.
+func (chain *Blockchain) SubscribeFromHeight(height uint64) (*Subscription, error) {
+	if height == 0 {
+		return chain.subscribe(Cursor{}, true), nil
+	}
+
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+
+	if height > chain.blockTree.bestBlockNode().Height+1 {
+		return nil, ErrSubscribeHeight
+	}
+	hash, err := chain.db.FetchBlockShaByHeight(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	return chain.subscribe(Cursor{Height: height - 1, Hash: *hash}, false), nil
+}
+
+// SubscribeFromCursor returns a Subscription that delivers main chain blocks
+// after cursor. If cursor is no longer on the main chain, blocks down to the
+// fork point are delivered as disconnected first.
+func (chain *Blockchain) SubscribeFromCursor(cursor Cursor) (*Subscription, error) {
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+
+	if hash, err := chain.db.FetchBlockShaByHeight(cursor.Height); err == nil && hash.IsEqual(&cursor.Hash) {
+		return chain.subscribe(cursor, false), nil
+	}
+	// side chain block
+	block, err := chain.blockCache.getBlock(&cursor.Hash)
+	if err != nil || block.Height() != cursor.Height {
+		return nil, ErrUnknownCursor
+	}
+	return chain.subscribe(cursor, false), nil
+}
+
+func (chain *Blockchain) subscribe(cursor Cursor, fromGenesis bool) *Subscription {
+	sub := &Subscription{
+		chain:       chain,
+		cursor:      cursor,
+		fromGenesis: fromGenesis,
+		events:      make(chan *SubscriptionEvent, defaultSubscriptionBuffer),
+		quit:        make(chan struct{}),
+	}
+	sub.cond = sync.NewCond(&sub.mtx)
+	go sub.run()
+	return sub
+}
+
+// Events returns the channel on which events are delivered. It is closed
+// when the subscription is closed or fails, see Err.
+func (sub *Subscription) Events() <-chan *SubscriptionEvent {
+	return sub.events
+}
+
+// Err returns the error that stopped the subscription, if any.
+func (sub *Subscription) Err() error {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	return sub.err
+}
+
+// Close stops the subscription.
+func (sub *Subscription) Close() {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.quit)
+	sub.unregister()
+	sub.cond.Broadcast()
+}
+
+// register registers subscription for live events in queue order.
+//
+// This function MUST be called with the subscription lock held.
+func (sub *Subscription) register() {
+	if !sub.closed && !sub.registered {
+		sub.chain.notifier.send(&notification{typ: ntfnRegister, listener: sub})
+		sub.registered = true
+	}
+}
+
+// unregister unregisters subscription in queue order, so that it is never
+// left registered by a previously queued ntfnRegister.
+//
+// This function MUST be called with the subscription lock held.
+func (sub *Subscription) unregister() {
+	if sub.registered {
+		sub.chain.notifier.send(&notification{typ: ntfnUnregister, listener: sub})
+		sub.registered = false
+	}
+}
+
+func (sub *Subscription) run() {
+	defer close(sub.events)
+
+	if err := sub.replay(); err != nil {
+		sub.fail(err)
+		return
+	}
+
+	for {
+		sub.mtx.Lock()
+		for len(sub.pending) == 0 && !sub.closed {
+			sub.cond.Wait()
+		}
+		if sub.closed {
+			sub.mtx.Unlock()
+			return
+		}
+		batch := sub.pending
+		sub.pending = nil
+		sub.mtx.Unlock()
+
+		for _, event := range batch {
+			if !sub.deliver(event) {
+				return
+			}
+		}
+	}
+}
+
+// replay delivers blocks from database until it reaches the best block, and
+// then registers the subscription for live events while holding the chain
+// lock, so that no event is missed or delivered twice.
+func (sub *Subscription) replay() error {
+	for {
+		events, done, err := sub.nextReplayBatch()
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if !sub.deliver(event) {
+				return nil
+			}
+		}
+		if done {
+			logging.CPrint(logging.DEBUG, "subscription caught up", logging.LogFormat{
+				"height": sub.cursor.Height,
+				"hash":   sub.cursor.Hash,
+			})
+			return nil
+		}
+	}
+}
+
+// nextReplayBatch returns the next events to replay. If the cursor is on the
+// best block, the subscription is registered and done is true.
+func (sub *Subscription) nextReplayBatch() (events []*SubscriptionEvent, done bool, err error) {
+	chain := sub.chain
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+
+	cursor := sub.cursor
+	best := chain.blockTree.bestBlockNode()
+
+	// Cursor might be detached by reorganization since last batch.
+	for !sub.fromGenesis {
+		hash, err := chain.db.FetchBlockShaByHeight(cursor.Height)
+		if err == nil && hash.IsEqual(&cursor.Hash) {
+			break
+		}
+		block, err := chain.blockCache.getBlock(&cursor.Hash)
+		if err != nil {
+			return nil, false, err
+		}
+		msg := block.MsgBlock()
+		cursor = Cursor{Height: cursor.Height - 1, Hash: msg.Header.Previous}
+		events = append(events, &SubscriptionEvent{Type: EventBlockDisconnected, Block: msg, Cursor: cursor})
+	}
+
+	next := cursor.Height + 1
+	if sub.fromGenesis {
+		next = 0
+	}
+	if next > best.Height {
+		sub.mtx.Lock()
+		sub.register()
+		sub.mtx.Unlock()
+		return events, true, nil
+	}
+
+	for height := next; height <= best.Height && height < next+subscriptionReplayBatch; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return nil, false, err
+		}
+		cursor = Cursor{Height: height, Hash: *block.Hash()}
+		events = append(events, &SubscriptionEvent{Type: EventBlockConnected, Block: block.MsgBlock(), Cursor: cursor})
+	}
+	return events, false, nil
+}
+
+// deliver sends event to Events channel and updates cursor, it returns false
+// if subscription is closed.
+func (sub *Subscription) deliver(event *SubscriptionEvent) bool {
+	select {
+	case sub.events <- event:
+		sub.cursor = event.Cursor
+		sub.fromGenesis = false
+		return true
+	case <-sub.quit:
+		return false
+	}
+}
+
+func (sub *Subscription) fail(err error) {
+	logging.CPrint(logging.ERROR, "subscription stopped", logging.LogFormat{
+		"height": sub.cursor.Height,
+		"hash":   sub.cursor.Hash,
+		"err":    err,
+	})
+	sub.mtx.Lock()
+	sub.err = err
+	sub.unregister()
+	sub.mtx.Unlock()
+}
+
+func (sub *Subscription) push(event *SubscriptionEvent) {
+	sub.mtx.Lock()
+	sub.pending = append(sub.pending, event)
+	sub.mtx.Unlock()
+	sub.cond.Broadcast()
+}
+
+// OnBlockConnected implements Listener.
+func (sub *Subscription) OnBlockConnected(block *wire.MsgBlock) error {
+	sub.push(&SubscriptionEvent{
+		Type:   EventBlockConnected,
+		Block:  block,
+		Cursor: Cursor{Height: block.Header.Height, Hash: block.BlockHash()},
+	})
+	return nil
+}
+
+// OnBlockDisconnected implements BlockDisconnectedListener.
+func (sub *Subscription) OnBlockDisconnected(block *wire.MsgBlock) error {
+	sub.push(&SubscriptionEvent{
+		Type:   EventBlockDisconnected,
+		Block:  block,
+		Cursor: Cursor{Height: block.Header.Height - 1, Hash: block.Header.Previous},
+	})
+	return nil
+}
+
+// OnReorganize implements ReorganizeListener.
+func (sub *Subscription) OnReorganize(*ReorgInfo) error {
+	return nil
+}
+
+// OnTransactionReceived implements Listener.
+func (sub *Subscription) OnTransactionReceived(*wire.MsgTx) error {
+	return nil
+}
+
+// OnTransactionEvicted implements TransactionEvictedListener.
+func (sub *Subscription) OnTransactionEvicted(*wire.MsgTx, EvictReason) error {
+	return nil
+}
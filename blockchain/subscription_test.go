@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// applyEvents reads events until cursor reaches tip, and checks that every
+// event continues from the previous cursor.
+func applyEvents(t *testing.T, sub *Subscription, cursor Cursor, tip *wire.Hash) Cursor {
+	timeout := time.After(10 * time.Second)
+	for !cursor.Hash.IsEqual(tip) {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				t.Fatal("subscription closed", sub.Err())
+			}
+			switch event.Type {
+			case EventBlockConnected:
+				if cursor != (Cursor{}) {
+					assert.Equal(t, cursor.Hash, event.Block.Header.Previous)
+					assert.Equal(t, cursor.Height+1, event.Block.Header.Height)
+				}
+			case EventBlockDisconnected:
+				assert.Equal(t, cursor.Hash, event.Block.BlockHash())
+			}
+			cursor = event.Cursor
+		case <-timeout:
+			t.Fatal("timeout waiting for events at cursor", cursor.Height)
+		}
+	}
+	return cursor
+}
+
+func TestSubscription(t *testing.T) {
+	// same blocks as TestForkBeforeStaking, blks[32:35] are a fork which
+	// becomes the best chain for a while
+	blks := loadBlks("./data/beforestaking.dat")
+	assert.Equal(t, 53, len(blks))
+
+	copy(config.ChainParams.GenesisHash[:], blks[0].Hash()[:])
+	copy(config.ChainParams.GenesisBlock.Header.Challenge[:], blks[0].MsgBlock().Header.Challenge[:])
+	copy(config.ChainParams.GenesisBlock.Header.ChainID[:], blks[0].MsgBlock().Header.ChainID[:])
+	config.ChainParams.GenesisBlock.Header.Timestamp = blks[0].MsgBlock().Header.Timestamp
+	config.ChainParams.GenesisBlock.Header.Target = blks[0].MsgBlock().Header.Target
+
+	bc, closeFunc := newReorgTestChain(blks[0], "sub")
+	defer closeFunc()
+
+	for i := 1; i < 20; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+
+	_, err := bc.SubscribeFromHeight(bc.BestBlockHeight() + 2)
+	assert.Equal(t, ErrSubscribeHeight, err)
+
+	// replay from genesis
+	sub0, err := bc.SubscribeFromHeight(0)
+	assert.Nil(t, err)
+	cursor0 := applyEvents(t, sub0, Cursor{}, bc.BestBlockHash())
+	assert.Equal(t, bc.BestBlockHeight(), cursor0.Height)
+
+	// replay from height 5, then receive live events including a reorg
+	sub, err := bc.SubscribeFromHeight(5)
+	assert.Nil(t, err)
+	cursor := Cursor{Height: 4, Hash: *blks[4].Hash()}
+
+	for i := 20; i < 34; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+	// blks[33] is the fork tip on the best chain now
+	assert.Equal(t, blks[33].Hash(), bc.BestBlockHash())
+	cursor = applyEvents(t, sub, cursor, bc.BestBlockHash())
+	sub.Close()
+	_, ok := <-sub.Events()
+	for ok {
+		_, ok = <-sub.Events()
+	}
+
+	// resume from a cursor on the fork which is detached later
+	for i := 34; i < 42; i++ {
+		_, err := bc.processBlock(blks[i], BFNone)
+		assert.Nil(t, err)
+	}
+	sub, err = bc.SubscribeFromCursor(cursor)
+	assert.Nil(t, err)
+	cursor = applyEvents(t, sub, cursor, bc.BestBlockHash())
+	assert.Equal(t, bc.BestBlockHeight(), cursor.Height)
+	sub.Close()
+
+	// sub0 continues receiving live events
+	cursor0 = applyEvents(t, sub0, cursor0, bc.BestBlockHash())
+	assert.Equal(t, cursor, cursor0)
+	sub0.Close()
+
+	_, err = bc.SubscribeFromCursor(Cursor{Height: 1, Hash: *blks[2].Hash()})
+	assert.Equal(t, ErrUnknownCursor, err)
+}
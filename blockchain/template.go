@@ -247,7 +247,7 @@ func reCreateCoinbaseTx(coinbase *wire.MsgTx, bindingTxListReply []*database.Bin
 			}
 		}
 	} else {
-		if !forks.EnforceMASSIP0002(nextBlockHeight) {
+		if !forks.EnforceMASSIP0002(chainParams, nextBlockHeight) {
 			logging.CPrint(logging.INFO, "re-create coinbase transaction without mass binding", logging.LogFormat{"height": nextBlockHeight})
 		} else {
 			// If miner has no binding, execution cannot reach here.
@@ -279,7 +279,7 @@ func reCreateCoinbaseTx(coinbase *wire.MsgTx, bindingTxListReply []*database.Bin
 		for _, snode := range rewardAddresses {
 			stakingNodes = append(stakingNodes, snode)
 		}
-		totalWeight, err := forks.CalcTotalStakingWeight(nextBlockHeight, stakingNodes...)
+		totalWeight, err := forks.CalcTotalStakingWeight(chainParams, nextBlockHeight, stakingNodes...)
 		if err != nil {
 			return err
 		}
@@ -296,7 +296,7 @@ func reCreateCoinbaseTx(coinbase *wire.MsgTx, bindingTxListReply []*database.Bin
 				return err
 			}
 
-			nodeWeight, err := forks.CalcStakingNodeWeight(nextBlockHeight, rewardAddresses[i])
+			nodeWeight, err := forks.CalcStakingNodeWeight(chainParams, nextBlockHeight, rewardAddresses[i])
 			if err != nil {
 				return err
 			}
@@ -534,7 +534,7 @@ func (chain *Blockchain) NewBlockTemplate(payoutAddresses []massutil.Address, te
 	bestNode := chain.blockTree.bestBlockNode()
 	txs := chain.txPool.TxDescs()
 	punishments := chain.proposalPool.PunishmentProposals()
-	rewardAddress, err := chain.db.FetchUnexpiredStakingRank(bestNode.Height+1, true)
+	rewardAddress, err := chain.db.FetchUnexpiredStakingRank(chain, bestNode.Height+1, true)
 	if err != nil {
 		return err
 	}
@@ -542,13 +542,17 @@ func (chain *Blockchain) NewBlockTemplate(payoutAddresses []massutil.Address, te
 	if err != nil {
 		return err
 	}
+	blockVersion, err := chain.calcNextBlockVersion(bestNode)
+	if err != nil {
+		return err
+	}
 
 	// run newBlockTemplate as goroutine
-	go newBlockTemplate(chain, payoutAddresses, templateCh, bestNode, txs, punishments, rewardAddress, bindingState)
+	go newBlockTemplate(chain, payoutAddresses, templateCh, bestNode, blockVersion, txs, punishments, rewardAddress, bindingState)
 	return nil
 }
 
-func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, templateCh chan interface{}, bestNode *BlockNode,
+func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, templateCh chan interface{}, bestNode *BlockNode, blockVersion uint64,
 	mempoolTxns []*TxDesc, proposals []*PunishmentProposal, rewardAddresses []database.Rank, bindingState state.Trie) {
 
 	rand.Seed(time.Now().Unix())
@@ -585,7 +589,7 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 	getCoinbaseTx := func(proof Proof, totalFee massutil.Amount) (*massutil.Tx, error) {
 		var bindingTxListReply []*database.BindingTxReply
 		requiredBinding := massutil.ZeroAmount()
-		if !forks.EnforceMASSIP0002WarmUp(nextBlockHeight) {
+		if !forks.EnforceMASSIP0002WarmUp(chain, nextBlockHeight) {
 			pkScriptHash, err := pkToScriptHash(proof.PlotPublicKey(), chain.chainParams)
 			if err != nil {
 				return nil, err
@@ -596,7 +600,7 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 				return nil, err
 			}
 
-			requiredBinding, err = forks.GetRequiredBinding(nextBlockHeight, 0, proof.ProofBitLength(), massutil.ZeroAmount())
+			requiredBinding, err = forks.GetRequiredBinding(chain, nextBlockHeight, 0, proof.ProofBitLength(), massutil.ZeroAmount())
 			if err != nil {
 				return nil, err
 			}
@@ -647,7 +651,7 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 
 	// passBinding := func(pubKey interfaces.PublicKey, proofType poc.ProofType, bitLength int, plotID [32]byte) bool {
 	passBinding := func(proof Proof) bool {
-		if !forks.EnforceMASSIP0002(nextBlockHeight) {
+		if !forks.EnforceMASSIP0002(chain, nextBlockHeight) {
 			// Only MASS allowed
 			return proof.ProofType() == poc.ProofTypeDefault
 		}
@@ -837,10 +841,11 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 	blockSigOps := numCoinbaseSigOps
 	totalFee := massutil.ZeroAmount()
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
+	// Choose which transactions make it into the high-priority section of
+	// the block.
+	selected := make(map[wire.Hash]struct{})
+	for !sortedByFee && priorityQueue.Len() > 0 {
+		// Grab the highest priority transaction.
 		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
 		tx := prioItem.tx
 
@@ -873,23 +878,11 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 			continue
 		}
 
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < float64(consensus.MinRelayTxFee) &&
-			blockPlusTxSize >= config.BlockMinSize {
-
-			logging.CPrint(logging.TRACE, "Skipping tx with feePerKB < TxMinFreeFee and block weight >= minBlockSize",
-				logging.LogFormat{"txid": tx.Hash().String(), "feePerKB": prioItem.feePerKB, "TxMinFreeFee": consensus.MinRelayTxFee, "block weight": blockPlusTxSize, "minBlockSize": config.BlockMinSize})
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
+		// Switch to select by fee per kilobyte once the block is larger
+		// than the priority size or there are no more high-priority
 		// transactions.
-		if !sortedByFee && (blockPlusTxSize >= config.BlockPrioritySize ||
-			prioItem.priority <= minHighPriority) {
+		if blockPlusTxSize >= config.BlockPrioritySize ||
+			prioItem.priority <= minHighPriority {
 
 			logging.CPrint(logging.TRACE, "Switching to sort by fees per kilobyte since blockSize >= BlockPrioritySize || priority <= minHighPriority",
 				logging.LogFormat{
@@ -899,19 +892,15 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 					"minHighPriority":   fmt.Sprintf("%.2f", minHighPriority)})
 
 			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
+
+			// Leave the transaction to be selected by fees if it
+			// won't fit into the high-priority section or the
+			// priority is too low.  Otherwise this transaction will
+			// be the final one in the high-priority section, so just
+			// fall though to the code below so it is added now.
 			if blockPlusTxSize > config.BlockPrioritySize ||
 				prioItem.priority < minHighPriority {
-
-				heap.Push(priorityQueue, prioItem)
-				continue
+				break
 			}
 		}
 
@@ -933,6 +922,7 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 		blockSigOps += numSigOps
 		totalFee = temp
 		txSigOpCounts = append(txSigOpCounts, numSigOps)
+		selected[*tx.Hash()] = struct{}{}
 
 		logging.CPrint(logging.TRACE, "Adding tx",
 			logging.LogFormat{"txid": tx.Hash().String(),
@@ -956,6 +946,84 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 		}
 	}
 
+	// Fill the rest of the block by the fee per kilobyte of ancestor
+	// packages, so that a transaction paying a high fee can bring its
+	// low-fee ancestors into the block.
+	selector := newPackageSelector(mempoolTxns, selected)
+	for {
+		pkg, pkgItem := selector.next()
+		if pkg == nil {
+			break
+		}
+		tx := pkgItem.tx
+
+		// Enforce maximum block size.  Also check for overflow.
+		var pkgSize uint32
+		var pkgSigOps int64
+		pkgSigOpCounts := make([]int64, 0, len(pkg))
+		for _, txD := range pkg {
+			pkgSize += uint32(txD.Tx.PlainSize())
+			numSigOps := int64(CountSigOps(txD.Tx))
+			pkgSigOps += numSigOps
+			pkgSigOpCounts = append(pkgSigOpCounts, numSigOps)
+		}
+		blockPlusPkgSize := blockSize + pkgSize
+		if blockPlusPkgSize < blockSize ||
+			blockPlusPkgSize >= config.BlockMaxSize {
+			logging.CPrint(logging.TRACE, "Skipping tx because it would exceed the max block weight",
+				logging.LogFormat{"txid": tx.Hash().String(), "package": len(pkg)})
+			selector.fail(*tx.Hash())
+			continue
+		}
+
+		// Enforce maximum signature operations per block.  Also check
+		// for overflow.
+		if blockSigOps+pkgSigOps < blockSigOps || blockSigOps+pkgSigOps > MaxSigOpsPerBlock {
+			logging.CPrint(logging.TRACE, "Skipping tx because it would exceed the maximum sigops per block",
+				logging.LogFormat{"txid": tx.Hash().String(), "package": len(pkg)})
+			selector.fail(*tx.Hash())
+			continue
+		}
+
+		// Skip free transactions once the block is larger than the
+		// minimum block size.
+		if pkgItem.feePerKB < float64(consensus.MinRelayTxFee) &&
+			blockPlusPkgSize >= config.BlockMinSize {
+
+			logging.CPrint(logging.TRACE, "Skipping tx with feePerKB < TxMinFreeFee and block weight >= minBlockSize",
+				logging.LogFormat{"txid": tx.Hash().String(), "feePerKB": pkgItem.feePerKB, "TxMinFreeFee": consensus.MinRelayTxFee, "block weight": blockPlusPkgSize, "minBlockSize": config.BlockMinSize})
+			selector.fail(*tx.Hash())
+			continue
+		}
+
+		temp, err := totalFee.AddInt(pkgItem.fee)
+		if err != nil {
+			logging.CPrint(logging.ERROR, "calc total fee error",
+				logging.LogFormat{
+					"err":  err,
+					"txid": tx.Hash().String(),
+				})
+			selector.fail(*tx.Hash())
+			continue
+		}
+
+		// Add the package to the block, increment counters, and save the
+		// fees and signature operation counts to the block template.
+		for _, txD := range pkg {
+			blockTxns = append(blockTxns, txD.Tx.MsgTx())
+		}
+		blockSize += pkgSize
+		blockSigOps += pkgSigOps
+		totalFee = temp
+		txSigOpCounts = append(txSigOpCounts, pkgSigOpCounts...)
+		selector.selectPackage(pkg)
+
+		logging.CPrint(logging.TRACE, "Adding tx",
+			logging.LogFormat{"txid": tx.Hash().String(),
+				"package":  len(pkg),
+				"feePerKB": fmt.Sprintf("%.2f", pkgItem.feePerKB)})
+	}
+
 	// Next, obtain the merkle root of a tree which consists of the
 	// wtxid of all transactions in the block. The coinbase
 	// transaction will have a special wtxid of all zeroes.
@@ -968,7 +1036,7 @@ func newBlockTemplate(chain *Blockchain, payoutAddresses []massutil.Address, tem
 	merkles := wire.BuildMerkleTreeStoreTransactions(blockTxns, false)
 	var msgBlock = wire.NewEmptyMsgBlock()
 	msgBlock.Header.ChainID = bestNode.ChainID
-	msgBlock.Header.Version = forks.GetBlockVersion(nextBlockHeight)
+	msgBlock.Header.Version = blockVersion
 	msgBlock.Header.Height = nextBlockHeight
 	msgBlock.Header.Previous = *bestNode.Hash
 	msgBlock.Header.TransactionRoot = *merkles[len(merkles)-1]
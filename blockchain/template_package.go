@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"container/heap"
+
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// packageSelector selects transactions from a snapshot of the memory pool by
+// the fee rate of their ancestor packages.  The ancestor package of a
+// transaction consists of the transaction and all its ancestors that are not
+// selected yet, so a child paying a high fee can bring its low-fee parents
+// into the block (child-pays-for-parent).
+type packageSelector struct {
+	descs    map[wire.Hash]*TxDesc
+	children map[wire.Hash][]*TxDesc
+	pkgFee   map[wire.Hash]int64
+	pkgSize  map[wire.Hash]int64
+	selected map[wire.Hash]struct{}
+	failed   map[wire.Hash]struct{}
+
+	// items holds the latest queued item of each transaction, items popped
+	// from queue are stale if they are not the latest.
+	items map[wire.Hash]*txPrioItem
+	queue *txPriorityQueue
+}
+
+// newPackageSelector returns a packageSelector for the transactions in
+// mempoolTxns, those in selected are already in the block.
+func newPackageSelector(mempoolTxns []*TxDesc, selected map[wire.Hash]struct{}) *packageSelector {
+	ps := &packageSelector{
+		descs:    make(map[wire.Hash]*TxDesc, len(mempoolTxns)),
+		children: make(map[wire.Hash][]*TxDesc),
+		pkgFee:   make(map[wire.Hash]int64, len(mempoolTxns)),
+		pkgSize:  make(map[wire.Hash]int64, len(mempoolTxns)),
+		selected: make(map[wire.Hash]struct{}),
+		failed:   make(map[wire.Hash]struct{}),
+		items:    make(map[wire.Hash]*txPrioItem, len(mempoolTxns)),
+		queue:    newTxPriorityQueue(len(mempoolTxns), true),
+	}
+	for _, txD := range mempoolTxns {
+		ps.descs[*txD.Tx.Hash()] = txD
+	}
+	for _, txD := range mempoolTxns {
+		parents := make(map[wire.Hash]struct{})
+		for _, txIn := range txD.Tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, exists := ps.descs[parentHash]; !exists {
+				continue
+			}
+			if _, exists := parents[parentHash]; !exists {
+				parents[parentHash] = struct{}{}
+				ps.children[parentHash] = append(ps.children[parentHash], txD)
+			}
+		}
+		ps.pkgFee[*txD.Tx.Hash()] = txD.ancestorFee.IntValue()
+		ps.pkgSize[*txD.Tx.Hash()] = txD.ancestorSize
+	}
+
+	var pkg []*TxDesc
+	for hash := range selected {
+		if txD, exists := ps.descs[hash]; exists {
+			pkg = append(pkg, txD)
+		}
+	}
+	ps.selectPackage(pkg)
+	for hash := range ps.descs {
+		if _, exists := ps.selected[hash]; !exists {
+			ps.push(hash)
+		}
+	}
+	return ps
+}
+
+// push queues the transaction with its current package fee rate.
+func (ps *packageSelector) push(hash wire.Hash) {
+	txD := ps.descs[hash]
+	item := &txPrioItem{
+		tx:       txD.Tx,
+		fee:      ps.pkgFee[hash],
+		feePerKB: float64(ps.pkgFee[hash]) / (float64(ps.pkgSize[hash]) / 1000),
+	}
+	ps.items[hash] = item
+	heap.Push(ps.queue, item)
+}
+
+// next returns the ancestor package with the highest fee rate, sorted so that
+// parents are in front of their children, along with the package fee and fee
+// rate.  It returns nil when no transaction is left.
+func (ps *packageSelector) next() ([]*TxDesc, *txPrioItem) {
+	for ps.queue.Len() > 0 {
+		item := heap.Pop(ps.queue).(*txPrioItem)
+		hash := *item.tx.Hash()
+		if ps.items[hash] != item {
+			continue
+		}
+		delete(ps.items, hash)
+		if _, exists := ps.failed[hash]; exists {
+			continue
+		}
+
+		var pkg []*TxDesc
+		visited := make(map[wire.Hash]struct{})
+		var visit func(txD *TxDesc)
+		visit = func(txD *TxDesc) {
+			visited[*txD.Tx.Hash()] = struct{}{}
+			for _, txIn := range txD.Tx.MsgTx().TxIn {
+				parentHash := txIn.PreviousOutPoint.Hash
+				parent, exists := ps.descs[parentHash]
+				if !exists {
+					continue
+				}
+				if _, exists := visited[parentHash]; exists {
+					continue
+				}
+				if _, exists := ps.selected[parentHash]; exists {
+					continue
+				}
+				visit(parent)
+			}
+			pkg = append(pkg, txD)
+		}
+		visit(ps.descs[hash])
+		return pkg, item
+	}
+	return nil, nil
+}
+
+// fail marks the transaction as not selectable, its ancestors are still
+// selectable on their own.
+func (ps *packageSelector) fail(hash wire.Hash) {
+	ps.failed[hash] = struct{}{}
+}
+
+// selectPackage marks the transactions in pkg as selected, and removes them
+// from the ancestor packages of their descendants.
+func (ps *packageSelector) selectPackage(pkg []*TxDesc) {
+	updated := make(map[wire.Hash]struct{})
+	for _, txD := range pkg {
+		hash := *txD.Tx.Hash()
+		ps.selected[hash] = struct{}{}
+		delete(ps.items, hash)
+
+		descendants := make(map[wire.Hash]struct{})
+		var visit func(hash wire.Hash)
+		visit = func(hash wire.Hash) {
+			for _, child := range ps.children[hash] {
+				childHash := *child.Tx.Hash()
+				if _, exists := descendants[childHash]; !exists {
+					descendants[childHash] = struct{}{}
+					visit(childHash)
+				}
+			}
+		}
+		visit(hash)
+		for descHash := range descendants {
+			ps.pkgFee[descHash] -= txD.Fee.IntValue()
+			ps.pkgSize[descHash] -= txD.size
+			updated[descHash] = struct{}{}
+		}
+	}
+	for hash := range updated {
+		if _, exists := ps.selected[hash]; !exists {
+			if _, exists := ps.items[hash]; exists {
+				ps.push(hash)
+			}
+		}
+	}
+}
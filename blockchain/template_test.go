@@ -9,6 +9,7 @@ import (
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/massutil/safetype"
 	"github.com/massnetorg/mass-core/txscript"
+	"github.com/massnetorg/mass-core/wire"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -388,3 +389,75 @@ func TestPayload(t *testing.T) {
 	assert.Equal(t, uint32(1), coinbasePayload.NumStakingReward())
 	assert.Equal(t, uint64(30379), coinbasePayload.height)
 }
+
+func TestPackageSelector(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	// addTx adds a transaction spending prev to the pool without validation.
+	addTx := func(prev wire.OutPoint, fee int64) *massutil.Tx {
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(&prev, nil))
+		msgTx.AddTxOut(wire.NewTxOut(100000000, anyoneRedeemableScript))
+		tx := massutil.NewTx(msgTx)
+		amt, err := massutil.NewAmountFromInt(fee)
+		assert.Nil(t, err)
+		assert.Nil(t, txP.addTransaction(tx, 25, 0, massutil.ZeroAmount(), amt))
+		return tx
+	}
+	hashes := func(pkg []*TxDesc) []wire.Hash {
+		result := make([]wire.Hash, 0, len(pkg))
+		for _, txD := range pkg {
+			result = append(result, *txD.Tx.Hash())
+		}
+		return result
+	}
+
+	// the child pays for its free parent, and the package pays a higher
+	// fee rate than other
+	parent := addTx(wire.OutPoint{Hash: wire.Hash{1}}, 0)
+	child := addTx(wire.OutPoint{Hash: *parent.Hash()}, 1000000)
+	other := addTx(wire.OutPoint{Hash: wire.Hash{2}}, 100000)
+
+	childD := txP.pool[*child.Hash()]
+	parentSize := int64(parent.MsgTx().PlainSize())
+	assert.Equal(t, int64(1000000), childD.ancestorFee.IntValue())
+	assert.Equal(t, childD.size+parentSize, childD.ancestorSize)
+
+	ps := newPackageSelector(txP.TxDescs(), nil)
+	pkg, item := ps.next()
+	assert.Equal(t, []wire.Hash{*parent.Hash(), *child.Hash()}, hashes(pkg))
+	assert.Equal(t, int64(1000000), item.fee)
+	ps.selectPackage(pkg)
+	pkg, _ = ps.next()
+	assert.Equal(t, []wire.Hash{*other.Hash()}, hashes(pkg))
+	ps.selectPackage(pkg)
+	pkg, _ = ps.next()
+	assert.Nil(t, pkg)
+
+	// the parent can be selected on its own once the package of child fails
+	ps = newPackageSelector(txP.TxDescs(), nil)
+	ps.next()
+	ps.fail(*child.Hash())
+	pkg, _ = ps.next()
+	assert.Equal(t, []wire.Hash{*other.Hash()}, hashes(pkg))
+	ps.selectPackage(pkg)
+	pkg, _ = ps.next()
+	assert.Equal(t, []wire.Hash{*parent.Hash()}, hashes(pkg))
+
+	// selected ancestors are not in the package
+	ps = newPackageSelector(txP.TxDescs(), map[wire.Hash]struct{}{*parent.Hash(): {}})
+	pkg, item = ps.next()
+	assert.Equal(t, []wire.Hash{*child.Hash()}, hashes(pkg))
+	assert.Equal(t, float64(1000000)/(float64(childD.size)/1000), item.feePerKB)
+
+	// mined parent is no longer an ancestor
+	txP.RemoveTransaction(parent, false)
+	assert.Equal(t, childD.Fee, childD.ancestorFee)
+	assert.Equal(t, childD.size, childD.ancestorSize)
+
+	// ancestor stats are updated when parent is added back
+	assert.Nil(t, txP.addTransaction(parent, 25, 0, massutil.ZeroAmount(), massutil.ZeroAmount()))
+	assert.Equal(t, childD.size+parentSize, childD.ancestorSize)
+}
@@ -445,7 +445,7 @@ func disconnectStakingTransactions(db database.Db, txStore database.StakingNodes
 	return nil
 }
 
-func getReward(stakingTxStore database.StakingNodes, height uint64) ([]database.Rank, error) {
+func getReward(params consensus.DeploymentChecker, stakingTxStore database.StakingNodes, height uint64) ([]database.Rank, error) {
 	txList := make(map[[sha256.Size]byte][]database.StakingTxInfo)
 	for rsh, node := range stakingTxStore {
 		for _, m := range node {
@@ -457,7 +457,7 @@ func getReward(stakingTxStore database.StakingNodes, height uint64) ([]database.
 		}
 	}
 
-	SortedStakingTx, err := database.SortMap(txList, height, true)
+	SortedStakingTx, err := database.SortMap(params, txList, height, true)
 	if err != nil {
 		return nil, err
 	}
@@ -489,7 +489,7 @@ func (chain *Blockchain) fetchStakingTxStore(node *BlockNode) ([]database.Rank,
 	// spent transactions in the results.  This is a little more efficient
 	// since it means less transaction lookups are needed.
 	if chain.blockTree.bestBlockNode() == nil || (prevNode != nil && prevNode.Hash.IsEqual(chain.blockTree.bestBlockNode().Hash)) {
-		stakingTxRank, err := chain.db.FetchUnexpiredStakingRank(node.Height, true)
+		stakingTxRank, err := chain.db.FetchUnexpiredStakingRank(chain.deploymentsAt(prevNode), node.Height, true)
 		if err != nil {
 			return nil, err
 		}
@@ -530,7 +530,7 @@ func (chain *Blockchain) fetchStakingTxStore(node *BlockNode) ([]database.Rank,
 	// attachNodes list indicate the requested node is on a side chain, so
 	// if there are no nodes to attach, we're done.
 	if attachNodes.Len() == 0 {
-		reward, err := getReward(stakingTxStore, node.Height)
+		reward, err := getReward(chain.deploymentsAt(prevNode), stakingTxStore, node.Height)
 		if err != nil {
 			return nil, err
 		}
@@ -551,7 +551,7 @@ func (chain *Blockchain) fetchStakingTxStore(node *BlockNode) ([]database.Rank,
 			return nil, err
 		}
 	}
-	reward, err := getReward(stakingTxStore, node.Height)
+	reward, err := getReward(chain.deploymentsAt(prevNode), stakingTxStore, node.Height)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +53,9 @@ type TxDesc struct {
 	startingPriority float64         // Priority when added to the pool.
 	Fee              massutil.Amount // Transaction fees.
 	totalInputValue  massutil.Amount
+	size             int64           // Serialized size of transaction.
+	ancestorFee      massutil.Amount // Fees of transaction and its ancestors in pool.
+	ancestorSize     int64           // Size of transaction and its ancestors in pool.
 }
 
 // TxPool is used as a source of transactions that need to be mined into
@@ -73,6 +76,12 @@ type TxPool struct {
 	hashCache     *txscript.HashCache
 	NewTxCh       chan *massutil.Tx
 
+	totalSize            int64     // total serialized size of txs in pool
+	rollingMinFeeRate    float64   // dynamic minimum relay fee in Maxwell/kB
+	lastRollingFeeUpdate time.Time // last time rollingMinFeeRate was updated
+
+	feeEstimator *feeEstimator
+
 	bindingTargets map[string]wire.Hash // binding.ScriptAddress -> TxHash
 }
 
@@ -92,6 +101,26 @@ func (tp *TxPool) RemoveOrphan(txHash *wire.Hash) {
 	tp.Unlock()
 }
 
+// RemoveOrphansByPeer removes all the orphan transactions from the peer, it
+// is called when the peer disconnects.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) RemoveOrphansByPeer(peerID string) {
+	if peerID == "" {
+		return
+	}
+	tp.Lock()
+	count := tp.orphanTxPool.removeOrphansByPeer(peerID)
+	tp.Unlock()
+
+	if count > 0 {
+		logging.CPrint(logging.DEBUG, "removed orphan transactions from disconnected peer", logging.LogFormat{
+			"peer":  peerID,
+			"count": count,
+		})
+	}
+}
+
 // isTransactionInPool returns whether or not the passed transaction already
 // exists in the main pool.
 //
@@ -147,16 +176,18 @@ func (tp *TxPool) HaveTransaction(hash *wire.Hash) bool {
 
 // removeTransaction is the internal function which implements the public
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
+// It returns all the transactions actually removed from the pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (tp *TxPool) removeTransaction(tx *massutil.Tx, removeRedeemers bool) {
+func (tp *TxPool) removeTransaction(tx *massutil.Tx, removeRedeemers bool) []*massutil.Tx {
+	var removed []*massutil.Tx
 	txHash := tx.Hash()
 	if removeRedeemers {
 		// Remove any transactions which rely on this one.
 		for i := uint32(0); i < uint32(len(tx.MsgTx().TxOut)); i++ {
 			outpoint := wire.NewOutPoint(txHash, i)
 			if txRedeemer, exists := tp.outpoints[*outpoint]; exists {
-				tp.removeTransaction(txRedeemer, true)
+				removed = append(removed, tp.removeTransaction(txRedeemer, true)...)
 			}
 		}
 	}
@@ -177,7 +208,40 @@ func (tp *TxPool) removeTransaction(tx *massutil.Tx, removeRedeemers bool) {
 			delete(tp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(tp.pool, *txHash)
+		tp.totalSize -= txDesc.size
 		tp.lastUpdated = time.Now()
+		removed = append(removed, tx)
+
+		// Transactions depending on a mined transaction no longer count it
+		// as an ancestor.
+		if !removeRedeemers {
+			descendants := make(map[wire.Hash]*TxDesc)
+			tp.descendants(txDesc, descendants)
+			tp.updateDescendantStats(descendants)
+		}
+	}
+	return removed
+}
+
+// evictTransaction removes the passed transaction and all transactions that
+// depend on it, then notifies listeners of the eviction.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) evictTransaction(tx *massutil.Tx, reason EvictReason) {
+	// Transactions evicted for low fee rates fail to be confirmed in time.
+	if txD, exists := tp.pool[*tx.Hash()]; exists && (reason == EvictSizeLimit || reason == EvictExpired) {
+		evicting := make(map[wire.Hash]*TxDesc)
+		tp.descendants(txD, evicting)
+		for _, d := range evicting {
+			tp.feeEstimator.removeUnconfirmed(d)
+		}
+	}
+	for _, evicted := range tp.removeTransaction(tx, true) {
+		logging.CPrint(logging.DEBUG, "transaction evicted from pool", logging.LogFormat{
+			"txid":   evicted.Hash(),
+			"reason": reason,
+		})
+		tp.chain.notifyTransactionEvicted(evicted, reason)
 	}
 }
 
@@ -269,7 +333,7 @@ func (tp *TxPool) removeDoubleSpends(tx *massutil.Tx) {
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txRedeemer, ok := tp.outpoints[txIn.PreviousOutPoint]; ok {
 			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				tp.removeTransaction(txRedeemer, true)
+				tp.evictTransaction(txRedeemer, EvictConflict)
 			}
 		}
 	}
@@ -281,6 +345,21 @@ func (tp *TxPool) removeDoubleSpends(tx *massutil.Tx) {
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (tp *TxPool) addTransaction(tx *massutil.Tx, height uint64, startingPriority float64,
+	totalInputValue, fee massutil.Amount) error {
+	err := tp.insertTransaction(tx, height, startingPriority, totalInputValue, fee)
+
+	// NewTxCh is not set yet when blocks are disconnected on startup.
+	if _, exists := tp.pool[*tx.Hash()]; exists && tp.NewTxCh != nil {
+		tp.NewTxCh <- tx
+	}
+	return err
+}
+
+// insertTransaction adds the passed transaction to the memory pool like
+// addTransaction, without sending it to NewTxCh.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) insertTransaction(tx *massutil.Tx, height uint64, startingPriority float64,
 	totalInputValue, fee massutil.Amount) error {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
@@ -289,14 +368,23 @@ func (tp *TxPool) addTransaction(tx *massutil.Tx, height uint64, startingPriorit
 		return ErrTxPoolNil
 	}
 
-	tp.pool[*tx.Hash()] = &TxDesc{
+	txD := &TxDesc{
 		Tx:               tx,
 		Added:            time.Now(),
 		Height:           height,
 		startingPriority: startingPriority,
 		Fee:              fee,
 		totalInputValue:  totalInputValue,
+		size:             int64(tx.MsgTx().PlainSize()),
 	}
+	tp.pool[*tx.Hash()] = txD
+	tp.totalSize += txD.size
+
+	// Transactions already in the pool may depend on the one added back
+	// from a disconnected block.
+	descendants := make(map[wire.Hash]*TxDesc)
+	tp.descendants(txD, descendants)
+	tp.updateDescendantStats(descendants)
 
 	for _, txIn := range tx.MsgTx().TxIn {
 		tp.outpoints[txIn.PreviousOutPoint] = tx
@@ -305,7 +393,7 @@ func (tp *TxPool) addTransaction(tx *massutil.Tx, height uint64, startingPriorit
 	for i := range tx.TxOut() {
 		psi := tx.GetPkScriptInfo(i)
 		txOutClass := txscript.ScriptClass(psi.Class)
-		if forks.EnforceMASSIP0002WarmUp(height+1) &&
+		if forks.EnforceMASSIP0002WarmUp(tp.chain, height+1) &&
 			txOutClass == txscript.BindingScriptHashTy &&
 			len(psi.BoundPkScript) == txscript.OP_DATA_22 {
 			tp.bindingTargets[string(psi.BoundPkScript)] = *tx.Hash()
@@ -314,8 +402,6 @@ func (tp *TxPool) addTransaction(tx *massutil.Tx, height uint64, startingPriorit
 
 	tp.lastUpdated = time.Now()
 
-	tp.NewTxCh <- tx
-
 	if config.AddrIndex {
 		err := tp.addTransactionToAddrIndex(tx)
 		return err
@@ -428,23 +514,31 @@ func currentPriority(tx *massutil.Tx, txStore TxStore, blockHeight uint64) (floa
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// Note it does not check for double spends against transactions already in the
-// main chain.
+// It returns true if all those transactions signal replaceability, in which
+// case the passed transaction is a replacement candidate, and ErrDoubleSpend
+// if any of them doesn't.  Note it does not check for double spends against
+// transactions already in the main chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
-func (tp *TxPool) checkPoolDoubleSpend(tx *massutil.Tx) error {
+func (tp *TxPool) checkPoolDoubleSpend(tx *massutil.Tx) (bool, error) {
+	var isReplacement bool
+	cache := make(map[wire.Hash]bool)
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txR, exists := tp.outpoints[txIn.PreviousOutPoint]; exists {
+			if tp.signalsReplacement(txR, cache) {
+				isReplacement = true
+				continue
+			}
 			logging.CPrint(logging.ERROR, "output already spent by transaction in the memory pool",
 				logging.LogFormat{
 					"output":      txIn.PreviousOutPoint,
 					"transcation": txR.Hash(),
 				})
-			return ErrDoubleSpend
+			return false, ErrDoubleSpend
 		}
 	}
 
-	return nil
+	return isReplacement, nil
 }
 
 func (tp *TxPool) CheckPoolOutPointSpend(op *wire.OutPoint) bool {
@@ -525,25 +619,67 @@ func (tp *TxPool) FilterTransactionsByAddress(addr massutil.Address) ([]*massuti
 	return nil, ErrFindTxByAddr
 }
 
+// txAcceptance holds the results of checking a transaction against the pool,
+// which are needed to add it to the pool.
+type txAcceptance struct {
+	height           uint64
+	fee              massutil.Amount
+	size             int64
+	startingPriority float64
+	totalInputValue  massutil.Amount
+	replacing        map[wire.Hash]*TxDesc
+}
+
 // maybeAcceptTransaction is the internal function which implements the public
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
 // more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool) ([]*wire.Hash, error) {
+	acceptance, missingParents, err := tp.checkAcceptTransaction(tx, isNew, rateLimit, false)
+	if err != nil || len(missingParents) > 0 {
+		return missingParents, err
+	}
+
+	// Add to transaction pool.
+	feePerKB := float64(acceptance.fee.IntValue()) / (float64(acceptance.size) / 1000)
+	if err = tp.makeRoom([]*massutil.Tx{tx}, acceptance.size, feePerKB, acceptance.replacing); err != nil {
+		return nil, err
+	}
+	for _, conflict := range tp.directConflicts(tx) {
+		tp.evictTransaction(conflict.Tx, EvictReplaced)
+	}
+	err = tp.addTransaction(tx, acceptance.height, acceptance.startingPriority,
+		acceptance.totalInputValue, acceptance.fee)
+	if err != nil {
+		return nil, err
+	}
+
+	tp.chain.notifyTransactionReceived(tx)
+
+	return nil, nil
+}
+
+// checkAcceptTransaction performs all the checks of maybeAcceptTransaction
+// without adding the transaction to the pool.  It returns the missing parents
+// if the transaction is an orphan.  The fee is not checked if inPackage is
+// true, and replacing transactions in the pool is not allowed then.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) checkAcceptTransaction(tx *massutil.Tx, isNew, rateLimit, inPackage bool) (*txAcceptance, []*wire.Hash, error) {
 	txHash := tx.Hash()
 
 	// Don't accept the transaction if it already exists in the pool.  This
 	// applies to orphan transactions as well.  This check is intended to
 	// be a quick check to weed out duplicates.
 	if tp.haveTransaction(txHash) {
-		return nil, errors.ErrTxAlreadyExists
+		return nil, nil, errors.ErrTxAlreadyExists
 	}
 
 	if len(tx.MsgTx().Payload) > maxTxPoolTxPayload {
 		logging.CPrint(logging.ERROR, "transaction payload size is too big",
 			logging.LogFormat{"size": len(tx.MsgTx().Payload), "max": maxTxPoolTxPayload})
-		return nil, ErrTxMsgPayloadSize
+		return nil, nil, ErrTxMsgPayloadSize
 	}
 
 	// Perform preliminary sanity checks on the transaction.  This makes
@@ -551,14 +687,14 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	// transactions are allowed into blocks.
 	err := CheckTransactionSanity(tx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// A standalone transaction must not be a coinbase transaction.
 	if IsCoinBase(tx) {
 		logging.CPrint(logging.ERROR, "transaction is an individual coinbase",
 			logging.LogFormat{"txHash": txHash})
-		return nil, ErrCoinbaseTx
+		return nil, nil, ErrCoinbaseTx
 	}
 
 	// Don't accept transactions with a lock time after the maximum int64
@@ -566,7 +702,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	if tx.MsgTx().LockTime > math.MaxInt64 {
 		logging.CPrint(logging.ERROR, "transaction has a lock time which is not accepted yet",
 			logging.LogFormat{"txHash": txHash, "lockTime": tx.MsgTx().LockTime})
-		return nil, ErrImmatureSpend
+		return nil, nil, ErrImmatureSpend
 	}
 
 	// Get the current height of the main chain.  A standalone transaction
@@ -577,7 +713,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	node := tp.chain.blockTree.bestBlockNode()
 	medianTimePast, err := tp.chain.calcPastMedianTime(node)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Fetch all of the transactions referenced by the inputs to this
@@ -589,7 +725,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	// Don't allow the transaction if it exists in the main chain and is not
 	// not already fully spent.
 	if txD, exists := txStore[*txHash]; exists && txD.Err == nil {
-		return nil, errors.ErrTxAlreadyExists
+		return nil, nil, errors.ErrTxAlreadyExists
 	}
 
 	delete(txStore, *txHash)
@@ -599,9 +735,9 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	if !tp.chain.chainParams.RelayNonStdTxs {
 		bst, err := tp.chain.BestBlockNode().BindingState(tp.chain.stateBindingDb)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		err = checkTransactionStandard(bst, tx, nextBlockHeight, massutil.MinRelayTxFee(), txStore, func(script []byte) bool {
+		err = checkTransactionStandard(tp.chain, bst, tx, nextBlockHeight, massutil.MinRelayTxFee(), txStore, func(script []byte) bool {
 			hash, ok := tp.bindingTargets[string(script)]
 			if ok {
 				if !tp.haveTransaction(&hash) {
@@ -612,7 +748,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 			return ok
 		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
@@ -624,9 +760,11 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = tp.checkPoolDoubleSpend(tx)
+	// Transactions signaling replaceability can be replaced, which is
+	// validated later once the fee is known.
+	isReplacement, err := tp.checkPoolDoubleSpend(tx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Transaction is an orphan if any of the referenced input transactions
@@ -640,7 +778,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 		}
 	}
 	if len(missingParents) > 0 {
-		return missingParents, nil
+		return nil, missingParents, nil
 	}
 
 	// Perform several checks on the transaction inputs using the invariant
@@ -654,17 +792,17 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 			"nextHeight": nextBlockHeight,
 			"err":        err,
 		})
-		return nil, err
+		return nil, nil, err
 	}
 	if payload := DecodePayload(tx.MsgTx().Payload); payload != nil {
 		switch payload.Method {
 		case BindPoolCoinbase:
 			if txFee.IntValue() < int64(consensus.MASSIP0002SetPoolPkCoinbaseFee) {
-				return nil, ErrFeeForPoolPkCoinbase
+				return nil, nil, ErrFeeForPoolPkCoinbase
 			}
 			if payload.Params.(*BindPoolCoinbaseParams).Nonce == 0 {
 				logging.CPrint(logging.ERROR, "zero payload nonce not allowed", logging.LogFormat{"tx": txHash})
-				return nil, ErrPayloadNonce
+				return nil, nil, ErrPayloadNonce
 			}
 		default:
 			// do nothing
@@ -677,11 +815,11 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	// with respect to its defined relative lock times.
 	sequenceLock, err := tp.chain.CalcSequenceLock(tx, txStore)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !SequenceLockActive(sequenceLock, nextBlockHeight,
 		medianTimePast) {
-		return nil, ErrSequenceNotSatisfied
+		return nil, nil, ErrSequenceNotSatisfied
 	}
 
 	// Don't allow transactions with non-standard inputs if the network
@@ -689,7 +827,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	if !tp.chain.chainParams.RelayNonStdTxs {
 		err := checkInputsStandard(tx, txStore)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
@@ -706,33 +844,93 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 	if numSigOps > maxSigOpsPerTx {
 		logging.CPrint(logging.ERROR, "transaction contains too many signature operations",
 			logging.LogFormat{"txHash": txHash, "numSigOps": numSigOps, "maxSigOpsPerTx": maxSigOpsPerTx})
-		return nil, ErrTooManySigOps
+		return nil, nil, ErrTooManySigOps
 	}
 
-	// Don't allow transactions with fees too low to get into a mined block.
-	//
-	// Most miners allow a free transaction area in blocks they mine to go
-	// alongside the area used for high-priority transactions as well as
-	// transactions with fees.  A transaction size of up to 1000 bytes is
-	// considered safe to go into this section.  Further, the minimum fee
-	// calculated below on its own would encourage several small
-	// transactions to avoid fees rather than one single larger transaction
-	// which is more desirable.  Therefore, as long as the size of the
-	// transaction does not exceeed 1000 less than the reserved space for
-	// high-priority transactions, don't require a fee for it.
-
+	// The fee of a transaction in a package is checked on the whole package
+	// instead.
 	serializedSize := int64(tx.MsgTx().PlainSize())
+	if !inPackage {
+		err = tp.checkTransactionFee(tx, txStore, txFee, serializedSize, nextBlockHeight, isNew, rateLimit)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if isReplacement {
+		logging.CPrint(logging.DEBUG, "transaction in package double spends transaction in pool",
+			logging.LogFormat{"txHash": txHash})
+		return nil, nil, ErrDoubleSpend
+	}
+
+	// If the transaction double spends transactions in the pool, make sure
+	// it pays enough to replace them.
+	var replacing map[wire.Hash]*TxDesc
+	if isReplacement {
+		replacing, err = tp.validateReplacement(tx, txFee, serializedSize)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Verify crypto signatures for each input and reject the transaction if
+	// any don't verify.
+	err = ValidateTransactionScripts(tp.chain, tx, txStore,
+		txscript.StandardVerifyFlags, tp.sigCache,
+		tp.hashCache)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startingPriority, totalInputValue, err := currentPriority(tx, txStore, curHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &txAcceptance{
+		height:           curHeight,
+		fee:              txFee,
+		size:             serializedSize,
+		startingPriority: startingPriority,
+		totalInputValue:  totalInputValue,
+		replacing:        replacing,
+	}, nil, nil
+}
+
+// checkTransactionFee checks whether or not the transaction pays enough fee to
+// be accepted by the pool, and applies the rate limit to free transactions.
+//
+// Most miners allow a free transaction area in blocks they mine to go
+// alongside the area used for high-priority transactions as well as
+// transactions with fees.  A transaction size of up to 1000 bytes is
+// considered safe to go into this section.  Further, the minimum fee
+// calculated below on its own would encourage several small
+// transactions to avoid fees rather than one single larger transaction
+// which is more desirable.  Therefore, as long as the size of the
+// transaction does not exceeed 1000 less than the reserved space for
+// high-priority transactions, don't require a fee for it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) checkTransactionFee(tx *massutil.Tx, txStore TxStore, txFee massutil.Amount,
+	serializedSize int64, nextBlockHeight uint64, isNew, rateLimit bool) error {
+	txHash := tx.Hash()
 	requiredFee, err := CalcMinRequiredTxRelayFee(serializedSize, massutil.MinRelayTxFee())
 	if err != nil {
 		logging.CPrint(logging.ERROR, "CalcMinRequiredTxRelayFee error", logging.LogFormat{"err": err})
-		return nil, err
+		return err
+	}
+
+	// Transactions paying less than the dynamic minimum relay fee, which is
+	// raised after the pool gets full, are rejected without exemption.
+	rollingMinFee := tp.rollingMinFee()
+	if float64(txFee.IntValue()) < rollingMinFee*float64(serializedSize)/1000 {
+		logging.CPrint(logging.DEBUG, "transaction`s fees is under the dynamic minimum relay fee",
+			logging.LogFormat{"txHash": txHash, "txFee": txFee, "minFeePerKB": rollingMinFee})
+		return ErrInsufficientFee
 	}
 
 	if txFee.Cmp(requiredFee) < 0 {
 		if serializedSize >= (defaultBlockPrioritySize - 1000) {
 			logging.CPrint(logging.ERROR, "transaction`s fees is under the required amount",
 				logging.LogFormat{"txHash": txHash, "txFee": txFee, "requiredFee": requiredFee})
-			return nil, ErrInsufficientFee
+			return ErrInsufficientFee
 		}
 
 		// Require that free transactions have sufficient priority to be mined
@@ -742,13 +940,13 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 		if isNew && !config.NoRelayPriority {
 			currentPriority, _, err := currentPriority(tx, txStore, nextBlockHeight)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			if currentPriority <= consensus.MinHighPriority {
 				logging.CPrint(logging.ERROR, "transaction has insufficient priority",
 					logging.LogFormat{"txHash": txHash, "currentPriority": currentPriority,
 						"MinHighPriority": consensus.MinHighPriority})
-				return nil, ErrInsufficientPriority
+				return ErrInsufficientPriority
 			}
 		}
 
@@ -766,7 +964,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 			if tp.pennyTotal >= config.FreeTxRelayLimit*10*1000 {
 				logging.CPrint(logging.ERROR, "transaction has been rejected by the rate limiter due to low fees",
 					logging.LogFormat{"txHash": txHash})
-				return nil, ErrInsufficientFee
+				return ErrInsufficientFee
 			}
 			oldTotal := tp.pennyTotal
 
@@ -780,31 +978,7 @@ func (tp *TxPool) maybeAcceptTransaction(tx *massutil.Tx, isNew, rateLimit bool)
 		}
 	}
 
-	// Verify crypto signatures for each input and reject the transaction if
-	// any don't verify.
-	err = ValidateTransactionScripts(tp.chain, tx, txStore,
-		txscript.StandardVerifyFlags, tp.sigCache,
-		tp.hashCache)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add to transaction pool.
-	startingPriority, totalInputValue, err := currentPriority(tx, txStore, curHeight)
-	if err != nil {
-		return nil, err
-	}
-	err = tp.addTransaction(tx, curHeight, startingPriority, totalInputValue, txFee)
-	if err != nil {
-		return nil, err
-	}
-
-	err = tp.chain.notifyTransactionReceived(tx)
-	if err != nil {
-		return nil, err
-	}
-
-	return nil, nil
+	return nil
 }
 
 // MaybeAcceptTransaction is the main workhorse for handling insertion of new
@@ -846,7 +1020,8 @@ func (tp *TxPool) processOrphans(hash *wire.Hash) {
 		// process if there are none.
 		orphans := tp.orphanTxPool.getOrphansByPrevious(processHash)
 
-		for _, tx := range orphans {
+		for _, orphan := range orphans {
+			tx := orphan.tx
 			orphanHash := tx.Hash()
 			tp.orphanTxPool.removeOrphan(orphanHash)
 
@@ -864,7 +1039,7 @@ func (tp *TxPool) processOrphans(hash *wire.Hash) {
 
 			if len(missingParents) > 0 {
 				// Transaction is still an orphan, so add it back.
-				tp.orphanTxPool.addOrphan(tx)
+				tp.orphanTxPool.addOrphan(tx, orphan.peerID)
 				continue
 			}
 
@@ -896,6 +1071,15 @@ func (tp *TxPool) ProcessOrphans(hash *wire.Hash) {
 //
 // This function is safe for concurrent access.
 func (tp *TxPool) ProcessTransaction(tx *massutil.Tx, allowOrphan, rateLimit bool) (bool, error) {
+	return tp.ProcessPeerTransaction(tx, allowOrphan, rateLimit, "")
+}
+
+// ProcessPeerTransaction is like ProcessTransaction, but tags orphans with
+// peerID, which is the ID of the peer the transaction comes from, or empty if
+// it does not come from a peer.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) ProcessPeerTransaction(tx *massutil.Tx, allowOrphan, rateLimit bool, peerID string) (bool, error) {
 	// Protect concurrent access.
 	tp.Lock()
 	defer tp.Unlock()
@@ -937,7 +1121,7 @@ func (tp *TxPool) ProcessTransaction(tx *massutil.Tx, allowOrphan, rateLimit boo
 		}
 
 		// Potentially add the orphan transaction to the orphan pool.
-		err := tp.orphanTxPool.maybeAddOrphan(tx)
+		err := tp.orphanTxPool.maybeAddOrphan(tx, peerID)
 		if err != nil {
 			return isOrphan, err
 		}
@@ -977,7 +1161,8 @@ func (tp *TxPool) TxShas() []*wire.Hash {
 }
 
 // TxDescs returns a slice of descriptors for all the transactions in the pool.
-// The descriptors are to be treated as read only.
+// The descriptors are copies taken at the same time, so that they are
+// consistent with each other.
 //
 // This function is safe for concurrent access.
 func (tp *TxPool) TxDescs() []*TxDesc {
@@ -987,7 +1172,8 @@ func (tp *TxPool) TxDescs() []*TxDesc {
 	descs := make([]*TxDesc, len(tp.pool))
 	i := 0
 	for _, desc := range tp.pool {
-		descs[i] = desc
+		descCopy := *desc
+		descs[i] = &descCopy
 		i++
 	}
 
@@ -1015,12 +1201,21 @@ func (tp *TxPool) SyncAttachBlock(block *massutil.Block) {
 	tp.Lock()
 	defer tp.Unlock()
 
+	confirmed := make([]*TxDesc, 0, len(block.Transactions())-1)
+	for _, tx := range block.Transactions()[1:] {
+		if txD, exists := tp.pool[*tx.Hash()]; exists {
+			confirmed = append(confirmed, txD)
+		}
+	}
+	tp.feeEstimator.processBlock(block.Height(), confirmed)
+
 	for _, tx := range block.Transactions()[1:] {
 		tp.removeTransaction(tx, false)
 		tp.removeDoubleSpends(tx)
 		tp.orphanTxPool.removeOrphan(tx.Hash())
 		tp.processOrphans(tx.Hash())
 	}
+	tp.expireTransactions()
 }
 
 func (tp *TxPool) SyncDetachBlock(block *massutil.Block) {
@@ -1032,7 +1227,7 @@ func (tp *TxPool) SyncDetachBlock(block *massutil.Block) {
 			// Remove the transaction and all transactions
 			// that depend on it if it wasn't accepted into
 			// the transaction pool.
-			tp.removeTransaction(tx, true)
+			tp.evictTransaction(tx, EvictReorg)
 		}
 	}
 }
@@ -1049,6 +1244,7 @@ func NewTxPool(chain *Blockchain, sigCache *txscript.SigCache, hashCache *txscri
 		errCache:       lru.New(500),
 		outpoints:      make(map[wire.OutPoint]*massutil.Tx),
 		bindingTargets: make(map[string]wire.Hash),
+		feeEstimator:   newFeeEstimator(),
 	}
 	if config.AddrIndex {
 		memPool.addrindex = make(map[string]map[wire.Hash]struct{})
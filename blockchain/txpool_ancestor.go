@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// ancestors adds all transactions in the pool that the transaction depends
+// on to result, the transaction itself is not added.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) ancestors(txD *TxDesc, result map[wire.Hash]*TxDesc) {
+	for _, txIn := range txD.Tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, visited := result[parentHash]; visited {
+			continue
+		}
+		if parent, exists := tp.pool[parentHash]; exists {
+			result[parentHash] = parent
+			tp.ancestors(parent, result)
+		}
+	}
+}
+
+// updateAncestorStats recalculates the total fee and size of the transaction
+// and its ancestors in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) updateAncestorStats(txD *TxDesc) {
+	ancestors := make(map[wire.Hash]*TxDesc)
+	tp.ancestors(txD, ancestors)
+
+	fee, size := txD.Fee, txD.size
+	for _, ancestor := range ancestors {
+		var err error
+		if fee, err = fee.Add(ancestor.Fee); err != nil {
+			// should never happen, fees in pool are far less than max amount
+			logging.CPrint(logging.ERROR, "calc ancestor fee error", logging.LogFormat{
+				"txid": txD.Tx.Hash(),
+				"err":  err,
+			})
+			break
+		}
+		size += ancestor.size
+	}
+	txD.ancestorFee, txD.ancestorSize = fee, size
+}
+
+// updateDescendantStats recalculates the ancestor fee and size of all the
+// descendants of the transaction, it is called when the transaction is added
+// to or removed from the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) updateDescendantStats(descendants map[wire.Hash]*TxDesc) {
+	for _, txD := range descendants {
+		if _, exists := tp.pool[*txD.Tx.Hash()]; exists {
+			tp.updateAncestorStats(txD)
+		}
+	}
+}
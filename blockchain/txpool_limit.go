@@ -0,0 +1,220 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+const (
+	// rollingMinFeeHalfLife is the time for the dynamic minimum relay fee
+	// to decay by half.
+	rollingMinFeeHalfLife = 12 * time.Hour
+)
+
+// feePerKB returns the fee rate of the transaction in Maxwell/kB.
+func (txD *TxDesc) feePerKB() float64 {
+	return float64(txD.Fee.IntValue()) / (float64(txD.size) / 1000)
+}
+
+// rollingMinFee returns the dynamic minimum relay fee in Maxwell/kB, which is
+// raised after transactions are evicted for the size limit, and decays
+// exponentially afterwards.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) rollingMinFee() float64 {
+	if tp.rollingMinFeeRate == 0 {
+		return 0
+	}
+	now := time.Now()
+	elapsed := now.Sub(tp.lastRollingFeeUpdate)
+	tp.rollingMinFeeRate /= math.Pow(2, float64(elapsed)/float64(rollingMinFeeHalfLife))
+	tp.lastRollingFeeUpdate = now
+	// Stop tracking once it is low enough to be covered by the static
+	// minimum relay fee.
+	if tp.rollingMinFeeRate < float64(consensus.MinRelayTxFee)/2 {
+		tp.rollingMinFeeRate = 0
+	}
+	return tp.rollingMinFeeRate
+}
+
+// MinRelayTxFee returns the minimum fee in Maxwell/kB currently required for
+// a transaction to be accepted, which is the greater of the static minimum
+// relay fee and the dynamic one raised by evictions.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) MinRelayTxFee() massutil.Amount {
+	tp.Lock()
+	defer tp.Unlock()
+
+	static := massutil.MinRelayTxFee()
+	dynamic, err := massutil.NewAmountFromInt(int64(math.Ceil(tp.rollingMinFee())))
+	if err != nil || dynamic.Cmp(static) <= 0 {
+		return static
+	}
+	return dynamic
+}
+
+// Size returns the total serialized size of transactions in the main pool.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) Size() int64 {
+	tp.RLock()
+	defer tp.RUnlock()
+
+	return tp.totalSize
+}
+
+// descendants adds the transaction and all transactions in the pool that
+// depend on it to result.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) descendants(txD *TxDesc, result map[wire.Hash]*TxDesc) {
+	result[*txD.Tx.Hash()] = txD
+	for i := range txD.Tx.MsgTx().TxOut {
+		redeemer, exists := tp.outpoints[*wire.NewOutPoint(txD.Tx.Hash(), uint32(i))]
+		if !exists {
+			continue
+		}
+		if _, visited := result[*redeemer.Hash()]; visited {
+			continue
+		}
+		if redeemerD, exists := tp.pool[*redeemer.Hash()]; exists {
+			tp.descendants(redeemerD, result)
+		}
+	}
+}
+
+// makeRoom evicts the transactions with the lowest fee rate, together with
+// their descendants, so that txs of total size and feePerKB fit in the size
+// limit.  The space of transactions being replaced by txs is counted as free.
+// Only transactions paying a lower fee rate than txs are evicted, and nothing is
+// evicted if enough room can not be made, in which case ErrTxPoolFull is
+// returned.  The dynamic minimum relay fee is raised above the fee rate of
+// evicted transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) makeRoom(txs []*massutil.Tx, size int64, feePerKB float64, replacing map[wire.Hash]*TxDesc) error {
+	roots, evicting, err := tp.sizeLimitEvictions(txs, size, feePerKB, replacing)
+	if err != nil || len(roots) == 0 {
+		return err
+	}
+
+	var freed int64
+	for hash, txD := range evicting {
+		if _, exists := replacing[hash]; !exists {
+			freed += txD.size
+		}
+	}
+	// Roots are sorted by fee rate in ascending order.
+	maxFeePerKB := roots[len(roots)-1].feePerKB()
+	for _, txD := range roots {
+		tp.evictTransaction(txD.Tx, EvictSizeLimit)
+	}
+	newMinFee := maxFeePerKB + float64(consensus.MinRelayTxFee)
+	if newMinFee > tp.rollingMinFee() {
+		tp.rollingMinFeeRate = newMinFee
+		tp.lastRollingFeeUpdate = time.Now()
+	}
+	logging.CPrint(logging.INFO, "transactions evicted for pool size limit", logging.LogFormat{
+		"count":       len(evicting) - len(replacing),
+		"freed":       freed,
+		"minFeePerKB": tp.rollingMinFeeRate,
+	})
+	return nil
+}
+
+// sizeLimitEvictions returns the transactions that makeRoom would evict for txs,
+// without evicting them.  roots are the evicted transactions sorted by fee
+// rate in ascending order, and evicting contains roots, their descendants and
+// the transactions in replacing.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) sizeLimitEvictions(txs []*massutil.Tx, size int64, feePerKB float64,
+	replacing map[wire.Hash]*TxDesc) (roots []*TxDesc, evicting map[wire.Hash]*TxDesc, err error) {
+	if config.MaxTxPoolSize <= 0 || tp.totalSize+size <= config.MaxTxPoolSize {
+		return nil, nil, nil
+	}
+
+	candidates := make([]*TxDesc, 0, len(tp.pool))
+	for _, txD := range tp.pool {
+		if txD.feePerKB() < feePerKB {
+			candidates = append(candidates, txD)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].feePerKB() < candidates[j].feePerKB()
+	})
+
+	// Parents of txs must stay in the pool.
+	parents := make(map[wire.Hash]struct{})
+	for _, tx := range txs {
+		for _, txIn := range tx.MsgTx().TxIn {
+			parents[txIn.PreviousOutPoint.Hash] = struct{}{}
+		}
+	}
+
+	var freed int64
+	evicting = make(map[wire.Hash]*TxDesc)
+	for hash, txD := range replacing {
+		evicting[hash] = txD
+		freed += txD.size
+	}
+	for _, txD := range candidates {
+		if tp.totalSize-freed+size <= config.MaxTxPoolSize {
+			break
+		}
+		if _, exists := evicting[*txD.Tx.Hash()]; exists {
+			continue
+		}
+		group := make(map[wire.Hash]*TxDesc)
+		tp.descendants(txD, group)
+		keep := false
+		for hash := range group {
+			if _, exists := parents[hash]; exists {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			continue
+		}
+		for hash, d := range group {
+			if _, exists := evicting[hash]; !exists {
+				evicting[hash] = d
+				freed += d.size
+			}
+		}
+		roots = append(roots, txD)
+	}
+	if tp.totalSize-freed+size > config.MaxTxPoolSize {
+		return nil, nil, ErrTxPoolFull
+	}
+	return roots, evicting, nil
+}
+
+// expireTransactions evicts transactions added to the pool earlier than
+// config.TxPoolExpiry ago, together with their descendants.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) expireTransactions() {
+	if config.TxPoolExpiry <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-config.TxPoolExpiry)
+	var expired []*massutil.Tx
+	for _, txD := range tp.pool {
+		if txD.Added.Before(deadline) {
+			expired = append(expired, txD.Tx)
+		}
+	}
+	for _, tx := range expired {
+		tp.evictTransaction(tx, EvictExpired)
+	}
+}
@@ -0,0 +1,185 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+const (
+	// maxPackageCount is the max number of transactions in a package.
+	maxPackageCount = 25
+
+	// maxPackageSize is the max total serialized size of transactions in a
+	// package.
+	maxPackageSize = 101000
+)
+
+// checkPackage checks that the package is within the limits, has no duplicate
+// transactions, and is sorted so that parents are in front of their children.
+func checkPackage(txs []*massutil.Tx) error {
+	if len(txs) == 0 {
+		return ErrInvalidPackage
+	}
+	if len(txs) > maxPackageCount {
+		return ErrPackageTooLarge
+	}
+
+	var size int64
+	later := make(map[wire.Hash]struct{}, len(txs))
+	for _, tx := range txs {
+		size += int64(tx.MsgTx().PlainSize())
+		later[*tx.Hash()] = struct{}{}
+	}
+	if len(later) != len(txs) {
+		return ErrInvalidPackage
+	}
+	if size > maxPackageSize {
+		return ErrPackageTooLarge
+	}
+	for _, tx := range txs {
+		delete(later, *tx.Hash())
+		for _, txIn := range tx.MsgTx().TxIn {
+			if _, exists := later[txIn.PreviousOutPoint.Hash]; exists {
+				logging.CPrint(logging.DEBUG, "package is not sorted",
+					logging.LogFormat{"tx": tx.Hash(), "parent": txIn.PreviousOutPoint.Hash})
+				return ErrInvalidPackage
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessPackage accepts a package of related transactions, sorted so that
+// parents are in front of their children, into the pool as a unit.  Either all
+// the transactions not in the pool yet are accepted, or none of them is.
+// Except for the fee, each transaction is checked the same as by
+// ProcessTransaction, while the fee is checked on the whole package, so a
+// child paying a high fee can bring in its parent paying below the minimum
+// relay fee.  Transactions of the package are taken out of the orphan pool.
+// Transactions in a package can not replace transactions in the pool.
+//
+// It returns the transactions accepted into the pool.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) ProcessPackage(txs []*massutil.Tx) ([]*massutil.Tx, error) {
+	if err := checkPackage(txs); err != nil {
+		return nil, err
+	}
+
+	tp.Lock()
+	defer tp.Unlock()
+
+	// Orphans in the package are added back if the package is rejected.
+	var orphans []*orphanTx
+	for _, tx := range txs {
+		if orphan, exists := tp.orphanTxPool.getOrphan(tx.Hash()); exists {
+			orphans = append(orphans, orphan)
+			tp.orphanTxPool.removeOrphan(tx.Hash())
+		}
+	}
+
+	pkg, err := tp.checkAcceptPackage(txs)
+	if err == nil && len(pkg.txs) > 0 {
+		feePerKB := float64(pkg.fee.IntValue()) / (float64(pkg.size) / 1000)
+		err = tp.makeRoom(pkg.txs, pkg.size, feePerKB, nil)
+	}
+	for i := 0; err == nil && i < len(pkg.txs); i++ {
+		acceptance := pkg.acceptances[i]
+		err = tp.insertTransaction(pkg.txs[i], acceptance.height, acceptance.startingPriority,
+			acceptance.totalInputValue, acceptance.fee)
+		if err != nil {
+			// Remove the transactions inserted so far, including the
+			// failed one, so that none of the package is left.
+			for j := i; j >= 0; j-- {
+				tp.removeTransaction(pkg.txs[j], false)
+			}
+		}
+	}
+	if err != nil {
+		for _, orphan := range orphans {
+			tp.orphanTxPool.addOrphan(orphan.tx, orphan.peerID)
+		}
+		return nil, err
+	}
+
+	// The package is announced only after all of it is accepted.
+	for _, tx := range pkg.txs {
+		if tp.NewTxCh != nil {
+			tp.NewTxCh <- tx
+		}
+		tp.chain.notifyTransactionReceived(tx)
+	}
+	for _, tx := range pkg.txs {
+		tp.processOrphans(tx.Hash())
+	}
+	return pkg.txs, nil
+}
+
+// packageAcceptance holds the results of checking a package against the pool.
+type packageAcceptance struct {
+	txs         []*massutil.Tx // transactions not in the pool yet
+	acceptances []*txAcceptance
+	fee         massutil.Amount
+	size        int64
+}
+
+// checkAcceptPackage checks the transactions of the package not in the pool
+// yet.  They are added to the pool one by one for their children to be
+// checked, and are all removed before it returns.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) checkAcceptPackage(txs []*massutil.Tx) (*packageAcceptance, error) {
+	pkg := &packageAcceptance{fee: massutil.ZeroAmount()}
+	defer func() {
+		for i := len(pkg.txs) - 1; i >= 0; i-- {
+			tp.removeTransaction(pkg.txs[i], false)
+		}
+	}()
+
+	for _, tx := range txs {
+		if tp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+		acceptance, missingParents, err := tp.checkAcceptTransaction(tx, true, false, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(missingParents) > 0 {
+			logging.CPrint(logging.DEBUG, "transaction in package has missing inputs",
+				logging.LogFormat{"tx": tx.Hash(), "missingParents": missingParents[0]})
+			return nil, ErrPackageMissingInputs
+		}
+		err = tp.insertTransaction(tx, acceptance.height, acceptance.startingPriority,
+			acceptance.totalInputValue, acceptance.fee)
+		if err != nil {
+			return nil, err
+		}
+		pkg.txs = append(pkg.txs, tx)
+		pkg.acceptances = append(pkg.acceptances, acceptance)
+		if pkg.fee, err = pkg.fee.Add(acceptance.fee); err != nil {
+			return nil, err
+		}
+		pkg.size += acceptance.size
+	}
+	if len(pkg.txs) == 0 {
+		return pkg, nil
+	}
+
+	requiredFee, err := CalcMinRequiredTxRelayFee(pkg.size, massutil.MinRelayTxFee())
+	if err != nil {
+		return nil, err
+	}
+	rollingMinFee := tp.rollingMinFee()
+	if pkg.fee.Cmp(requiredFee) < 0 || float64(pkg.fee.IntValue()) < rollingMinFee*float64(pkg.size)/1000 {
+		logging.CPrint(logging.DEBUG, "package`s fees is under the required amount", logging.LogFormat{
+			"txs":         len(pkg.txs),
+			"fee":         pkg.fee,
+			"size":        pkg.size,
+			"requiredFee": requiredFee,
+			"minFeePerKB": rollingMinFee,
+		})
+		return nil, ErrInsufficientFee
+	}
+	return pkg, nil
+}
@@ -0,0 +1,306 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// Layout of the mempool file, all integers are little-endian:
+//
+//	magic "MASSPOOL" (8 bytes) | version (4 bytes) | tx count (4 bytes) | txs | orphan count (4 bytes) | orphans
+//
+//	tx:     added unix nano (8 bytes) | height (8 bytes) | fee (8 bytes) | tx length (4 bytes) | tx (wire.DB)
+//	orphan: tx length (4 bytes) | tx (wire.DB)
+const (
+	// mempoolFileVersion is the current version of mempool file.
+	mempoolFileVersion = uint32(1)
+
+	// maxMempoolFileTxSize is the max size of a transaction read from
+	// mempool file.
+	maxMempoolFileTxSize = wire.MaxBlockPayload
+)
+
+// MempoolFileName is the conventional name of mempool file in the chain
+// store directory.
+const MempoolFileName = "mempool.dat"
+
+var mempoolFileMagic = []byte("MASSPOOL")
+
+// poolFileEntry is a transaction read from mempool file.
+type poolFileEntry struct {
+	tx     *massutil.Tx
+	added  time.Time
+	height uint64
+	fee    massutil.Amount
+}
+
+// SaveToFile writes the transactions and orphans in the pool to path, so
+// that they can be reloaded by LoadFromFile after restart.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) SaveToFile(path string) error {
+	tp.RLock()
+	defer tp.RUnlock()
+
+	if err := writeFileAtomic(path, tp.writeMempool); err != nil {
+		return err
+	}
+
+	logging.CPrint(logging.INFO, "mempool saved", logging.LogFormat{
+		"path":    path,
+		"txs":     len(tp.pool),
+		"orphans": tp.orphanTxPool.pool.Count(),
+	})
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it to path after the
+// write succeeds, so that path is never left partially written.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) writeMempool(w io.Writer) error {
+	if _, err := w.Write(mempoolFileMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, mempoolFileVersion); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(tp.pool))); err != nil {
+		return err
+	}
+	for _, txD := range tp.pool {
+		for _, v := range []interface{}{txD.Added.UnixNano(), txD.Height, txD.Fee.IntValue()} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		if err := writePoolFileTx(w, txD.Tx); err != nil {
+			return err
+		}
+	}
+
+	orphans := tp.orphanTxPool.orphans()
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(orphans))); err != nil {
+		return err
+	}
+	for _, tx := range orphans {
+		if err := writePoolFileTx(w, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePoolFileTx(w io.Writer, tx *massutil.Tx) error {
+	bs, err := tx.MsgTx().Bytes(wire.DB)
+	if err != nil {
+		return err
+	}
+	if err = binary.Write(w, binary.LittleEndian, uint32(len(bs))); err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+func readPoolFileTx(r io.Reader) (*massutil.Tx, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxMempoolFileTxSize {
+		return nil, ErrInvalidMempoolFile
+	}
+	bs := make([]byte, size)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return nil, err
+	}
+	return massutil.NewTxFromBytes(bs, wire.DB)
+}
+
+// readMempool reads transactions and orphans from r.
+func readMempool(r io.Reader) (txs []*poolFileEntry, orphans []*massutil.Tx, err error) {
+	magic := make([]byte, len(mempoolFileMagic))
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(magic, mempoolFileMagic) {
+		return nil, nil, ErrInvalidMempoolFile
+	}
+	var version uint32
+	if err = binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, nil, err
+	}
+	if version != mempoolFileVersion {
+		return nil, nil, ErrMempoolFileVersion
+	}
+
+	var count uint32
+	if err = binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, nil, err
+	}
+	for i := uint32(0); i < count; i++ {
+		var added, fee int64
+		entry := &poolFileEntry{}
+		if err = binary.Read(r, binary.LittleEndian, &added); err != nil {
+			return nil, nil, err
+		}
+		if err = binary.Read(r, binary.LittleEndian, &entry.height); err != nil {
+			return nil, nil, err
+		}
+		if err = binary.Read(r, binary.LittleEndian, &fee); err != nil {
+			return nil, nil, err
+		}
+		if entry.fee, err = massutil.NewAmountFromInt(fee); err != nil {
+			return nil, nil, err
+		}
+		if entry.tx, err = readPoolFileTx(r); err != nil {
+			return nil, nil, err
+		}
+		entry.added = time.Unix(0, added)
+		txs = append(txs, entry)
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, nil, err
+	}
+	for i := uint32(0); i < count; i++ {
+		tx, err := readPoolFileTx(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		orphans = append(orphans, tx)
+	}
+	return txs, orphans, nil
+}
+
+// LoadFromFile reads the transactions and orphans saved by SaveToFile, and
+// adds them back to the pool.  Every transaction is validated again against
+// the current best chain, those no longer valid are dropped, and those whose
+// parents are missing are kept as orphans.  It does nothing if the file does
+// not exist.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	txs, orphans, err := readMempool(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		logging.CPrint(logging.ERROR, "failed to read mempool file", logging.LogFormat{
+			"path": path,
+			"err":  err,
+		})
+		return err
+	}
+
+	// Parents are always added to the pool earlier than their children.
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].added.Before(txs[j].added)
+	})
+
+	tp.Lock()
+	defer tp.Unlock()
+
+	var accepted, orphaned, dropped int
+	count := func(isOrphan bool, err error) {
+		switch {
+		case err != nil:
+			dropped++
+		case isOrphan:
+			orphaned++
+		default:
+			accepted++
+		}
+	}
+	for _, entry := range txs {
+		isOrphan, err := tp.reloadTransaction(entry.tx)
+		count(isOrphan, err)
+		if err == nil && !isOrphan {
+			// Restore the metadata of the transaction.
+			if txD, ok := tp.pool[*entry.tx.Hash()]; ok {
+				txD.Added = entry.added
+				txD.Height = entry.height
+				if txD.Fee.Cmp(entry.fee) != 0 {
+					logging.CPrint(logging.DEBUG, "fee of reloaded transaction changed", logging.LogFormat{
+						"tx":      entry.tx.Hash(),
+						"saved":   entry.fee,
+						"current": txD.Fee,
+					})
+				}
+			}
+		}
+	}
+	for _, tx := range orphans {
+		count(tp.reloadTransaction(tx))
+	}
+
+	logging.CPrint(logging.INFO, "mempool loaded", logging.LogFormat{
+		"path":     path,
+		"accepted": accepted,
+		"orphans":  orphaned,
+		"dropped":  dropped,
+	})
+	return nil
+}
+
+// reloadTransaction validates tx and adds it to either the pool or the
+// orphan pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (tp *TxPool) reloadTransaction(tx *massutil.Tx) (isOrphan bool, err error) {
+	missingParents, err := tp.maybeAcceptTransaction(tx, false, false)
+	if err == nil && len(missingParents) > 0 {
+		isOrphan = true
+		err = tp.orphanTxPool.maybeAddOrphan(tx, "")
+	}
+	if err != nil {
+		logging.CPrint(logging.DEBUG, "drop transaction from mempool file", logging.LogFormat{
+			"tx":  tx.Hash(),
+			"err": err,
+		})
+		return isOrphan, err
+	}
+	if !isOrphan {
+		tp.processOrphans(tx.Hash())
+	}
+	return isOrphan, nil
+}
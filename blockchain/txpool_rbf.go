@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+const (
+	// MaxRBFSequence is the max sequence number of an input to signal that
+	// the transaction is replaceable by fee.
+	MaxRBFSequence = wire.MaxTxInSequenceNum - 2
+
+	// maxReplacementEvictions is the max number of transactions, including
+	// descendants, that can be evicted by a replacement.
+	maxReplacementEvictions = 100
+)
+
+// signalsReplacement returns whether or not the transaction in the pool can
+// be replaced, either because one of its inputs has a sequence number no
+// greater than MaxRBFSequence, or because one of its unconfirmed ancestors
+// does.  The cache memorizes results of transactions already checked.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) signalsReplacement(tx *massutil.Tx, cache map[wire.Hash]bool) bool {
+	if signals, ok := cache[*tx.Hash()]; ok {
+		return signals
+	}
+	cache[*tx.Hash()] = false
+
+	for _, txIn := range tx.MsgTx().TxIn {
+		if txIn.Sequence <= MaxRBFSequence {
+			cache[*tx.Hash()] = true
+			return true
+		}
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		parent, exists := tp.pool[txIn.PreviousOutPoint.Hash]
+		if exists && tp.signalsReplacement(parent.Tx, cache) {
+			cache[*tx.Hash()] = true
+			return true
+		}
+	}
+	return false
+}
+
+// directConflicts returns the transactions in the pool that spend any of the
+// outputs spent by tx.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) directConflicts(tx *massutil.Tx) map[wire.Hash]*TxDesc {
+	conflicts := make(map[wire.Hash]*TxDesc)
+	for _, txIn := range tx.MsgTx().TxIn {
+		if conflict, exists := tp.outpoints[txIn.PreviousOutPoint]; exists {
+			conflicts[*conflict.Hash()] = tp.pool[*conflict.Hash()]
+		}
+	}
+	return conflicts
+}
+
+// validateReplacement checks whether or not tx can replace the transactions
+// it conflicts with in the pool, and returns all the transactions to be
+// replaced, including descendants of the conflicts.  The replacement must pay
+// a higher fee rate than every conflict, pay for all the replaced
+// transactions plus its own relay fee, not spend outputs of any replaced
+// transaction, and not replace more than maxReplacementEvictions.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (tp *TxPool) validateReplacement(tx *massutil.Tx, txFee massutil.Amount, size int64) (map[wire.Hash]*TxDesc, error) {
+	txHash := tx.Hash()
+	feePerKB := float64(txFee.IntValue()) / (float64(size) / 1000)
+
+	replacing := make(map[wire.Hash]*TxDesc)
+	for _, conflict := range tp.directConflicts(tx) {
+		if feePerKB <= conflict.feePerKB() {
+			logging.CPrint(logging.DEBUG, "replacement transaction pays insufficient fee rate",
+				logging.LogFormat{"txHash": txHash, "feePerKB": feePerKB,
+					"conflict": conflict.Tx.Hash(), "conflictFeePerKB": conflict.feePerKB()})
+			return nil, ErrReplacementFeeRate
+		}
+		tp.descendants(conflict, replacing)
+		if len(replacing) > maxReplacementEvictions {
+			logging.CPrint(logging.DEBUG, "replacement transaction evicts too many transactions",
+				logging.LogFormat{"txHash": txHash, "max": maxReplacementEvictions})
+			return nil, ErrTooManyReplacements
+		}
+	}
+
+	for _, txIn := range tx.MsgTx().TxIn {
+		if _, exists := replacing[txIn.PreviousOutPoint.Hash]; exists {
+			logging.CPrint(logging.DEBUG, "replacement transaction spends output of transaction it replaces",
+				logging.LogFormat{"txHash": txHash, "output": txIn.PreviousOutPoint})
+			return nil, ErrReplacementSpendsConflict
+		}
+	}
+
+	requiredFee, err := CalcMinRequiredTxRelayFee(size, massutil.MinRelayTxFee())
+	if err != nil {
+		return nil, err
+	}
+	for _, txD := range replacing {
+		if requiredFee, err = requiredFee.Add(txD.Fee); err != nil {
+			return nil, err
+		}
+	}
+	if txFee.Cmp(requiredFee) < 0 {
+		logging.CPrint(logging.DEBUG, "replacement transaction pays insufficient fee",
+			logging.LogFormat{"txHash": txHash, "txFee": txFee, "requiredFee": requiredFee})
+		return nil, ErrReplacementFee
+	}
+	return replacing, nil
+}
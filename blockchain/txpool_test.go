@@ -7,14 +7,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/massnetorg/mass-core/blockchain/state"
 	"github.com/massnetorg/mass-core/config"
 	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/errors"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/massutil/safetype"
+	"github.com/massnetorg/mass-core/trie/rawdb"
 	"github.com/massnetorg/mass-core/txscript"
 	"github.com/massnetorg/mass-core/wire"
 )
@@ -318,7 +323,7 @@ func TestTxPool_checkPoolDoubleSpend(t *testing.T) {
 
 	tx := massutil.NewTx(grandTx)
 	txP.addTransaction(massutil.NewTx(grandTx), 27, 100.0, massutil.ZeroAmount(), massutil.ZeroAmount())
-	err = txP.checkPoolDoubleSpend(tx)
+	_, err = txP.checkPoolDoubleSpend(tx)
 	assert.Equal(t, ErrDoubleSpend, err)
 
 	grandTx, err = getTx("grandChild")
@@ -792,7 +797,7 @@ func TestTxPool_RemoveOrphan(t *testing.T) {
 	msgtx, err := getTx("orphanTxStr")
 	assert.Nil(t, err)
 	tx := massutil.NewTx(msgtx)
-	err = txP.orphanTxPool.maybeAddOrphan(tx)
+	err = txP.orphanTxPool.maybeAddOrphan(tx, "")
 	assert.Nil(t, err)
 	assert.True(t, txP.IsOrphanInPool(tx.Hash()))
 	txP.RemoveOrphan(tx.Hash())
@@ -884,3 +889,367 @@ func TestTxPool_MaybeAcceptTransaction_LockTime(t *testing.T) {
 	_, err = txP.maybeAcceptTransaction(tx, true, true)
 	assert.Equal(t, ErrImmatureSpend, err)
 }
+
+func TestTxPool_SaveAndLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mempool")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mempool.dat")
+
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	// nothing to load
+	assert.Nil(t, txP.LoadFromFile(path))
+
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	tx := massutil.NewTx(msgtx)
+	_, err = txP.maybeAcceptTransaction(tx, true, true)
+	assert.Nil(t, err)
+	txD := *txP.pool[*tx.Hash()]
+	txD.Added = time.Unix(1600000000, 0)
+	txP.pool[*tx.Hash()].Added = txD.Added
+
+	msgtx, err = getTx("orphanTxStr")
+	assert.Nil(t, err)
+	orphan := massutil.NewTx(msgtx)
+	isOrphan, err := txP.ProcessTransaction(orphan, true, true)
+	assert.Nil(t, err)
+	assert.True(t, isOrphan)
+
+	assert.Nil(t, txP.SaveToFile(path))
+	txP.RemoveTransaction(tx, true)
+	txP.RemoveOrphan(orphan.Hash())
+	assert.Equal(t, 0, txP.Count())
+	assert.False(t, txP.IsOrphanInPool(orphan.Hash()))
+
+	assert.Nil(t, txP.LoadFromFile(path))
+	assert.Equal(t, 1, txP.Count())
+	assert.True(t, txP.IsOrphanInPool(orphan.Hash()))
+	loaded := txP.pool[*tx.Hash()]
+	assert.NotNil(t, loaded)
+	assert.True(t, txD.Added.Equal(loaded.Added))
+	assert.Equal(t, txD.Height, loaded.Height)
+	assert.Equal(t, txD.Fee, loaded.Fee)
+
+	// reloading transactions already in the pool changes nothing
+	assert.Nil(t, txP.LoadFromFile(path))
+	assert.Equal(t, 1, txP.Count())
+	assert.True(t, txD.Added.Equal(txP.pool[*tx.Hash()].Added))
+
+	// unsupported version
+	bs, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	bs[len(mempoolFileMagic)]++
+	assert.Nil(t, ioutil.WriteFile(path, bs, 0600))
+	assert.Equal(t, ErrMempoolFileVersion, txP.LoadFromFile(path))
+}
+
+func TestTxPool_SizeLimit(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	// child1 pays a lower fee rate than child2, they don't fit in the pool
+	// together
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	child1 := massutil.NewTx(msgtx)
+	msgtx, err = getTx("child2")
+	assert.Nil(t, err)
+	child2 := massutil.NewTx(msgtx)
+	size1, size2 := int64(child1.MsgTx().PlainSize()), int64(child2.MsgTx().PlainSize())
+
+	defer func(size int64) { config.MaxTxPoolSize = size }(config.MaxTxPoolSize)
+	config.MaxTxPoolSize = size1 + size2 - 1
+
+	_, err = txP.MaybeAcceptTransaction(child2, true, false)
+	assert.Nil(t, err)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrTxPoolFull, err)
+	assert.Equal(t, size2, txP.Size())
+	assert.Equal(t, massutil.MinRelayTxFee(), txP.MinRelayTxFee())
+
+	// child1 is evicted for child2
+	txP.RemoveTransaction(child2, true)
+	assert.Equal(t, int64(0), txP.Size())
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+	_, err = txP.MaybeAcceptTransaction(child2, true, false)
+	assert.Nil(t, err)
+	assert.False(t, txP.IsTransactionInPool(child1.Hash()))
+	assert.True(t, txP.IsTransactionInPool(child2.Hash()))
+	assert.Equal(t, size2, txP.Size())
+
+	// minimum relay fee is raised above the fee rate of child1
+	assert.True(t, txP.MinRelayTxFee().Cmp(massutil.MinRelayTxFee()) > 0)
+	txP.RemoveTransaction(child2, true)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrInsufficientFee, err)
+
+	// and decays over time
+	txP.lastRollingFeeUpdate = txP.lastRollingFeeUpdate.Add(-100 * rollingMinFeeHalfLife)
+	assert.Equal(t, massutil.MinRelayTxFee(), txP.MinRelayTxFee())
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+}
+
+func TestTxPool_Expiry(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	child1 := massutil.NewTx(msgtx)
+	msgtx, err = getTx("child2")
+	assert.Nil(t, err)
+	child2 := massutil.NewTx(msgtx)
+
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+	_, err = txP.MaybeAcceptTransaction(child2, true, false)
+	assert.Nil(t, err)
+
+	txP.pool[*child1.Hash()].Added = time.Now().Add(-config.TxPoolExpiry - time.Minute)
+	txP.expireTransactions()
+	assert.False(t, txP.IsTransactionInPool(child1.Hash()))
+	assert.True(t, txP.IsTransactionInPool(child2.Hash()))
+	assert.Equal(t, int64(child2.MsgTx().PlainSize()), txP.Size())
+}
+
+func TestTxPool_ReplaceByFee(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	txP.SetNewTxCh(make(chan *massutil.Tx, 2000))
+
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	child1 := massutil.NewTx(msgtx)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+	fee := txP.pool[*child1.Hash()].Fee.IntValue()
+	txP.RemoveTransaction(child1, true)
+
+	// newConflict adds a transaction spending the same outputs as child1.
+	newConflict := func(sequence uint64, fee int64) *massutil.Tx {
+		bs, err := msgtx.Bytes(wire.Packet)
+		assert.Nil(t, err)
+		conflict := wire.NewMsgTx()
+		assert.Nil(t, conflict.SetBytes(bs, wire.Packet))
+		conflict.TxIn[0].Sequence = sequence
+		conflict.LockTime++
+		tx := massutil.NewTx(conflict)
+		amt, err := massutil.NewAmountFromInt(fee)
+		assert.Nil(t, err)
+		assert.Nil(t, txP.addTransaction(tx, 25, 0, massutil.ZeroAmount(), amt))
+		return tx
+	}
+	// newChild adds a transaction spending the first output of parent.
+	newChild := func(parent *massutil.Tx) *massutil.Tx {
+		child := wire.NewMsgTx()
+		child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent.Hash(), 0), nil))
+		child.AddTxOut(wire.NewTxOut(parent.MsgTx().TxOut[0].Value, parent.MsgTx().TxOut[0].PkScript))
+		tx := massutil.NewTx(child)
+		assert.Nil(t, txP.addTransaction(tx, 25, 0, massutil.ZeroAmount(), massutil.ZeroAmount()))
+		return tx
+	}
+
+	// conflict does not signal replaceability
+	conflict := newConflict(wire.MaxTxInSequenceNum, 0)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrDoubleSpend, err)
+	txP.RemoveTransaction(conflict, true)
+
+	// conflict pays higher fee rate
+	conflict = newConflict(MaxRBFSequence, fee+1)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrReplacementFeeRate, err)
+	txP.RemoveTransaction(conflict, true)
+
+	// replacement does not pay for its own relay fee
+	conflict = newConflict(MaxRBFSequence, fee-1)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrReplacementFee, err)
+	txP.RemoveTransaction(conflict, true)
+
+	// too many descendants are evicted
+	conflict = newConflict(MaxRBFSequence, 0)
+	for i, parent := 0, conflict; i < maxReplacementEvictions; i++ {
+		parent = newChild(parent)
+	}
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrTooManyReplacements, err)
+	txP.RemoveTransaction(conflict, true)
+	assert.Equal(t, 0, txP.Count())
+
+	// conflict is replaced together with its descendants
+	conflict = newConflict(MaxRBFSequence, 0)
+	child := newChild(conflict)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+	assert.True(t, txP.IsTransactionInPool(child1.Hash()))
+	assert.False(t, txP.IsTransactionInPool(conflict.Hash()))
+	assert.False(t, txP.IsTransactionInPool(child.Hash()))
+	assert.Equal(t, 1, txP.Count())
+	assert.Equal(t, int64(child1.MsgTx().PlainSize()), txP.Size())
+}
+
+func TestTxPool_TestAccept(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	child1 := massutil.NewTx(msgtx)
+	msgtx, err = getTx("orphanTxStr")
+	assert.Nil(t, err)
+	orphan := massutil.NewTx(msgtx)
+
+	// copyTx returns a copy of child1 with a different hash.
+	copyTx := func(modify func(msgTx *wire.MsgTx)) *massutil.Tx {
+		bs, err := child1.MsgTx().Bytes(wire.Packet)
+		assert.Nil(t, err)
+		msgTx := wire.NewMsgTx()
+		assert.Nil(t, msgTx.SetBytes(bs, wire.Packet))
+		modify(msgTx)
+		return massutil.NewTx(msgTx)
+	}
+	bigPayload := copyTx(func(msgTx *wire.MsgTx) {
+		msgTx.Payload = make([]byte, maxTxPoolTxPayload+1)
+	})
+
+	results := txP.TestAccept([]*massutil.Tx{child1, orphan, bigPayload})
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, *child1.Hash(), results[0].TxHash)
+	assert.True(t, results[0].Accepted)
+	assert.Equal(t, RejectNone, results[0].RejectCode)
+	assert.True(t, results[0].Fee.IntValue() > 0)
+	assert.Equal(t, int64(child1.MsgTx().PlainSize()), results[0].VirtualSize)
+	assert.False(t, results[1].Accepted)
+	assert.Equal(t, RejectMissingInputs, results[1].RejectCode)
+	assert.False(t, results[2].Accepted)
+	assert.Equal(t, RejectPayloadTooLarge, results[2].RejectCode)
+	assert.Equal(t, ErrTxMsgPayloadSize, results[2].Err)
+	// pool is not changed
+	assert.Equal(t, 0, txP.Count())
+	assert.Equal(t, 0, txP.orphanTxPool.pool.Count())
+
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Nil(t, err)
+	fee := txP.pool[*child1.Hash()].Fee
+
+	conflict := copyTx(func(msgTx *wire.MsgTx) {
+		msgTx.LockTime++
+	})
+	results = txP.TestAccept([]*massutil.Tx{child1, conflict})
+	assert.Equal(t, RejectDuplicate, results[0].RejectCode)
+	assert.Equal(t, RejectDoubleSpend, results[1].RejectCode)
+	assert.Equal(t, ErrDoubleSpend, results[1].Err)
+	assert.Equal(t, 1, txP.Count())
+	assert.Equal(t, fee, txP.pool[*child1.Hash()].Fee)
+}
+
+func TestTxPool_ProcessPackage(t *testing.T) {
+	txP, close, err := newTxPool(25)
+	assert.Nil(t, err)
+	defer close()
+
+	var txs []*massutil.Tx
+	for _, name := range []string{"child1", "child2", "orphanTxStr"} {
+		msgtx, err := getTx(name)
+		assert.Nil(t, err)
+		txs = append(txs, massutil.NewTx(msgtx))
+	}
+	child1, child2, orphan := txs[0], txs[1], txs[2]
+
+	_, err = txP.ProcessPackage(nil)
+	assert.Equal(t, ErrInvalidPackage, err)
+	_, err = txP.ProcessPackage([]*massutil.Tx{child1, child1})
+	assert.Equal(t, ErrInvalidPackage, err)
+	_, err = txP.ProcessPackage(make([]*massutil.Tx, maxPackageCount+1))
+	assert.Equal(t, ErrPackageTooLarge, err)
+
+	// Nothing is accepted if any transaction is rejected.
+	_, err = txP.ProcessPackage([]*massutil.Tx{child1, orphan})
+	assert.Equal(t, ErrPackageMissingInputs, err)
+	assert.Equal(t, 0, txP.Count())
+
+	// child1 pays lower fee rate than the pool requires, while the package
+	// pays enough.
+	setMinFee := func(feePerKB float64) {
+		txP.rollingMinFeeRate = feePerKB
+		txP.lastRollingFeeUpdate = time.Now()
+	}
+	setMinFee(2.2e9)
+	_, err = txP.MaybeAcceptTransaction(child1, true, false)
+	assert.Equal(t, ErrInsufficientFee, err)
+	setMinFee(2.5e9)
+	_, err = txP.ProcessPackage([]*massutil.Tx{child1, child2})
+	assert.Equal(t, ErrInsufficientFee, err)
+	assert.Equal(t, 0, txP.Count())
+	assert.Equal(t, int64(0), txP.Size())
+
+	setMinFee(2.2e9)
+	accepted, err := txP.ProcessPackage([]*massutil.Tx{child1, child2})
+	assert.Nil(t, err)
+	assert.Equal(t, []*massutil.Tx{child1, child2}, accepted)
+	assert.True(t, txP.IsTransactionInPool(child1.Hash()))
+	assert.True(t, txP.IsTransactionInPool(child2.Hash()))
+	assert.Equal(t, int64(child1.MsgTx().PlainSize()+child2.MsgTx().PlainSize()), txP.Size())
+
+	// Transactions already in the pool are skipped.
+	accepted, err = txP.ProcessPackage([]*massutil.Tx{child1, child2})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(accepted))
+}
+
+func TestTxPool_PersistAcrossRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mempool")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := newTestChainDb()
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, loadTestBlksIntoTestChainDb(db, 25))
+	bindingDb, err := rawdb.NewLevelDBDatabase(filepath.Join(dir, "bindingstate"), 0, 0, "", false)
+	assert.Nil(t, err)
+	defer bindingDb.Close()
+
+	cfg := &Config{
+		DB:               db,
+		StateBindingDb:   state.NewDatabase(bindingDb),
+		ChainParams:      &config.ChainParams,
+		CachePath:        filepath.Join(dir, BlockCacheFileName),
+		MempoolPath:      filepath.Join(dir, MempoolFileName),
+		FeeEstimatesPath: filepath.Join(dir, FeeEstimatesFileName),
+	}
+	bc, err := NewBlockchain(cfg)
+	assert.Nil(t, err)
+	bc.GetTxPool().SetNewTxCh(make(chan *massutil.Tx, 50))
+
+	msgtx, err := getTx("child1")
+	assert.Nil(t, err)
+	tx := massutil.NewTx(msgtx)
+	_, err = bc.ProcessTx(tx)
+	assert.Nil(t, err)
+
+	// Stop saves the pool once
+	assert.Nil(t, bc.Stop())
+	assert.Nil(t, bc.Stop())
+	_, err = os.Stat(cfg.MempoolPath)
+	assert.Nil(t, err)
+	_, err = os.Stat(cfg.FeeEstimatesPath)
+	assert.Nil(t, err)
+
+	bc2, err := NewBlockchain(cfg)
+	assert.Nil(t, err)
+	defer bc2.Stop()
+	assert.True(t, bc2.GetTxPool().HaveTransaction(tx.Hash()))
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/errors"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// RejectCode identifies the reason why a transaction is rejected by the pool.
+type RejectCode int
+
+const (
+	// RejectNone means the transaction is accepted.
+	RejectNone RejectCode = iota
+
+	// RejectInvalid means the transaction breaks consensus rules, or is
+	// rejected for a reason not covered by other codes.
+	RejectInvalid
+
+	// RejectDuplicate means the transaction is already in the pool or in
+	// the main chain.
+	RejectDuplicate
+
+	// RejectMissingInputs means the transaction is an orphan.
+	RejectMissingInputs
+
+	// RejectDust means the transaction has a dust output.
+	RejectDust
+
+	// RejectNonStandard means the transaction breaks the standard policy.
+	RejectNonStandard
+
+	// RejectInsufficientFee means the transaction pays a fee too low to be
+	// accepted, or to replace the transactions it conflicts with.
+	RejectInsufficientFee
+
+	// RejectDoubleSpend means the transaction spends outputs already spent
+	// by transactions in the pool that can not be replaced.
+	RejectDoubleSpend
+
+	// RejectBindingInPool means the binding target of the transaction is
+	// already bound by a transaction in the pool.
+	RejectBindingInPool
+
+	// RejectPayloadTooLarge means the payload of the transaction exceeds
+	// the max size allowed by the pool.
+	RejectPayloadTooLarge
+)
+
+var rejectCodeStrings = map[RejectCode]string{
+	RejectNone:            "none",
+	RejectInvalid:         "invalid",
+	RejectDuplicate:       "duplicate",
+	RejectMissingInputs:   "missing inputs",
+	RejectDust:            "dust",
+	RejectNonStandard:     "non-standard",
+	RejectInsufficientFee: "insufficient fee",
+	RejectDoubleSpend:     "double spend",
+	RejectBindingInPool:   "binding target in pool",
+	RejectPayloadTooLarge: "payload too large",
+}
+
+// String returns the RejectCode in human-readable form.
+func (code RejectCode) String() string {
+	if s, ok := rejectCodeStrings[code]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// rejectCode maps an error returned by maybeAcceptTransaction to RejectCode.
+func rejectCode(err error) RejectCode {
+	switch err {
+	case nil:
+		return RejectNone
+	case errors.ErrTxAlreadyExists:
+		return RejectDuplicate
+	case ErrDust:
+		return RejectDust
+	case ErrInvalidTxVersion, ErrUnfinalizedTx, ErrNonStandardTxSize, ErrWitnessLength,
+		ErrWitnessSize, ErrSignaturePushOnly, ErrNuLLDataScript, ErrNonStandardType,
+		ErrParseInputScript, ErrExpectedSignInput, ErrStandardBindingTx, ErrTooManySigOps:
+		return RejectNonStandard
+	case ErrInsufficientFee, ErrInsufficientPriority, ErrTxPoolFull, ErrFeeForPoolPkCoinbase,
+		ErrReplacementFee, ErrReplacementFeeRate:
+		return RejectInsufficientFee
+	case ErrDoubleSpend, ErrTooManyReplacements, ErrReplacementSpendsConflict:
+		return RejectDoubleSpend
+	case ErrBindingTargetInPool:
+		return RejectBindingInPool
+	case ErrTxMsgPayloadSize:
+		return RejectPayloadTooLarge
+	default:
+		return RejectInvalid
+	}
+}
+
+// TestAcceptResult is the result of TestAccept for a transaction.
+type TestAcceptResult struct {
+	TxHash   wire.Hash
+	Accepted bool
+	Fee      massutil.Amount
+	// VirtualSize is the size used to calculate the fee rate of the
+	// transaction.
+	VirtualSize int64
+	RejectCode  RejectCode
+	// Err is the error returned by the pool, nil if accepted.
+	Err error
+}
+
+// TestAccept checks whether or not each of txs would be accepted by the pool,
+// running the same checks as MaybeAcceptTransaction without changing the
+// pool.  Each transaction is checked on its own against the current pool, so
+// a transaction spending outputs of another one in txs is reported as missing
+// inputs.  Free transactions are not counted by the rate limiter.
+//
+// This function is safe for concurrent access.
+func (tp *TxPool) TestAccept(txs []*massutil.Tx) []*TestAcceptResult {
+	tp.Lock()
+	defer tp.Unlock()
+
+	results := make([]*TestAcceptResult, 0, len(txs))
+	for _, tx := range txs {
+		result := &TestAcceptResult{TxHash: *tx.Hash(), Fee: massutil.ZeroAmount()}
+		results = append(results, result)
+
+		acceptance, missingParents, err := tp.checkAcceptTransaction(tx, true, false, false)
+		if err == nil && len(missingParents) > 0 {
+			result.RejectCode = RejectMissingInputs
+			result.Err = ErrMissingTx
+			continue
+		}
+		if err == nil {
+			result.Fee = acceptance.fee
+			result.VirtualSize = acceptance.size
+			feePerKB := float64(acceptance.fee.IntValue()) / (float64(acceptance.size) / 1000)
+			_, _, err = tp.sizeLimitEvictions([]*massutil.Tx{tx}, acceptance.size, feePerKB, acceptance.replacing)
+		}
+		result.Accepted = err == nil
+		result.RejectCode = rejectCode(err)
+		result.Err = err
+	}
+	return results
+}
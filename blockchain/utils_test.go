@@ -9,6 +9,7 @@ import (
 	"github.com/massnetorg/mass-core/config"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/poc/chiapos"
+	"github.com/massnetorg/mass-core/trie"
 	"github.com/massnetorg/mass-core/trie/common"
 	"github.com/massnetorg/mass-core/trie/rawdb"
 	"github.com/stretchr/testify/require"
@@ -85,3 +86,43 @@ func TestGetPutNetworkBinding(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, amt.IntValue() == 1000)
 }
+
+func TestVerifyBindingProof(t *testing.T) {
+	stateDb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	bst, err := stateDb.OpenBindingTrie(common.Hash{})
+	require.NoError(t, err)
+
+	scripts := make([][]byte, 20)
+	for i := range scripts {
+		scripts[i] = bytes.Repeat([]byte{byte(i)}, 22)
+		if i%2 == 0 {
+			info := &state.BindingInfo{Amount: int64(i+1) * 1e8}
+			require.NoError(t, bst.TryUpdate(scripts[i], state.EncodeBindingInfo(info)))
+		}
+	}
+	root, err := bst.Commit()
+	require.NoError(t, err)
+	bst, err = stateDb.OpenBindingTrie(root)
+	require.NoError(t, err)
+
+	for i, script := range scripts {
+		var proof trie.ProofList
+		require.NoError(t, bst.Prove(script, 0, &proof))
+		info, err := state.VerifyBindingProof(root, script, proof)
+		require.NoError(t, err)
+		if i%2 == 0 {
+			require.Equal(t, int64(i+1)*1e8, info.Amount)
+		} else {
+			require.Nil(t, info)
+		}
+
+		// proof against another root
+		_, err = state.VerifyBindingProof(common.Hash{0x01}, script, proof)
+		require.Error(t, err)
+	}
+
+	// empty binding state
+	info, err := state.VerifyBindingProof(common.Hash{}, scripts[0], nil)
+	require.NoError(t, err)
+	require.Nil(t, info)
+}
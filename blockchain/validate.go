@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/massnetorg/mass-core/blockchain/state"
@@ -19,6 +20,7 @@ import (
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/poc"
 	"github.com/massnetorg/mass-core/poc/pocutil"
+	"github.com/massnetorg/mass-core/pocec"
 	"github.com/massnetorg/mass-core/txscript"
 	"github.com/massnetorg/mass-core/wire"
 )
@@ -251,9 +253,10 @@ func CheckTransactionSanity(tx *massutil.Tx) error {
 // checkProofOfCapacity ensures the block header Target
 // is in min/max range and that the block's proof quality is less than the
 // Target difficulty as claimed.
-func checkProofOfCapacity(header *wire.BlockHeader, pocLimit *big.Int) error {
+func checkProofOfCapacity(params consensus.DeploymentChecker, header *wire.BlockHeader, pocLimit *big.Int) error {
 	// match proof type with header version
-	if !forks.EnforceMASSIP0002(header.Height) && header.Proof.Type() != poc.ProofTypeDefault {
+	massip2 := forks.EnforceMASSIP0002(params, header.Height)
+	if !massip2 && header.Proof.Type() != poc.ProofTypeDefault {
 		return ErrInvalidProofType
 	}
 
@@ -281,7 +284,7 @@ func checkProofOfCapacity(header *wire.BlockHeader, pocLimit *big.Int) error {
 
 	pubKeyHash := pocutil.PubKeyItfHash(header.PubKey)
 	slot := uint64(header.Timestamp.Unix()) / poc.PoCSlot
-	quality, err := header.Proof.VerifiedQuality(pubKeyHash, pocutil.Hash(header.Challenge), forks.EnforceMASSIP0002(header.Height), slot, header.Height)
+	quality, err := header.Proof.VerifiedQualityAt(pubKeyHash, pocutil.Hash(header.Challenge), massip2, slot, header.Height, massip2)
 	if err != nil {
 		return err
 	}
@@ -297,8 +300,8 @@ func checkProofOfCapacity(header *wire.BlockHeader, pocLimit *big.Int) error {
 // CheckProofOfWork ensures the block header bits which indicate the Target
 // difficulty is in min/max range and that the block's proof quality is less than the
 // Target difficulty as claimed.
-func CheckProofOfCapacity(block *massutil.Block, pocLimit *big.Int) error {
-	return checkProofOfCapacity(&block.MsgBlock().Header, pocLimit)
+func CheckProofOfCapacity(params consensus.DeploymentChecker, block *massutil.Block, pocLimit *big.Int) error {
+	return checkProofOfCapacity(params, &block.MsgBlock().Header, pocLimit)
 }
 
 func checkChainID(header *wire.BlockHeader, chainID wire.Hash) error {
@@ -311,8 +314,8 @@ func checkChainID(header *wire.BlockHeader, chainID wire.Hash) error {
 	return nil
 }
 
-func checkVersion(header *wire.BlockHeader) error {
-	requiredVersion := forks.GetBlockVersion(header.Height)
+func checkVersion(params consensus.DeploymentChecker, header *wire.BlockHeader) error {
+	requiredVersion := forks.GetBlockVersion(params, header.Height)
 	if header.Version < requiredVersion {
 		logging.CPrint(logging.ERROR, "invalid block version",
 			logging.LogFormat{"err": ErrInvalidBlockVersion, "block_version": header.Version, "required_version": requiredVersion})
@@ -350,10 +353,17 @@ func checkHeaderTimestamp(header *wire.BlockHeader) error {
 	return nil
 }
 
-func checkHeaderBanList(header *wire.BlockHeader) error {
+func checkHeaderBanList(params consensus.DeploymentChecker, header *wire.BlockHeader) error {
+	// only MASS miners are punished before MASSIP0002
+	enforceMassIp2 := forks.EnforceMASSIP0002(params, header.Height)
 	dupPk := make(map[string]struct{})
 	hpk := header.PublicKey().SerializeCompressed()
 	for _, bpk := range header.BannedPublicKeys() {
+		if _, ok := bpk.(*pocec.PublicKey); !ok && !enforceMassIp2 {
+			logging.CPrint(logging.ERROR, "non-MASS pubKey in header banList before MASSIP0002",
+				logging.LogFormat{"height": header.Height})
+			return ErrBanList
+		}
 		if bytes.Equal(hpk, bpk.SerializeCompressed()) {
 			logging.CPrint(logging.ERROR, "block's pubKey is banned in header banList",
 				logging.LogFormat{"pubkey": hex.EncodeToString(hpk)})
@@ -424,13 +434,13 @@ func CountSigOps(tx *massutil.Tx) int {
 //
 // The flags do not modify the behavior of this function directly, however they
 // are needed to pass along to checkProofOfWork.
-func checkBlockHeaderSanity(header *wire.BlockHeader, chainID wire.Hash, pocLimit *big.Int, flags BehaviorFlags) (err error) {
+func checkBlockHeaderSanity(params consensus.DeploymentChecker, header *wire.BlockHeader, chainID wire.Hash, pocLimit *big.Int, flags BehaviorFlags) (err error) {
 	err = checkChainID(header, chainID)
 	if err != nil {
 		return
 	}
 
-	err = checkVersion(header)
+	err = checkVersion(params, header)
 	if err != nil {
 		return
 	}
@@ -440,12 +450,12 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, chainID wire.Hash, pocLimi
 		return
 	}
 
-	err = checkHeaderBanList(header)
+	err = checkHeaderBanList(params, header)
 	if err != nil {
 		return
 	}
 
-	err = checkProofOfCapacity(header, pocLimit)
+	err = checkProofOfCapacity(params, header, pocLimit)
 	if err != nil {
 		return err
 	}
@@ -460,18 +470,18 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, chainID wire.Hash, pocLimi
 
 // checkBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
-func checkBlockSanity(block *massutil.Block, chainID wire.Hash, pocLimit *big.Int, flags BehaviorFlags) error {
+func checkBlockSanity(params consensus.DeploymentChecker, block *massutil.Block, chainID wire.Hash, pocLimit *big.Int, flags BehaviorFlags) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
 	proposals := &msgBlock.Proposals
 
 	if !flags.isFlagSet(BFNoPoCCheck) {
-		if err := checkBlockHeaderSanity(header, chainID, pocLimit, flags); err != nil {
+		if err := checkBlockHeaderSanity(params, header, chainID, pocLimit, flags); err != nil {
 			return err
 		}
 	}
 
-	if err := checkBlockProposalSanity(proposals, header, chainID); err != nil {
+	if err := checkBlockProposalSanity(params, proposals, header, chainID); err != nil {
 		return err
 	}
 
@@ -595,8 +605,8 @@ func checkBlockSanity(block *massutil.Block, chainID wire.Hash, pocLimit *big.In
 
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is
 // sane before continuing with block processing.  These checks are context free.
-func CheckBlockSanity(block *massutil.Block, chainID wire.Hash, pocLimit *big.Int) error {
-	return checkBlockSanity(block, chainID, pocLimit, BFNone)
+func CheckBlockSanity(params consensus.DeploymentChecker, block *massutil.Block, chainID wire.Hash, pocLimit *big.Int) error {
+	return checkBlockSanity(params, block, chainID, pocLimit, BFNone)
 }
 
 // checkBlockHeaderContext peforms several validation checks on the block header
@@ -1043,7 +1053,10 @@ func (chain *Blockchain) checkConnectBlock(node *BlockNode, block *massutil.Bloc
 		}
 	}
 
-	enforceMassIp2WarmUp := forks.EnforceMASSIP0002WarmUp(block.Height())
+	// The rules of the block follow the deployments of its own chain, which
+	// may be a side chain.
+	deployments := chain.deploymentsAt(node.Parent)
+	enforceMassIp2WarmUp := forks.EnforceMASSIP0002WarmUp(deployments, block.Height())
 	// Perform several checks on the inputs for each transaction.  Also
 	// accumulate the total fees.  This could technically be combined with
 	// the loop above instead of running another loop over the transactions,
@@ -1141,7 +1154,7 @@ func (chain *Blockchain) checkConnectBlock(node *BlockNode, block *massutil.Bloc
 			return err
 		}
 	}
-	if err := checkParsePkScriptNew(block.Height(), bst, nil, txInputStore, block.Transactions()...); err != nil {
+	if err := checkParsePkScriptNew(deployments, block.Height(), bst, nil, txInputStore, block.Transactions()...); err != nil {
 		logging.CPrint(logging.ERROR, "checkParsePkScript error", logging.LogFormat{"err": err})
 		return err
 	}
@@ -1153,9 +1166,16 @@ func (chain *Blockchain) checkConnectBlock(node *BlockNode, block *massutil.Bloc
 	// optimization because running the scripts is the most time consuming
 	// portion of block handling.
 	runScripts := true
+	stat := &chain.scriptStats.Checked
 	checkpoint := chain.LatestCheckpoint()
 	if (checkpoint != nil && node.Height <= checkpoint.Height) || block.IsFastImport() {
 		runScripts = false
+		stat = &chain.scriptStats.CheckpointSkipped
+	} else if chain.isAssumedValid(node) {
+		// Likewise, the scripts of the ancestors of the assume-valid block
+		// are trusted to be valid, while all other checks still run.
+		runScripts = false
+		stat = &chain.scriptStats.AssumeValidSkipped
 	}
 
 	// Now that the inexpensive checks are done and have passed, verify the
@@ -1163,23 +1183,27 @@ func (chain *Blockchain) checkConnectBlock(node *BlockNode, block *massutil.Bloc
 	// expensive ECDSA signature check scripts.  Doing this last helps
 	// prevent CPU exhaustion attacks.
 	if runScripts {
-		err := checkBlockScripts(block, txInputStore, scriptFlags, chain.sigCache, chain.hashCache)
+		err := checkBlockScripts(deployments, block, txInputStore, scriptFlags, chain.sigCache, chain.hashCache)
 		if err != nil {
 			return err
 		}
 	}
+	// block templates have no hash and are not counted
+	if node.Hash != nil {
+		atomic.AddUint64(stat, 1)
+	}
 
 	return nil
 }
 
-func checkFaultPkSanity(fpk *wire.FaultPubKey, chainID wire.Hash) error {
+func checkFaultPkSanity(params consensus.DeploymentChecker, fpk *wire.FaultPubKey, chainID wire.Hash) error {
 	if err := fpk.IsValid(); err != nil {
 		logging.CPrint(logging.ERROR, "invalid faultPk (checkFaultPkSanity)",
 			logging.LogFormat{"err": err})
 		return ErrCheckBannedPk
 	}
-	err0 := checkBlockHeaderSanity(fpk.Testimony[0], chainID, big.NewInt(0), BFNone)
-	err1 := checkBlockHeaderSanity(fpk.Testimony[1], chainID, big.NewInt(0), BFNone)
+	err0 := checkBlockHeaderSanity(params, fpk.Testimony[0], chainID, big.NewInt(0), BFNone)
+	err1 := checkBlockHeaderSanity(params, fpk.Testimony[1], chainID, big.NewInt(0), BFNone)
 	if err0 != nil || err1 != nil {
 		logging.CPrint(logging.ERROR, "invalid faultPk (checkFaultPkSanity, get bad testimony)", logging.LogFormat{"err0": err0, "err1": err1})
 		return ErrCheckBannedPk
@@ -1187,7 +1211,7 @@ func checkFaultPkSanity(fpk *wire.FaultPubKey, chainID wire.Hash) error {
 	return nil
 }
 
-func checkBlockProposalSanity(pa *wire.ProposalArea, header *wire.BlockHeader, chainID wire.Hash) error {
+func checkBlockProposalSanity(params consensus.DeploymentChecker, pa *wire.ProposalArea, header *wire.BlockHeader, chainID wire.Hash) error {
 
 	bannedKeys := header.BannedPublicKeys()
 	if pa.PunishmentCount() != len(bannedKeys) {
@@ -1210,7 +1234,7 @@ func checkBlockProposalSanity(pa *wire.ProposalArea, header *wire.BlockHeader, c
 				logging.LogFormat{"index": index})
 			return ErrBanList
 		}
-		if err := checkFaultPkSanity(fpk, chainID); err != nil {
+		if err := checkFaultPkSanity(params, fpk, chainID); err != nil {
 			logging.CPrint(logging.ERROR, "banList contains invalid testimony (sanity check fail on index)",
 				logging.LogFormat{"index": index, "err": err.Error()})
 			return ErrBanList
@@ -44,20 +44,21 @@ func (chain *Blockchain) validateCoinbase(
 		return err
 	}
 
+	deployments := chain.deploymentsAt(node.Parent)
 	//     |--------- mass binding before massip2 warmup -------|---------- no binding and only mass miner before massip2 ------|------ binding required ------|
 	hasValidBinding := false
-	if !forks.EnforceMASSIP0002WarmUp(block.Height()) {
+	if !forks.EnforceMASSIP0002WarmUp(deployments, block.Height()) {
 		totalBinding, err := checkCoinbaseInputs(coinbaseTx, txInputStore, bindingTarget, net, node.Height)
 		if err != nil {
 			return err
 		}
-		requiredBinding, err := forks.GetRequiredBinding(block.Height(), 0, node.BitLength(), massutil.ZeroAmount())
+		requiredBinding, err := forks.GetRequiredBinding(deployments, block.Height(), 0, node.BitLength(), massutil.ZeroAmount())
 		if err != nil {
 			return err
 		}
 		hasValidBinding = totalBinding.Cmp(requiredBinding) >= 0
 
-	} else if forks.EnforceMASSIP0002(block.Height()) {
+	} else if forks.EnforceMASSIP0002(deployments, block.Height()) {
 		parentBindingState := reorgBindingState
 		if parentBindingState == nil { // TODO: maybe use flags is better
 			parentBindingState, err = node.ParentBindingState(chain.stateBindingDb)
@@ -257,14 +258,14 @@ func checkCoinbase(tx *massutil.Tx, stakingRanks []database.Rank, node *BlockNod
 	for _, snode := range stakingRanks {
 		stakingNodes = append(stakingNodes, snode)
 	}
-	totalWeight, err := forks.CalcTotalStakingWeight(nextBlockHeight, stakingNodes...)
+	totalWeight, err := forks.CalcTotalStakingWeight(net, nextBlockHeight, stakingNodes...)
 	if err != nil {
 		return massutil.ZeroAmount(), err
 	}
 
 	i := 0
 	for ; i < num; i++ {
-		nodeWeight, err := forks.CalcStakingNodeWeight(nextBlockHeight, stakingRanks[i])
+		nodeWeight, err := forks.CalcStakingNodeWeight(net, nextBlockHeight, stakingRanks[i])
 		if err != nil {
 			return massutil.ZeroAmount(), err
 		}
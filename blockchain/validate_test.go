@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/interfaces"
 	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/poc/chiapos"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,14 +31,14 @@ func TestCheckConnectBlock(t *testing.T) {
 	blk0, err := loadNthBlk(1)
 	assert.Nil(t, err)
 	genesisHash := blk0.Hash()
-	err = chain.checkConnectBlock(NewBlockNode(&blk0.MsgBlock().Header, genesisHash, BFNone), blk0, BFNone, nil)
+	err = chain.checkConnectBlock(NewBlockNode(chain.chainParams, &blk0.MsgBlock().Header, genesisHash, BFNone), blk0, BFNone, nil)
 	assert.Equal(t, ErrConnectGenesis, err)
 
 	blk1, err := loadNthBlk(2)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(1), blk1.Height())
 	blk1Hash := blk1.Hash()
-	err = chain.checkConnectBlock(NewBlockNode(&blk1.MsgBlock().Header, blk1Hash, BFNone), blk1, BFNone, nil)
+	err = chain.checkConnectBlock(NewBlockNode(chain.chainParams, &blk1.MsgBlock().Header, blk1Hash, BFNone), blk1, BFNone, nil)
 	assert.Nil(t, err)
 }
 
@@ -52,14 +54,14 @@ func TestCheckBlockSanity(t *testing.T) {
 	blk0, err := loadNthBlk(1)
 	assert.Nil(t, err)
 
-	err = CheckBlockSanity(block, blk0.MsgBlock().Header.ChainID, pocLimit)
+	err = CheckBlockSanity(&config.ChainParams, block, blk0.MsgBlock().Header.ChainID, pocLimit)
 	assert.Nil(t, err)
 
 	// Ensure a block that has a timestamp with a precision higher than one
 	// second fails.
 	timestamp := block.MsgBlock().Header.Timestamp
 	block.MsgBlock().Header.Timestamp = timestamp.Add(time.Nanosecond)
-	err = CheckBlockSanity(block, blk0.MsgBlock().Header.ChainID, pocLimit)
+	err = CheckBlockSanity(&config.ChainParams, block, blk0.MsgBlock().Header.ChainID, pocLimit)
 	assert.Equal(t, ErrInvalidTime, err)
 }
 
@@ -103,3 +105,24 @@ func TestCheckSerializedHeight(t *testing.T) {
 		})
 	}
 }
+
+// TestCheckHeaderBanList ensures non-MASS public keys are only accepted in
+// the header banList once MASSIP0002 is active on the chain.
+func TestCheckHeaderBanList(t *testing.T) {
+	block, err := loadNthBlk(22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := block.MsgBlock().Header
+	header.BanList = []interfaces.PublicKey{chiapos.NewG1ElementGenerator()}
+
+	err = checkHeaderBanList(&config.ChainParams, &header)
+	assert.Equal(t, ErrBanList, err)
+
+	err = checkHeaderBanList(config.NewRegressionNetParams(0), &header)
+	assert.Nil(t, err)
+
+	header.BanList = append(header.BanList, header.BanList[0])
+	err = checkHeaderBanList(config.NewRegressionNetParams(0), &header)
+	assert.Equal(t, ErrBanList, err)
+}
@@ -0,0 +1,364 @@
+package blockchain
+
+import (
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/consensus/forks"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// ThresholdState is the state of a signalled deployment in a period of
+// MinerConfirmationWindow blocks.
+type ThresholdState string
+
+const (
+	// ThresholdDefined is the first state of a deployment, until the period
+	// of its start height.
+	ThresholdDefined ThresholdState = "defined"
+
+	// ThresholdStarted is the state of a deployment whose signalling is
+	// counted.
+	ThresholdStarted ThresholdState = "started"
+
+	// ThresholdLockedIn is the state of a deployment for the period after
+	// the one RuleChangeActivationThreshold blocks signalled it in.
+	ThresholdLockedIn ThresholdState = "locked_in"
+
+	// ThresholdActive is the state of a deployment for all periods after
+	// the locked-in one, its rules are enforced.
+	ThresholdActive ThresholdState = "active"
+
+	// ThresholdFailed is the state of a deployment not locked in before its
+	// timeout height.
+	ThresholdFailed ThresholdState = "failed"
+)
+
+// DeploymentStatus describes a signalled deployment for the block after the
+// best block.
+type DeploymentStatus struct {
+	Name          string
+	Bit           uint8
+	StartHeight   uint64
+	TimeoutHeight uint64
+	State         ThresholdState
+	// Elapsed is the number of blocks of the current period on the best
+	// chain, and Count is the number of them signalling the deployment.
+	Elapsed uint64
+	Count   uint64
+}
+
+// parentNode returns the parent of node without changing the block tree, so
+// that deployments can be checked without the chain lock.  Parents below the
+// root of the block tree are loaded from the database as detached nodes, with
+// only the fields needed to check deployments.
+func (chain *Blockchain) parentNode(node *BlockNode) (*BlockNode, error) {
+	if parent, exists := chain.blockTree.parentBlockNode(node); exists {
+		return parent, nil
+	}
+	if node.Hash.IsEqual(chain.chainParams.GenesisHash) {
+		return nil, nil
+	}
+	header, err := chain.db.FetchBlockHeaderBySha(&node.Previous)
+	if err != nil {
+		return nil, err
+	}
+	hash := node.Previous
+	return &BlockNode{
+		Hash:     &hash,
+		Version:  header.Version,
+		Height:   header.Height,
+		Previous: header.Previous,
+	}, nil
+}
+
+// ancestorNode returns the ancestor of node at height, it loads the nodes
+// below the root of the block tree from the database if necessary.
+func (chain *Blockchain) ancestorNode(node *BlockNode, height uint64) (*BlockNode, error) {
+	for node != nil && node.Height > height {
+		parent, err := chain.parentNode(node)
+		if err != nil {
+			return nil, err
+		}
+		node = parent
+	}
+	return node, nil
+}
+
+// lastPeriodNode returns the last node of the period before the one of the
+// block after prevNode, or nil if that block is in the first period.
+func (chain *Blockchain) lastPeriodNode(prevNode *BlockNode) (*BlockNode, error) {
+	window := chain.chainParams.MinerConfirmationWindow
+	if prevNode == nil || prevNode.Height+1 < window {
+		return nil, nil
+	}
+	return chain.ancestorNode(prevNode, prevNode.Height-(prevNode.Height+1)%window)
+}
+
+// countSignals returns the number of the n blocks ending at node which signal
+// the deployment.
+func (chain *Blockchain) countSignals(node *BlockNode, n uint64, d *consensus.Deployment) (uint64, error) {
+	var count uint64
+	for i := uint64(0); i < n && node != nil; i++ {
+		if d.Signals(node.Version) {
+			count++
+		}
+		if i+1 == n {
+			break
+		}
+		parent, err := chain.parentNode(node)
+		if err != nil {
+			return 0, err
+		}
+		node = parent
+	}
+	return count, nil
+}
+
+// thresholdState returns the state of the signalled deployment d for the
+// block after prevNode.  States only change at the first block of a period,
+// they are cached by the hash of the last block of each period, so they
+// survive the nodes below the block tree being reloaded.
+func (chain *Blockchain) thresholdState(prevNode *BlockNode, d *consensus.Deployment) (ThresholdState, error) {
+	chain.deploymentStatesLock.Lock()
+	defer chain.deploymentStatesLock.Unlock()
+
+	window := chain.chainParams.MinerConfirmationWindow
+	node, err := chain.lastPeriodNode(prevNode)
+	if err != nil {
+		return "", err
+	}
+
+	// Walk backwards by period until a cached state or the first period,
+	// collecting the nodes whose states have to be calculated.
+	state := ThresholdDefined
+	var needed []*BlockNode
+	for node != nil {
+		if cached, ok := chain.deploymentStates[*node.Hash][d.Name]; ok {
+			state = cached
+			break
+		}
+		// The deployment is defined in all periods before its start.
+		if node.Height+1 < d.Signal.StartHeight {
+			chain.setDeploymentState(node, d.Name, ThresholdDefined)
+			break
+		}
+		needed = append(needed, node)
+		if node.Height < window {
+			break
+		}
+		if node, err = chain.ancestorNode(node, node.Height-window); err != nil {
+			return "", err
+		}
+	}
+
+	// Calculate the states forwards from the oldest period.
+	for i := len(needed) - 1; i >= 0; i-- {
+		node := needed[i]
+		nextHeight := node.Height + 1
+		switch state {
+		case ThresholdDefined:
+			if nextHeight >= d.Signal.TimeoutHeight {
+				state = ThresholdFailed
+			} else if nextHeight >= d.Signal.StartHeight {
+				state = ThresholdStarted
+			}
+
+		case ThresholdStarted:
+			if nextHeight >= d.Signal.TimeoutHeight {
+				state = ThresholdFailed
+				break
+			}
+			count, err := chain.countSignals(node, window, d)
+			if err != nil {
+				return "", err
+			}
+			if count >= chain.chainParams.RuleChangeActivationThreshold {
+				state = ThresholdLockedIn
+			}
+
+		case ThresholdLockedIn:
+			state = ThresholdActive
+		}
+		chain.setDeploymentState(node, d.Name, state)
+	}
+	return state, nil
+}
+
+// setDeploymentState caches the state of the deployment of name for the period
+// after node, it must be called with deploymentStatesLock held.
+func (chain *Blockchain) setDeploymentState(node *BlockNode, name string, state ThresholdState) {
+	states, ok := chain.deploymentStates[*node.Hash]
+	if !ok {
+		states = make(map[string]ThresholdState)
+		chain.deploymentStates[*node.Hash] = states
+	}
+	states[name] = state
+}
+
+// signalledDeployment returns the deployment of name, which must be
+// signalled.
+func (chain *Blockchain) signalledDeployment(name string) (*consensus.Deployment, error) {
+	d := chain.chainParams.Deployment(name)
+	if d == nil {
+		return nil, ErrUnknownDeployment
+	}
+	if d.Signal == nil {
+		return nil, ErrNotSignalledDeployment
+	}
+	return d, nil
+}
+
+// deploymentActive returns whether the deployment of name is active for the
+// block after prevNode, either by height or by signalling.
+func (chain *Blockchain) deploymentActive(prevNode *BlockNode, name string) (bool, error) {
+	d := chain.chainParams.Deployment(name)
+	if d == nil {
+		return false, ErrUnknownDeployment
+	}
+	var nextHeight uint64
+	if prevNode != nil {
+		nextHeight = prevNode.Height + 1
+	}
+	if d.IsActive(nextHeight) || d.Signal == nil {
+		return d.IsActive(nextHeight), nil
+	}
+	state, err := chain.thresholdState(prevNode, d)
+	if err != nil {
+		return false, err
+	}
+	return state == ThresholdActive, nil
+}
+
+// chainDeployments checks deployments on the chain ending at tip, taking
+// signalling into account.
+type chainDeployments struct {
+	chain *Blockchain
+	tip   *BlockNode
+}
+
+// IsActive returns whether the deployment of name is active at height on the
+// chain ending at tip.  Heights above the block after tip are checked against
+// the state of that block.
+func (cd chainDeployments) IsActive(name string, height uint64) bool {
+	d := cd.chain.chainParams.Deployment(name)
+	if d == nil {
+		return false
+	}
+	if d.IsActive(height) || d.Signal == nil {
+		return d.IsActive(height)
+	}
+
+	prevNode := cd.tip
+	if height == 0 {
+		prevNode = nil
+	} else if prevNode != nil && height <= prevNode.Height {
+		var err error
+		if prevNode, err = cd.chain.ancestorNode(prevNode, height-1); err != nil {
+			logging.CPrint(logging.ERROR, "failed to load ancestor to check deployment",
+				logging.LogFormat{"deployment": name, "height": height, "err": err})
+			return false
+		}
+	}
+	state, err := cd.chain.thresholdState(prevNode, d)
+	if err != nil {
+		logging.CPrint(logging.ERROR, "failed to check deployment",
+			logging.LogFormat{"deployment": name, "height": height, "err": err})
+		return false
+	}
+	return state == ThresholdActive
+}
+
+// deploymentsAt returns the deployments of the chain ending at prevNode, which
+// are the ones a block after prevNode is validated with.
+func (chain *Blockchain) deploymentsAt(prevNode *BlockNode) consensus.DeploymentChecker {
+	return chainDeployments{chain: chain, tip: prevNode}
+}
+
+// IsActive returns whether the deployment of name is active at height on the
+// best chain, either by height or by signalling.  It implements
+// consensus.DeploymentChecker for the rules of blocks and transactions built
+// on the best block, and is safe to call without the chain lock.
+func (chain *Blockchain) IsActive(name string, height uint64) bool {
+	return chain.deploymentsAt(chain.blockTree.bestBlockNode()).IsActive(name, height)
+}
+
+// calcNextBlockVersion returns the version of the block after prevNode, with
+// the bits of the deployments started or locked in.  Signalling bits are only
+// set on top of BlockVersionV2, since any greater version is encoded as it.
+func (chain *Blockchain) calcNextBlockVersion(prevNode *BlockNode) (uint64, error) {
+	nextHeight := prevNode.Height + 1
+	version := forks.GetBlockVersion(chain.deploymentsAt(prevNode), nextHeight)
+	if version < wire.BlockVersionV2 {
+		return version, nil
+	}
+	for i := range chain.chainParams.Deployments {
+		d := &chain.chainParams.Deployments[i]
+		if d.Signal == nil || d.IsActive(nextHeight) {
+			continue
+		}
+		state, err := chain.thresholdState(prevNode, d)
+		if err != nil {
+			return 0, err
+		}
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			version |= d.Signal.Mask()
+		}
+	}
+	return version, nil
+}
+
+// IsDeploymentActive returns whether the deployment of name is active for the
+// block after the best block, either by height or by signalling.
+func (chain *Blockchain) IsDeploymentActive(name string) (bool, error) {
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+	return chain.deploymentActive(chain.blockTree.bestBlockNode(), name)
+}
+
+// DeploymentState returns the state of the signalled deployment of name for
+// the block after the best block.
+func (chain *Blockchain) DeploymentState(name string) (ThresholdState, error) {
+	d, err := chain.signalledDeployment(name)
+	if err != nil {
+		return "", err
+	}
+
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+	return chain.thresholdState(chain.blockTree.bestBlockNode(), d)
+}
+
+// DeploymentStates returns the status of all signalled deployments for the
+// block after the best block, in the order of the network parameters.
+func (chain *Blockchain) DeploymentStates() ([]*DeploymentStatus, error) {
+	chain.l.RLock()
+	defer chain.l.RUnlock()
+
+	best := chain.blockTree.bestBlockNode()
+	elapsed := (best.Height + 1) % chain.chainParams.MinerConfirmationWindow
+	statuses := make([]*DeploymentStatus, 0, len(chain.chainParams.Deployments))
+	for i := range chain.chainParams.Deployments {
+		d := &chain.chainParams.Deployments[i]
+		if d.Signal == nil {
+			continue
+		}
+		state, err := chain.thresholdState(best, d)
+		if err != nil {
+			return nil, err
+		}
+		count, err := chain.countSignals(best, elapsed, d)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, &DeploymentStatus{
+			Name:          d.Name,
+			Bit:           d.Signal.Bit,
+			StartHeight:   d.Signal.StartHeight,
+			TimeoutHeight: d.Signal.TimeoutHeight,
+			State:         state,
+			Elapsed:       elapsed,
+			Count:         count,
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,210 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/consensus/forks"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// newVersionBitsTestChain returns a chain of nodes of heights [0, n] whose
+// versions are given by version, and the best node.
+func newVersionBitsTestChain(params *config.Params, n uint64, version func(height uint64) uint64) (*Blockchain, *BlockNode) {
+	chain := &Blockchain{
+		chainParams:      params,
+		blockTree:        NewBlockTree(),
+		deploymentStates: make(map[wire.Hash]map[string]ThresholdState),
+	}
+	chain.blockTree.setBestBlockNode(appendVersionBitsTestNodes(nil, 0, n, version))
+	return chain, chain.blockTree.bestBlockNode()
+}
+
+// appendVersionBitsTestNodes appends nodes up to height n to node, whose
+// versions are given by version and hashes are told apart by branch.
+func appendVersionBitsTestNodes(node *BlockNode, branch byte, n uint64, version func(height uint64) uint64) *BlockNode {
+	height := uint64(0)
+	if node != nil {
+		height = node.Height + 1
+	}
+	for ; height <= n; height++ {
+		hash := wire.Hash{byte(height), byte(height >> 8), branch}
+		node = &BlockNode{
+			Parent:  node,
+			Hash:    &hash,
+			Height:  height,
+			Version: version(height),
+		}
+	}
+	return node
+}
+
+func TestThresholdState(t *testing.T) {
+	params := config.RegressionNetParams
+	params.MinerConfirmationWindow = 10
+	params.RuleChangeActivationThreshold = 8
+	params.Deployments = append([]consensus.Deployment{
+		{Name: "dummy", Height: 1000, Signal: &consensus.VersionBits{Bit: 1, StartHeight: 20, TimeoutHeight: 100}},
+		{Name: "timeout", Height: 1000, Signal: &consensus.VersionBits{Bit: 2, StartHeight: 10, TimeoutHeight: 40}},
+	}, params.Deployments...)
+	dummy := params.Deployment("dummy")
+	timeout := params.Deployment("timeout")
+
+	// 7 blocks signal dummy in [20, 29], 8 blocks in [30, 39]
+	signals := map[uint64]bool{}
+	for h := uint64(21); h < 28; h++ {
+		signals[h] = true
+	}
+	for h := uint64(30); h < 38; h++ {
+		signals[h] = true
+	}
+	chain, best := newVersionBitsTestChain(&params, 65, func(height uint64) uint64 {
+		if signals[height] {
+			return wire.BlockVersionV2 | dummy.Signal.Mask()
+		}
+		return wire.BlockVersionV2
+	})
+
+	tests := []struct {
+		prevHeight uint64
+		dummy      ThresholdState
+		timeout    ThresholdState
+	}{
+		{0, ThresholdDefined, ThresholdDefined},
+		{8, ThresholdDefined, ThresholdDefined},
+		{9, ThresholdDefined, ThresholdStarted},
+		{19, ThresholdStarted, ThresholdStarted},
+		{29, ThresholdStarted, ThresholdStarted},
+		{38, ThresholdStarted, ThresholdStarted},
+		{39, ThresholdLockedIn, ThresholdFailed},
+		{48, ThresholdLockedIn, ThresholdFailed},
+		{49, ThresholdActive, ThresholdFailed},
+		{65, ThresholdActive, ThresholdFailed},
+	}
+	// in reverse order so that states are calculated across periods
+	for i := len(tests) - 1; i >= 0; i-- {
+		test := tests[i]
+		prevNode := best.Ancestor(test.prevHeight)
+		state, err := chain.thresholdState(prevNode, dummy)
+		require.NoError(t, err)
+		require.Equal(t, test.dummy, state, "dummy after %d", test.prevHeight)
+		state, err = chain.thresholdState(prevNode, timeout)
+		require.NoError(t, err)
+		require.Equal(t, test.timeout, state, "timeout after %d", test.prevHeight)
+	}
+	require.Equal(t, ThresholdActive, chain.deploymentStates[*best.Ancestor(49).Hash]["dummy"])
+
+	// signalling bits of the next block
+	version, err := chain.calcNextBlockVersion(best.Ancestor(19))
+	require.NoError(t, err)
+	require.Equal(t, wire.BlockVersionV2|dummy.Signal.Mask()|timeout.Signal.Mask(), version)
+	version, err = chain.calcNextBlockVersion(best.Ancestor(45))
+	require.NoError(t, err)
+	require.Equal(t, wire.BlockVersionV2|dummy.Signal.Mask(), version)
+	version, err = chain.calcNextBlockVersion(best)
+	require.NoError(t, err)
+	require.Equal(t, uint64(wire.BlockVersionV2), version)
+
+	// API
+	active, err := chain.IsDeploymentActive("dummy")
+	require.NoError(t, err)
+	require.True(t, active)
+	active, err = chain.IsDeploymentActive(consensus.DeploymentMASSIP0002)
+	require.NoError(t, err)
+	require.False(t, active)
+	_, err = chain.IsDeploymentActive("unknown")
+	require.Equal(t, ErrUnknownDeployment, err)
+	state, err := chain.DeploymentState("timeout")
+	require.NoError(t, err)
+	require.Equal(t, ThresholdFailed, state)
+	_, err = chain.DeploymentState(consensus.DeploymentMASSIP0001)
+	require.Equal(t, ErrNotSignalledDeployment, err)
+
+	chain.blockTree.setBestBlockNode(best.Ancestor(34))
+	statuses, err := chain.DeploymentStates()
+	require.NoError(t, err)
+	require.Equal(t, []*DeploymentStatus{
+		{Name: "dummy", Bit: 1, StartHeight: 20, TimeoutHeight: 100, State: ThresholdStarted, Elapsed: 5, Count: 5},
+		{Name: "timeout", Bit: 2, StartHeight: 10, TimeoutHeight: 40, State: ThresholdStarted, Elapsed: 5, Count: 0},
+	}, statuses)
+}
+
+func TestSignalledDeploymentRules(t *testing.T) {
+	params := config.RegressionNetParams
+	params.MinerConfirmationWindow = 10
+	params.RuleChangeActivationThreshold = 8
+	params.Deployments = []consensus.Deployment{
+		{Name: consensus.DeploymentMASSIP0001, Height: 0},
+		{Name: consensus.DeploymentMASSIP0002WarmUp, Height: math.MaxUint64,
+			Signal: &consensus.VersionBits{Bit: 0, StartHeight: 10, TimeoutHeight: 100}},
+		{Name: consensus.DeploymentMASSIP0002, Height: math.MaxUint64},
+	}
+	warmUp := params.Deployment(consensus.DeploymentMASSIP0002WarmUp)
+
+	// blocks [10, 19] signal the warm-up, which is locked in at 20 and
+	// active since 30
+	chain, best := newVersionBitsTestChain(&params, 35, func(height uint64) uint64 {
+		if height >= 10 && height < 20 {
+			return wire.BlockVersionV1 | warmUp.Signal.Mask()
+		}
+		return wire.BlockVersionV1
+	})
+	require.False(t, forks.EnforceMASSIP0002WarmUp(chain, 29))
+	require.True(t, forks.EnforceMASSIP0002WarmUp(chain, 30))
+	require.True(t, forks.EnforceMASSIP0002WarmUp(chain, 36))
+	require.Equal(t, uint64(wire.BlockVersionV1), forks.GetBlockVersion(chain, 29))
+	require.Equal(t, uint64(wire.BlockVersionV2), forks.GetBlockVersion(chain, 30))
+	require.False(t, forks.EnforceMASSIP0002WarmUp(&params, 30))
+
+	// a side chain without signalling does not activate it
+	side := appendVersionBitsTestNodes(best.Ancestor(9), 1, 35, func(height uint64) uint64 {
+		return wire.BlockVersionV1
+	})
+	require.False(t, chain.deploymentsAt(side).IsActive(consensus.DeploymentMASSIP0002WarmUp, 30))
+	require.True(t, chain.deploymentsAt(best).IsActive(consensus.DeploymentMASSIP0002WarmUp, 30))
+
+	// states are cached by block hash, not by node, so a reloaded node
+	// finds them
+	last := best.Ancestor(29)
+	require.Equal(t, ThresholdActive, chain.deploymentStates[*last.Hash][consensus.DeploymentMASSIP0002WarmUp])
+	reloaded := *last
+	reloaded.Parent = nil
+	state, err := chain.thresholdState(&reloaded, warmUp)
+	require.NoError(t, err)
+	require.Equal(t, ThresholdActive, state)
+}
+
+// TestAncestorNodeBelowRoot ensures ancestors below the root of the block
+// tree are loaded from the database without being added to the tree, since
+// deployments are checked without the chain lock.
+func TestAncestorNodeBelowRoot(t *testing.T) {
+	bc, closeChain := newRegtestChain(t, &config.RegressionNetParams)
+	defer closeChain()
+	payout, err := massutil.NewAddressWitnessScriptHash(make([]byte, 32), &config.RegressionNetParams)
+	require.NoError(t, err)
+	hashes, err := bc.GenerateBlocks(5, payout)
+	require.NoError(t, err)
+
+	// the best node is reloaded into an empty block tree
+	chain := &Blockchain{
+		chainParams:      &config.RegressionNetParams,
+		db:               bc.db,
+		blockTree:        NewBlockTree(),
+		deploymentStates: make(map[wire.Hash]map[string]ThresholdState),
+	}
+	best := bc.BestBlockNode()
+	tip := &BlockNode{Hash: best.Hash, Version: best.Version, Height: best.Height, Previous: best.Previous}
+
+	node, err := chain.ancestorNode(tip, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), node.Height)
+	require.Equal(t, hashes[0], node.Hash)
+	node, err = chain.ancestorNode(tip, 0)
+	require.NoError(t, err)
+	require.Equal(t, config.RegressionNetParams.GenesisHash, node.Hash)
+	require.Empty(t, chain.blockTree.index)
+}
@@ -0,0 +1,211 @@
+package cmdutils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb"
+)
+
+// A binding state dump is a JSON lines file. The first line describes the
+// block of the binding state:
+//
+//	{"height":1000,"block":"<hex>","root":"<hex>"}
+//
+// Followed by a line for each entry of the binding state trie, in the order
+// of iteration:
+//
+//	{"key":"<hex>","value":"<hex>"}
+type bindingDumpHeader struct {
+	Height uint64 `json:"height"`
+	Block  string `json:"block"`
+	Root   string `json:"root"`
+}
+
+type bindingDumpEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// DumpBindingState dumps the binding state trie at the main chain block of
+// height in chainstoreDir into the specified file, truncating any data already
+// present in the file. It returns the number of entries dumped.
+func DumpBindingState(chainstoreDir, fn string, height uint64) (int, error) {
+	chainDb, bindingDb, err := openChainStore(chainstoreDir, true)
+	if err != nil {
+		return 0, err
+	}
+	defer bindingDb.Close()
+	defer chainDb.Close()
+
+	hash, err := chainDb.FetchBlockShaByHeight(height)
+	if err != nil {
+		return 0, err
+	}
+	header, err := chainDb.FetchBlockHeaderBySha(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	logging.CPrint(logging.INFO, "Dumping binding state", logging.LogFormat{"file": fn, "height": height})
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	bw := bufio.NewWriter(writer)
+
+	dh := &bindingDumpHeader{
+		Height: height,
+		Block:  hash.String(),
+		Root:   header.BindingRoot.Hex(),
+	}
+	entries, err := dumpBindingState(bw, state.NewDatabase(bindingDb), header.BindingRoot, dh)
+	if err != nil {
+		return 0, err
+	}
+	if err = bw.Flush(); err != nil {
+		return 0, err
+	}
+
+	logging.CPrint(logging.INFO, "Dumped binding state", logging.LogFormat{
+		"file":        fn,
+		"height":      height,
+		"hash":        hash,
+		"bindingRoot": header.BindingRoot,
+		"entries":     entries,
+	})
+	return entries, nil
+}
+
+func dumpBindingState(w io.Writer, stateDb state.Database, root common.Hash, dh *bindingDumpHeader) (int, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(dh); err != nil {
+		return 0, err
+	}
+
+	tr, err := stateDb.OpenBindingTrie(root)
+	if err != nil {
+		return 0, err
+	}
+	entries := 0
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		entry := &bindingDumpEntry{
+			Key:   hex.EncodeToString(it.Key),
+			Value: hex.EncodeToString(it.Value),
+		}
+		if err = enc.Encode(entry); err != nil {
+			return 0, err
+		}
+		entries++
+	}
+	if it.Err != nil {
+		return 0, it.Err
+	}
+	return entries, nil
+}
+
+// RebuildBindingState rebuilds the binding state trie from a dump file made by
+// DumpBindingState with a StackTrie, and checks that its root matches the one
+// in the dump. Trie nodes are written to db if it is not nil. It returns the
+// root and the number of entries rebuilt.
+func RebuildBindingState(fn string, db massdb.KeyValueWriter) (common.Hash, int, error) {
+	logging.CPrint(logging.INFO, "Rebuilding binding state", logging.LogFormat{"file": fn})
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return common.Hash{}, 0, err
+		}
+	}
+
+	root, entries, err := rebuildBindingState(bufio.NewReader(reader), db)
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+
+	logging.CPrint(logging.INFO, "Rebuilt binding state", logging.LogFormat{
+		"file":        fn,
+		"bindingRoot": root,
+		"entries":     entries,
+	})
+	return root, entries, nil
+}
+
+func rebuildBindingState(r io.Reader, db massdb.KeyValueWriter) (common.Hash, int, error) {
+	dec := json.NewDecoder(r)
+	dh := new(bindingDumpHeader)
+	if err := dec.Decode(dh); err != nil {
+		return common.Hash{}, 0, err
+	}
+	rootBytes, err := hex.DecodeString(strings.TrimPrefix(dh.Root, "0x"))
+	if err != nil || len(rootBytes) != common.HashLength {
+		return common.Hash{}, 0, fmt.Errorf("invalid binding root %s in dump", dh.Root)
+	}
+	expectRoot := common.BytesToHash(rootBytes)
+
+	st := trie.NewStackTrie(db)
+	entries := 0
+	for {
+		entry := new(bindingDumpEntry)
+		if err := dec.Decode(entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, 0, err
+		}
+		key, err := hex.DecodeString(entry.Key)
+		if err != nil {
+			return common.Hash{}, 0, err
+		}
+		value, err := hex.DecodeString(entry.Value)
+		if err != nil {
+			return common.Hash{}, 0, err
+		}
+		if err = st.TryUpdate(key, value); err != nil {
+			return common.Hash{}, 0, err
+		}
+		entries++
+	}
+
+	var root common.Hash
+	if db != nil {
+		root, err = st.Commit()
+	} else {
+		root = st.Hash()
+	}
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	// binding root is zero in headers before binding state is enforced
+	if (expectRoot == common.Hash{}) && entries == 0 {
+		return expectRoot, 0, nil
+	}
+	if root != expectRoot {
+		return common.Hash{}, 0, fmt.Errorf("rebuilt binding root %s mismatched %s", root, expectRoot)
+	}
+	return root, entries, nil
+}
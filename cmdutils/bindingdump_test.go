@@ -0,0 +1,64 @@
+package cmdutils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb/memorydb"
+	"github.com/massnetorg/mass-core/trie/rawdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpRebuildBindingState(t *testing.T) {
+	stateDb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	tr, err := stateDb.OpenBindingTrie(common.Hash{})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		script := append([]byte{0x00, 0x14}, bytes.Repeat([]byte{byte(i)}, 20)...)
+		require.NoError(t, tr.TryUpdate(script, state.EncodeBindingInfo(&state.BindingInfo{Amount: int64(i) + 1})))
+	}
+	require.NoError(t, tr.TryUpdate([]byte("networkbinding"), []byte{0x01, 0x02}))
+	root, err := tr.Commit()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	entries, err := dumpBindingState(&buf, stateDb, root, &bindingDumpHeader{Height: 10, Root: root.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, 101, entries)
+	require.Equal(t, 102, strings.Count(buf.String(), "\n"))
+
+	// rebuild without and with db
+	rebuilt, entries, err := rebuildBindingState(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	require.Equal(t, root, rebuilt)
+	require.Equal(t, 101, entries)
+
+	db := memorydb.New()
+	rebuilt, _, err = rebuildBindingState(bytes.NewReader(buf.Bytes()), db)
+	require.NoError(t, err)
+	require.Equal(t, root, rebuilt)
+	rebuiltTrie, err := trie.New(root, trie.NewDatabase(db))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0x02}, rebuiltTrie.Get([]byte("networkbinding")))
+
+	// tampered value
+	lines := strings.Split(buf.String(), "\n")
+	lines[5] = fmt.Sprintf(`{"key":"%s","value":"00"}`, lines[5][8:8+44])
+	_, _, err = rebuildBindingState(strings.NewReader(strings.Join(lines, "\n")), nil)
+	require.Error(t, err)
+
+	// empty binding state before MASSIP0002
+	buf.Reset()
+	entries, err = dumpBindingState(&buf, stateDb, common.Hash{}, &bindingDumpHeader{Root: common.Hash{}.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, 0, entries)
+	rebuilt, entries, err = rebuildBindingState(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}, rebuilt)
+	require.Equal(t, 0, entries)
+}
@@ -27,7 +27,44 @@ import (
 )
 
 func MakeChain(chainstoreDir string, readonly bool, chainParams *config.Params) (*blockchain.Blockchain, func(), error) {
+	chainDb, bindingDb, err := openChainStore(chainstoreDir, readonly)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeDb := func() {
+		chainDb.Close()
+		bindingDb.Close()
+	}
+
+	cfg := &blockchain.Config{
+		DB:             chainDb,
+		ChainParams:    chainParams,
+		StateBindingDb: state.NewDatabase(bindingDb),
+		Checkpoints:    chainParams.Checkpoints,
+		CachePath:      filepath.Join(chainstoreDir, blockchain.BlockCacheFileName),
+	}
+	if !readonly {
+		cfg.MempoolPath = filepath.Join(chainstoreDir, blockchain.MempoolFileName)
+		cfg.FeeEstimatesPath = filepath.Join(chainstoreDir, blockchain.FeeEstimatesFileName)
+	}
+	bc, err := blockchain.NewBlockchain(cfg)
+	if err != nil {
+		closeDb()
+		return nil, nil, err
+	}
+	close := func() {
+		if err := bc.Stop(); err != nil {
+			logging.CPrint(logging.WARN, "failed to stop chain", logging.LogFormat{"err": err})
+		}
+		closeDb()
+	}
+	return bc, close, nil
+}
 
+// openChainStore opens or creates the block database and binding state
+// database in chainstoreDir.
+func openChainStore(chainstoreDir string, readonly bool) (database.Db, massdb.Database, error) {
 	chainDb, err := database.OpenDB("leveldb", filepath.Join(chainstoreDir, "blocks.db"), readonly)
 	if err != nil {
 		if !strings.Contains(err.Error(), "file does not exist") || readonly {
@@ -44,10 +81,12 @@ func MakeChain(chainstoreDir string, readonly bool, chainParams *config.Params)
 	var bindingDb massdb.Database
 	if _, err = os.Stat(path); err != nil {
 		if !os.IsNotExist(err) {
+			chainDb.Close()
 			return nil, nil, err
 		}
 		err = os.MkdirAll(path, 0700)
 		if err != nil {
+			chainDb.Close()
 			return nil, nil, err
 		}
 		bindingDb, err = rawdb.NewLevelDBDatabase(path, 0, 0, "", false)
@@ -59,24 +98,7 @@ func MakeChain(chainstoreDir string, readonly bool, chainParams *config.Params)
 		chainDb.Close()
 		return nil, nil, fmt.Errorf("new leveldb for binding state failed: %v", err)
 	}
-
-	close := func() {
-		chainDb.Close()
-		bindingDb.Close()
-	}
-
-	bc, err := blockchain.NewBlockchain(&blockchain.Config{
-		DB:             chainDb,
-		ChainParams:    chainParams,
-		StateBindingDb: state.NewDatabase(bindingDb),
-		Checkpoints:    chainParams.Checkpoints,
-		CachePath:      filepath.Join(chainstoreDir, blockchain.BlockCacheFileName),
-	})
-	if err != nil {
-		close()
-		return nil, nil, err
-	}
-	return bc, close, nil
+	return chainDb, bindingDb, nil
 }
 
 func encodeBlock(writer io.Writer, block *wire.MsgBlock) error {
@@ -187,7 +209,12 @@ func ExportChain(bc *blockchain.Blockchain, fn string, last uint64) error {
 }
 
 func ImportChain(bc *blockchain.Blockchain, fn string, noExpensiveValidation bool) error {
-	logging.CPrint(logging.INFO, "Importing blockchain", logging.LogFormat{"file": fn})
+	return importChain(bc, fn, noExpensiveValidation, 0)
+}
+
+// importChain imports blocks up to height last, or all blocks if last is 0.
+func importChain(bc *blockchain.Blockchain, fn string, noExpensiveValidation bool, last uint64) error {
+	logging.CPrint(logging.INFO, "Importing blockchain", logging.LogFormat{"file": fn, "last": last})
 
 	// Watch for Ctrl-C while the import is running.
 	// If a signal is received, the import will stop at the next batch.
@@ -231,7 +258,8 @@ func ImportChain(bc *blockchain.Blockchain, fn string, noExpensiveValidation boo
 	importBatchSize := 2000
 	blocks := make([]*wire.MsgBlock, importBatchSize)
 	n := 0
-	for batch := 0; ; batch++ {
+	reachedLast := false
+	for batch := 0; !reachedLast; batch++ {
 		// Load a batch of RLP blocks.
 		if checkInterrupt() {
 			return fmt.Errorf("interrupted")
@@ -245,6 +273,10 @@ func ImportChain(bc *blockchain.Blockchain, fn string, noExpensiveValidation boo
 				}
 				return fmt.Errorf("at block %d: %v", n, err)
 			}
+			if last != 0 && block.Header.Height > last {
+				reachedLast = true
+				break
+			}
 			// don't import first block
 			if block.Header.Height == 0 {
 				i--
@@ -0,0 +1,368 @@
+package cmdutils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/massnetorg/mass-core/blockchain/state"
+	"github.com/massnetorg/mass-core/config"
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/trie"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// A snapshot file consists of the database snapshot, see database.Db, followed
+// by contents of the binding state trie at the same block:
+//
+// | "MASSBIND" |   root   |  entry  |  ...  | 0-length key |
+// |   8-bytes  | 32-bytes |         |       |    4-bytes   |
+//
+// Each entry is encoded as:
+//
+// | key length |  key  | value length |  value  |
+// |   4-bytes  |       |    4-bytes   |         |
+var bindingSnapshotMagic = []byte("MASSBIND")
+
+// ExportSnapshot exports a snapshot of the chain state in chainstoreDir into
+// the specified file, truncating any data already present in the file. Raw
+// data of the latest numBlocks blocks are included, 0 means all.
+//
+// The snapshot is always taken at the best block, since only the current
+// unspent transactions and binding state are kept.  To snapshot an earlier
+// height, import the chain up to that height with ImportChain first.
+func ExportSnapshot(chainstoreDir, fn string, numBlocks uint64) (*database.SnapshotInfo, error) {
+	chainDb, bindingDb, err := openChainStore(chainstoreDir, true)
+	if err != nil {
+		return nil, err
+	}
+	defer bindingDb.Close()
+	defer chainDb.Close()
+
+	bestHash, bestHeight, err := chainDb.NewestSha()
+	if err != nil {
+		return nil, err
+	}
+	header, err := chainDb.FetchBlockHeaderBySha(bestHash)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.CPrint(logging.INFO, "Exporting snapshot", logging.LogFormat{"file": fn, "height": bestHeight})
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	bw := bufio.NewWriter(writer)
+
+	info, err := chainDb.ExportSnapshot(bw, numBlocks)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := exportBindingState(bw, state.NewDatabase(bindingDb), header.BindingRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	logging.CPrint(logging.INFO, "Exported snapshot", logging.LogFormat{
+		"file":        fn,
+		"height":      info.Height,
+		"hash":        info.Hash,
+		"commitment":  info.Commitment,
+		"bindingRoot": header.BindingRoot,
+		"bindings":    entries,
+	})
+	return info, nil
+}
+
+func exportBindingState(w io.Writer, stateDb state.Database, root common.Hash) (int, error) {
+	if _, err := w.Write(bindingSnapshotMagic); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(root[:]); err != nil {
+		return 0, err
+	}
+
+	entries := 0
+	if (root != common.Hash{}) {
+		tr, err := stateDb.OpenBindingTrie(root)
+		if err != nil {
+			return 0, err
+		}
+		it := trie.NewIterator(tr.NodeIterator(nil))
+		for it.Next() {
+			if err = writeBindingEntry(w, it.Key, it.Value); err != nil {
+				return 0, err
+			}
+			entries++
+		}
+		if it.Err != nil {
+			return 0, it.Err
+		}
+	}
+	return entries, writeBindingEntry(w, nil, nil)
+}
+
+func writeBindingEntry(w io.Writer, key, value []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(key)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	if _, err := w.Write(key); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(value)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(value)
+	return err
+}
+
+func readBindingEntry(r io.Reader) (key, value []byte, err error) {
+	var lenBuf [4]byte
+	if _, err = io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, nil, err
+	}
+	if size := binary.BigEndian.Uint32(lenBuf[:]); size > 0 {
+		key = make([]byte, size)
+		if _, err = io.ReadFull(r, key); err != nil {
+			return nil, nil, err
+		}
+		if _, err = io.ReadFull(r, lenBuf[:]); err != nil {
+			return nil, nil, err
+		}
+		value = make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, value, nil
+}
+
+// ImportSnapshot imports a snapshot file into chainstoreDir, which must not
+// contain a chain yet. Blocks before the snapshot are treated as pruned. The
+// imported chain is usable by MakeChain once it returns without error, the
+// partially imported chain store is removed on error.
+func ImportSnapshot(chainstoreDir, fn string, chainParams *config.Params) (info *database.SnapshotInfo, err error) {
+	logging.CPrint(logging.INFO, "Importing snapshot", logging.LogFormat{"file": fn})
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReader(reader)
+
+	chainDb, bindingDb, err := openChainStore(chainstoreDir, false)
+	if err != nil {
+		return nil, err
+	}
+	closeChainStore := func() {
+		bindingDb.Close()
+		chainDb.Close()
+	}
+	if _, height, err := chainDb.NewestSha(); err != nil || height != math.MaxUint64 {
+		closeChainStore()
+		if err == nil {
+			err = database.ErrSnapshotDbNotEmpty
+		}
+		return nil, err
+	}
+	defer func() {
+		closeChainStore()
+		if err != nil {
+			removeChainStore(chainstoreDir)
+		}
+	}()
+
+	// The binding state follows the database snapshot, it is imported
+	// before the database is marked imported.
+	var (
+		bindingRoot common.Hash
+		entries     int
+	)
+	info, err = chainDb.ImportSnapshot(br, chainParams.GenesisHash, func(info *database.SnapshotInfo, header *wire.BlockHeader) error {
+		bindingRoot = header.BindingRoot
+		n, err := importBindingState(br, state.NewDatabase(bindingDb), header.BindingRoot)
+		entries = n
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.CPrint(logging.INFO, "Imported snapshot", logging.LogFormat{
+		"file":        fn,
+		"height":      info.Height,
+		"hash":        info.Hash,
+		"commitment":  info.Commitment,
+		"bindingRoot": bindingRoot,
+		"bindings":    entries,
+	})
+	return info, nil
+}
+
+// removeChainStore removes the databases and block files created in
+// chainstoreDir by openChainStore.
+func removeChainStore(chainstoreDir string) {
+	for _, name := range []string{"blocks.db", "blocks", "bindingstate"} {
+		if err := os.RemoveAll(filepath.Join(chainstoreDir, name)); err != nil {
+			logging.CPrint(logging.WARN, "failed to remove chain store", logging.LogFormat{
+				"path": filepath.Join(chainstoreDir, name),
+				"err":  err,
+			})
+		}
+	}
+}
+
+// importBindingState rebuilds binding state trie from snapshot, and checks
+// that its root matches the one in block header.
+func importBindingState(r io.Reader, stateDb state.Database, expectRoot common.Hash) (int, error) {
+	magic := make([]byte, len(bindingSnapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(magic, bindingSnapshotMagic) {
+		return 0, database.ErrInvalidSnapshot
+	}
+	var root common.Hash
+	if _, err := io.ReadFull(r, root[:]); err != nil {
+		return 0, err
+	}
+	if root != expectRoot {
+		return 0, fmt.Errorf("snapshot binding root %s mismatched %s", root, expectRoot)
+	}
+
+	tr, err := stateDb.OpenBindingTrie(common.Hash{})
+	if err != nil {
+		return 0, err
+	}
+	entries := 0
+	for {
+		key, value, err := readBindingEntry(r)
+		if err != nil {
+			return 0, err
+		}
+		if key == nil {
+			break
+		}
+		if err = tr.TryUpdate(key, value); err != nil {
+			return 0, err
+		}
+		entries++
+	}
+	if (root == common.Hash{}) {
+		if entries != 0 {
+			return 0, database.ErrInvalidSnapshot
+		}
+		return 0, nil
+	}
+
+	commitRoot, err := tr.Commit()
+	if err != nil {
+		return 0, err
+	}
+	if commitRoot != root {
+		return 0, fmt.Errorf("rebuilt binding root %s mismatched %s", commitRoot, root)
+	}
+	return entries, nil
+}
+
+// VerifySnapshot validates the snapshot described by info in background. It
+// imports blocks from genesis in archive, which is exported by ExportChain,
+// into a temporary chain store, and checks that the chain state at snapshot
+// height has the same commitment. The result is sent on the returned channel.
+func VerifySnapshot(archive string, info *database.SnapshotInfo, chainParams *config.Params) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		err := verifySnapshot(archive, info, chainParams)
+		if err != nil {
+			logging.CPrint(logging.ERROR, "Snapshot verification failed", logging.LogFormat{
+				"height":     info.Height,
+				"commitment": info.Commitment,
+				"err":        err,
+			})
+		} else {
+			logging.CPrint(logging.INFO, "Snapshot verified", logging.LogFormat{
+				"height":     info.Height,
+				"commitment": info.Commitment,
+			})
+		}
+		result <- err
+	}()
+	return result
+}
+
+func verifySnapshot(archive string, info *database.SnapshotInfo, chainParams *config.Params) error {
+	dir, err := ioutil.TempDir("", "snapshot-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	bc, closeChain, err := MakeChain(dir, false, chainParams)
+	if err != nil {
+		return err
+	}
+	err = importChain(bc, archive, false, info.Height)
+	closeChain()
+	if err != nil {
+		return err
+	}
+
+	chainDb, bindingDb, err := openChainStore(dir, true)
+	if err != nil {
+		return err
+	}
+	defer bindingDb.Close()
+	defer chainDb.Close()
+
+	hash, height, err := chainDb.NewestSha()
+	if err != nil {
+		return err
+	}
+	if height != info.Height || *hash != info.Hash {
+		return fmt.Errorf("archive ends at %d %s, expect %d %s", height, hash, info.Height, info.Hash)
+	}
+	verified, err := chainDb.ExportSnapshot(ioutil.Discard, info.NumBlocks)
+	if err != nil {
+		return err
+	}
+	if verified.Commitment != info.Commitment {
+		return database.ErrSnapshotCommitment
+	}
+	return nil
+}
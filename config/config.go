@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/wire"
 )
@@ -10,6 +12,8 @@ const (
 	defaultBlockMinSize      = 0
 	defaultBlockMaxSize      = wire.MaxBlockPayload
 	defaultBlockPrioritySize = consensus.DefaultBlockPrioritySize
+	defaultMaxTxPoolSize     = 300 * 1024 * 1024
+	defaultTxPoolExpiry      = 14 * 24 * time.Hour
 )
 
 var (
@@ -22,6 +26,12 @@ var (
 	MaxPeers                 = 50
 	Moniker                  = "anonymous"
 	ChainTag                 = defaultChainTag
+	// MaxTxPoolSize is the max total size in bytes of transactions in
+	// the pool, 0 means no limit.
+	MaxTxPoolSize int64 = defaultMaxTxPoolSize
+	// TxPoolExpiry is the max time a transaction stays in the pool, 0
+	// means no expiry.
+	TxPoolExpiry = defaultTxPoolExpiry
 )
 
 type Config struct {
@@ -35,6 +45,13 @@ type Config struct {
 type Chain struct {
 	DisableCheckpoints bool     `json:"disable_checkpoints"`
 	AddCheckpoints     []string `json:"add_checkpoints"`
+	PruneDepth         uint64   `json:"prune_depth"`
+	UtxoIndex          bool     `json:"utxo_index"`
+	MaxReorgDepth      uint64   `json:"max_reorg_depth"`
+	BindingPruneDepth  uint64   `json:"binding_prune_depth"`
+	// AssumeValid is the block in the '<height>:<hash>' format whose
+	// ancestors are assumed to have valid scripts, see ParseAssumeValid.
+	AssumeValid string `json:"assume_valid"`
 }
 
 type P2P struct {
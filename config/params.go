@@ -23,9 +23,19 @@ var (
 	// is intended to identify the network for a hierarchical deterministic
 	// private extended key is not registered.
 	ErrUnknownHDKeyID = errors.New("unknown hd private extended key bytes")
+
+	// ErrDuplicateNet describes an error where the parameters for a Mass
+	// network could not be set due to the network already being a standard
+	// network or previously-registered into this package.
+	ErrDuplicateNet = errors.New("duplicate Mass network")
+
+	// ErrUnknownNet describes an error where the parameters for a Mass
+	// network are looked up by a name which is not registered.
+	ErrUnknownNet = errors.New("unknown Mass network")
 )
 
 var (
+	registeredNets       = make(map[string]*Params)
 	pubKeyHashAddrIDs    = make(map[byte]struct{})
 	scriptHashAddrIDs    = make(map[byte]struct{})
 	bech32SegwitPrefixes = make(map[string]struct{})
@@ -42,6 +52,10 @@ var (
 // parameters based on inputs and work regardless of the network being standard
 // or not.
 func Register(params *Params) error {
+	if _, ok := registeredNets[params.Name]; ok {
+		return ErrDuplicateNet
+	}
+	registeredNets[params.Name] = params
 	pubKeyHashAddrIDs[params.PubKeyHashAddrID] = struct{}{}
 	scriptHashAddrIDs[params.ScriptHashAddrID] = struct{}{}
 	hdPrivToPubKeyIDs[params.HDPrivateKeyID] = params.HDPublicKeyID[:]
@@ -52,6 +66,15 @@ func Register(params *Params) error {
 	return nil
 }
 
+// ParamsByName returns the parameters of the registered network of name.
+func ParamsByName(name string) (*Params, error) {
+	params, ok := registeredNets[name]
+	if !ok {
+		return nil, ErrUnknownNet
+	}
+	return params, nil
+}
+
 // Checkpoint identifies a known good point in the block chain.  Using
 // checkpoints allows a few optimizations for old blocks during initial download
 // and also prevents forks from old blocks.
@@ -104,6 +127,15 @@ type Params struct {
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	HDCoinType uint32
+
+	// Deployments of consensus rule changes, see IsActive.
+	Deployments []consensus.Deployment
+
+	// Signalling of deployments through block versions: a deployment is
+	// locked in after RuleChangeActivationThreshold of the
+	// MinerConfirmationWindow blocks of a period signal it.
+	RuleChangeActivationThreshold uint64
+	MinerConfirmationWindow       uint64
 }
 
 // ChainParams defines the network parameters for the main Mass network.
@@ -153,6 +185,28 @@ var ChainParams = Params{
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	HDCoinType: HDCoinTypeMassMainNet,
+
+	// Deployments of consensus rule changes
+	Deployments:                   consensus.MainNetDeployments,
+	RuleChangeActivationThreshold: 12768, // 95% of MinerConfirmationWindow
+	MinerConfirmationWindow:       13440, // about a week
+}
+
+// Deployment returns the deployment of name, or nil if params have none.
+func (p *Params) Deployment(name string) *consensus.Deployment {
+	for i := range p.Deployments {
+		if p.Deployments[i].Name == name {
+			return &p.Deployments[i]
+		}
+	}
+	return nil
+}
+
+// IsActive returns whether the deployment of name is active at height on the
+// network of params.  An unknown deployment is never active.
+func (p *Params) IsActive(deployment string, height uint64) bool {
+	d := p.Deployment(deployment)
+	return d != nil && d.IsActive(height)
 }
 
 // IsPubKeyHashAddrID returns whether the id is an identifier known to prefix a
@@ -224,8 +278,10 @@ func UpdateGenesisBlock(blk *wire.MsgBlock) {
 func init() {
 	// update genesis block
 	UpdateGenesisBlock(ChainParams.GenesisBlock)
+	initGenesis(&RegressionNetParams)
 	// register chainParams
 	Register(&ChainParams)
+	Register(&RegressionNetParams)
 }
 
 func newHashFromStr(hexStr string) *wire.Hash {
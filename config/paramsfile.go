@@ -0,0 +1,362 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// ParamsFile is the JSON form of Params read by LoadParams, for example:
+//
+//	{
+//	  "name": "testnet",
+//	  "default_port": "43553",
+//	  "dns_seeds": ["seed.example.org:43553"],
+//	  "genesis_block": "<hex of the block in wire.Packet encoding>",
+//	  "genesis_hash": "<hash>",
+//	  "poc_limit": "0xfffff",
+//	  "checkpoints": ["<height>:<hash>"],
+//	  "bech32_hrp_segwit": "mst",
+//	  "pubkey_hash_addr_id": 111,
+//	  ...
+//	  "hd_private_key_id": "04358394",
+//	  "hd_public_key_id": "043587cf",
+//	  "hd_coin_type": 1,
+//	  "deployments": [
+//	    {"name": "massip0002", "height": 1000},
+//	    {"name": "newrule", "bit": 0, "start_height": 2016, "timeout_height": 20160}
+//	  ],
+//	  "miner_confirmation_window": 2016,
+//	  "rule_change_activation_threshold": 1512
+//	}
+//
+// Omitted subsidy halving interval, deployments and signalling parameters are
+// the ones of the main network.
+type ParamsFile struct {
+	Name        string   `json:"name"`
+	DefaultPort string   `json:"default_port"`
+	DNSSeeds    []string `json:"dns_seeds"`
+
+	// Chain parameters
+	GenesisBlock           string `json:"genesis_block"`
+	GenesisHash            string `json:"genesis_hash"`
+	PocLimit               string `json:"poc_limit"`
+	SubsidyHalvingInterval uint64 `json:"subsidy_halving_interval"`
+	ResetMinDifficulty     bool   `json:"reset_min_difficulty"`
+
+	// Checkpoints in the '<height>:<hash>' format, ordered from oldest to
+	// newest.
+	Checkpoints []string `json:"checkpoints"`
+
+	// Mempool parameters
+	RelayNonStdTxs bool `json:"relay_non_std_txs"`
+
+	// Human-readable part for Bech32 encoded segwit addresses
+	Bech32HRPSegwit string `json:"bech32_hrp_segwit"`
+
+	// Address encoding magics
+	PubKeyHashAddrID        byte `json:"pubkey_hash_addr_id"`
+	ScriptHashAddrID        byte `json:"script_hash_addr_id"`
+	PrivateKeyID            byte `json:"private_key_id"`
+	WitnessPubKeyHashAddrID byte `json:"witness_pubkey_hash_addr_id"`
+	WitnessScriptHashAddrID byte `json:"witness_script_hash_addr_id"`
+
+	// BIP32 hierarchical deterministic extended key magics in hex
+	HDPrivateKeyID string `json:"hd_private_key_id"`
+	HDPublicKeyID  string `json:"hd_public_key_id"`
+
+	// BIP44 coin type
+	HDCoinType uint32 `json:"hd_coin_type"`
+
+	// Deployments of consensus rule changes, replacing the ones of the main
+	// network of the same names.
+	Deployments                   []DeploymentFile `json:"deployments"`
+	MinerConfirmationWindow       uint64           `json:"miner_confirmation_window"`
+	RuleChangeActivationThreshold uint64           `json:"rule_change_activation_threshold"`
+}
+
+// DeploymentFile is the JSON form of a consensus.Deployment in ParamsFile.
+// Bit is the optional signalling bit, and an omitted height means the
+// deployment is only enforced by signalling.  The MASSIP0001 and MASSIP0002
+// deployments are only enforced by height.
+type DeploymentFile struct {
+	Name          string  `json:"name"`
+	Height        *uint64 `json:"height,omitempty"`
+	Bit           *uint8  `json:"bit,omitempty"`
+	StartHeight   uint64  `json:"start_height,omitempty"`
+	TimeoutHeight uint64  `json:"timeout_height,omitempty"`
+}
+
+// LoadParams reads network parameters from the JSON file of ParamsFile and
+// validates them.
+func LoadParams(path string) (*Params, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pf := new(ParamsFile)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(pf); err != nil {
+		return nil, fmt.Errorf("failed to decode params file %s: %v", path, err)
+	}
+	params, err := pf.Params()
+	if err != nil {
+		return nil, fmt.Errorf("invalid params file %s: %v", path, err)
+	}
+	return params, nil
+}
+
+// RegisterParamsFile loads network parameters by LoadParams and registers
+// them, so that they can be looked up by ParamsByName.
+func RegisterParamsFile(path string) (*Params, error) {
+	params, err := LoadParams(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = Register(params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Params converts pf to Params and validates them.
+func (pf *ParamsFile) Params() (*Params, error) {
+	if pf.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	if err := checkPort(pf.DefaultPort); err != nil {
+		return nil, fmt.Errorf("invalid default port: %v", err)
+	}
+	for _, seed := range pf.DNSSeeds {
+		if err := checkSeed(seed); err != nil {
+			return nil, fmt.Errorf("invalid dns seed %q: %v", seed, err)
+		}
+	}
+
+	genesisBlock, genesisHash, err := parseGenesisBlock(pf.GenesisBlock, pf.GenesisHash)
+	if err != nil {
+		return nil, err
+	}
+	chainID := genesisBlock.Header.ChainID
+
+	pocLimit, ok := new(big.Int).SetString(pf.PocLimit, 0)
+	if !ok || pocLimit.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid poc limit %q", pf.PocLimit)
+	}
+	if genesisBlock.Header.Target.Cmp(pocLimit) < 0 {
+		return nil, fmt.Errorf("genesis target %s is lower than poc limit %s", genesisBlock.Header.Target, pocLimit)
+	}
+
+	checkpoints, err := ParseCheckpoints(pf.Checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	for i, checkpoint := range checkpoints {
+		if checkpoint.Height == 0 || (i > 0 && checkpoint.Height <= checkpoints[i-1].Height) {
+			return nil, errors.New("checkpoints are not sorted by height or at genesis")
+		}
+	}
+
+	if pf.Bech32HRPSegwit == "" || strings.ToLower(pf.Bech32HRPSegwit) != pf.Bech32HRPSegwit {
+		return nil, fmt.Errorf("invalid bech32 hrp %q", pf.Bech32HRPSegwit)
+	}
+	if pf.PubKeyHashAddrID == pf.ScriptHashAddrID ||
+		pf.WitnessPubKeyHashAddrID == pf.WitnessScriptHashAddrID {
+		return nil, errors.New("duplicate address ids")
+	}
+	hdPrivateKeyID, err := parseHDKeyID(pf.HDPrivateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	hdPublicKeyID, err := parseHDKeyID(pf.HDPublicKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if hdPrivateKeyID == hdPublicKeyID {
+		return nil, errors.New("duplicate hd key ids")
+	}
+
+	params := &Params{
+		Name:                          pf.Name,
+		DefaultPort:                   pf.DefaultPort,
+		DNSSeeds:                      pf.DNSSeeds,
+		GenesisBlock:                  genesisBlock,
+		GenesisHash:                   genesisHash,
+		ChainID:                       &chainID,
+		PocLimit:                      pocLimit,
+		SubsidyHalvingInterval:        pf.SubsidyHalvingInterval,
+		ResetMinDifficulty:            pf.ResetMinDifficulty,
+		Checkpoints:                   checkpoints,
+		RelayNonStdTxs:                pf.RelayNonStdTxs,
+		Bech32HRPSegwit:               pf.Bech32HRPSegwit,
+		PubKeyHashAddrID:              pf.PubKeyHashAddrID,
+		ScriptHashAddrID:              pf.ScriptHashAddrID,
+		PrivateKeyID:                  pf.PrivateKeyID,
+		WitnessPubKeyHashAddrID:       pf.WitnessPubKeyHashAddrID,
+		WitnessScriptHashAddrID:       pf.WitnessScriptHashAddrID,
+		HDPrivateKeyID:                hdPrivateKeyID,
+		HDPublicKeyID:                 hdPublicKeyID,
+		HDCoinType:                    pf.HDCoinType,
+		Deployments:                   mergeDeployments(consensus.MainNetDeployments, pf.Deployments),
+		RuleChangeActivationThreshold: pf.RuleChangeActivationThreshold,
+		MinerConfirmationWindow:       pf.MinerConfirmationWindow,
+	}
+	if params.SubsidyHalvingInterval == 0 {
+		params.SubsidyHalvingInterval = consensus.SubsidyHalvingInterval
+	}
+	if params.MinerConfirmationWindow == 0 {
+		params.MinerConfirmationWindow = ChainParams.MinerConfirmationWindow
+	}
+	if params.RuleChangeActivationThreshold == 0 {
+		params.RuleChangeActivationThreshold = ChainParams.RuleChangeActivationThreshold
+	}
+	if params.RuleChangeActivationThreshold > params.MinerConfirmationWindow {
+		return nil, errors.New("rule change activation threshold is greater than miner confirmation window")
+	}
+	if err = consensus.CheckDeployments(params.Deployments); err != nil {
+		return nil, err
+	}
+	// Block nodes reloaded from the database only follow these deployments
+	// by height, so they can't be signalled.
+	for _, name := range []string{
+		consensus.DeploymentMASSIP0001,
+		consensus.DeploymentMASSIP0002WarmUp,
+		consensus.DeploymentMASSIP0002,
+	} {
+		if params.Deployment(name).Signal != nil {
+			return nil, fmt.Errorf("deployment %s can't be signalled", name)
+		}
+	}
+	warmUp := params.Deployment(consensus.DeploymentMASSIP0002WarmUp)
+	if ip2 := params.Deployment(consensus.DeploymentMASSIP0002); warmUp.Height > ip2.Height {
+		return nil, errors.New("MASSIP0002 warm-up height is greater than MASSIP0002 height")
+	}
+	return params, nil
+}
+
+// mergeDeployments returns a copy of base with the deployments of files,
+// which replace the ones of the same names.
+func mergeDeployments(base []consensus.Deployment, files []DeploymentFile) []consensus.Deployment {
+	deployments := make([]consensus.Deployment, len(base), len(base)+len(files))
+	copy(deployments, base)
+	for _, df := range files {
+		d := consensus.Deployment{Name: df.Name, Height: math.MaxUint64}
+		if df.Height != nil {
+			d.Height = *df.Height
+		}
+		if df.Bit != nil {
+			d.Signal = &consensus.VersionBits{
+				Bit:           *df.Bit,
+				StartHeight:   df.StartHeight,
+				TimeoutHeight: df.TimeoutHeight,
+			}
+		}
+		replaced := false
+		for i := range deployments[:len(base)] {
+			if deployments[i].Name == d.Name {
+				deployments[i], replaced = d, true
+				break
+			}
+		}
+		if !replaced {
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments
+}
+
+// parseGenesisBlock decodes the genesis block and ensures it is a genesis
+// block with the expected hash.
+func parseGenesisBlock(blockHex, hashStr string) (*wire.MsgBlock, *wire.Hash, error) {
+	buf, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid genesis block: %v", err)
+	}
+	block := wire.NewEmptyMsgBlock()
+	if err = block.SetBytes(buf, wire.Packet); err != nil {
+		return nil, nil, fmt.Errorf("invalid genesis block: %v", err)
+	}
+	header := &block.Header
+	if header.Height != 0 || !header.Previous.IsEqual(&wire.Hash{}) {
+		return nil, nil, errors.New("genesis block has a height or a previous block")
+	}
+	if len(block.Transactions) == 0 {
+		return nil, nil, errors.New("genesis block has no transactions")
+	}
+	merkles := wire.BuildMerkleTreeStoreTransactions(block.Transactions, false)
+	if !header.TransactionRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, nil, errors.New("genesis block has a wrong transaction root")
+	}
+	chainID, err := header.GetChainID()
+	if err != nil {
+		return nil, nil, err
+	}
+	if chainID != header.ChainID {
+		return nil, nil, fmt.Errorf("genesis chain id %s mismatched %s", header.ChainID, chainID)
+	}
+
+	expected, err := wire.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid genesis hash %q", hashStr)
+	}
+	hash := header.BlockHash()
+	if !hash.IsEqual(expected) {
+		return nil, nil, fmt.Errorf("genesis hash %s mismatched %s", hash, expected)
+	}
+	return block, &hash, nil
+}
+
+// parseHDKeyID decodes a 4-byte hierarchical deterministic key magic in hex.
+func parseHDKeyID(s string) ([4]byte, error) {
+	var id [4]byte
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != len(id) {
+		return id, fmt.Errorf("invalid hd key id %q", s)
+	}
+	copy(id[:], buf)
+	return id, nil
+}
+
+// checkPort ensures port is a valid port number.
+func checkPort(port string) error {
+	portN, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	if portN <= 0 || portN > 65535 {
+		return fmt.Errorf("invalid port %d", portN)
+	}
+	return nil
+}
+
+// checkSeed ensures seed is a host with an optional port, without looking it
+// up like NormalizeSeed.
+func checkSeed(seed string) error {
+	host, port := seed, ""
+	if strings.Contains(seed, ":") && !strings.HasSuffix(seed, "]") {
+		var err error
+		if host, port, err = net.SplitHostPort(seed); err != nil {
+			return err
+		}
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return errors.New("missing host")
+	}
+	if port != "" {
+		return checkPort(port)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testWarmUpHeight = uint64(100)
+	testBit          = uint8(3)
+)
+
+func newTestParamsFile(t *testing.T) *ParamsFile {
+	buf, err := RegressionNetParams.GenesisBlock.Bytes(wire.Packet)
+	require.NoError(t, err)
+	return &ParamsFile{
+		Name:                    "filenet",
+		DefaultPort:             "43653",
+		DNSSeeds:                []string{"seed.example.org", "127.0.0.1:43653", "[::1]:43653"},
+		GenesisBlock:            hex.EncodeToString(buf),
+		GenesisHash:             RegressionNetParams.GenesisHash.String(),
+		PocLimit:                "0x1",
+		Checkpoints:             []string{"10:" + RegressionNetParams.GenesisHash.String(), "20:" + RegressionNetParams.GenesisHash.String()},
+		Bech32HRPSegwit:         "msf",
+		PubKeyHashAddrID:        0x70,
+		ScriptHashAddrID:        0xc5,
+		PrivateKeyID:            0xf0,
+		WitnessPubKeyHashAddrID: 0x04,
+		WitnessScriptHashAddrID: 0x29,
+		HDPrivateKeyID:          "04358395",
+		HDPublicKeyID:           "043587d0",
+		HDCoinType:              1,
+		Deployments: []DeploymentFile{
+			{Name: consensus.DeploymentMASSIP0002WarmUp, Height: &testWarmUpHeight},
+			{Name: "test", Bit: &testBit, StartHeight: 144, TimeoutHeight: 1440},
+		},
+	}
+}
+
+func writeTestParamsFile(t *testing.T, dir string, pf interface{}) string {
+	data, err := json.Marshal(pf)
+	require.NoError(t, err)
+	fn := filepath.Join(dir, "params.json")
+	require.NoError(t, ioutil.WriteFile(fn, data, 0600))
+	return fn
+}
+
+func TestLoadParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paramsfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	params, err := LoadParams(writeTestParamsFile(t, dir, newTestParamsFile(t)))
+	require.NoError(t, err)
+	require.Equal(t, "filenet", params.Name)
+	require.Equal(t, RegressionNetParams.GenesisHash, params.GenesisHash)
+	require.Equal(t, RegressionNetParams.ChainID, params.ChainID)
+	require.Equal(t, int64(1), params.PocLimit.Int64())
+	require.Len(t, params.Checkpoints, 2)
+	require.Equal(t, uint64(20), params.Checkpoints[1].Height)
+	require.Equal(t, [4]byte{0x04, 0x35, 0x87, 0xd0}, params.HDPublicKeyID)
+	require.Equal(t, ChainParams.SubsidyHalvingInterval, params.SubsidyHalvingInterval)
+	require.Len(t, params.Deployments, 4)
+	require.Equal(t, ChainParams.Deployment(consensus.DeploymentMASSIP0001), params.Deployment(consensus.DeploymentMASSIP0001))
+	require.True(t, params.IsActive(consensus.DeploymentMASSIP0002WarmUp, 100))
+	require.False(t, params.IsActive(consensus.DeploymentMASSIP0002WarmUp, 99))
+	require.False(t, ChainParams.IsActive(consensus.DeploymentMASSIP0002WarmUp, 100))
+	require.True(t, params.Deployment("test").Signals(1<<(consensus.VersionBitsShift+3)|wire.BlockVersionV2))
+	require.False(t, params.Deployment("test").Signals(wire.BlockVersionV2))
+	require.False(t, params.IsActive("test", math.MaxUint64-1))
+	require.Equal(t, uint64(1440), params.Deployment("test").Signal.TimeoutHeight)
+	require.Equal(t, ChainParams.MinerConfirmationWindow, params.MinerConfirmationWindow)
+
+	// registered and looked up by name
+	_, err = ParamsByName("filenet")
+	require.Equal(t, ErrUnknownNet, err)
+	fn := writeTestParamsFile(t, dir, newTestParamsFile(t))
+	params, err = RegisterParamsFile(fn)
+	require.NoError(t, err)
+	found, err := ParamsByName("filenet")
+	require.NoError(t, err)
+	require.Equal(t, params, found)
+	require.True(t, IsBech32SegwitPrefix("msf1"))
+	_, err = RegisterParamsFile(fn)
+	require.Equal(t, ErrDuplicateNet, err)
+
+	found, err = ParamsByName(RegressionNetParams.Name)
+	require.NoError(t, err)
+	require.Equal(t, &RegressionNetParams, found)
+}
+
+func TestLoadParamsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paramsfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mainBlock, err := ChainParams.GenesisBlock.Bytes(wire.Packet)
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		modify func(pf *ParamsFile)
+	}{
+		{"missing name", func(pf *ParamsFile) { pf.Name = "" }},
+		{"invalid port", func(pf *ParamsFile) { pf.DefaultPort = "65536" }},
+		{"invalid seed", func(pf *ParamsFile) { pf.DNSSeeds = []string{":43653"} }},
+		{"invalid genesis block", func(pf *ParamsFile) { pf.GenesisBlock = pf.GenesisBlock[:100] }},
+		{"mismatched genesis hash", func(pf *ParamsFile) { pf.GenesisHash = ChainParams.GenesisHash.String() }},
+		{"mismatched genesis block", func(pf *ParamsFile) { pf.GenesisBlock = hex.EncodeToString(mainBlock) }},
+		{"invalid poc limit", func(pf *ParamsFile) { pf.PocLimit = "0" }},
+		{"poc limit above genesis target", func(pf *ParamsFile) { pf.PocLimit = "2" }},
+		{"unsorted checkpoints", func(pf *ParamsFile) { pf.Checkpoints[0], pf.Checkpoints[1] = pf.Checkpoints[1], pf.Checkpoints[0] }},
+		{"malformed checkpoint", func(pf *ParamsFile) { pf.Checkpoints = []string{"10"} }},
+		{"uppercase hrp", func(pf *ParamsFile) { pf.Bech32HRPSegwit = "MSF" }},
+		{"duplicate address ids", func(pf *ParamsFile) { pf.ScriptHashAddrID = pf.PubKeyHashAddrID }},
+		{"invalid hd key id", func(pf *ParamsFile) { pf.HDPrivateKeyID = "043583" }},
+		{"duplicate hd key ids", func(pf *ParamsFile) { pf.HDPrivateKeyID = pf.HDPublicKeyID }},
+		{"warm-up after MASSIP0002", func(pf *ParamsFile) {
+			height := uint64(99)
+			pf.Deployments = append(pf.Deployments, DeploymentFile{Name: consensus.DeploymentMASSIP0002, Height: &height})
+		}},
+		{"duplicate deployment", func(pf *ParamsFile) { pf.Deployments = append(pf.Deployments, pf.Deployments[1]) }},
+		{"shared signalling bit", func(pf *ParamsFile) {
+			pf.Deployments = append(pf.Deployments, DeploymentFile{Name: "other", Bit: &testBit, TimeoutHeight: 1})
+		}},
+		{"signalled MASSIP0002", func(pf *ParamsFile) {
+			bit := testBit + 1
+			pf.Deployments = append(pf.Deployments, DeploymentFile{Name: consensus.DeploymentMASSIP0002, Bit: &bit, TimeoutHeight: 1})
+		}},
+		{"signalled MASSIP0002 warm-up", func(pf *ParamsFile) {
+			bit := testBit + 1
+			pf.Deployments[0].Bit, pf.Deployments[0].TimeoutHeight = &bit, 1
+		}},
+		{"timeout before start", func(pf *ParamsFile) { pf.Deployments[1].TimeoutHeight = pf.Deployments[1].StartHeight }},
+		{"threshold above window", func(pf *ParamsFile) {
+			pf.MinerConfirmationWindow, pf.RuleChangeActivationThreshold = 10, 11
+		}},
+	}
+	for _, test := range tests {
+		pf := newTestParamsFile(t)
+		test.modify(pf)
+		_, err := LoadParams(writeTestParamsFile(t, dir, pf))
+		require.Error(t, err, test.name)
+	}
+
+	// unknown fields
+	pf := map[string]interface{}{"name": "filenet", "unknown": 1}
+	_, err = LoadParams(writeTestParamsFile(t, dir, pf))
+	require.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/interfaces"
+	"github.com/massnetorg/mass-core/poc"
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// regressionPocLimit is the smallest proof of capacity target of the
+// regression test network, any valid proof meets it.
+var regressionPocLimit = big.NewInt(1)
+
+// regressionGenesisHeader is the header of the genesis block of the
+// regression test network, its ChainID is filled in init.  Binding state is
+// enforced since genesis, so BindingRoot is the root of an empty trie.  It is
+// signed by the first regtest key of blockchain.GenerateBlocks.
+var regressionGenesisHeader = wire.BlockHeader{
+	Version:         wire.BlockVersionV2,
+	Height:          0,
+	Timestamp:       time.Unix(0x5fee6601, 0), // 2021-01-01 00:00:01 +0000 UTC
+	Previous:        mustDecodeHash("0000000000000000000000000000000000000000000000000000000000000000"),
+	TransactionRoot: genesisHeader.TransactionRoot,
+	WitnessRoot:     genesisHeader.WitnessRoot,
+	ProposalRoot:    genesisHeader.ProposalRoot,
+	Target:          regressionPocLimit,
+	Challenge:       mustDecodeHash("4ef5079e389a16a39037d790a5ce3b851c4b7266527175a1859ae34d832e9b54"),
+	PubKey:          mustDecodePoCPublicKey("02c57ec343194cb08645935a9db37ce67e71a427b4d9a81d2c58c9a0d5ee38be2f"),
+	Proof: &poc.DefaultProof{
+		X:      mustDecodeString("940c66"),
+		XPrime: mustDecodeString("e3b4ad"),
+		BL:     24,
+	},
+	BindingRoot: common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"), // empty binding state
+	Signature:   mustDecodePoCSignature("3044022048e215c492add9d119a4f2930ba52ed9785611d87efe443a6cc6888a5d9c9bb802205f5b93cba3169440b02dc8b552ac938d0ccac7ae614919d008285f9d637e8168"),
+	BanList:     make([]interfaces.PublicKey, 0),
+}
+
+// regressionGenesisBlock defines the genesis block of the regression test
+// network, it has the same coinbase as the one of the main network.
+var regressionGenesisBlock = wire.MsgBlock{
+	Header: regressionGenesisHeader,
+	Proposals: wire.ProposalArea{
+		PunishmentArea: make([]*wire.FaultPubKey, 0),
+		OtherArea:      make([]*wire.NormalProposal, 0),
+	},
+	Transactions: []*wire.MsgTx{&genesisCoinbaseTx},
+}
+
+// RegressionNetParams defines the network parameters for the regression test
+// network.  It is meant for local tests only: the proof of capacity target is
+// trivially low, there are no checkpoints, and MASSIP0001 and the warm-up of
+// MASSIP0002 are active since genesis.  MASSIP0002 itself is disabled by
+// default since minting requires a binding once it is active, use
+// NewRegressionNetParams to test it.
+var RegressionNetParams = Params{
+	Name:        "regtest",
+	DefaultPort: "43553",
+	DNSSeeds:    []string{},
+
+	// Chain parameters
+	GenesisBlock:           &regressionGenesisBlock,
+	PocLimit:               regressionPocLimit,
+	SubsidyHalvingInterval: consensus.SubsidyHalvingInterval,
+	ResetMinDifficulty:     true,
+
+	// Checkpoints ordered from oldest to newest.
+	Checkpoints: nil,
+
+	// Mempool parameters
+	RelayNonStdTxs: true,
+
+	// Human-readable part for Bech32 encoded segwit addresses, as defined in
+	// BIP 173.
+	Bech32HRPSegwit: "msrt", // always msrt for regression test net
+
+	// Address encoding magics
+	PubKeyHashAddrID:        0x6f, // starts with m or n
+	ScriptHashAddrID:        0xc4, // starts with 2
+	PrivateKeyID:            0xef, // starts with 9 (uncompressed) or c (compressed)
+	WitnessPubKeyHashAddrID: 0x03,
+	WitnessScriptHashAddrID: 0x28,
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: HDCoinTypeTestNet,
+
+	// Deployments of consensus rule changes
+	Deployments: []consensus.Deployment{
+		{Name: consensus.DeploymentMASSIP0001, Height: 0},
+		{Name: consensus.DeploymentMASSIP0002WarmUp, Height: 0},
+		{Name: consensus.DeploymentMASSIP0002, Height: math.MaxUint64},
+	},
+	RuleChangeActivationThreshold: 108, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       144,
+}
+
+// NewRegressionNetParams returns a copy of RegressionNetParams with MASSIP0002
+// active since massip0002Height, so that tests can exercise the binding rules
+// of MASSIP0002 after binding the plots of the first blocks.
+func NewRegressionNetParams(massip0002Height uint64) *Params {
+	params := RegressionNetParams
+	params.Deployments = make([]consensus.Deployment, len(RegressionNetParams.Deployments))
+	copy(params.Deployments, RegressionNetParams.Deployments)
+	params.Deployment(consensus.DeploymentMASSIP0002).Height = massip0002Height
+	return &params
+}
+
+// initGenesis fills the ChainID of the genesis block of params and sets
+// ChainID and GenesisHash.
+func initGenesis(params *Params) {
+	chainID, err := params.GenesisBlock.Header.GetChainID()
+	if err != nil {
+		panic(err) // should not happen
+	}
+	params.GenesisBlock.Header.ChainID = chainID
+	genesisHash := params.GenesisBlock.Header.BlockHash()
+	params.ChainID = &chainID
+	params.GenesisHash = &genesisHash
+}
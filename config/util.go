@@ -318,3 +318,16 @@ func ParseCheckpoints(checkpointStrings []string) ([]Checkpoint, error) {
 	}
 	return checkpoints, nil
 }
+
+// ParseAssumeValid parses the assume-valid block in the '<height>:<hash>'
+// format, it returns nil if the string is empty, which disables assume-valid.
+func ParseAssumeValid(assumeValid string) (*Checkpoint, error) {
+	if assumeValid == "" {
+		return nil, nil
+	}
+	checkpoint, err := newCheckpointFromStr(assumeValid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assume-valid block: %v", err)
+	}
+	return &checkpoint, nil
+}
@@ -0,0 +1,113 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Names of the deployments of consensus rule changes.
+const (
+	DeploymentMASSIP0001       = "massip0001"
+	DeploymentMASSIP0002WarmUp = "massip0002_warmup"
+	DeploymentMASSIP0002       = "massip0002"
+)
+
+// VersionBitsShift is the position of the first bit of BlockHeader.Version
+// used by miners to signal deployments, the lower bits hold the block version
+// itself.
+const VersionBitsShift = 32
+
+// MaxVersionBit is the largest signalling bit of a deployment.
+const MaxVersionBit = 63 - VersionBitsShift
+
+// VersionBits describes how miners signal a deployment through the upper
+// bits of BlockHeader.Version.  Signalling is counted in periods of blocks,
+// the deployment is locked in after a period with enough signalling blocks
+// and active since the next period.
+type VersionBits struct {
+	// Bit is the signalling bit, counted from VersionBitsShift.
+	Bit uint8
+
+	// StartHeight is the height signalling is counted since, it should be
+	// the first height of a period.
+	StartHeight uint64
+
+	// TimeoutHeight is the height the deployment fails at if it is not
+	// locked in yet.
+	TimeoutHeight uint64
+}
+
+// Mask returns the bits of a block version signalling the deployment.
+func (vb *VersionBits) Mask() uint64 {
+	return uint64(1) << (VersionBitsShift + uint(vb.Bit))
+}
+
+// Deployment describes a named consensus rule change.
+type Deployment struct {
+	Name string
+
+	// Height is the height of the first block the rules are enforced at.  A
+	// signalled deployment may be enforced earlier by signalling, its Height
+	// is math.MaxUint64 if it is only enforced by signalling.
+	Height uint64
+
+	// Signal is the optional signalling of the deployment through block
+	// versions, nil if it is not signalled.
+	Signal *VersionBits
+}
+
+// Signals returns whether a block of version signals the deployment.
+func (d *Deployment) Signals(version uint64) bool {
+	return d.Signal != nil && version&d.Signal.Mask() != 0
+}
+
+// IsActive returns whether the deployment is active at height, regardless of
+// signalling.
+func (d *Deployment) IsActive(height uint64) bool {
+	return height >= d.Height
+}
+
+// MainNetDeployments are the deployments of the main network.
+var MainNetDeployments = []Deployment{
+	{Name: DeploymentMASSIP0001, Height: 694000},
+	{Name: DeploymentMASSIP0002WarmUp, Height: 1398801}, // disable old binding
+	{Name: DeploymentMASSIP0002, Height: 1404801},       // disallow minting without binding
+}
+
+// CheckDeployments ensures deployments have unique names and signalling bits.
+func CheckDeployments(deployments []Deployment) error {
+	names := make(map[string]struct{}, len(deployments))
+	bits := make(map[uint8]string)
+	for _, d := range deployments {
+		if d.Name == "" {
+			return errors.New("missing deployment name")
+		}
+		if _, ok := names[d.Name]; ok {
+			return fmt.Errorf("duplicate deployment %s", d.Name)
+		}
+		names[d.Name] = struct{}{}
+		if d.Signal == nil {
+			continue
+		}
+		if d.Signal.Bit > MaxVersionBit {
+			return fmt.Errorf("invalid signalling bit %d of deployment %s", d.Signal.Bit, d.Name)
+		}
+		if d.Signal.StartHeight >= d.Signal.TimeoutHeight {
+			return fmt.Errorf("deployment %s times out before it starts", d.Name)
+		}
+		if other, ok := bits[d.Signal.Bit]; ok {
+			return fmt.Errorf("deployments %s and %s share signalling bit %d", other, d.Name, d.Signal.Bit)
+		}
+		bits[d.Signal.Bit] = d.Name
+	}
+	return nil
+}
+
+// DeploymentChecker reports whether the deployment of name is active at
+// height.  It is implemented by the parameters of a network by height, and by
+// the block chain, which also takes signalling into account.  Consensus rules
+// are checked against the deployments of the chain being validated, there is
+// no process-wide set of deployments.
+type DeploymentChecker interface {
+	IsActive(name string, height uint64) bool
+}
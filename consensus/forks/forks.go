@@ -19,11 +19,11 @@ type StakingTx interface {
 	GetFrozenPeriod() uint64
 }
 
-func CalcTotalStakingWeight(blockHeight uint64, stakingNodes ...StakingNode) (*safetype.Uint128, error) {
+func CalcTotalStakingWeight(params consensus.DeploymentChecker, blockHeight uint64, stakingNodes ...StakingNode) (*safetype.Uint128, error) {
 	totalWeight := safetype.NewUint128()
 	var err error
 	for _, node := range stakingNodes {
-		if blockHeight < consensus.MASSIP0001Height {
+		if !params.IsActive(consensus.DeploymentMASSIP0001, blockHeight) {
 			// by value
 			totalWeight, err = totalWeight.AddInt(node.GetValue())
 		} else {
@@ -37,15 +37,15 @@ func CalcTotalStakingWeight(blockHeight uint64, stakingNodes ...StakingNode) (*s
 	return totalWeight, nil
 }
 
-func CalcStakingNodeWeight(blockHeight uint64, stakingNode StakingNode) (*safetype.Uint128, error) {
-	if blockHeight < consensus.MASSIP0001Height {
+func CalcStakingNodeWeight(params consensus.DeploymentChecker, blockHeight uint64, stakingNode StakingNode) (*safetype.Uint128, error) {
+	if !params.IsActive(consensus.DeploymentMASSIP0001, blockHeight) {
 		return safetype.NewUint128FromInt(stakingNode.GetValue())
 	}
 	return stakingNode.GetWeight(), nil
 }
 
-func CalcEffectiveStakingPeriod(blockHeight uint64, stakingTx StakingTx) (period uint64) {
-	if blockHeight < consensus.MASSIP0001Height {
+func CalcEffectiveStakingPeriod(params consensus.DeploymentChecker, blockHeight uint64, stakingTx StakingTx) (period uint64) {
+	if !params.IsActive(consensus.DeploymentMASSIP0001, blockHeight) {
 		tmp := stakingTx.GetBlockHeight() + stakingTx.GetFrozenPeriod() + 1
 		if tmp >= blockHeight {
 			period = tmp - blockHeight
@@ -59,8 +59,8 @@ func CalcEffectiveStakingPeriod(blockHeight uint64, stakingTx StakingTx) (period
 	return
 }
 
-func SortStakingNodesByWeight(blockHeight uint64) bool {
-	return blockHeight >= consensus.MASSIP0001Height
+func SortStakingNodesByWeight(params consensus.DeploymentChecker, blockHeight uint64) bool {
+	return params.IsActive(consensus.DeploymentMASSIP0001, blockHeight)
 }
 
 // 1. Disable old binding, enfore new binding.
@@ -72,8 +72,8 @@ func SortStakingNodesByWeight(blockHeight uint64) bool {
 // 4. New reward logic.
 //
 // 5. Both MASS and Chia miner available.
-func EnforceMASSIP0002(blockHeight uint64) bool {
-	return blockHeight >= consensus.MASSIP0002Height
+func EnforceMASSIP0002(params consensus.DeploymentChecker, blockHeight uint64) bool {
+	return params.IsActive(consensus.DeploymentMASSIP0002, blockHeight)
 }
 
 // 1. Disable old binding, enfore new binding.
@@ -83,12 +83,12 @@ func EnforceMASSIP0002(blockHeight uint64) bool {
 // 3. Base minting reward (no binding reward).
 //
 // 4. Only MASS miner available.
-func EnforceMASSIP0002WarmUp(blockHeight uint64) bool {
-	return blockHeight >= consensus.MASSIP0002WarmUpHeight
+func EnforceMASSIP0002WarmUp(params consensus.DeploymentChecker, blockHeight uint64) bool {
+	return params.IsActive(consensus.DeploymentMASSIP0002WarmUp, blockHeight)
 }
 
-func GetRequiredBinding(nextHeight, plotSize uint64, massBitlength int, networkBinding massutil.Amount) (massutil.Amount, error) {
-	if !EnforceMASSIP0002WarmUp(nextHeight) {
+func GetRequiredBinding(params consensus.DeploymentChecker, nextHeight, plotSize uint64, massBitlength int, networkBinding massutil.Amount) (massutil.Amount, error) {
+	if !EnforceMASSIP0002WarmUp(params, nextHeight) {
 		price, ok := bindingPriceSinceGenesis[massBitlength]
 		if !ok {
 			return massutil.ZeroAmount(), fmt.Errorf("invalid mass bitlength %d", massBitlength)
@@ -145,8 +145,8 @@ func GetRequiredBinding(nextHeight, plotSize uint64, massBitlength int, networkB
 
 }
 
-func GetBlockVersion(height uint64) uint64 {
-	if EnforceMASSIP0002WarmUp(height) {
+func GetBlockVersion(params consensus.DeploymentChecker, height uint64) uint64 {
+	if EnforceMASSIP0002WarmUp(params, height) {
 		return wire.BlockVersionV2
 	} else {
 		return wire.BlockVersionV1
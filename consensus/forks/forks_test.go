@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/massnetorg/mass-core/config"
 	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/stretchr/testify/assert"
@@ -114,7 +115,7 @@ func TestGetRequiredBinding(t *testing.T) {
 	}{
 		{
 			name:           "zero network binding",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       32 * 1024 * 1024 * 1024,
 			bitlength:      20,
 			networkBinding: newAmount(0),
@@ -122,7 +123,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "3 million MASS",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       32 * 1024 * 1024 * 1024,
 			bitlength:      20,
 			networkBinding: newAmount(166666600000000),
@@ -130,7 +131,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "3 million MASS + 1 Maxwell, enter next interval",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       32 * 1024 * 1024 * 1024,
 			bitlength:      20,
 			networkBinding: newAmount(166666600000001),
@@ -138,7 +139,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "zero plot size",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       0,
 			bitlength:      20,
 			networkBinding: newAmount(166666600000001),
@@ -147,7 +148,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "1-byte plot size",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       1,
 			bitlength:      20,
 			networkBinding: newAmount(166666600000001),
@@ -155,7 +156,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "64GB - 1B",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       32*1024*1024*1024*2 - 1,
 			bitlength:      20,
 			networkBinding: newAmount(300000000000001),
@@ -163,7 +164,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "64GB",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       32 * 1024 * 1024 * 1024 * 2,
 			bitlength:      20,
 			networkBinding: newAmount(300000000000001),
@@ -171,7 +172,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "1TB and no pre calculated price found",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       1024 * 1024 * 1024 * 1024,
 			bitlength:      -1,
 			networkBinding: newAmount(1580825600000001), // 1 Maxwell more than 3000PB
@@ -179,7 +180,7 @@ func TestGetRequiredBinding(t *testing.T) {
 		},
 		{
 			name:           "160TB and no pre calculated price found-2",
-			height:         consensus.MASSIP0002WarmUpHeight,
+			height:         config.ChainParams.Deployment(consensus.DeploymentMASSIP0002WarmUp).Height,
 			plotsize:       160 * 1024 * 1024 * 1024 * 1024,
 			bitlength:      -1,
 			networkBinding: newAmount(1822933900000000), // 4900PB
@@ -189,7 +190,7 @@ func TestGetRequiredBinding(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			amt, err := GetRequiredBinding(test.height, test.plotsize, test.bitlength, test.networkBinding)
+			amt, err := GetRequiredBinding(&config.ChainParams, test.height, test.plotsize, test.bitlength, test.networkBinding)
 			if test.expectErr == "" {
 				assert.NoError(t, err)
 			} else {
@@ -201,3 +202,23 @@ func TestGetRequiredBinding(t *testing.T) {
 		})
 	}
 }
+
+func TestDeployments(t *testing.T) {
+	params := config.ChainParams
+	params.Deployments = []consensus.Deployment{
+		{Name: consensus.DeploymentMASSIP0001, Height: 0},
+		{Name: consensus.DeploymentMASSIP0002WarmUp, Height: 10},
+		{Name: consensus.DeploymentMASSIP0002, Height: 20},
+	}
+	require.True(t, SortStakingNodesByWeight(&params, 0))
+	require.False(t, EnforceMASSIP0002WarmUp(&params, 9))
+	require.True(t, EnforceMASSIP0002WarmUp(&params, 10))
+	require.False(t, EnforceMASSIP0002(&params, 19))
+	require.True(t, EnforceMASSIP0002(&params, 20))
+	require.Equal(t, uint64(2), GetBlockVersion(&params, 10))
+
+	// the deployments of one network do not affect another
+	require.False(t, SortStakingNodesByWeight(&config.ChainParams, 0))
+	require.False(t, EnforceMASSIP0002WarmUp(&config.ChainParams, 10))
+	require.Equal(t, uint64(1), GetBlockVersion(&config.ChainParams, 10))
+}
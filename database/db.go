@@ -3,7 +3,9 @@ package database
 import (
 	"crypto/sha256"
 	"errors"
+	"io"
 
+	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/interfaces"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/wire"
@@ -26,6 +28,13 @@ var (
 	ErrInvalidBlockStorageMeta  = errors.New("invalid block storage meta")
 	ErrInvalidAddrIndexMeta     = errors.New("invalid addr index meta")
 	ErrDeleteNonNewestBlock     = errors.New("delete block that is not newest")
+	ErrBlockPruned              = errors.New("requested block has been pruned")
+	ErrInvalidSnapshot          = errors.New("invalid snapshot data")
+	ErrSnapshotVersion          = errors.New("unsupported snapshot version")
+	ErrSnapshotDbNotEmpty       = errors.New("snapshot must be imported into empty database")
+	ErrSnapshotCommitment       = errors.New("snapshot commitment mismatch")
+	ErrSnapshotGenesis          = errors.New("snapshot genesis mismatch")
+	ErrUtxoIndexDoesNotExist    = errors.New("utxo index is not enabled")
 )
 
 // Db defines a generic interface that is used to request and insert data into
@@ -129,11 +138,12 @@ type Db interface {
 
 	// FetchUnexpiredStakingRank returns only currently unexpired staking rank at
 	// target height. This function is for mining and validating block.
-	FetchUnexpiredStakingRank(height uint64, onlyOnList bool) ([]Rank, error)
+	// Staking weights follow the deployments of params.
+	FetchUnexpiredStakingRank(params consensus.DeploymentChecker, height uint64, onlyOnList bool) ([]Rank, error)
 
 	// FetchStakingRank returns staking rank at any height. This
 	// function may be slow.
-	FetchStakingRank(height uint64, onlyOnList bool) ([]Rank, error)
+	FetchStakingRank(params consensus.DeploymentChecker, height uint64, onlyOnList bool) ([]Rank, error)
 
 	// fetch a map of all staking transactions in database
 	FetchStakingTxMap() (StakingNodes, error)
@@ -176,6 +186,41 @@ type Db interface {
 
 	FetchMinedBlocks(pubKey interfaces.PublicKey) ([]uint64, error)
 
+	// InsertInvalidBlock marks a block as invalid instantly.
+	InsertInvalidBlock(hash *wire.Hash) error
+
+	// DeleteInvalidBlock removes the invalid mark of a block instantly.
+	DeleteInvalidBlock(hash *wire.Hash) error
+
+	// FetchInvalidBlocks returns all blocks marked as invalid, with random order.
+	FetchInvalidBlocks() ([]*wire.Hash, error)
+
+	// PruneBlockFiles deletes block files that hold only blocks lower than
+	// (best height - keepDepth). Headers and unspent transactions of pruned
+	// blocks are still kept in database. It returns the pruned height.
+	PruneBlockFiles(keepDepth uint64) (prunedHeight uint64, err error)
+
+	// FetchPrunedHeight returns the height below which raw blocks may have
+	// been pruned, it returns 0 if no block has been pruned. Fetching pruned
+	// blocks returns ErrBlockPruned.
+	FetchPrunedHeight() uint64
+
+	// ExportSnapshot writes a snapshot of the chain state at current best
+	// block to w, including unspent transactions, staking tx index, fault
+	// pubkeys, headers of all blocks and raw data of the latest numBlocks
+	// blocks. The returned info contains the commitment of the snapshot.
+	ExportSnapshot(w io.Writer, numBlocks uint64) (*SnapshotInfo, error)
+
+	// ImportSnapshot initializes an empty database from snapshot written by
+	// ExportSnapshot. Blocks not included in the snapshot are treated as
+	// pruned. It returns ErrSnapshotGenesis before writing anything if the
+	// snapshot is of another chain than genesis, and ErrSnapshotCommitment if
+	// the snapshot is corrupted. The optional commit is called once all
+	// records are verified, the database stays empty unless it succeeds.
+	// Data written before an error is not removed, the database must be
+	// discarded on any error.
+	ImportSnapshot(r io.Reader, genesis *wire.Hash, commit SnapshotCommitFunc) (*SnapshotInfo, error)
+
 	// FetchAddrIndexTip returns the hash and block height of the most recent
 	// block which has had its address index populated. It will return
 	// ErrAddrIndexDoesNotExist along with a zero hash, and math.MaxUint64 if
@@ -191,6 +236,24 @@ type Db interface {
 
 	CheckScriptHashUsed(scriptHash []byte) (bool, error)
 
+	// EnableUtxoIndex builds the index of unspent outputs by script hash from
+	// current unspent transactions if it does not exist. Once enabled, the
+	// index is updated by SubmitAddrIndex and DeleteAddrIndex.
+	EnableUtxoIndex() error
+
+	// DisableUtxoIndex removes the index of unspent outputs if it exists.
+	DisableUtxoIndex() error
+
+	// FetchUtxosByScriptHash returns unspent outputs of scriptHash, which is
+	// the witness script hash, or the holder script hash of binding outputs.
+	// It returns ErrUtxoIndexDoesNotExist if the index is not enabled.
+	FetchUtxosByScriptHash(scriptHash []byte) ([]*UtxoReply, error)
+
+	// FetchBalanceByScriptHash returns total value of unspent outputs of
+	// scriptHash by type. It returns ErrUtxoIndexDoesNotExist if the index is
+	// not enabled.
+	FetchBalanceByScriptHash(scriptHash []byte) (*ScriptHashBalance, error)
+
 	// pubkeyHash is hash of MASS plot pubkey
 	FetchOldBinding(pubkeyHash []byte) ([]*BindingTxReply, error)
 
@@ -266,6 +329,12 @@ type UtxoReply struct {
 	Coinbase bool
 	Index    uint32
 	Value    massutil.Amount
+	Type     UtxoType
+	// FrozenPeriod is only set for staking outputs.
+	FrozenPeriod uint64
+	// Immature is true if it is a coinbase output that has not reached
+	// coinbase maturity at best height.
+	Immature bool
 }
 
 // AddrIndexKeySize is the number of bytes used by keys into the BlockAddrIndex.
@@ -362,6 +431,43 @@ type AddrIndexData struct {
 	TxIndex             TxAddrIndex
 	BindingTxIndex      BindingTxAddrIndex
 	BindingTxSpentIndex BindingTxSpentAddrIndex
+	// UtxoIndex is nil if the utxo index is not enabled.
+	UtxoIndex *UtxoIndexData
+}
+
+// UtxoIndexData represents the outputs created and spent by a block.
+type UtxoIndexData struct {
+	Created []*UtxoIndexOutput
+	Spent   []*UtxoIndexOutput
+}
+
+type UtxoIndexOutput struct {
+	OutPoint    wire.OutPoint
+	PkScript    []byte
+	Value       int64
+	BlockHeight uint64
+	Coinbase    bool
+}
+
+// UtxoType is the type of an indexed unspent output.
+type UtxoType byte
+
+const (
+	// UtxoRegular is a witness v0 script hash output.
+	UtxoRegular UtxoType = iota
+	// UtxoStaking is a staking script hash output.
+	UtxoStaking
+	// UtxoBinding is a binding script hash output, indexed by its holder.
+	UtxoBinding
+)
+
+// ScriptHashBalance is the total value of unspent outputs of a script hash,
+// each output is counted in exactly one of the fields.
+type ScriptHashBalance struct {
+	Spendable        massutil.Amount // regular outputs except immature coinbase
+	ImmatureCoinbase massutil.Amount
+	Staking          massutil.Amount
+	Binding          massutil.Amount
 }
 
 type BLHeight struct {
@@ -376,3 +482,20 @@ type BlockLoc struct {
 	Offset uint64
 	Length uint64
 }
+
+// SnapshotCommitFunc is called by ImportSnapshot with the snapshot info and
+// the header of the snapshot block before the import is committed, data
+// following the database snapshot is read from the same reader.
+type SnapshotCommitFunc func(info *SnapshotInfo, header *wire.BlockHeader) error
+
+// SnapshotInfo describes a snapshot of the chain state.
+type SnapshotInfo struct {
+	Height    uint64
+	Hash      wire.Hash
+	Genesis   wire.Hash
+	NumBlocks uint64 // number of latest blocks with raw data
+	NumTxs    uint64 // number of unspent transactions
+	// Commitment is the sha256 of snapshot data, it only depends on the
+	// chain state and NumBlocks.
+	Commitment wire.Hash
+}
@@ -28,6 +28,7 @@ type BlockFile struct {
 	lastAccessAt time.Time
 	file         *os.File
 	readonly     bool
+	pruned       bool
 }
 
 func NewBlockFile(fileNo uint32, readonly bool) *BlockFile {
@@ -74,6 +75,42 @@ func (b *BlockFile) Number() uint32 {
 	return b.fileNo
 }
 
+func (b *BlockFile) NumBlocks() uint32 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.numBlocks
+}
+
+func (b *BlockFile) HeightFirst() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.heightFirst
+}
+
+func (b *BlockFile) HeightLast() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.heightLast
+}
+
+func (b *BlockFile) IsPruned() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.pruned
+}
+
+// markPruned closes opened file and rejects any further read.
+func (b *BlockFile) markPruned() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+	b.pruned = true
+}
+
 func (b *BlockFile) AddBlock(height, size uint64, timestamp uint64) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -148,6 +185,10 @@ func (b *BlockFile) ReadRawData(flatFileSeq *FlatFileSeq, offset int64, size int
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if b.pruned {
+		return nil, ErrFilePruned
+	}
+
 	file, err := b.openFile(flatFileSeq, offset)
 	if err != nil {
 		return nil, err
@@ -19,7 +19,9 @@ type BlockFileKeeper struct {
 	closed        bool
 }
 
-func NewBlockFileKeeper(dir string, records [][]byte) *BlockFileKeeper {
+// NewBlockFileKeeper loads block files from records. Files that hold only
+// blocks lower than prunedHeight are regarded as pruned.
+func NewBlockFileKeeper(dir string, records [][]byte, prunedHeight uint64) *BlockFileKeeper {
 	keeper := &BlockFileKeeper{
 		flatFileSeq:   NewFlatFileSeq(dir, "blk", BlockfileChunkSize),
 		blockFiles:    make([]*BlockFile, len(records)),
@@ -35,6 +37,16 @@ func NewBlockFileKeeper(dir string, records [][]byte) *BlockFileKeeper {
 		}
 		keeper.blockFiles[bf.fileNo] = bf
 
+		// remove residual file if last pruning was interrupted
+		if readonly && bf.numBlocks > 0 && bf.heightLast < prunedHeight {
+			bf.pruned = true
+			if err := keeper.flatFileSeq.Remove(NewFlatFilePos(bf.fileNo, 0)); err != nil {
+				logging.CPrint(logging.ERROR, fmt.Sprintf("remove pruned blk%05d.dat error", bf.fileNo), logging.LogFormat{"err": err})
+				return nil
+			}
+			continue
+		}
+
 		// check file exist
 		if i < len(records)-1 {
 			exist, err := keeper.flatFileSeq.ExistFile(NewFlatFilePos(bf.fileNo, 0))
@@ -175,3 +187,47 @@ func (b *BlockFileKeeper) ReadRawTx(fileNo uint32, offsetBlk, offsetTxInBlk int6
 	targetOffset := offsetBlk + int64(BlkMessageHeaderLength) + offsetTxInBlk
 	return b.blockFiles[fileNo].ReadRawData(b.flatFileSeq, targetOffset, txSize)
 }
+
+// PrunableFiles returns unpruned files that hold only blocks lower than height,
+// the file being written is never returned.
+func (b *BlockFileKeeper) PrunableFiles(height uint64) []*BlockFile {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	files := make([]*BlockFile, 0)
+	for i, bf := range b.blockFiles {
+		if i >= int(b.lastBlockFile) {
+			break
+		}
+		if bf.IsPruned() || bf.NumBlocks() == 0 || bf.HeightLast() >= height {
+			continue
+		}
+		files = append(files, bf)
+	}
+	return files
+}
+
+// RemoveFiles marks files as pruned and deletes them from disk.
+func (b *BlockFileKeeper) RemoveFiles(files []*BlockFile) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, bf := range files {
+		if bf.Number() >= b.lastBlockFile {
+			return ErrFileOutOfRange
+		}
+		bf.markPruned()
+		if err := b.flatFileSeq.Remove(NewFlatFilePos(bf.Number(), 0)); err != nil {
+			return err
+		}
+		logging.CPrint(logging.INFO, fmt.Sprintf("blk%05d.dat pruned", bf.Number()), logging.LogFormat{
+			"heightFirst": bf.HeightFirst(),
+			"heightLast":  bf.HeightLast(),
+		})
+	}
+	return nil
+}
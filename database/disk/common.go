@@ -6,12 +6,15 @@ import (
 )
 
 const (
-	MaxBlockfileSize   = 128 * 1024 * 1024 // 128 MiB
-	BlockfileChunkSize = 16 * 1024 * 1024  // 16 MiB
+	BlockfileChunkSize = 16 * 1024 * 1024 // 16 MiB
 
 	MinDiskSpace = 256 * 1024 * 1024 // 256 MiB
 )
 
+// MaxBlockfileSize is the size limit of a single blkXXXXX.dat, it is declared
+// as variable so that tests are able to shrink it.
+var MaxBlockfileSize uint64 = 128 * 1024 * 1024 // 128 MiB
+
 var (
 	ErrInvalidFlatFilePos    = errors.New("invalid FlatFilePos")
 	ErrOutOfSpace            = errors.New("out of space")
@@ -20,6 +23,7 @@ var (
 	ErrReadBrokenData        = errors.New("read broken data")
 	ErrFileOutOfRange        = errors.New("file out of range")
 	ErrClosed                = errors.New("file writer closed")
+	ErrFilePruned            = errors.New("file pruned")
 )
 
 var (
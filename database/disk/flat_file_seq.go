@@ -35,6 +35,14 @@ func (f *FlatFileSeq) ExistFile(pos *FlatFilePos) (bool, error) {
 	return true, nil
 }
 
+func (f *FlatFileSeq) Remove(pos *FlatFilePos) error {
+	err := os.Remove(f.FilePath(pos))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 func (f *FlatFileSeq) Open(pos *FlatFilePos, readOnly bool) (file *os.File, err error) {
 	if pos == nil {
 		return nil, ErrInvalidFlatFilePos
@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/database/disk"
 	"github.com/massnetorg/mass-core/database/storage"
 	"github.com/massnetorg/mass-core/debug"
 	"github.com/massnetorg/mass-core/errors"
@@ -94,6 +95,7 @@ func (db *ChainDb) submitBlock(block *massutil.Block) (err error) {
 	newStorageMeta := dbStorageMeta{
 		currentHeight: block.Height(),
 		currentHash:   *block.Hash(),
+		prunedHeight:  db.dbStorageMeta.prunedHeight,
 	}
 	batch.Put(dbStorageMetaDataKey, encodeDBStorageMetaData(newStorageMeta))
 
@@ -168,7 +170,7 @@ func (db *ChainDb) submitBlock(block *massutil.Block) (err error) {
 			return err
 		}
 	}
-	return nil
+	return db.markSpentPrunedTxs(batch, block.Height(), true)
 }
 
 func (db *ChainDb) DeleteBlock(hash *wire.Hash) error {
@@ -242,6 +244,9 @@ func (db *ChainDb) deleteBlock(hash *wire.Hash) (err error) {
 			return err
 		}
 	}
+	if err = db.markSpentPrunedTxs(batch, height, false); err != nil {
+		return err
+	}
 
 	if err = db.freeze(height); err != nil {
 		return err
@@ -284,16 +289,15 @@ func (db *ChainDb) deleteBlock(hash *wire.Hash) (err error) {
 	// See NewChainDb(...)
 	newStorageMeta := dbStorageMeta{
 		currentHeight: UnknownHeight,
+		prunedHeight:  db.dbStorageMeta.prunedHeight,
 	}
 	if height != 0 {
-		lastHash, _, err := db.getBlkByHeight(height - 1)
+		lastHash, err := db.fetchBlockShaByHeight(height - 1)
 		if err != nil {
 			return err
 		}
-		newStorageMeta = dbStorageMeta{
-			currentHeight: height - 1,
-			currentHash:   *lastHash,
-		}
+		newStorageMeta.currentHeight = height - 1
+		newStorageMeta.currentHash = *lastHash
 	}
 	batch.Put(dbStorageMetaDataKey, encodeDBStorageMetaData(newStorageMeta))
 
@@ -413,11 +417,21 @@ func (db *ChainDb) FetchBlockHeightBySha(sha *wire.Hash) (uint64, error) {
 func (db *ChainDb) FetchBlockHeaderBySha(sha *wire.Hash) (bh *wire.BlockHeader, err error) {
 
 	// Read the raw block from the database.
-	buf, _, err := db.fetchSha(sha)
+	buf, height, err := db.fetchSha(sha)
+	if err == database.ErrBlockPruned {
+		buf, err = db.getPrunedBlockBase(height)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	bh, _, err = decodeBlockHeader(buf)
+	return bh, err
+}
+
+// decodeBlockHeader decodes header from the leading BlockBase of raw block,
+// it also returns the length of bytes consumed.
+func decodeBlockHeader(buf []byte) (*wire.BlockHeader, int, error) {
 	r := bytes.NewReader(buf)
 
 	// Only deserialize the header portion and ensure the transaction count
@@ -425,28 +439,26 @@ func (db *ChainDb) FetchBlockHeaderBySha(sha *wire.Hash) (bh *wire.BlockHeader,
 	// Read BLockBase length
 	blockBaseLength, _, err := wire.ReadUint64(r, 0)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// Read BlockBase
 	baseData := make([]byte, blockBaseLength)
 	_, err = r.Read(baseData)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	basePb := new(wirepb.BlockBase)
 	err = proto.Unmarshal(baseData, basePb)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	base, err := wire.NewBlockBaseFromProto(basePb)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	bh = &base.Header
-
-	return bh, nil
+	return &base.Header, len(buf) - r.Len(), nil
 }
 
 func (db *ChainDb) getBlkHeight(sha *wire.Hash) (uint64, error) {
@@ -495,9 +507,15 @@ func (db *ChainDb) getBlkByHeight(blkHeight uint64) (rsha *wire.Hash, rbuf []byt
 	if err != nil {
 		return nil, nil, err
 	}
+	if fileNo == snapshotFileNo {
+		return rsha, nil, database.ErrBlockPruned
+	}
 
 	rbuf, err = db.blkFileKeeper.ReadRawBlock(fileNo, offset, int(blkSize))
 	if err != nil {
+		if err == disk.ErrFilePruned {
+			return rsha, nil, database.ErrBlockPruned
+		}
 		logging.CPrint(logging.ERROR, "failed to read raw block", logging.LogFormat{"height": blkHeight, "err": err})
 		return nil, nil, err
 	}
@@ -517,12 +535,13 @@ func (db *ChainDb) getBlk(sha *wire.Hash) (rBlkHeight uint64, rBuf []byte, err e
 
 	_, buf, err = db.getBlkByHeight(blkHeight)
 	if err != nil {
-		return
+		return blkHeight, nil, err
 	}
 	return blkHeight, buf, nil
 }
 
 // fetchSha returns the datablock for the given Hash.
+// The block height is also returned with database.ErrBlockPruned.
 func (db *ChainDb) fetchSha(sha *wire.Hash) (rBuf []byte,
 	rBlkHeight uint64, err error) {
 	var blkHeight uint64
@@ -530,7 +549,7 @@ func (db *ChainDb) fetchSha(sha *wire.Hash) (rBuf []byte,
 
 	blkHeight, buf, err = db.getBlk(sha)
 	if err != nil {
-		return
+		return nil, blkHeight, err
 	}
 
 	return buf, blkHeight, nil
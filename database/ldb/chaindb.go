@@ -23,32 +23,47 @@ const (
 	blockBatch     = 0
 	addrIndexBatch = 1
 
-	blockStorageMetaDataLength = 40
+	blockStorageMetaDataLength       = 40
+	blockStorageMetaDataLengthPruned = 48
 )
 
 var (
 	dbStorageMetaDataKey = []byte("DBSTORAGEMETA")
 )
 
+// |  current hash  |  current height  |  pruned height(optional)  |
+// |    32-bytes    |     8-bytes      |          8-bytes          |
 type dbStorageMeta struct {
 	currentHeight uint64
 	currentHash   wire.Hash
+	prunedHeight  uint64
 }
 
 func decodeDBStorageMetaData(bs []byte) (meta dbStorageMeta, err error) {
-	if length := len(bs); length != blockStorageMetaDataLength {
+	length := len(bs)
+	if length != blockStorageMetaDataLength && length != blockStorageMetaDataLengthPruned {
 		logging.CPrint(logging.ERROR, "invalid blockStorageMetaData", logging.LogFormat{"length": length, "data": bs})
 		return dbStorageMeta{}, database.ErrInvalidBlockStorageMeta
 	}
 	copy(meta.currentHash[:], bs[:32])
-	meta.currentHeight = binary.LittleEndian.Uint64(bs[32:])
+	meta.currentHeight = binary.LittleEndian.Uint64(bs[32:40])
+	if length == blockStorageMetaDataLengthPruned {
+		meta.prunedHeight = binary.LittleEndian.Uint64(bs[40:48])
+	}
 	return meta, nil
 }
 
 func encodeDBStorageMetaData(meta dbStorageMeta) []byte {
-	bs := make([]byte, blockStorageMetaDataLength)
+	if meta.prunedHeight == 0 {
+		bs := make([]byte, blockStorageMetaDataLength)
+		copy(bs, meta.currentHash[:])
+		binary.LittleEndian.PutUint64(bs[32:], meta.currentHeight)
+		return bs
+	}
+	bs := make([]byte, blockStorageMetaDataLengthPruned)
 	copy(bs, meta.currentHash[:])
-	binary.LittleEndian.PutUint64(bs[32:], meta.currentHeight)
+	binary.LittleEndian.PutUint64(bs[32:40], meta.currentHeight)
+	binary.LittleEndian.PutUint64(bs[40:48], meta.prunedHeight)
 	return bs
 }
 
@@ -166,7 +181,10 @@ func NewChainDb(dbpath string, stor storage.Storage) (*ChainDb, error) {
 		}
 		records = append(records, file0)
 	}
-	cdb.blkFileKeeper = disk.NewBlockFileKeeper(blkDir, records)
+	cdb.blkFileKeeper = disk.NewBlockFileKeeper(blkDir, records, blockMeta.prunedHeight)
+	if cdb.blkFileKeeper == nil {
+		return nil, ErrInvalidBlockFileMeta
+	}
 	return cdb, nil
 }
 
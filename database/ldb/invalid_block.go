@@ -0,0 +1,50 @@
+package ldb
+
+import (
+	"github.com/massnetorg/mass-core/database/storage"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+var (
+	// Blocks invalidated manually, descendants are not recorded.
+	//
+	// |  "INVBLK"  |  block hash  |      |  (empty)  |
+	// |  6-bytes   |   32-bytes   |  ->  |           |
+	invalidBlockPrefix = []byte("INVBLK")
+)
+
+func invalidBlockToKey(hash *wire.Hash) []byte {
+	key := make([]byte, len(invalidBlockPrefix)+wire.HashSize)
+	copy(key, invalidBlockPrefix)
+	copy(key[len(invalidBlockPrefix):], hash[:])
+	return key
+}
+
+// InsertInvalidBlock marks the block as invalid instantly.
+func (db *ChainDb) InsertInvalidBlock(hash *wire.Hash) error {
+	return db.stor.Put(invalidBlockToKey(hash), blankData)
+}
+
+// DeleteInvalidBlock removes the invalid mark of the block instantly.
+func (db *ChainDb) DeleteInvalidBlock(hash *wire.Hash) error {
+	return db.stor.Delete(invalidBlockToKey(hash))
+}
+
+// FetchInvalidBlocks returns all blocks marked as invalid, with random order.
+func (db *ChainDb) FetchInvalidBlocks() ([]*wire.Hash, error) {
+	iter := db.stor.NewIterator(storage.BytesPrefix(invalidBlockPrefix))
+	defer iter.Release()
+
+	hashes := make([]*wire.Hash, 0)
+	for iter.Next() {
+		hash, err := wire.NewHash(iter.Key()[len(invalidBlockPrefix):])
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
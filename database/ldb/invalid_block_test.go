@@ -0,0 +1,31 @@
+package ldb_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainDb_InvalidBlock(t *testing.T) {
+	db, tearDown, err := GetDb("DbTest")
+	assert.Nil(t, err)
+	defer tearDown()
+
+	hashes, err := db.FetchInvalidBlocks()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(hashes))
+
+	hash1, hash2 := mockHash(), mockHash()
+	assert.Nil(t, db.InsertInvalidBlock(&hash1))
+	assert.Nil(t, db.InsertInvalidBlock(&hash2))
+	assert.Nil(t, db.InsertInvalidBlock(&hash2))
+	hashes, err = db.FetchInvalidBlocks()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hashes))
+
+	assert.Nil(t, db.DeleteInvalidBlock(&hash1))
+	hashes, err = db.FetchInvalidBlocks()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hashes))
+	assert.Equal(t, hash2, *hashes[0])
+}
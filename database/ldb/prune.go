@@ -0,0 +1,321 @@
+package ldb
+
+import (
+	"encoding/binary"
+
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/database/disk"
+	"github.com/massnetorg/mass-core/database/storage"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+var (
+	// Leading BlockBase of pruned main chain blocks, so that headers
+	// are still available.
+	//
+	// |  "PRNHDR"  |  block height  |      |  base length  |  BlockBase  |
+	// |   6-bytes  |     8-bytes    |  ->  |     varint    |             |
+	prunedHeaderKeyPrefix = []byte("PRNHDR")
+
+	// Raw transactions that were unspent when their block file was pruned.
+	//
+	// |  "PRNTX"  |  file no  |  block offset  |  tx offset  |      |  raw tx  |
+	// |  5-bytes  |  4-bytes  |     8-bytes    |   4-bytes   |  ->  |          |
+	prunedTxKeyPrefix = []byte("PRNTX")
+
+	// Raw transactions kept on pruning that were fully spent by the block at
+	// spent height, the value is the key of the raw transaction.  They are
+	// deleted once the spending block is deeper than the prune depth.
+	//
+	// |  "PRNSPT"  |  spent height  |  tx hash  |      |  "PRNTX" key  |
+	// |   6-bytes  |     8-bytes    |  32-bytes |  ->  |    21-bytes   |
+	prunedSpentKeyPrefix = []byte("PRNSPT")
+)
+
+const (
+	prunedHeaderKeyLength = 6 + 8
+	prunedTxKeyLength     = 5 + 4 + 8 + 4
+	prunedSpentKeyLength  = 6 + 8 + 32
+)
+
+func makePrunedHeaderKey(height uint64) []byte {
+	var bs [prunedHeaderKeyLength]byte
+	copy(bs[:], prunedHeaderKeyPrefix)
+	binary.LittleEndian.PutUint64(bs[6:], height)
+	return bs[:]
+}
+
+func makePrunedTxKey(fileNo uint32, blkOffset int64, txOff int) []byte {
+	var bs [prunedTxKeyLength]byte
+	copy(bs[:], prunedTxKeyPrefix)
+	binary.LittleEndian.PutUint32(bs[5:9], fileNo)
+	binary.LittleEndian.PutUint64(bs[9:17], uint64(blkOffset))
+	binary.LittleEndian.PutUint32(bs[17:21], uint32(txOff))
+	return bs[:]
+}
+
+// makePrunedSpentKey uses big endian height so that keys are ordered by height.
+func makePrunedSpentKey(height uint64, txSha *wire.Hash) []byte {
+	var bs [prunedSpentKeyLength]byte
+	copy(bs[:], prunedSpentKeyPrefix)
+	binary.BigEndian.PutUint64(bs[6:14], height)
+	copy(bs[14:], txSha[:])
+	return bs[:]
+}
+
+// getPrunedBlockBase returns the leading BlockBase of a pruned block.
+func (db *ChainDb) getPrunedBlockBase(height uint64) ([]byte, error) {
+	buf, err := db.stor.Get(makePrunedHeaderKey(height))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			err = database.ErrBlockPruned
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// getPrunedTx returns raw transaction kept on pruning its block file.
+func (db *ChainDb) getPrunedTx(fileNo uint32, blkOffset int64, txOff int) ([]byte, error) {
+	buf, err := db.stor.Get(makePrunedTxKey(fileNo, blkOffset, txOff))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			err = database.ErrBlockPruned
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readRawTx reads raw transaction from block file, or from database if the
+// block file has been pruned or the block is imported from snapshot.
+func (db *ChainDb) readRawTx(fileNo uint32, blkOffset int64, txOff, txLen int) ([]byte, error) {
+	if fileNo == snapshotFileNo {
+		return db.getPrunedTx(fileNo, blkOffset, txOff)
+	}
+	buf, err := db.blkFileKeeper.ReadRawTx(fileNo, blkOffset, int64(txOff), txLen)
+	if err == disk.ErrFilePruned {
+		return db.getPrunedTx(fileNo, blkOffset, txOff)
+	}
+	return buf, err
+}
+
+// FetchPrunedHeight returns the height below which raw blocks may have
+// been pruned.
+func (db *ChainDb) FetchPrunedHeight() uint64 {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.dbStorageMeta.prunedHeight
+}
+
+// PruneBlockFiles deletes whole block files that hold only blocks lower than
+// (best height - keepDepth). Before deleting, headers and transactions of main
+// chain blocks in these files that are unspent, or spent by the recent
+// keepDepth blocks, are copied into database, so keepDepth must be greater
+// than the max reorg depth.  Copies of transactions spent by blocks lower than
+// (best height - keepDepth) are deleted.
+//
+// It must not be called between SubmitBlock/DeleteBlock and Commit.
+func (db *ChainDb) PruneBlockFiles(keepDepth uint64) (uint64, error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	bestHeight := db.dbStorageMeta.currentHeight
+	if bestHeight == UnknownHeight || bestHeight <= keepDepth {
+		return db.dbStorageMeta.prunedHeight, nil
+	}
+
+	batch := db.stor.NewBatch()
+	defer batch.Release()
+
+	swept, err := db.deleteSpentPrunedTxs(batch, bestHeight-keepDepth)
+	if err != nil {
+		return db.dbStorageMeta.prunedHeight, err
+	}
+
+	files := db.blkFileKeeper.PrunableFiles(bestHeight - keepDepth)
+	if len(files) == 0 {
+		if swept > 0 {
+			if err := db.stor.Write(batch); err != nil {
+				return db.dbStorageMeta.prunedHeight, err
+			}
+		}
+		return db.dbStorageMeta.prunedHeight, nil
+	}
+
+	recentSpent, err := db.fetchSpentTxHeights(bestHeight-keepDepth+1, bestHeight)
+	if err != nil {
+		return db.dbStorageMeta.prunedHeight, err
+	}
+
+	prunedHeight := db.dbStorageMeta.prunedHeight
+	for _, file := range files {
+		if err := db.keepPrunedData(batch, file, recentSpent); err != nil {
+			logging.CPrint(logging.ERROR, "failed to keep data of pruned block file", logging.LogFormat{
+				"file": file.Number(),
+				"err":  err,
+			})
+			return db.dbStorageMeta.prunedHeight, err
+		}
+		if file.HeightLast()+1 > prunedHeight {
+			prunedHeight = file.HeightLast() + 1
+		}
+	}
+
+	meta := db.dbStorageMeta
+	meta.prunedHeight = prunedHeight
+	if err := batch.Put(dbStorageMetaDataKey, encodeDBStorageMetaData(meta)); err != nil {
+		return db.dbStorageMeta.prunedHeight, err
+	}
+	if err := db.stor.Write(batch); err != nil {
+		return db.dbStorageMeta.prunedHeight, err
+	}
+	db.dbStorageMeta = meta
+
+	// Files left on error would be removed on next start, see disk.NewBlockFileKeeper.
+	if err := db.blkFileKeeper.RemoveFiles(files); err != nil {
+		logging.CPrint(logging.ERROR, "failed to remove pruned block files", logging.LogFormat{"err": err})
+		return prunedHeight, err
+	}
+	logging.CPrint(logging.INFO, "block files pruned", logging.LogFormat{
+		"files":        len(files),
+		"prunedHeight": prunedHeight,
+		"bestHeight":   bestHeight,
+	})
+	return prunedHeight, nil
+}
+
+// deleteSpentPrunedTxs puts into batch the deletion of raw transactions kept
+// on pruning that were fully spent by blocks lower than height, which are too
+// deep to be detached, and returns the number of deleted transactions.
+func (db *ChainDb) deleteSpentPrunedTxs(batch storage.Batch, height uint64) (int, error) {
+	iter := db.stor.NewIterator(&storage.Range{
+		Start: makePrunedSpentKey(0, &wire.Hash{}),
+		Limit: makePrunedSpentKey(height, &wire.Hash{}),
+	})
+	defer iter.Release()
+
+	count := 0
+	for iter.Next() {
+		if err := batch.Delete(iter.Value()); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(iter.Key()); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, iter.Error()
+}
+
+// fetchSpentTxHeights returns the highest block in [from, to] spending each
+// transaction, which is the block fully spending it if it is fully spent.
+func (db *ChainDb) fetchSpentTxHeights(from, to uint64) (map[wire.Hash]uint64, error) {
+	spent := make(map[wire.Hash]uint64)
+	for height := from; height <= to; height++ {
+		_, buf, err := db.getBlkByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		blk, err := massutil.NewBlockFromBytes(buf, wire.DB)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range blk.MsgBlock().Transactions {
+			for _, txIn := range tx.TxIn {
+				if txIn.PreviousOutPoint.Index == ^uint32(0) {
+					continue
+				}
+				spent[txIn.PreviousOutPoint.Hash] = height
+			}
+		}
+	}
+	return spent, nil
+}
+
+// markSpentPrunedTxs puts into batch the transactions of pruned blocks that
+// are fully spent by the block at height if spend is true, or that are no
+// longer fully spent on deleting the block at height if spend is false.
+func (db *ChainDb) markSpentPrunedTxs(batch storage.Batch, height uint64, spend bool) error {
+	for txSha, txU := range db.txUpdateMap {
+		if txU.delete != spend || txU.blkHeight >= db.dbStorageMeta.prunedHeight {
+			continue
+		}
+		txSha := txSha
+		if !spend {
+			if err := batch.Delete(makePrunedSpentKey(height, &txSha)); err != nil {
+				return err
+			}
+			continue
+		}
+		_, fileNo, offset, _, err := db.GetBlkLocByHeight(txU.blkHeight)
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(makePrunedSpentKey(height, &txSha), makePrunedTxKey(fileNo, offset, txU.txoff)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepPrunedData puts headers of main chain blocks in file into batch, with
+// their transactions that are unspent or fully spent by a block in
+// recentSpent, which may still be detached.
+func (db *ChainDb) keepPrunedData(batch storage.Batch, file *disk.BlockFile, recentSpent map[wire.Hash]uint64) error {
+	for height := file.HeightFirst(); height <= file.HeightLast(); height++ {
+		_, fileNo, offset, size, err := db.GetBlkLocByHeight(height)
+		if err != nil {
+			return err
+		}
+		if fileNo != file.Number() {
+			continue
+		}
+		buf, err := db.blkFileKeeper.ReadRawBlock(fileNo, offset, int(size))
+		if err != nil {
+			return err
+		}
+
+		_, baseLen, err := decodeBlockHeader(buf)
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(makePrunedHeaderKey(height), buf[:baseLen]); err != nil {
+			return err
+		}
+
+		blk, err := massutil.NewBlockFromBytes(buf, wire.DB)
+		if err != nil {
+			return err
+		}
+		txLocs, err := blk.TxLoc()
+		if err != nil {
+			return err
+		}
+		for i, tx := range blk.Transactions() {
+			txOff := txLocs[i].TxStart
+			txKey := makePrunedTxKey(fileNo, offset, txOff)
+			txHeight, unspentOff, _, _, err := db.getTxData(tx.Hash())
+			if err != nil && err != storage.ErrNotFound {
+				return err
+			}
+			if err != nil || txHeight != height || unspentOff != txOff {
+				spentHeight, ok := recentSpent[*tx.Hash()]
+				if !ok {
+					continue
+				}
+				if err = batch.Put(makePrunedSpentKey(spentHeight, tx.Hash()), txKey); err != nil {
+					return err
+				}
+			}
+			raw := buf[txOff : txOff+txLocs[i].TxLen]
+			if err = batch.Put(txKey, raw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package ldb_test
+
+import (
+	"testing"
+
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/database/disk"
+	"github.com/massnetorg/mass-core/database/ldb"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainDb_PruneBlockFiles(t *testing.T) {
+	maxSize := disk.MaxBlockfileSize
+	disk.MaxBlockfileSize = 16 * 1024
+	defer func() {
+		disk.MaxBlockfileSize = maxSize
+	}()
+
+	db, tearDown, err := GetDb("DbTest")
+	assert.Nil(t, err)
+	defer tearDown()
+
+	err = initBlocks(db, 200)
+	assert.Nil(t, err)
+
+	// collect unspent transactions before pruning
+	unspent := make(map[wire.Hash]*wire.MsgTx)
+	for _, blk := range blks200[1:] {
+		shas := make([]*wire.Hash, 0, len(blk.Transactions()))
+		for _, tx := range blk.Transactions() {
+			shas = append(shas, tx.Hash())
+		}
+		for _, reply := range db.FetchUnSpentTxByShaList(shas) {
+			if reply.Err == nil && reply.Tx != nil {
+				unspent[*reply.Sha] = reply.Tx
+			}
+		}
+	}
+
+	assert.Equal(t, uint64(0), db.FetchPrunedHeight())
+	prunedHeight, err := db.PruneBlockFiles(50)
+	assert.Nil(t, err)
+	assert.True(t, prunedHeight > 0)
+	assert.True(t, prunedHeight <= 150)
+	assert.Equal(t, prunedHeight, db.FetchPrunedHeight())
+
+	// pruning again changes nothing
+	again, err := db.PruneBlockFiles(50)
+	assert.Nil(t, err)
+	assert.Equal(t, prunedHeight, again)
+
+	for _, blk := range blks200[1:prunedHeight] {
+		_, err := db.FetchBlockBySha(blk.Hash())
+		assert.Equal(t, database.ErrBlockPruned, err)
+
+		header, err := db.FetchBlockHeaderBySha(blk.Hash())
+		assert.Nil(t, err)
+		assert.Equal(t, blk.Hash().String(), header.BlockHash().String())
+	}
+	for _, blk := range blks200[prunedHeight:] {
+		_, err := db.FetchBlockBySha(blk.Hash())
+		assert.Nil(t, err)
+	}
+
+	for sha, tx := range unspent {
+		shaCopy := sha
+		replies := db.FetchUnSpentTxByShaList([]*wire.Hash{&shaCopy})
+		assert.Equal(t, 1, len(replies))
+		assert.Nil(t, replies[0].Err)
+		assert.Equal(t, tx.TxHash().String(), replies[0].Tx.TxHash().String())
+	}
+}
+
+func TestChainDb_PruneBlockFilesReorg(t *testing.T) {
+	maxSize := disk.MaxBlockfileSize
+	disk.MaxBlockfileSize = 16 * 1024
+	defer func() {
+		disk.MaxBlockfileSize = maxSize
+	}()
+
+	db, tearDown, err := GetDb("DbTest")
+	assert.Nil(t, err)
+	defer tearDown()
+
+	err = initBlocks(db, 200)
+	assert.Nil(t, err)
+
+	prunedHeight, err := db.PruneBlockFiles(50)
+	assert.Nil(t, err)
+	assert.True(t, prunedHeight > 0)
+
+	var prunedShas []*wire.Hash
+	for _, blk := range blks200[1:prunedHeight] {
+		for _, tx := range blk.Transactions() {
+			prunedShas = append(prunedShas, tx.Hash())
+		}
+	}
+	unspent := make(map[wire.Hash]bool)
+	for _, reply := range db.FetchUnSpentTxByShaList(prunedShas) {
+		unspent[*reply.Sha] = reply.Err == nil
+	}
+
+	// detach all blocks that may be reorganized, transactions of pruned
+	// blocks spent by them are still available
+	for j := 199; j >= 150; j-- {
+		block := blks200[j]
+		assert.Nil(t, db.DeleteBlock(block.Hash()))
+		db.(*ldb.ChainDb).Batch(1).Set(*block.Hash())
+		db.(*ldb.ChainDb).Batch(1).Done()
+		assert.Nil(t, db.Commit(*block.Hash()))
+	}
+	var unspentAgain []*wire.Hash
+	for _, reply := range db.FetchUnSpentTxByShaList(prunedShas) {
+		if reply.Err == database.ErrTxShaMissing {
+			continue
+		}
+		assert.Nil(t, reply.Err)
+		if !unspent[*reply.Sha] {
+			unspentAgain = append(unspentAgain, reply.Sha)
+		}
+	}
+	assert.NotEmpty(t, unspentAgain)
+
+	// once the spending blocks are deeper than the prune depth, the kept
+	// transactions are deleted
+	for _, blk := range blks200[150:] {
+		assert.Nil(t, db.SubmitBlock(blk))
+		db.(*ldb.ChainDb).Batch(1).Set(*blk.Hash())
+		db.(*ldb.ChainDb).Batch(1).Done()
+		assert.Nil(t, db.Commit(*blk.Hash()))
+	}
+	for _, sha := range unspentAgain {
+		_, err := db.FetchTxBySha(sha)
+		assert.Nil(t, err)
+	}
+	spentHeight := make(map[wire.Hash]uint64)
+	for _, blk := range blks200[150:] {
+		for _, tx := range blk.MsgBlock().Transactions {
+			for _, txIn := range tx.TxIn {
+				spentHeight[txIn.PreviousOutPoint.Hash] = blk.Height()
+			}
+		}
+	}
+	_, err = db.PruneBlockFiles(10)
+	assert.Nil(t, err)
+	deleted := 0
+	for _, sha := range unspentAgain {
+		_, err := db.FetchTxBySha(sha)
+		if spentHeight[*sha] < 199-10 {
+			assert.Equal(t, database.ErrBlockPruned, err)
+			deleted++
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+	assert.NotZero(t, deleted)
+}
@@ -0,0 +1,547 @@
+package ldb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/database/disk"
+	"github.com/massnetorg/mass-core/database/storage"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+// Snapshot layout:
+//
+// |  magic  |  version  |  height  |  best hash  |  genesis hash  |  num blocks  |
+// | 8-bytes |  4-bytes  |  8-bytes |   32-bytes  |    32-bytes    |    8-bytes   |
+//
+// followed by records:
+//
+// |  type  |  length  |  payload  |
+// | 1-byte |  4-bytes |           |
+//
+// Records are written in order of headers of blocks without raw data, raw
+// blocks, unspent transactions, key-values and the end. The payload of snapshotRecordEnd is the commitment, which is the sha256 of
+// all bytes before the end record.
+const (
+	snapshotVersion    = 1
+	snapshotHeaderSize = 8 + 4 + 8 + 32 + 32 + 8
+
+	// snapshotFileNo is the file number in block height index of blocks
+	// imported from snapshot without raw data, their unspent transactions
+	// are kept like those of pruned blocks.
+	snapshotFileNo = math.MaxUint32
+
+	snapshotBatchSize = 10000
+
+	// snapshotMaxRecordSize bounds the payload length read from a record
+	// header.  The largest records are raw blocks and unspent transactions
+	// with their index, both are far below twice the block payload.
+	snapshotMaxRecordSize = 2 * wire.MaxBlockPayload
+)
+
+const (
+	// | BlockBase length |  BlockBase  |
+	// |      varint      |             |
+	snapshotRecordHeader byte = iota + 1
+
+	snapshotRecordBlock
+
+	// | tx hash  |  TXD length  |  TXD value  |  raw tx  |
+	// | 32-bytes |    4-bytes   |             |          |
+	snapshotRecordTx
+
+	// | key length |  key  |  value  |
+	// |   2-bytes  |       |         |
+	snapshotRecordKV
+
+	snapshotRecordEnd
+)
+
+var (
+	snapshotMagic = []byte("MASSSNAP")
+
+	// prefixes of key-value records exported as is
+	snapshotKVPrefixes = [][]byte{
+		recordStakingTx,
+		recordExpiredStakingTx,
+		faultPkShaDataPrefix,
+		faultPkHeightShaPrefix,
+	}
+)
+
+type snapshotWriter struct {
+	w      io.Writer
+	hasher hash.Hash
+}
+
+func (sw *snapshotWriter) write(bs ...[]byte) error {
+	for _, b := range bs {
+		if _, err := sw.w.Write(b); err != nil {
+			return err
+		}
+		sw.hasher.Write(b)
+	}
+	return nil
+}
+
+func (sw *snapshotWriter) writeRecord(typ byte, payload ...[]byte) error {
+	var hdr [5]byte
+	hdr[0] = typ
+	length := 0
+	for _, p := range payload {
+		length += len(p)
+	}
+	binary.LittleEndian.PutUint32(hdr[1:], uint32(length))
+	return sw.write(append([][]byte{hdr[:]}, payload...)...)
+}
+
+type snapshotReader struct {
+	r      io.Reader
+	hasher hash.Hash
+}
+
+func (sr *snapshotReader) read(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, buf); err != nil {
+		return nil, err
+	}
+	sr.hasher.Write(buf)
+	return buf, nil
+}
+
+func (sr *snapshotReader) readRecord() (typ byte, payload []byte, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(sr.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[1:])
+	if size > snapshotMaxRecordSize {
+		return 0, nil, database.ErrInvalidSnapshot
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(sr.r, payload); err != nil {
+		return 0, nil, err
+	}
+	// commitment is not part of itself
+	if hdr[0] != snapshotRecordEnd {
+		sr.hasher.Write(hdr[:])
+		sr.hasher.Write(payload)
+	}
+	return hdr[0], payload, nil
+}
+
+func encodeSnapshotHeader(info *database.SnapshotInfo) []byte {
+	bs := make([]byte, snapshotHeaderSize)
+	copy(bs[0:8], snapshotMagic)
+	binary.LittleEndian.PutUint32(bs[8:12], snapshotVersion)
+	binary.LittleEndian.PutUint64(bs[12:20], info.Height)
+	copy(bs[20:52], info.Hash[:])
+	copy(bs[52:84], info.Genesis[:])
+	binary.LittleEndian.PutUint64(bs[84:92], info.NumBlocks)
+	return bs
+}
+
+func decodeSnapshotHeader(bs []byte) (*database.SnapshotInfo, error) {
+	if !bytes.Equal(bs[0:8], snapshotMagic) {
+		return nil, database.ErrInvalidSnapshot
+	}
+	if binary.LittleEndian.Uint32(bs[8:12]) != snapshotVersion {
+		return nil, database.ErrSnapshotVersion
+	}
+	info := &database.SnapshotInfo{
+		Height:    binary.LittleEndian.Uint64(bs[12:20]),
+		NumBlocks: binary.LittleEndian.Uint64(bs[84:92]),
+	}
+	copy(info.Hash[:], bs[20:52])
+	copy(info.Genesis[:], bs[52:84])
+	if info.NumBlocks == 0 || info.NumBlocks > info.Height+1 {
+		return nil, database.ErrInvalidSnapshot
+	}
+	return info, nil
+}
+
+// ExportSnapshot writes a snapshot of the chain state at current best block,
+// see database.Db for details.
+func (db *ChainDb) ExportSnapshot(w io.Writer, numBlocks uint64) (*database.SnapshotInfo, error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	meta := db.dbStorageMeta
+	if meta.currentHeight == UnknownHeight {
+		return nil, database.ErrBlockShaMissing
+	}
+	firstHeight := meta.prunedHeight
+	if numBlocks > 0 && numBlocks <= meta.currentHeight+1 && meta.currentHeight+1-numBlocks > firstHeight {
+		firstHeight = meta.currentHeight + 1 - numBlocks
+	}
+	genesis, err := db.fetchBlockShaByHeight(0)
+	if err != nil {
+		return nil, err
+	}
+	info := &database.SnapshotInfo{
+		Height:    meta.currentHeight,
+		Hash:      meta.currentHash,
+		Genesis:   *genesis,
+		NumBlocks: meta.currentHeight + 1 - firstHeight,
+	}
+
+	sw := &snapshotWriter{w: w, hasher: sha256.New()}
+	if err = sw.write(encodeSnapshotHeader(info)); err != nil {
+		return nil, err
+	}
+
+	// headers and raw blocks
+	for height := uint64(0); height <= info.Height; height++ {
+		_, fileNo, offset, size, err := db.GetBlkLocByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		var buf []byte
+		if fileNo != snapshotFileNo {
+			buf, err = db.blkFileKeeper.ReadRawBlock(fileNo, offset, int(size))
+		}
+		if fileNo == snapshotFileNo || err == disk.ErrFilePruned {
+			buf, err = db.getPrunedBlockBase(height)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if height >= firstHeight {
+			err = sw.writeRecord(snapshotRecordBlock, buf)
+		} else {
+			_, baseLen, err := decodeBlockHeader(buf)
+			if err != nil {
+				return nil, err
+			}
+			err = sw.writeRecord(snapshotRecordHeader, buf[:baseLen])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// unspent transactions
+	iter := db.stor.NewIterator(storage.BytesPrefix(recordSuffixTx))
+	defer iter.Release()
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		height := binary.LittleEndian.Uint64(value[0:8])
+		txOff := int(binary.LittleEndian.Uint32(value[8:12]))
+		txLen := int(binary.LittleEndian.Uint32(value[12:16]))
+
+		_, fileNo, blkOffset, _, err := db.GetBlkLocByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := db.readRawTx(fileNo, blkOffset, txOff, txLen)
+		if err != nil {
+			return nil, err
+		}
+		var txdLen [4]byte
+		binary.LittleEndian.PutUint32(txdLen[:], uint32(len(value)))
+		if err = sw.writeRecord(snapshotRecordTx, key[len(recordSuffixTx):], txdLen[:], value, raw); err != nil {
+			return nil, err
+		}
+		info.NumTxs++
+	}
+	if err = iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// staking index and fault pubkeys
+	for _, prefix := range snapshotKVPrefixes {
+		if err = db.exportSnapshotKVs(sw, prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	copy(info.Commitment[:], sw.hasher.Sum(nil))
+	if err = sw.writeRecord(snapshotRecordEnd, info.Commitment[:]); err != nil {
+		return nil, err
+	}
+
+	logging.CPrint(logging.INFO, "snapshot exported", logging.LogFormat{
+		"height":     info.Height,
+		"hash":       info.Hash,
+		"blocks":     info.NumBlocks,
+		"txs":        info.NumTxs,
+		"commitment": info.Commitment,
+	})
+	return info, nil
+}
+
+func (db *ChainDb) exportSnapshotKVs(sw *snapshotWriter, prefix []byte) error {
+	iter := db.stor.NewIterator(storage.BytesPrefix(prefix))
+	defer iter.Release()
+	for iter.Next() {
+		var keyLen [2]byte
+		binary.LittleEndian.PutUint16(keyLen[:], uint16(len(iter.Key())))
+		if err := sw.writeRecord(snapshotRecordKV, keyLen[:], iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// ImportSnapshot initializes an empty database from snapshot, see database.Db
+// for details.
+func (db *ChainDb) ImportSnapshot(r io.Reader, genesis *wire.Hash, commit database.SnapshotCommitFunc) (*database.SnapshotInfo, error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if db.dbStorageMeta.currentHeight != UnknownHeight {
+		return nil, database.ErrSnapshotDbNotEmpty
+	}
+
+	sr := &snapshotReader{r: r, hasher: sha256.New()}
+	hdr, err := sr.read(snapshotHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	info, err := decodeSnapshotHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Genesis.IsEqual(genesis) {
+		return nil, database.ErrSnapshotGenesis
+	}
+	firstHeight := info.Height + 1 - info.NumBlocks
+
+	batch := db.stor.NewBatch()
+	defer batch.Release()
+	flush := func() error {
+		if err := db.stor.Write(batch); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+
+	var (
+		nextHeight uint64
+		prevHash   wire.Hash
+		header     *wire.BlockHeader
+		commitment []byte
+		count      int
+	)
+	for commitment == nil {
+		typ, payload, err := sr.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case snapshotRecordHeader:
+			if nextHeight >= firstHeight {
+				return nil, database.ErrInvalidSnapshot
+			}
+			header, err = importSnapshotHeader(batch, payload, nextHeight, &prevHash)
+			if err != nil {
+				return nil, err
+			}
+			hash := header.BlockHash()
+			if nextHeight == 0 && !hash.IsEqual(&info.Genesis) {
+				return nil, database.ErrInvalidSnapshot
+			}
+			prevHash = hash
+			nextHeight++
+
+		case snapshotRecordBlock:
+			if nextHeight < firstHeight || nextHeight > info.Height {
+				return nil, database.ErrInvalidSnapshot
+			}
+			header, err = db.importSnapshotBlock(batch, payload, nextHeight, &prevHash)
+			if err != nil {
+				return nil, err
+			}
+			hash := header.BlockHash()
+			if nextHeight == 0 && !hash.IsEqual(&info.Genesis) {
+				return nil, database.ErrInvalidSnapshot
+			}
+			// flush index along with block file meta
+			if err = flush(); err != nil {
+				return nil, err
+			}
+			db.blkFileKeeper.CommitRecentChange()
+			prevHash = hash
+			nextHeight++
+
+		case snapshotRecordTx:
+			if nextHeight <= info.Height {
+				return nil, database.ErrInvalidSnapshot
+			}
+			if err = importSnapshotTx(batch, payload, firstHeight); err != nil {
+				return nil, err
+			}
+			info.NumTxs++
+
+		case snapshotRecordKV:
+			if nextHeight <= info.Height {
+				return nil, database.ErrInvalidSnapshot
+			}
+			if err = importSnapshotKV(batch, payload); err != nil {
+				return nil, err
+			}
+
+		case snapshotRecordEnd:
+			commitment = payload
+
+		default:
+			return nil, database.ErrInvalidSnapshot
+		}
+
+		if count++; count%snapshotBatchSize == 0 {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	copy(info.Commitment[:], sr.hasher.Sum(nil))
+	if !bytes.Equal(info.Commitment[:], commitment) || !prevHash.IsEqual(&info.Hash) {
+		return nil, database.ErrSnapshotCommitment
+	}
+	if commit != nil {
+		if err = flush(); err != nil {
+			return nil, err
+		}
+		if err = commit(info, header); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := dbStorageMeta{
+		currentHeight: info.Height,
+		currentHash:   info.Hash,
+		prunedHeight:  firstHeight,
+	}
+	if err = batch.Put(dbStorageMetaDataKey, encodeDBStorageMetaData(meta)); err != nil {
+		return nil, err
+	}
+	if err = flush(); err != nil {
+		return nil, err
+	}
+	db.dbStorageMeta = meta
+
+	logging.CPrint(logging.INFO, "snapshot imported", logging.LogFormat{
+		"height":     info.Height,
+		"hash":       info.Hash,
+		"blocks":     info.NumBlocks,
+		"txs":        info.NumTxs,
+		"commitment": info.Commitment,
+	})
+	return info, nil
+}
+
+// importSnapshotHeader puts header and block index of a block without raw
+// data into batch. The header is kept like that of a pruned block, and the
+// block is located in snapshotFileNo at offset of its height.
+func importSnapshotHeader(batch storage.Batch, base []byte, height uint64, prevHash *wire.Hash) (*wire.BlockHeader, error) {
+	header, baseLen, err := decodeBlockHeader(base)
+	if err != nil {
+		return nil, err
+	}
+	if baseLen != len(base) || header.Height != height || (height > 0 && !header.Previous.IsEqual(prevHash)) {
+		return nil, database.ErrInvalidSnapshot
+	}
+	sha := header.BlockHash()
+
+	blkHgtKey := makeBlockHeightKey(height)
+	if err = batch.Put(makeBlockShaKey(&sha), blkHgtKey[len(blkHgtKey)-8:]); err != nil {
+		return nil, err
+	}
+	blkHgtValue := make([]byte, len(sha)+4+8+8)
+	copy(blkHgtValue[0:], sha[:])
+	binary.LittleEndian.PutUint32(blkHgtValue[len(sha):], snapshotFileNo)
+	binary.LittleEndian.PutUint64(blkHgtValue[len(sha)+4:], height)
+	if err = batch.Put(blkHgtKey, blkHgtValue); err != nil {
+		return nil, err
+	}
+	if err = batch.Put(makePrunedHeaderKey(height), base); err != nil {
+		return nil, err
+	}
+	if err = updateMinedBlockIndex(batch, true, header.PublicKey(), height); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// importSnapshotBlock saves raw block to disk and puts its index into batch.
+func (db *ChainDb) importSnapshotBlock(batch storage.Batch, raw []byte, height uint64, prevHash *wire.Hash) (*wire.BlockHeader, error) {
+	block, err := massutil.NewBlockFromBytes(raw, wire.DB)
+	if err != nil {
+		return nil, err
+	}
+	header := &block.MsgBlock().Header
+	if header.Height != height || (height > 0 && !header.Previous.IsEqual(prevHash)) {
+		return nil, database.ErrInvalidSnapshot
+	}
+	blkFile, offset, err := db.blkFileKeeper.SaveRawBlockToDisk(raw, height, header.Timestamp.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if err = putRawBlockIndex(batch, block, blkFile, offset, int64(len(raw))); err != nil {
+		return nil, err
+	}
+	if err = updateMinedBlockIndex(batch, true, header.PublicKey(), height); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// importSnapshotTx puts unspent transaction into batch, raw transaction is
+// kept like that of a pruned block if its block is imported without raw data.
+func importSnapshotTx(batch storage.Batch, payload []byte, firstHeight uint64) error {
+	if len(payload) < 32+4 {
+		return database.ErrInvalidSnapshot
+	}
+	var txSha wire.Hash
+	copy(txSha[:], payload[0:32])
+	txdLen := int(binary.LittleEndian.Uint32(payload[32:36]))
+	if txdLen < 16 || len(payload) < 36+txdLen {
+		return database.ErrInvalidSnapshot
+	}
+	txd := payload[36 : 36+txdLen]
+	raw := payload[36+txdLen:]
+
+	var tx wire.MsgTx
+	if err := tx.SetBytes(raw, wire.DB); err != nil {
+		return err
+	}
+	if tx.TxHash() != txSha {
+		return database.ErrInvalidSnapshot
+	}
+
+	if err := batch.Put(shaTxToKey(&txSha), txd); err != nil {
+		return err
+	}
+	height := binary.LittleEndian.Uint64(txd[0:8])
+	if height >= firstHeight {
+		return nil
+	}
+	txOff := int(binary.LittleEndian.Uint32(txd[8:12]))
+	return batch.Put(makePrunedTxKey(snapshotFileNo, int64(height), txOff), raw)
+}
+
+func importSnapshotKV(batch storage.Batch, payload []byte) error {
+	if len(payload) < 2 {
+		return database.ErrInvalidSnapshot
+	}
+	keyLen := int(binary.LittleEndian.Uint16(payload[0:2]))
+	if len(payload) < 2+keyLen {
+		return database.ErrInvalidSnapshot
+	}
+	key, value := payload[2:2+keyLen], payload[2+keyLen:]
+	for _, prefix := range snapshotKVPrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return batch.Put(key, value)
+		}
+	}
+	return database.ErrInvalidSnapshot
+}
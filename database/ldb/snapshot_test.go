@@ -0,0 +1,135 @@
+package ldb_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainDb_Snapshot(t *testing.T) {
+	db, tearDown, err := GetDb("DbTest")
+	assert.Nil(t, err)
+	defer tearDown()
+
+	err = initBlocks(db, 150)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	info, err := db.ExportSnapshot(&buf, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(149), info.Height)
+	assert.Equal(t, uint64(20), info.NumBlocks)
+	assert.Equal(t, *blks200[0].Hash(), info.Genesis)
+	data := buf.Bytes()
+
+	// snapshot must be imported into another empty database, block files
+	// are kept in the parent directory of database
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db2, err := database.CreateDB(dbtype, filepath.Join(dir, "db"))
+	assert.Nil(t, err)
+	defer db2.Close()
+
+	_, err = db.ImportSnapshot(bytes.NewReader(data), &info.Genesis, nil)
+	assert.Equal(t, database.ErrSnapshotDbNotEmpty, err)
+
+	// corrupted snapshot
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	dir3, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir3)
+	db3, err := database.CreateDB(dbtype, filepath.Join(dir3, "db"))
+	assert.Nil(t, err)
+	_, err = db3.ImportSnapshot(bytes.NewReader(corrupted), &info.Genesis, nil)
+	assert.NotNil(t, err)
+	db3.Close()
+
+	// snapshot of another chain is rejected before anything is written
+	_, err = db2.ImportSnapshot(bytes.NewReader(data), &wire.Hash{}, nil)
+	assert.Equal(t, database.ErrSnapshotGenesis, err)
+
+	// oversized record
+	oversized := append([]byte{}, data[:92]...)
+	oversized = append(oversized, 2, 0xff, 0xff, 0xff, 0xff)
+	_, err = db2.ImportSnapshot(bytes.NewReader(oversized), &info.Genesis, nil)
+	assert.Equal(t, database.ErrInvalidSnapshot, err)
+
+	// failed commit leaves the database empty
+	errCommit := errors.New("commit failed")
+	_, err = db2.ImportSnapshot(bytes.NewReader(data), &info.Genesis, func(info *database.SnapshotInfo, header *wire.BlockHeader) error {
+		assert.Equal(t, info.Hash, header.BlockHash())
+		return errCommit
+	})
+	assert.Equal(t, errCommit, err)
+	_, height, err := db2.NewestSha()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), height)
+
+	info2, err := db2.ImportSnapshot(bytes.NewReader(data), &info.Genesis, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, info, info2)
+
+	sha, height, err := db2.NewestSha()
+	assert.Nil(t, err)
+	assert.Equal(t, info.Height, height)
+	assert.Equal(t, info.Hash, *sha)
+	assert.Equal(t, uint64(130), db2.FetchPrunedHeight())
+
+	for _, blk := range blks200[:130] {
+		_, err := db2.FetchBlockBySha(blk.Hash())
+		assert.Equal(t, database.ErrBlockPruned, err)
+		header, err := db2.FetchBlockHeaderBySha(blk.Hash())
+		assert.Nil(t, err)
+		assert.Equal(t, blk.Hash().String(), header.BlockHash().String())
+	}
+	for _, blk := range blks200[130:150] {
+		_, err := db2.FetchBlockBySha(blk.Hash())
+		assert.Nil(t, err)
+	}
+
+	// unspent transactions are the same
+	for _, blk := range blks200[:150] {
+		shas := make([]*wire.Hash, 0, len(blk.Transactions()))
+		for _, tx := range blk.Transactions() {
+			shas = append(shas, tx.Hash())
+		}
+		replies := db.FetchUnSpentTxByShaList(shas)
+		replies2 := db2.FetchUnSpentTxByShaList(shas)
+		for i := range replies {
+			assert.Equal(t, replies[i].Err, replies2[i].Err)
+			if replies[i].Tx != nil {
+				assert.Equal(t, replies[i].Tx.TxHash(), replies2[i].Tx.TxHash())
+				assert.Equal(t, replies[i].TxSpent, replies2[i].TxSpent)
+			}
+		}
+	}
+
+	// re-exported snapshot has the same commitment
+	buf.Reset()
+	info3, err := db2.ExportSnapshot(&buf, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Commitment, info3.Commitment)
+	assert.Equal(t, data, buf.Bytes())
+
+	// both databases accept following blocks and stay consistent
+	for _, blk := range blks200[150:] {
+		assert.Nil(t, insertBlock(db, blk))
+		assert.Nil(t, insertBlock(db2, blk))
+	}
+	info, err = db.ExportSnapshot(ioutil.Discard, 60)
+	assert.Nil(t, err)
+	info2, err = db2.ExportSnapshot(ioutil.Discard, 60)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(199), info.Height)
+	assert.Equal(t, info.Commitment, info2.Commitment)
+}
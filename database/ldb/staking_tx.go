@@ -299,12 +299,12 @@ func (db *ChainDb) fetchActiveStakingTxFromUnexpired(height uint64) (map[[sha256
 
 // FetchUnexpiredStakingRank returns only currently unexpired staking rank at
 // target height. This function is for mining and validating block.
-func (db *ChainDb) FetchUnexpiredStakingRank(height uint64, onlyOnList bool) ([]database.Rank, error) {
+func (db *ChainDb) FetchUnexpiredStakingRank(params consensus.DeploymentChecker, height uint64, onlyOnList bool) ([]database.Rank, error) {
 	stakingTxInfos, err := db.fetchActiveStakingTxFromUnexpired(height)
 	if err != nil {
 		return nil, err
 	}
-	sortedStakingTx, err := database.SortMap(stakingTxInfos, height, onlyOnList)
+	sortedStakingTx, err := database.SortMap(params, stakingTxInfos, height, onlyOnList)
 	if err != nil {
 		return nil, err
 	}
@@ -355,7 +355,7 @@ func (db *ChainDb) fetchActiveStakingTxFromExpired(height uint64) (map[[sha256.S
 
 // FetchStakingRank returns staking rank at any height. This
 // function may be slow.
-func (db *ChainDb) FetchStakingRank(height uint64, onlyOnList bool) ([]database.Rank, error) {
+func (db *ChainDb) FetchStakingRank(params consensus.DeploymentChecker, height uint64, onlyOnList bool) ([]database.Rank, error) {
 	stakingTxInfos, err := db.fetchActiveStakingTxFromUnexpired(height)
 	if err != nil {
 		return nil, err
@@ -374,7 +374,7 @@ func (db *ChainDb) FetchStakingRank(height uint64, onlyOnList bool) ([]database.
 		stakingTxInfos[expiredK] = append(stakingTxInfos[expiredK], expiredV...)
 	}
 
-	sortedStakingTx, err := database.SortMap(stakingTxInfos, height, onlyOnList)
+	sortedStakingTx, err := database.SortMap(params, stakingTxInfos, height, onlyOnList)
 	if err != nil {
 		return nil, err
 	}
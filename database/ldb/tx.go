@@ -293,7 +293,7 @@ func (db *ChainDb) fetchTxDataByLoc(blkHeight uint64, txOff int, txLen int) (rtx
 	if err != nil {
 		return nil, nil, err
 	}
-	buf, err := db.blkFileKeeper.ReadRawTx(fileNo, blkOffset, int64(txOff), txLen)
+	buf, err := db.readRawTx(fileNo, blkOffset, txOff, txLen)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -318,7 +318,7 @@ func (db *ChainDb) FetchTxByLoc(blkHeight uint64, txOff int, txLen int) (*wire.M
 }
 
 func (db *ChainDb) FetchTxByFileLoc(blkLoc *database.BlockLoc, txLoc *wire.TxLoc) (*wire.MsgTx, error) {
-	buf, err := db.blkFileKeeper.ReadRawTx(blkLoc.File, int64(blkLoc.Offset), int64(txLoc.TxStart), txLoc.TxLen)
+	buf, err := db.readRawTx(blkLoc.File, int64(blkLoc.Offset), txLoc.TxStart, txLoc.TxLen)
 	if err != nil {
 		return nil, err
 	}
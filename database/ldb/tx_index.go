@@ -380,6 +380,12 @@ func (db *ChainDb) submitAddrIndex(height uint64, addrIndexData *database.AddrIn
 		}
 	}
 
+	if addrIndexData.UtxoIndex != nil {
+		if err := db.submitUtxoIndex(batch, height, addrIndexData.UtxoIndex); err != nil {
+			return err
+		}
+	}
+
 	// Ensure we're writing an address index version
 	newIndexVersion := make([]byte, 2)
 	binary.LittleEndian.PutUint16(newIndexVersion[0:2],
@@ -553,7 +559,7 @@ func (db *ChainDb) deleteAddrIndex(height uint64) error {
 		return err
 	}
 
-	return nil
+	return db.deleteUtxoIndex(batch, height)
 }
 
 // from start to stop-1
@@ -0,0 +1,427 @@
+package ldb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/massnetorg/mass-core/consensus"
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/database/storage"
+	"github.com/massnetorg/mass-core/logging"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/txscript"
+	"github.com/massnetorg/mass-core/wire"
+)
+
+var (
+	// Unspent outputs by script hash, binding outputs are indexed by holder.
+	//
+	// |  "UTX"  | script hash |  tx hash  |  index  |      |  type  |  height  |  value  |  frozen  |  coinbase  |
+	// | 3-bytes |   32-bytes  |  32-bytes | 4-bytes |  ->  | 1-byte |  8-bytes | 8-bytes |  8-bytes |   1-byte   |
+	utxoIndexPrefix = []byte("UTX")
+
+	// Undo data of utxo index for each block.
+	//
+	// |  "UTU"  |  height  |      |  N created  |  key x N  |  M spent  |  (key | value) x M  |
+	// | 3-bytes |  8-bytes |  ->  |   4-bytes   |           |  4-bytes  |                      |
+	utxoUndoPrefix = []byte("UTU")
+
+	// Existence of this key means the utxo index is enabled, the value is the
+	// best height when the index was built.
+	utxoIndexVersionKey = []byte("UTIVERSION")
+)
+
+const (
+	utxoIndexKeyLen   = 3 + sha256.Size + sha256.Size + 4
+	utxoIndexValueLen = 1 + 8 + 8 + 8 + 1
+	utxoUndoKeyLen    = 3 + 8
+
+	// utxoIndexBatchSize is the number of changes written at once when
+	// building or removing utxo index.
+	utxoIndexBatchSize = 10000
+)
+
+func makeUtxoIndexKey(scriptHash []byte, op *wire.OutPoint) []byte {
+	key := make([]byte, utxoIndexKeyLen)
+	copy(key, utxoIndexPrefix)
+	copy(key[3:35], scriptHash)
+	copy(key[35:67], op.Hash[:])
+	binary.BigEndian.PutUint32(key[67:71], op.Index)
+	return key
+}
+
+func makeUtxoUndoKey(height uint64) []byte {
+	key := make([]byte, utxoUndoKeyLen)
+	copy(key, utxoUndoPrefix)
+	binary.BigEndian.PutUint64(key[3:11], height)
+	return key
+}
+
+// encodeUtxoIndexEntry returns key and value of an output in utxo index, it
+// returns nil key for outputs that are not indexed.
+func encodeUtxoIndexEntry(out *database.UtxoIndexOutput) (key, value []byte) {
+	var typ database.UtxoType
+	class, pops := txscript.GetScriptInfo(out.PkScript)
+	switch class {
+	case txscript.WitnessV0ScriptHashTy:
+		typ = database.UtxoRegular
+	case txscript.StakingScriptHashTy:
+		typ = database.UtxoStaking
+	case txscript.BindingScriptHashTy:
+		typ = database.UtxoBinding
+	default:
+		return nil, nil
+	}
+	frozen, scriptHash, err := txscript.GetParsedOpcode(pops, class)
+	if err != nil {
+		logging.CPrint(logging.WARN, "failed to parse pkscript for utxo index", logging.LogFormat{
+			"outpoint": out.OutPoint,
+			"err":      err,
+		})
+		return nil, nil
+	}
+
+	value = make([]byte, utxoIndexValueLen)
+	value[0] = byte(typ)
+	binary.LittleEndian.PutUint64(value[1:9], out.BlockHeight)
+	binary.LittleEndian.PutUint64(value[9:17], uint64(out.Value))
+	binary.LittleEndian.PutUint64(value[17:25], frozen)
+	if out.Coinbase {
+		value[25] = 1
+	}
+	return makeUtxoIndexKey(scriptHash[:], &out.OutPoint), value
+}
+
+func decodeUtxoIndexEntry(key, value []byte, bestHeight uint64) (*database.UtxoReply, error) {
+	if len(key) != utxoIndexKeyLen || len(value) != utxoIndexValueLen {
+		return nil, ErrIncorrectDbData
+	}
+	amount, err := massutil.NewAmountFromUint(binary.LittleEndian.Uint64(value[9:17]))
+	if err != nil {
+		return nil, err
+	}
+	txSha, err := wire.NewHash(key[35:67])
+	if err != nil {
+		return nil, err
+	}
+	reply := &database.UtxoReply{
+		TxSha:        txSha,
+		Height:       binary.LittleEndian.Uint64(value[1:9]),
+		Coinbase:     value[25] == 1,
+		Index:        binary.BigEndian.Uint32(key[67:71]),
+		Value:        amount,
+		Type:         database.UtxoType(value[0]),
+		FrozenPeriod: binary.LittleEndian.Uint64(value[17:25]),
+	}
+	reply.Immature = reply.Coinbase && bestHeight-reply.Height < consensus.CoinbaseMaturity
+	return reply, nil
+}
+
+func (db *ChainDb) utxoIndexEnabled() (bool, error) {
+	return db.stor.Has(utxoIndexVersionKey)
+}
+
+// submitUtxoIndex updates utxo index and puts undo data for block at height.
+func (db *ChainDb) submitUtxoIndex(batch storage.Batch, height uint64, data *database.UtxoIndexData) error {
+	enabled, err := db.utxoIndexEnabled()
+	if err != nil || !enabled {
+		return err
+	}
+
+	created := make(map[string][]byte)
+	createdKeys := make([][]byte, 0, len(data.Created))
+	for _, out := range data.Created {
+		key, value := encodeUtxoIndexEntry(out)
+		if key == nil {
+			continue
+		}
+		created[string(key)] = value
+		createdKeys = append(createdKeys, key)
+	}
+
+	var spent [][2][]byte
+	for _, out := range data.Spent {
+		key, value := encodeUtxoIndexEntry(out)
+		if key == nil {
+			continue
+		}
+		if _, ok := created[string(key)]; ok {
+			// created and spent in the same block
+			delete(created, string(key))
+			continue
+		}
+		batch.Delete(key)
+		spent = append(spent, [2][]byte{key, value})
+	}
+
+	undo := make([]byte, 4, 4+len(createdKeys)*utxoIndexKeyLen+4+len(spent)*(utxoIndexKeyLen+utxoIndexValueLen))
+	n := 0
+	for _, key := range createdKeys {
+		value, ok := created[string(key)]
+		if !ok {
+			continue
+		}
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		undo = append(undo, key...)
+		n++
+	}
+	binary.LittleEndian.PutUint32(undo[0:4], uint32(n))
+
+	var m [4]byte
+	binary.LittleEndian.PutUint32(m[:], uint32(len(spent)))
+	undo = append(undo, m[:]...)
+	for _, kv := range spent {
+		undo = append(undo, kv[0]...)
+		undo = append(undo, kv[1]...)
+	}
+	return batch.Put(makeUtxoUndoKey(height), undo)
+}
+
+// deleteUtxoIndex reverts changes of utxo index made by block at height.
+// If undo data is missing because the block was connected before the index
+// was built, the index is disabled and will be rebuilt by EnableUtxoIndex.
+func (db *ChainDb) deleteUtxoIndex(batch storage.Batch, height uint64) error {
+	enabled, err := db.utxoIndexEnabled()
+	if err != nil || !enabled {
+		return err
+	}
+
+	undoKey := makeUtxoUndoKey(height)
+	undo, err := db.stor.Get(undoKey)
+	if err != nil {
+		if err != storage.ErrNotFound {
+			return err
+		}
+		logging.CPrint(logging.WARN, "utxo index disabled for missing undo data", logging.LogFormat{"height": height})
+		return batch.Delete(utxoIndexVersionKey)
+	}
+
+	if len(undo) < 4 {
+		return ErrIncorrectDbData
+	}
+	n := int(binary.LittleEndian.Uint32(undo[0:4]))
+	cur := 4
+	if len(undo) < cur+n*utxoIndexKeyLen+4 {
+		return ErrIncorrectDbData
+	}
+	for i := 0; i < n; i++ {
+		batch.Delete(undo[cur : cur+utxoIndexKeyLen])
+		cur += utxoIndexKeyLen
+	}
+	m := int(binary.LittleEndian.Uint32(undo[cur : cur+4]))
+	cur += 4
+	if len(undo) != cur+m*(utxoIndexKeyLen+utxoIndexValueLen) {
+		return ErrIncorrectDbData
+	}
+	for i := 0; i < m; i++ {
+		key := undo[cur : cur+utxoIndexKeyLen]
+		value := undo[cur+utxoIndexKeyLen : cur+utxoIndexKeyLen+utxoIndexValueLen]
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		cur += utxoIndexKeyLen + utxoIndexValueLen
+	}
+	return batch.Delete(undoKey)
+}
+
+// EnableUtxoIndex builds utxo index from unspent transactions if it is not
+// enabled yet.
+//
+// It must not be called between SubmitBlock/DeleteBlock and Commit.
+func (db *ChainDb) EnableUtxoIndex() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	enabled, err := db.utxoIndexEnabled()
+	if err != nil || enabled {
+		return err
+	}
+	// remove outdated index
+	if err = db.dropUtxoIndex(); err != nil {
+		return err
+	}
+
+	bestHeight := db.dbStorageMeta.currentHeight
+	logging.CPrint(logging.INFO, "building utxo index", logging.LogFormat{"height": bestHeight})
+
+	batch := db.stor.NewBatch()
+	defer batch.Release()
+
+	count := 0
+	iter := db.stor.NewIterator(storage.BytesPrefix(recordSuffixTx))
+	defer iter.Release()
+	for iter.Next() {
+		var txSha wire.Hash
+		copy(txSha[:], iter.Key()[len(recordSuffixTx):])
+		value := iter.Value()
+		height := binary.LittleEndian.Uint64(value[0:8])
+		txOff := int(binary.LittleEndian.Uint32(value[8:12]))
+		txLen := int(binary.LittleEndian.Uint32(value[12:16]))
+		spentBuf := value[16:]
+
+		_, fileNo, blkOffset, _, err := db.GetBlkLocByHeight(height)
+		if err != nil {
+			return err
+		}
+		raw, err := db.readRawTx(fileNo, blkOffset, txOff, txLen)
+		if err != nil {
+			return err
+		}
+		var tx wire.MsgTx
+		if err = tx.SetBytes(raw, wire.DB); err != nil {
+			return err
+		}
+		coinbase := isCoinBaseTx(&tx)
+
+		for i, txOut := range tx.TxOut {
+			if i/8 < len(spentBuf) && spentBuf[i/8]&(byte(1)<<uint(i%8)) != 0 {
+				continue
+			}
+			key, value := encodeUtxoIndexEntry(&database.UtxoIndexOutput{
+				OutPoint:    wire.OutPoint{Hash: txSha, Index: uint32(i)},
+				PkScript:    txOut.PkScript,
+				Value:       txOut.Value,
+				BlockHeight: height,
+				Coinbase:    coinbase,
+			})
+			if key == nil {
+				continue
+			}
+			if err = batch.Put(key, value); err != nil {
+				return err
+			}
+			if count++; count%utxoIndexBatchSize == 0 {
+				if err = db.stor.Write(batch); err != nil {
+					return err
+				}
+				batch.Reset()
+			}
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return err
+	}
+
+	var version [8]byte
+	binary.LittleEndian.PutUint64(version[:], bestHeight)
+	if err = batch.Put(utxoIndexVersionKey, version[:]); err != nil {
+		return err
+	}
+	if err = db.stor.Write(batch); err != nil {
+		return err
+	}
+	logging.CPrint(logging.INFO, "utxo index built", logging.LogFormat{
+		"height":  bestHeight,
+		"outputs": count,
+	})
+	return nil
+}
+
+// DisableUtxoIndex removes utxo index.
+func (db *ChainDb) DisableUtxoIndex() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if err := db.stor.Delete(utxoIndexVersionKey); err != nil {
+		return err
+	}
+	return db.dropUtxoIndex()
+}
+
+func (db *ChainDb) dropUtxoIndex() error {
+	batch := db.stor.NewBatch()
+	defer batch.Release()
+
+	count := 0
+	for _, prefix := range [][]byte{utxoIndexPrefix, utxoUndoPrefix} {
+		iter := db.stor.NewIterator(storage.BytesPrefix(prefix))
+		for iter.Next() {
+			batch.Delete(iter.Key())
+			if count++; count%utxoIndexBatchSize == 0 {
+				if err := db.stor.Write(batch); err != nil {
+					iter.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return db.stor.Write(batch)
+}
+
+// FetchUtxosByScriptHash returns unspent outputs of scriptHash.
+func (db *ChainDb) FetchUtxosByScriptHash(scriptHash []byte) ([]*database.UtxoReply, error) {
+	if len(scriptHash) != sha256.Size {
+		return nil, ErrWrongScriptHashLength
+	}
+
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	enabled, err := db.utxoIndexEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, database.ErrUtxoIndexDoesNotExist
+	}
+
+	prefix := make([]byte, 3+sha256.Size)
+	copy(prefix, utxoIndexPrefix)
+	copy(prefix[3:], scriptHash)
+
+	bestHeight := db.dbStorageMeta.currentHeight
+	replies := make([]*database.UtxoReply, 0)
+	iter := db.stor.NewIterator(storage.BytesPrefix(prefix))
+	defer iter.Release()
+	for iter.Next() {
+		reply, err := decodeUtxoIndexEntry(iter.Key(), iter.Value(), bestHeight)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	if err = iter.Error(); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// FetchBalanceByScriptHash returns total value of unspent outputs of
+// scriptHash by type.
+func (db *ChainDb) FetchBalanceByScriptHash(scriptHash []byte) (*database.ScriptHashBalance, error) {
+	utxos, err := db.FetchUtxosByScriptHash(scriptHash)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &database.ScriptHashBalance{
+		Spendable:        massutil.ZeroAmount(),
+		ImmatureCoinbase: massutil.ZeroAmount(),
+		Staking:          massutil.ZeroAmount(),
+		Binding:          massutil.ZeroAmount(),
+	}
+	for _, utxo := range utxos {
+		var total *massutil.Amount
+		switch {
+		case utxo.Type == database.UtxoStaking:
+			total = &balance.Staking
+		case utxo.Type == database.UtxoBinding:
+			total = &balance.Binding
+		case utxo.Immature:
+			total = &balance.ImmatureCoinbase
+		default:
+			total = &balance.Spendable
+		}
+		if *total, err = total.Add(utxo.Value); err != nil {
+			return nil, err
+		}
+	}
+	return balance, nil
+}
@@ -0,0 +1,158 @@
+package ldb_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/massnetorg/mass-core/database"
+	"github.com/massnetorg/mass-core/massutil"
+	"github.com/massnetorg/mass-core/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// utxoIndexEntries returns all entries of utxo index.
+func utxoIndexEntries(db database.Db) map[string][]byte {
+	entries := make(map[string][]byte)
+	for k, v := range db.TestExportDbEntries() {
+		if strings.HasPrefix(k, "UTX") {
+			entries[k] = v
+		}
+	}
+	return entries
+}
+
+// makeUtxoIndexData collects outputs created and spent by blk, it must be
+// called before blk is submitted.
+func makeUtxoIndexData(t *testing.T, db database.Db, blk *massutil.Block) *database.UtxoIndexData {
+	data := &database.UtxoIndexData{}
+	created := make(map[wire.Hash]*wire.MsgTx)
+	for _, tx := range blk.Transactions() {
+		msgTx := tx.MsgTx()
+		if !msgTx.IsCoinBaseTx() {
+			for _, txIn := range msgTx.TxIn {
+				op := txIn.PreviousOutPoint
+				prev, height := created[op.Hash], blk.Height()
+				if prev == nil {
+					replies, err := db.FetchTxBySha(&op.Hash)
+					assert.Nil(t, err)
+					reply := replies[len(replies)-1]
+					prev, height = reply.Tx, reply.Height
+				}
+				data.Spent = append(data.Spent, &database.UtxoIndexOutput{
+					OutPoint:    op,
+					PkScript:    prev.TxOut[op.Index].PkScript,
+					Value:       prev.TxOut[op.Index].Value,
+					BlockHeight: height,
+					Coinbase:    prev.IsCoinBaseTx(),
+				})
+			}
+		}
+		for i, txOut := range msgTx.TxOut {
+			data.Created = append(data.Created, &database.UtxoIndexOutput{
+				OutPoint:    wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)},
+				PkScript:    txOut.PkScript,
+				Value:       txOut.Value,
+				BlockHeight: blk.Height(),
+				Coinbase:    msgTx.IsCoinBaseTx(),
+			})
+		}
+		created[*tx.Hash()] = msgTx
+	}
+	return data
+}
+
+func TestChainDb_UtxoIndex(t *testing.T) {
+	db, tearDown, err := GetDb("DbTest")
+	assert.Nil(t, err)
+	defer tearDown()
+
+	err = initBlocks(db, 100)
+	assert.Nil(t, err)
+
+	_, err = db.FetchUtxosByScriptHash(make([]byte, 32))
+	assert.Equal(t, database.ErrUtxoIndexDoesNotExist, err)
+	assert.Nil(t, db.EnableUtxoIndex())
+	_, err = db.FetchUtxosByScriptHash(make([]byte, 20))
+	assert.NotNil(t, err)
+
+	// every indexed output is unspent
+	built := utxoIndexEntries(db)
+	assert.NotEqual(t, 0, len(built))
+	scriptHashes := make(map[string]struct{})
+	for k := range built {
+		scriptHashes[k[3:35]] = struct{}{}
+	}
+	for sh := range scriptHashes {
+		utxos, err := db.FetchUtxosByScriptHash([]byte(sh))
+		assert.Nil(t, err)
+		assert.NotEqual(t, 0, len(utxos))
+
+		total := massutil.ZeroAmount()
+		for _, utxo := range utxos {
+			replies := db.FetchUnSpentTxByShaList([]*wire.Hash{utxo.TxSha})
+			assert.Nil(t, replies[0].Err)
+			assert.False(t, replies[0].TxSpent[utxo.Index])
+			assert.Equal(t, replies[0].Height, utxo.Height)
+			total, err = total.Add(utxo.Value)
+			assert.Nil(t, err)
+		}
+		balance, err := db.FetchBalanceByScriptHash([]byte(sh))
+		assert.Nil(t, err)
+		sum := balance.Spendable
+		for _, amt := range []massutil.Amount{balance.ImmatureCoinbase, balance.Staking, balance.Binding} {
+			sum, err = sum.Add(amt)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, total, sum)
+	}
+
+	// index is maintained along with new blocks
+	snapshots := make(map[uint64]map[string][]byte)
+	for _, blk := range blks200[100:150] {
+		data := makeUtxoIndexData(t, db, blk)
+		assert.Nil(t, db.SubmitBlock(blk))
+		assert.Nil(t, db.SubmitAddrIndex(blk.Hash(), blk.Height(), &database.AddrIndexData{UtxoIndex: data}))
+		assert.Nil(t, db.Commit(*blk.Hash()))
+		snapshots[blk.Height()] = utxoIndexEntries(db)
+	}
+
+	// detaching blocks restores index
+	for i := 149; i >= 120; i-- {
+		blk := blks200[i]
+		assert.Nil(t, db.DeleteBlock(blk.Hash()))
+		assert.Nil(t, db.DeleteAddrIndex(blk.Hash(), blk.Height()))
+		assert.Nil(t, db.Commit(*blk.Hash()))
+		assert.Equal(t, snapshots[blk.Height()-1], utxoIndexEntries(db))
+	}
+	for i := 119; i >= 100; i-- {
+		blk := blks200[i]
+		assert.Nil(t, db.DeleteBlock(blk.Hash()))
+		assert.Nil(t, db.DeleteAddrIndex(blk.Hash(), blk.Height()))
+		assert.Nil(t, db.Commit(*blk.Hash()))
+	}
+	assert.Equal(t, built, utxoIndexEntries(db))
+
+	// rebuilt index is the same as the maintained one
+	for _, blk := range blks200[100:150] {
+		data := makeUtxoIndexData(t, db, blk)
+		assert.Nil(t, db.SubmitBlock(blk))
+		assert.Nil(t, db.SubmitAddrIndex(blk.Hash(), blk.Height(), &database.AddrIndexData{UtxoIndex: data}))
+		assert.Nil(t, db.Commit(*blk.Hash()))
+	}
+	maintained := utxoIndexEntries(db)
+	assert.Equal(t, snapshots[149], maintained)
+	assert.Nil(t, db.DisableUtxoIndex())
+	assert.Equal(t, 0, len(utxoIndexEntries(db)))
+	_, err = db.FetchBalanceByScriptHash(make([]byte, 32))
+	assert.Equal(t, database.ErrUtxoIndexDoesNotExist, err)
+	assert.Nil(t, db.EnableUtxoIndex())
+	assert.Equal(t, maintained, utxoIndexEntries(db))
+
+	// index disables itself when detaching blocks before it was built
+	blk := blks200[149]
+	assert.Nil(t, db.DeleteBlock(blk.Hash()))
+	assert.Nil(t, db.DeleteAddrIndex(blk.Hash(), blk.Height()))
+	assert.Nil(t, db.Commit(*blk.Hash()))
+	_, err = db.FetchUtxosByScriptHash(make([]byte, 32))
+	assert.Equal(t, database.ErrUtxoIndexDoesNotExist, err)
+}
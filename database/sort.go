@@ -128,7 +128,7 @@ func (p Pairs) Less(i, j int) bool {
 	//return string(key1) < string(key2)
 }
 
-func SortMap(m map[[sha256.Size]byte][]StakingTxInfo, newestHeight uint64, isOnlyReward bool) (Pairs, error) {
+func SortMap(params consensus.DeploymentChecker, m map[[sha256.Size]byte][]StakingTxInfo, newestHeight uint64, isOnlyReward bool) (Pairs, error) {
 	length := len(m)
 	if length == 0 {
 		return Pairs{}, nil
@@ -136,7 +136,7 @@ func SortMap(m map[[sha256.Size]byte][]StakingTxInfo, newestHeight uint64, isOnl
 	ps := make(Pairs, length)
 	pl := PairList{
 		pairs:       ps,
-		weightFirst: forks.SortStakingNodesByWeight(newestHeight),
+		weightFirst: forks.SortStakingNodesByWeight(params, newestHeight),
 	}
 	i := 0
 
@@ -187,7 +187,7 @@ func SortMap(m map[[sha256.Size]byte][]StakingTxInfo, newestHeight uint64, isOnl
 				return nil, errors.New("expired staking tx found")
 			}
 
-			period := forks.CalcEffectiveStakingPeriod(newestHeight, stakingTx)
+			period := forks.CalcEffectiveStakingPeriod(params, newestHeight, stakingTx)
 			uPeriod := safetype.NewUint128FromUint(period)
 			uWeight, err := va.Value().Mul(uPeriod)
 			if err != nil {
@@ -3,6 +3,8 @@ package database
 import (
 	"crypto/sha256"
 	"testing"
+
+	"github.com/massnetorg/mass-core/config"
 )
 
 var (
@@ -111,7 +113,7 @@ func TestSortMapByValue(t *testing.T) {
 			},
 		},
 	}
-	pairs, err := SortMap(tests, 590602, true)
+	pairs, err := SortMap(&config.ChainParams, tests, 590602, true)
 	if err != nil {
 		t.Fatalf("failed to sort, %v", err)
 	}
@@ -123,7 +125,7 @@ func TestSortMapByValue(t *testing.T) {
 		t.Logf("")
 	}
 
-	pairs, err = SortMap(tests, 600002, true)
+	pairs, err = SortMap(&config.ChainParams, tests, 600002, true)
 	if err != nil {
 		t.Fatalf("failed to sort, %v", err)
 	}
@@ -1,6 +1,7 @@
 package netsync
 
 import (
+	"github.com/massnetorg/mass-core/blockchain"
 	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/wire"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
@@ -74,7 +75,11 @@ func (f *blockFetcher) insert(msg *blockMsg) {
 			return
 		}
 
-		f.peers.addBanScore(msg.peerID, 20, 0, err.Error())
+		score := uint64(20)
+		if err == blockchain.ErrReorgTooDeep {
+			score = reorgTooDeepBanScore
+		}
+		f.peers.addBanScore(msg.peerID, score, 0, err.Error())
 		return
 	}
 
@@ -144,6 +144,7 @@ func (bk *blockKeeper) fastBlockSync(checkPoint *config.Checkpoint) error {
 			return err
 		}
 	}
+	bk.chain.AddHeaderChain(bk.headerChain())
 
 	fastHeader := bk.headerList.Front()
 	for bk.chain.BestBlockHeight() < checkPoint.Height {
@@ -209,6 +210,7 @@ func (bk *blockKeeper) batchBlockSync(targetHeight uint64) error {
 	if err := bk.appendHeaderList(headers); err != nil {
 		return err
 	}
+	bk.chain.AddHeaderChain(bk.headerChain())
 
 	batchHeader := bk.headerList.Front()
 	syncHeight := bk.headerList.Back().Value.(*wire.BlockHeader).Height
@@ -272,6 +274,7 @@ func (bk *blockKeeper) batchForkedSync(root *wire.BlockHeader, diverged []*wire.
 			return err
 		}
 	}
+	bk.chain.AddHeaderChain(bk.headerChain())
 
 	batchHeader := bk.headerList.Front()
 	syncHeight := bk.headerList.Back().Value.(*wire.BlockHeader).Height
@@ -368,6 +371,15 @@ func (bk *blockKeeper) locateHeaders(locator []*wire.Hash, stopHash *wire.Hash,
 	return headers, nil
 }
 
+// headerChain returns the headers in headerList ordered by height.
+func (bk *blockKeeper) headerChain() []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, bk.headerList.Len())
+	for e := bk.headerList.Front(); e != nil; e = e.Next() {
+		headers = append(headers, e.Value.(*wire.BlockHeader))
+	}
+	return headers
+}
+
 func (bk *blockKeeper) nextCheckpoint() *config.Checkpoint {
 	height := bk.chain.BestBlockHeader().Height
 	checkpoints := bk.chain.Checkpoints()
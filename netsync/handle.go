@@ -29,14 +29,17 @@ type Chain interface {
 	GetHeaderByHeight(uint64) (*wire.BlockHeader, error)
 	InMainChain(wire.Hash) bool
 	ProcessBlock(*massutil.Block) (bool, error)
-	ProcessTx(*massutil.Tx) (bool, error)
+	ProcessPeerTx(*massutil.Tx, string) (bool, error)
 	ChainID() *wire.Hash
 	Checkpoints() []config.Checkpoint
+	AddHeaderChain([]*wire.BlockHeader) bool
+	IsPruned() bool
 }
 
 type TxPool interface {
 	TxDescs() []*blockchain.TxDesc
 	SetNewTxCh(chan *massutil.Tx)
+	RemoveOrphansByPeer(string)
 }
 
 //SyncManager Sync Manager is responsible for the business layer information synchronization
@@ -69,6 +72,10 @@ func NewSyncManager(config *config.Config, chain Chain, txPool *blockchain.TxPoo
 	if err != nil {
 		return nil, err
 	}
+	// Pruned node can not serve historical blocks
+	if chain.IsPruned() {
+		sw.SetServices(consensus.DefaultServices &^ consensus.SFFullNode)
+	}
 	peers := newPeerSet(sw)
 	manager := &SyncManager{
 		sw:          sw,
@@ -377,8 +384,11 @@ func (sm *SyncManager) handleTransactionMsg(peer *peer, msg *TransactionMessage)
 		return
 	}
 
-	if isOrphan, err := sm.chain.ProcessTx(tx); err != nil && !isOrphan {
+	if isOrphan, err := sm.chain.ProcessPeerTx(tx, peer.ID()); err != nil && !isOrphan {
 		if err == errors.ErrTxAlreadyExists || err == blockchain.ErrDoubleSpend ||
+			err == blockchain.ErrTxPoolFull || err == blockchain.ErrReplacementFeeRate ||
+			err == blockchain.ErrReplacementFee || err == blockchain.ErrTooManyReplacements ||
+			err == blockchain.ErrBindingTargetInPool ||
 			(!sm.IsCaughtUp() &&
 				(err == blockchain.ErrImmatureSpend ||
 					err == blockchain.ErrBindingInputMissing ||
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/massnetorg/mass-core/blockchain"
 	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/errors"
 	"github.com/massnetorg/mass-core/logging"
@@ -22,6 +23,10 @@ const (
 	maxKnownBlocks      = 1024  // Maximum block hashes to keep in the known list (prevent DOS)
 	defaultBanThreshold = uint64(100)
 	maxBanScoreCache    = 1000
+
+	// reorgTooDeepBanScore is added to peers pushing chains that exceed max
+	// reorg depth, which are likely long-range attacks.
+	reorgTooDeepBanScore = uint64(50)
 )
 
 //BasePeer is the interface for connection level peer
@@ -414,9 +419,12 @@ func (ps *peerSet) broadcastTx(tx *massutil.Tx) error {
 }
 
 func (ps *peerSet) errorHandler(peerID string, err error) {
-	if errors.Root(err) == errPeerMisbehave {
+	switch errors.Root(err) {
+	case errPeerMisbehave:
 		ps.addBanScore(peerID, 20, 0, err.Error())
-	} else {
+	case blockchain.ErrReorgTooDeep:
+		ps.addBanScore(peerID, reorgTooDeepBanScore, 0, err.Error())
+	default:
 		ps.removePeer(peerID)
 	}
 }
@@ -85,6 +85,7 @@ func (pr *ProtocolReactor) AddPeer(peer *p2p.Peer) error {
 // RemovePeer implements Reactor by removing peer from the pool.
 func (pr *ProtocolReactor) RemovePeer(peer *p2p.Peer, reason interface{}) {
 	pr.peers.removePeer(peer.Key)
+	pr.sm.txPool.RemoveOrphansByPeer(peer.Key)
 }
 
 // Receive implements Reactor by handling 4 types of messages (look below).
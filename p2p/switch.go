@@ -432,6 +432,15 @@ func (sw *Switch) SetNodeInfo(nodeInfo *NodeInfo) {
 	sw.nodeInfo = nodeInfo
 }
 
+// SetServices sets services advertised to other nodes through NodeInfo.
+// NOTE: Not goroutine safe, must be called before switch starts.
+func (sw *Switch) SetServices(services consensus.ServiceFlag) {
+	if sw.nodeInfo == nil {
+		return
+	}
+	sw.nodeInfo.Other = []string{strconv.FormatUint(uint64(services), 10)}
+}
+
 // SetNodePrivKey sets the switch's private key for authenticated encryption.
 // NOTE: Not goroutine safe.
 func (sw *Switch) SetNodePrivKey(nodePrivKey crypto.PrivKeyEd25519) {
@@ -81,13 +81,28 @@ type Proof interface {
 	BitLength() int
 	Encode() []byte
 	Decode([]byte) error
+	// Quality returns QualityAt with MASSIP0002 active as on the main
+	// network.
 	Quality(slot, height uint64) *big.Int
+	// QualityAt returns the quality of the proof, massip2 is whether
+	// MASSIP0002 is active at height on the chain of the block.
+	QualityAt(slot, height uint64, massip2 bool) *big.Int
 	Verify(seed pocutil.Hash, challenge pocutil.Hash, filter bool) error
 	VerifiedQuality(seed pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64) (*big.Int, error)
+	VerifiedQualityAt(seed pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64, massip2 bool) (*big.Int, error)
 }
 
+// EnforceMASSIP0002 returns whether MASSIP0002 is active at height on the
+// main network.
+//
+// Deprecated: the activation depends on the chain, pass it to QualityAt.
 func EnforceMASSIP0002(height uint64) bool {
-	return height >= consensus.MASSIP0002Height
+	for i := range consensus.MainNetDeployments {
+		if d := &consensus.MainNetDeployments[i]; d.Name == consensus.DeploymentMASSIP0002 {
+			return d.IsActive(height)
+		}
+	}
+	return false
 }
 
 // VerifyProof verifies proof.
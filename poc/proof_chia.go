@@ -105,6 +105,10 @@ func (proof *ChiaProof) Decode(data []byte) error {
 }
 
 func (proof *ChiaProof) Quality(slot, height uint64) *big.Int {
+	return proof.QualityAt(slot, height, EnforceMASSIP0002(height))
+}
+
+func (proof *ChiaProof) QualityAt(slot, height uint64, massip2 bool) *big.Int {
 	if proof.pos == nil {
 		return big.NewInt(0)
 	}
@@ -142,10 +146,14 @@ func (proof *ChiaProof) Verify(useless, challenge pocutil.Hash, filter bool) err
 }
 
 func (proof *ChiaProof) VerifiedQuality(useless, challenge pocutil.Hash, filter bool, slot, height uint64) (*big.Int, error) {
+	return proof.VerifiedQualityAt(useless, challenge, filter, slot, height, EnforceMASSIP0002(height))
+}
+
+func (proof *ChiaProof) VerifiedQualityAt(useless, challenge pocutil.Hash, filter bool, slot, height uint64, massip2 bool) (*big.Int, error) {
 	if err := proof.Verify(useless, challenge, filter); err != nil {
 		return nil, err
 	}
-	return proof.Quality(slot, height), nil
+	return proof.QualityAt(slot, height, massip2), nil
 }
 
 func (proof *ChiaProof) Pos() *chiapos.ProofOfSpace {
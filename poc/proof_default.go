@@ -97,9 +97,14 @@ func (proof *DefaultProof) Decode(data []byte) error {
 //
 // A proof is considered as valid when Quality >= target.
 func (proof *DefaultProof) Quality(slot, height uint64) *big.Int {
+	return proof.QualityAt(slot, height, EnforceMASSIP0002(height))
+}
+
+// QualityAt is Quality on a chain where MASSIP0002 is active if massip2.
+func (proof *DefaultProof) QualityAt(slot, height uint64, massip2 bool) *big.Int {
 	hashVal := proof.GetHashVal(slot, height)
 	q1 := Q1FactorDefault(proof.BL)
-	if EnforceMASSIP0002(height) {
+	if massip2 {
 		q1.Mul(q1, big.NewFloat(QualityConstantMASSIP0002))
 	}
 	return GetQuality(q1, hashVal)
@@ -139,10 +144,16 @@ func (proof *DefaultProof) Verify(pubKeyHash pocutil.Hash, challenge pocutil.Has
 
 // VerifiedQuality verifies the proof and then calculates its quality.
 func (proof *DefaultProof) VerifiedQuality(pubKeyHash pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64) (*big.Int, error) {
+	return proof.VerifiedQualityAt(pubKeyHash, challenge, filter, slot, height, EnforceMASSIP0002(height))
+}
+
+// VerifiedQualityAt is VerifiedQuality on a chain where MASSIP0002 is active
+// if massip2.
+func (proof *DefaultProof) VerifiedQualityAt(pubKeyHash pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64, massip2 bool) (*big.Int, error) {
 	if err := proof.Verify(pubKeyHash, challenge, filter); err != nil {
 		return nil, err
 	}
-	return proof.Quality(slot, height), nil
+	return proof.QualityAt(slot, height, massip2), nil
 }
 
 // GetHashVal returns SHA256(t//s,x,x',height).
@@ -32,6 +32,10 @@ func (proof *EmptyProof) Quality(slot, height uint64) *big.Int {
 	return big.NewInt(0)
 }
 
+func (proof *EmptyProof) QualityAt(slot, height uint64, massip2 bool) *big.Int {
+	return big.NewInt(0)
+}
+
 func (proof *EmptyProof) Verify(plotSeed pocutil.Hash, challenge pocutil.Hash, filter bool) error {
 	return nil
 }
@@ -39,3 +43,7 @@ func (proof *EmptyProof) Verify(plotSeed pocutil.Hash, challenge pocutil.Hash, f
 func (proof *EmptyProof) VerifiedQuality(plotSeed pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64) (*big.Int, error) {
 	return big.NewInt(0), nil
 }
+
+func (proof *EmptyProof) VerifiedQualityAt(plotSeed pocutil.Hash, challenge pocutil.Hash, filter bool, slot, height uint64, massip2 bool) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
@@ -19,6 +19,8 @@ import (
 type committer struct {
 	// sha crypto.KeccakState
 
+	db    *Database
+	batch massdb.Batch // nil if committed nodes are tracked by db
 }
 
 // // committers live in a global sync.Pool
@@ -48,22 +50,27 @@ func (c *committer) Commit(n node, db *Database) (hashNode, error) {
 		return nil, errors.New("no db provided")
 	}
 
-	batch := db.diskdb.NewBatch()
+	c.db = db
+	if !db.tracksDirties() {
+		c.batch = db.diskdb.NewBatch()
+	}
 
-	h, err := c.commit(n, batch)
+	h, err := c.commit(n)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := batch.Write(); err != nil {
-		return nil, err
+	if c.batch != nil {
+		if err := c.batch.Write(); err != nil {
+			return nil, err
+		}
 	}
 
 	return h.(hashNode), nil
 }
 
 // commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) commit(n node, batch massdb.Batch) (node, error) {
+func (c *committer) commit(n node) (node, error) {
 	// if this path is clean, use available cached data
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
@@ -78,7 +85,7 @@ func (c *committer) commit(n node, batch massdb.Batch) (node, error) {
 		// If the child is fullnode, recursively commit.
 		// Otherwise it can only be hashNode or valueNode.
 		if _, ok := cn.Val.(*fullNode); ok {
-			childV, err := c.commit(cn.Val, batch)
+			childV, err := c.commit(cn.Val)
 			if err != nil {
 				return nil, err
 			}
@@ -86,20 +93,20 @@ func (c *committer) commit(n node, batch massdb.Batch) (node, error) {
 		}
 		// The key needs to be copied, since we're delivering it to database
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, batch)
+		hashedNode := c.store(collapsed)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
 		return collapsed, nil
 	case *fullNode:
-		hashedKids, err := c.commitChildren(cn, batch)
+		hashedKids, err := c.commitChildren(cn)
 		if err != nil {
 			return nil, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, batch)
+		hashedNode := c.store(collapsed)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
@@ -113,7 +120,7 @@ func (c *committer) commit(n node, batch massdb.Batch) (node, error) {
 }
 
 // commitChildren commits the children of the given fullnode
-func (c *committer) commitChildren(n *fullNode, batch massdb.Batch) ([17]node, error) {
+func (c *committer) commitChildren(n *fullNode) ([17]node, error) {
 	var children [17]node
 	for i := 0; i < 16; i++ {
 		child := n.Children[i]
@@ -130,7 +137,7 @@ func (c *committer) commitChildren(n *fullNode, batch massdb.Batch) ([17]node, e
 		// Commit the child recursively and store the "hashed" value.
 		// Note the returned node can be some embedded nodes, so it's
 		// possible the type is not hashnode.
-		hashed, err := c.commit(child, batch)
+		hashed, err := c.commit(child)
 		if err != nil {
 			return children, err
 		}
@@ -204,7 +211,11 @@ func (c *committer) commitChildren(n *fullNode, batch massdb.Batch) ([17]node, e
 // }
 
 //===============
-func (c *committer) store(n node, batch massdb.Batch) node {
+
+// store writes the node to the batch, or inserts it into the database if
+// committed nodes are tracked, the node is returned as is if it's too small
+// to be hashed.
+func (c *committer) store(n node) node {
 	hash, _ := n.cache()
 
 	if hash == nil {
@@ -220,6 +231,12 @@ func (c *committer) store(n node, batch massdb.Batch) node {
 		logging.CPrint(logging.PANIC, "failed to encode node", logging.LogFormat{"err": err})
 	}
 
-	rawdb.WriteTrieNode(batch, common.BytesToHash(hash), enc)
+	if c.batch != nil {
+		rawdb.WriteTrieNode(c.batch, common.BytesToHash(hash), enc)
+		return hash
+	}
+	c.db.lock.Lock()
+	c.db.insert(common.BytesToHash(hash), enc, n)
+	c.db.lock.Unlock()
 	return hash
 }
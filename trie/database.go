@@ -2,12 +2,21 @@ package trie
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
+	"github.com/massnetorg/mass-core/logging"
 	"github.com/massnetorg/mass-core/trie/common"
 	"github.com/massnetorg/mass-core/trie/massdb"
 	"github.com/massnetorg/mass-core/trie/rawdb"
 )
 
+// idealBatchSize defines the size of the data batches should ideally add in one
+// write.
+const idealBatchSize = 100 * 1024
+
 // Database is an intermediate write layer between the trie data structures and
 // the disk database. The aim is to accumulate trie writes in-memory and only
 // periodically flush a couple tries to disk, garbage collecting the remainder.
@@ -19,202 +28,183 @@ import (
 type Database struct {
 	diskdb massdb.KeyValueStore // Persistent storage for matured trie nodes
 
-	// dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes
-	// oldest  common.Hash                 // Oldest tracked node, flush-list head
-	// newest  common.Hash                 // Newest tracked node, flush-list tail
+	dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes, nil if not tracked
+	oldest  common.Hash                 // Oldest tracked node, flush-list head
+	newest  common.Hash                 // Newest tracked node, flush-list tail
+
+	gctime  time.Duration      // Time spent on garbage collection
+	gcnodes uint64             // Nodes garbage collected
+	gcsize  common.StorageSize // Data storage garbage collected
+
+	flushtime  time.Duration      // Time spent on data flushing
+	flushnodes uint64             // Nodes flushed
+	flushsize  common.StorageSize // Data storage flushed
+
+	dirtiesSize  common.StorageSize // Storage size of the dirty node cache (exc. metadata)
+	childrenSize common.StorageSize // Storage size of the external children tracking
+
+	lock sync.RWMutex
+}
+
+// Config defines the options of Database.
+type Config struct {
+	// TrackDirties keeps committed nodes in memory with reference counts
+	// until they are flushed by Commit or Cap, nodes only referenced by
+	// dereferenced roots are garbage collected without being written to
+	// disk. Otherwise committed nodes are written to disk directly.
+	TrackDirties bool
+}
+
+// GCStats is the statistics of garbage collection and flushing of dirty nodes.
+// Counters are accumulated since the database is created.
+type GCStats struct {
+	DirtyNodes int                // Number of dirty nodes in memory
+	DirtySize  common.StorageSize // Memory used by dirty nodes
+
+	GCNodes uint64             // Nodes garbage collected
+	GCSize  common.StorageSize // Data storage garbage collected
+	GCTime  time.Duration      // Time spent on garbage collection
+
+	FlushNodes uint64             // Nodes flushed to disk
+	FlushSize  common.StorageSize // Data storage flushed to disk
+	FlushTime  time.Duration      // Time spent on flushing
+}
+
+// cachedNode is all the information we know about a single cached trie node
+// in the memory database write layer.
+type cachedNode struct {
+	enc  []byte        // Encoded trie node
+	refs []common.Hash // Hashes of the children inside the node
+
+	parents  uint32                 // Number of live nodes referencing this one
+	children map[common.Hash]uint16 // External children referenced by this node
 
-	// gctime  time.Duration      // Time spent on garbage collection since last commit
-	// gcnodes uint64             // Nodes garbage collected since last commit
-	// gcsize  common.StorageSize // Data storage garbage collected since last commit
+	flushPrev common.Hash // Previous node in the flush-list
+	flushNext common.Hash // Next node in the flush-list
+}
 
-	// flushtime  time.Duration      // Time spent on data flushing since last commit
-	// flushnodes uint64             // Nodes flushed since last commit
-	// flushsize  common.StorageSize // Data storage flushed since last commit
+// cachedNodeSize is the raw size of a cachedNode data structure without any
+// node data included. It's an approximate size, but should be a lot better
+// than not counting them.
+var cachedNodeSize = int(reflect.TypeOf(cachedNode{}).Size())
 
-	// dirtiesSize   common.StorageSize // Storage size of the dirty node cache (exc. metadata)
-	// childrenSize  common.StorageSize // Storage size of the external children tracking
-	// preimagesSize common.StorageSize // Storage size of the preimages cache
+// cachedNodeChildrenSize is the raw size of an initialized but empty external
+// reference map.
+const cachedNodeChildrenSize = 48
 
-	// lock sync.RWMutex
+// size returns the storage size of the node data and the hashes of children
+// inside it.
+func (n *cachedNode) size() common.StorageSize {
+	return common.StorageSize(common.HashLength + len(n.enc) + len(n.refs)*common.HashLength)
 }
 
-// // rawNode is a simple binary blob used to differentiate between collapsed trie
-// // nodes and already encoded RLP binary blobs (while at the same time store them
-// // in the same cache fields).
-// type rawNode []byte
-
-// func (n rawNode) cache() (hashNode, bool) { panic("this should never end up in a live trie") }
-
-// // rawFullNode represents only the useful data content of a full node, with the
-// // caches and flags stripped out to minimize its data storage. This type honors
-// // the same RLP encoding as the original parent.
-// type rawFullNode [17]node
-
-// func (n rawFullNode) cache() (hashNode, bool) { panic("this should never end up in a live trie") }
-
-// // rawShortNode represents only the useful data content of a short node, with the
-// // caches and flags stripped out to minimize its data storage. This type honors
-// // the same RLP encoding as the original parent.
-// type rawShortNode struct {
-// 	Key []byte
-// 	Val node
-// }
-
-// func (n rawShortNode) cache() (hashNode, bool) { panic("this should never end up in a live trie") }
-
-// // cachedNode is all the information we know about a single cached trie node
-// // in the memory database write layer.
-// type cachedNode struct {
-// 	node node   // Cached collapsed trie node, or raw rlp data
-// 	size uint16 // Byte size of the useful cached data
-
-// 	parents  uint32                 // Number of live nodes referencing this one
-// 	children map[common.Hash]uint16 // External children referenced by this node
-
-// 	flushPrev common.Hash // Previous node in the flush-list
-// 	flushNext common.Hash // Next node in the flush-list
-// }
-
-// // rlp returns the raw rlp encoded blob of the cached trie node, either directly
-// // from the cache, or by regenerating it from the collapsed node.
-// func (n *cachedNode) rlp() []byte {
-// 	if node, ok := n.node.(rawNode); ok {
-// 		return node
-// 	}
-// 	blob, err := rlp.EncodeToBytes(n.node)
-// 	if err != nil {
-// 		panic(err)
-// 	}
-// 	return blob
-// }
-
-// // obj returns the decoded and expanded trie node, either directly from the cache,
-// // or by regenerating it from the rlp encoded blob.
-// func (n *cachedNode) obj(hash common.Hash) node {
-// 	if node, ok := n.node.(rawNode); ok {
-// 		return mustDecodeNode(hash[:], node)
-// 	}
-// 	return expandNode(hash[:], n.node)
-// }
-
-// // forChilds invokes the callback for all the tracked children of this node,
-// // both the implicit ones from inside the node as well as the explicit ones
-// // from outside the node.
-// func (n *cachedNode) forChilds(onChild func(hash common.Hash)) {
-// 	for child := range n.children {
-// 		onChild(child)
-// 	}
-// 	if _, ok := n.node.(rawNode); !ok {
-// 		forGatherChildren(n.node, onChild)
-// 	}
-// }
-
-// // forGatherChildren traverses the node hierarchy of a collapsed storage node and
-// // invokes the callback for all the hashnode children.
-// func forGatherChildren(n node, onChild func(hash common.Hash)) {
-// 	switch n := n.(type) {
-// 	case *rawShortNode:
-// 		forGatherChildren(n.Val, onChild)
-// 	case rawFullNode:
-// 		for i := 0; i < 16; i++ {
-// 			forGatherChildren(n[i], onChild)
-// 		}
-// 	case hashNode:
-// 		onChild(common.BytesToHash(n))
-// 	case valueNode, nil, rawNode:
-// 	default:
-// 		panic(fmt.Sprintf("unknown node type: %T", n))
-// 	}
-// }
-
-// // simplifyNode traverses the hierarchy of an expanded memory node and discards
-// // all the internal caches, returning a node that only contains the raw data.
-// func simplifyNode(n node) node {
-// 	switch n := n.(type) {
-// 	case *shortNode:
-// 		// Short nodes discard the flags and cascade
-// 		return &rawShortNode{Key: n.Key, Val: simplifyNode(n.Val)}
-
-// 	case *fullNode:
-// 		// Full nodes discard the flags and cascade
-// 		node := rawFullNode(n.Children)
-// 		for i := 0; i < len(node); i++ {
-// 			if node[i] != nil {
-// 				node[i] = simplifyNode(node[i])
-// 			}
-// 		}
-// 		return node
-
-// 	case valueNode, hashNode, rawNode:
-// 		return n
-
-// 	default:
-// 		panic(fmt.Sprintf("unknown node type: %T", n))
-// 	}
-// }
-
-// // expandNode traverses the node hierarchy of a collapsed storage node and converts
-// // all fields and keys into expanded memory form.
-// func expandNode(hash hashNode, n node) node {
-// 	switch n := n.(type) {
-// 	case *rawShortNode:
-// 		// Short nodes need key and child expansion
-// 		return &shortNode{
-// 			Key: compactToHex(n.Key),
-// 			Val: expandNode(nil, n.Val),
-// 			flags: nodeFlag{
-// 				hash: hash,
-// 			},
-// 		}
-
-// 	case rawFullNode:
-// 		// Full nodes need child expansion
-// 		node := &fullNode{
-// 			flags: nodeFlag{
-// 				hash: hash,
-// 			},
-// 		}
-// 		for i := 0; i < len(node.Children); i++ {
-// 			if n[i] != nil {
-// 				node.Children[i] = expandNode(nil, n[i])
-// 			}
-// 		}
-// 		return node
-
-// 	case valueNode, hashNode:
-// 		return n
-
-// 	default:
-// 		panic(fmt.Sprintf("unknown node type: %T", n))
-// 	}
-// }
+// forChilds invokes the callback for all the tracked children of this node,
+// both the implicit ones from inside the node as well as the explicit ones
+// from outside the node.
+func (n *cachedNode) forChilds(onChild func(hash common.Hash)) {
+	for child := range n.children {
+		onChild(child)
+	}
+	for _, child := range n.refs {
+		onChild(child)
+	}
+}
+
+// forGatherChildren traverses the node hierarchy of a collapsed node and
+// invokes the callback for all the hashnode children.
+func forGatherChildren(n node, onChild func(hash common.Hash)) {
+	switch n := n.(type) {
+	case *shortNode:
+		forGatherChildren(n.Val, onChild)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			forGatherChildren(n.Children[i], onChild)
+		}
+	case hashNode:
+		onChild(common.BytesToHash(n))
+	case valueNode, nil:
+	default:
+		panic(fmt.Sprintf("unknown node type: %T", n))
+	}
+}
 
+// NewDatabase creates a new trie database to store ephemeral trie content before
+// its written out to disk. Committed nodes are written to disk directly.
 func NewDatabase(diskdb massdb.KeyValueStore) *Database {
+	return NewDatabaseWithConfig(diskdb, nil)
+}
+
+// NewDatabaseWithConfig creates a new trie database to store ephemeral trie content
+// before its written out to disk, dirty nodes are tracked in memory if enabled by
+// config.
+func NewDatabaseWithConfig(diskdb massdb.KeyValueStore, config *Config) *Database {
 	db := &Database{
 		diskdb: diskdb,
-		// dirties: map[common.Hash]*cachedNode{{}: {
-		// 	children: make(map[common.Hash]uint16),
-		// }},
+	}
+	if config != nil && config.TrackDirties {
+		db.dirties = map[common.Hash]*cachedNode{{}: {
+			children: make(map[common.Hash]uint16),
+		}}
 	}
 	return db
 }
 
+// DiskDB retrieves the persistent storage backing the trie database.
+func (db *Database) DiskDB() massdb.KeyValueStore {
+	return db.diskdb
+}
+
+// tracksDirties returns whether committed nodes are tracked in memory.
+func (db *Database) tracksDirties() bool {
+	return db.dirties != nil
+}
+
+// insert inserts a collapsed trie node into the memory database. All nodes
+// inserted by this function will be reference tracked.
+//
+// This function MUST be called with the database lock held (for writes).
+func (db *Database) insert(hash common.Hash, enc []byte, n node) {
+	// If the node's already cached, skip
+	if _, ok := db.dirties[hash]; ok {
+		return
+	}
+
+	// Create the cached entry for this node
+	entry := &cachedNode{
+		enc:       enc,
+		flushPrev: db.newest,
+	}
+	forGatherChildren(n, func(child common.Hash) {
+		entry.refs = append(entry.refs, child)
+	})
+	entry.forChilds(func(child common.Hash) {
+		if c := db.dirties[child]; c != nil {
+			c.parents++
+		}
+	})
+	db.dirties[hash] = entry
+
+	// Update the flush-list endpoints
+	if db.oldest == (common.Hash{}) {
+		db.oldest, db.newest = hash, hash
+	} else {
+		db.dirties[db.newest].flushNext, db.newest = hash, hash
+	}
+	db.dirtiesSize += entry.size()
+}
+
 // node retrieves a cached trie node from memory, or returns nil if none can be
 // found in the memory cache.
 func (db *Database) node(hash common.Hash) node {
-	// // Retrieve the node from the dirty cache if available
-	// db.lock.RLock()
-	// dirty := db.dirties[hash]
-	// db.lock.RUnlock()
-
-	// if dirty != nil {
-	// 	return dirty.obj(hash)
-	// }
-
-	// Content unavailable in memory, attempt to retrieve from disk
-	enc, err := db.diskdb.Get(hash[:])
-	if err != nil || enc == nil {
-		return nil
+	// Retrieve the node from the dirty cache if available
+	enc := db.dirtyNode(hash)
+	if enc == nil {
+		// Content unavailable in memory, attempt to retrieve from disk
+		var err error
+		enc, err = db.diskdb.Get(hash[:])
+		if err != nil || enc == nil {
+			return nil
+		}
 	}
 
 	n, err := decodeNode(hash[:], enc)
@@ -230,6 +220,20 @@ func (db *Database) node(hash common.Hash) node {
 	return n
 }
 
+// dirtyNode retrieves an encoded dirty trie node from memory, or returns nil
+// if not found.
+func (db *Database) dirtyNode(hash common.Hash) []byte {
+	if !db.tracksDirties() {
+		return nil
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if dirty := db.dirties[hash]; dirty != nil {
+		return dirty.enc
+	}
+	return nil
+}
+
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
@@ -237,6 +241,9 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
 	}
+	if enc := db.dirtyNode(hash); enc != nil {
+		return enc, nil
+	}
 
 	// Content unavailable in memory, attempt to retrieve from disk
 	enc := rawdb.ReadTrieNode(db.diskdb, hash)
@@ -246,34 +253,365 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	return nil, errors.New("not found")
 }
 
-// // insert inserts a collapsed trie node into the memory database.
-// // The blob size must be specified to allow proper size tracking.
-// // All nodes inserted by this function will be reference tracked
-// // and in theory should only used for **trie nodes** insertion.
-// func (db *Database) insert(hash common.Hash, size int, node node) {
-// 	// If the node's already cached, skip
-// 	if _, ok := db.dirties[hash]; ok {
-// 		return
-// 	}
-
-// 	// Create the cached entry for this node
-// 	entry := &cachedNode{
-// 		node:      simplifyNode(node),
-// 		size:      uint16(size),
-// 		flushPrev: db.newest,
-// 	}
-// 	entry.forChilds(func(child common.Hash) {
-// 		if c := db.dirties[child]; c != nil {
-// 			c.parents++
-// 		}
-// 	})
-// 	db.dirties[hash] = entry
-
-// 	// Update the flush-list endpoints
-// 	if db.oldest == (common.Hash{}) {
-// 		db.oldest, db.newest = hash, hash
-// 	} else {
-// 		db.dirties[db.newest].flushNext, db.newest = hash, hash
-// 	}
-// 	db.dirtiesSize += common.StorageSize(common.HashLength + entry.size)
-// }
+// Reference adds a new reference from a parent node to a child node. It is
+// used to reference a root with the meta root (the zero hash) as parent, to
+// keep the root and all its nodes in memory until it is dereferenced.
+func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	if !db.tracksDirties() {
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.reference(child, parent)
+}
+
+// reference is the private locked version of Reference.
+func (db *Database) reference(child common.Hash, parent common.Hash) {
+	// If the node does not exist, it's a node pulled from disk, skip
+	node, ok := db.dirties[child]
+	if !ok {
+		return
+	}
+	// If the reference already exists, only duplicate for roots
+	if db.dirties[parent].children == nil {
+		db.dirties[parent].children = make(map[common.Hash]uint16)
+		db.childrenSize += cachedNodeChildrenSize
+	} else if _, ok = db.dirties[parent].children[child]; ok && parent != (common.Hash{}) {
+		return
+	}
+	node.parents++
+	db.dirties[parent].children[child]++
+	if db.dirties[parent].children[child] == 1 {
+		db.childrenSize += common.HashLength + 2 // uint16 counter
+	}
+}
+
+// Dereference removes an existing reference from a root node, nodes no longer
+// referenced are garbage collected.
+func (db *Database) Dereference(root common.Hash) {
+	if !db.tracksDirties() {
+		return
+	}
+	// Sanity check to ensure that the meta-root is not removed
+	if root == (common.Hash{}) {
+		logging.CPrint(logging.ERROR, "attempted to dereference the trie cache meta root")
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
+	db.dereference(root, common.Hash{})
+
+	db.gcnodes += uint64(nodes - len(db.dirties))
+	db.gcsize += storage - db.dirtiesSize
+	db.gctime += time.Since(start)
+
+	logging.CPrint(logging.DEBUG, "dereferenced trie from memory database", logging.LogFormat{
+		"nodes":     nodes - len(db.dirties),
+		"size":      storage - db.dirtiesSize,
+		"time":      time.Since(start),
+		"gcnodes":   db.gcnodes,
+		"gcsize":    db.gcsize,
+		"gctime":    db.gctime,
+		"livenodes": len(db.dirties) - 1,
+		"livesize":  db.dirtiesSize,
+	})
+}
+
+// dereference is the private locked version of Dereference.
+func (db *Database) dereference(child common.Hash, parent common.Hash) {
+	// Dereference the parent-child
+	node := db.dirties[parent]
+
+	if node.children != nil && node.children[child] > 0 {
+		node.children[child]--
+		if node.children[child] == 0 {
+			delete(node.children, child)
+			db.childrenSize -= (common.HashLength + 2) // uint16 counter
+		}
+	}
+	// If the child does not exist, it's a previously committed node.
+	node, ok := db.dirties[child]
+	if !ok {
+		return
+	}
+	// If there are no more references to the child, delete it and cascade
+	if node.parents > 0 {
+		// This is a special cornercase where a node loaded from disk (i.e. not in the
+		// memcache any more) gets reinjected as a new node (short node split into full,
+		// then reverted into short), causing a cached node to have no parents. That is
+		// no problem in itself, but don't make maxint parents out of it.
+		node.parents--
+	}
+	if node.parents == 0 {
+		// Remove the node from the flush-list
+		db.removeFromFlushList(child, node)
+
+		// Dereference all children and delete the node
+		node.forChilds(func(hash common.Hash) {
+			db.dereference(hash, child)
+		})
+		delete(db.dirties, child)
+		db.dirtiesSize -= node.size()
+		if node.children != nil {
+			db.childrenSize -= cachedNodeChildrenSize
+		}
+	}
+}
+
+// removeFromFlushList unlinks the node from the flush-list.
+func (db *Database) removeFromFlushList(hash common.Hash, node *cachedNode) {
+	switch hash {
+	case db.oldest:
+		db.oldest = node.flushNext
+		db.dirties[node.flushNext].flushPrev = common.Hash{}
+	case db.newest:
+		db.newest = node.flushPrev
+		db.dirties[node.flushPrev].flushNext = common.Hash{}
+	default:
+		db.dirties[node.flushPrev].flushNext = node.flushNext
+		db.dirties[node.flushNext].flushPrev = node.flushPrev
+	}
+}
+
+// Cap iteratively flushes old but still referenced trie nodes until the total
+// memory usage goes below the given threshold.
+//
+// Note, this method is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) Cap(limit common.StorageSize) error {
+	if !db.tracksDirties() {
+		return nil
+	}
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
+	batch := db.diskdb.NewBatch()
+
+	// db.dirtiesSize only contains the useful data in the cache, but when reporting
+	// the total memory consumption, the maintenance metadata is also needed to be
+	// counted.
+	size := db.size()
+
+	// Keep committing nodes from the flush-list until we're below allowance
+	oldest := db.oldest
+	for size > limit && oldest != (common.Hash{}) {
+		// Fetch the oldest referenced node and push into the batch
+		node := db.dirties[oldest]
+		rawdb.WriteTrieNode(batch, oldest, node.enc)
+
+		// If we exceeded the ideal batch size, commit and reset
+		if batch.ValueSize() >= idealBatchSize {
+			if err := batch.Write(); err != nil {
+				logging.CPrint(logging.ERROR, "failed to write flush list to disk", logging.LogFormat{"err": err})
+				return err
+			}
+			batch.Reset()
+		}
+		// Iterate to the next flush item, or abort if the size cap was achieved. Size
+		// is the total size, including the useful cached data (hash -> blob), the
+		// cache item metadata, as well as external children mappings.
+		size -= node.size() + common.StorageSize(cachedNodeSize)
+		if node.children != nil {
+			size -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
+		}
+		oldest = node.flushNext
+	}
+	// Flush out any remainder data from the last batch
+	if err := batch.Write(); err != nil {
+		logging.CPrint(logging.ERROR, "failed to write flush list to disk", logging.LogFormat{"err": err})
+		return err
+	}
+	// Write successful, clear out the flushed data
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for db.oldest != oldest {
+		node := db.dirties[db.oldest]
+		delete(db.dirties, db.oldest)
+		db.oldest = node.flushNext
+
+		db.dirtiesSize -= node.size()
+		if node.children != nil {
+			db.childrenSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
+		}
+	}
+	if db.oldest != (common.Hash{}) {
+		db.dirties[db.oldest].flushPrev = common.Hash{}
+	}
+	db.flushnodes += uint64(nodes - len(db.dirties))
+	db.flushsize += storage - db.dirtiesSize
+	db.flushtime += time.Since(start)
+
+	logging.CPrint(logging.DEBUG, "persisted nodes from memory database", logging.LogFormat{
+		"nodes":      nodes - len(db.dirties),
+		"size":       storage - db.dirtiesSize,
+		"time":       time.Since(start),
+		"flushnodes": db.flushnodes,
+		"flushsize":  db.flushsize,
+		"flushtime":  db.flushtime,
+		"livenodes":  len(db.dirties) - 1,
+		"livesize":   db.dirtiesSize,
+	})
+	return nil
+}
+
+// Commit iterates over all the children of a particular node, writes them out
+// to disk, forcefully tearing down all references in both directions.
+//
+// Note, this method is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) Commit(node common.Hash) error {
+	if !db.tracksDirties() {
+		return nil
+	}
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	start := time.Now()
+	batch := db.diskdb.NewBatch()
+
+	// Move the trie itself into the batch, flushing if enough data is accumulated
+	nodes, storage := len(db.dirties), db.dirtiesSize
+
+	uncacher := &cleaner{db}
+	if err := db.commit(node, batch, uncacher); err != nil {
+		logging.CPrint(logging.ERROR, "failed to commit trie from trie database", logging.LogFormat{"err": err})
+		return err
+	}
+	// Trie mostly committed to disk, flush any batch leftovers
+	if err := batch.Write(); err != nil {
+		logging.CPrint(logging.ERROR, "failed to write trie to disk", logging.LogFormat{"err": err})
+		return err
+	}
+	// Uncache any leftovers in the last batch
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	batch.Replay(uncacher)
+	batch.Reset()
+
+	db.flushnodes += uint64(nodes - len(db.dirties))
+	db.flushsize += storage - db.dirtiesSize
+	db.flushtime += time.Since(start)
+
+	logging.CPrint(logging.DEBUG, "persisted trie from memory database", logging.LogFormat{
+		"root":       node,
+		"nodes":      nodes - len(db.dirties),
+		"size":       storage - db.dirtiesSize,
+		"time":       time.Since(start),
+		"livenodes":  len(db.dirties) - 1,
+		"livesize":   db.dirtiesSize,
+		"flushnodes": db.flushnodes,
+		"flushsize":  db.flushsize,
+	})
+	return nil
+}
+
+// commit is the private locked version of Commit.
+func (db *Database) commit(hash common.Hash, batch massdb.Batch, uncacher *cleaner) error {
+	// If the node does not exist, it's a previously committed node
+	node, ok := db.dirties[hash]
+	if !ok {
+		return nil
+	}
+	var err error
+	node.forChilds(func(child common.Hash) {
+		if err == nil {
+			err = db.commit(child, batch, uncacher)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	rawdb.WriteTrieNode(batch, hash, node.enc)
+	if batch.ValueSize() >= idealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		db.lock.Lock()
+		batch.Replay(uncacher)
+		batch.Reset()
+		db.lock.Unlock()
+	}
+	return nil
+}
+
+// cleaner is a database batch replayer that takes a batch of write operations
+// and cleans up the trie database from anything written to disk.
+type cleaner struct {
+	db *Database
+}
+
+// Put reacts to database writes and implements dirty data uncaching. This is the
+// post-processing step of a commit operation where the already persisted trie is
+// removed from the dirty cache.
+func (c *cleaner) Put(key []byte, enc []byte) error {
+	hash := common.BytesToHash(key)
+
+	// If the node does not exist, we're done on this path
+	node, ok := c.db.dirties[hash]
+	if !ok {
+		return nil
+	}
+	// Node still exists, remove it from the flush-list
+	c.db.removeFromFlushList(hash, node)
+
+	// Remove the node from the dirty cache
+	delete(c.db.dirties, hash)
+	c.db.dirtiesSize -= node.size()
+	if node.children != nil {
+		c.db.childrenSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
+	}
+	return nil
+}
+
+func (c *cleaner) Delete(key []byte) error {
+	panic("not implemented")
+}
+
+// size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (db *Database) size() common.StorageSize {
+	size := db.dirtiesSize + common.StorageSize((len(db.dirties)-1)*cachedNodeSize)
+	size += db.childrenSize - common.StorageSize(len(db.dirties[common.Hash{}].children)*(common.HashLength+2))
+	return size
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (db *Database) Size() common.StorageSize {
+	if !db.tracksDirties() {
+		return 0
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.size()
+}
+
+// GCStats returns the statistics of garbage collection and flushing of dirty
+// nodes.
+func (db *Database) GCStats() GCStats {
+	if !db.tracksDirties() {
+		return GCStats{}
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return GCStats{
+		DirtyNodes: len(db.dirties) - 1,
+		DirtySize:  db.size(),
+		GCNodes:    db.gcnodes,
+		GCSize:     db.gcsize,
+		GCTime:     db.gctime,
+		FlushNodes: db.flushnodes,
+		FlushSize:  db.flushsize,
+		FlushTime:  db.flushtime,
+	}
+}
@@ -1,6 +1,7 @@
 package trie
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/massnetorg/mass-core/trie/common"
@@ -15,3 +16,121 @@ func TestDatabaseMetarootFetch(t *testing.T) {
 		t.Fatalf("metaroot retrieval succeeded")
 	}
 }
+
+// Tests that dereferenced roots are garbage collected from memory without
+// being written to disk, while live roots are kept.
+func TestDatabaseGC(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{TrackDirties: true})
+
+	addresses, accounts := makeAccounts(200)
+	trie, _ := New(common.Hash{}, db)
+	for i := 0; i < 100; i++ {
+		trie.Update(addresses[i][:], accounts[i])
+	}
+	root1, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	db.Reference(root1, common.Hash{})
+	for i := 100; i < len(addresses); i++ {
+		trie.Update(addresses[i][:], accounts[i])
+	}
+	root2, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	db.Reference(root2, common.Hash{})
+
+	if diskdb.Len() != 0 {
+		t.Fatalf("nodes written to disk before flushing: %d", diskdb.Len())
+	}
+	stats := db.GCStats()
+	if stats.DirtyNodes == 0 || stats.DirtySize != db.Size() {
+		t.Fatalf("unexpected dirty stats: %+v", stats)
+	}
+
+	// Nodes only referenced by root1 are garbage collected.
+	db.Dereference(root1)
+	if _, err := New(root1, db); err == nil {
+		t.Fatalf("dereferenced root still available")
+	}
+	stats = db.GCStats()
+	if stats.GCNodes == 0 || stats.GCSize == 0 {
+		t.Fatalf("unexpected gc stats: %+v", stats)
+	}
+	checkTrie := func(root common.Hash) {
+		tr, err := New(root, db)
+		if err != nil {
+			t.Fatalf("failed to open trie %x: %v", root, err)
+		}
+		for i := range addresses {
+			if val := tr.Get(addresses[i][:]); !bytes.Equal(val, accounts[i]) {
+				t.Fatalf("value mismatch for key %x: have %x, want %x", addresses[i], val, accounts[i])
+			}
+		}
+	}
+	checkTrie(root2)
+
+	// Flush root2 to disk.
+	if err := db.Commit(root2); err != nil {
+		t.Fatalf("failed to commit root: %v", err)
+	}
+	stats = db.GCStats()
+	if stats.DirtyNodes != 0 || db.Size() != 0 || stats.FlushNodes != uint64(diskdb.Len()) {
+		t.Fatalf("unexpected flush stats: %+v, disk nodes %d", stats, diskdb.Len())
+	}
+	db.Dereference(root2)
+	checkTrie(root2)
+	if _, err := New(root2, NewDatabase(diskdb)); err != nil {
+		t.Fatalf("flushed trie missing on disk: %v", err)
+	}
+}
+
+// Tests that Cap flushes the oldest nodes until the memory usage is below
+// the limit, and flushed roots survive dereferencing.
+func TestDatabaseCap(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{TrackDirties: true})
+
+	addresses, accounts := makeAccounts(500)
+	trie, _ := New(common.Hash{}, db)
+	var roots []common.Hash
+	for i := range addresses {
+		trie.Update(addresses[i][:], accounts[i])
+		if i%100 == 99 {
+			root, err := trie.Commit()
+			if err != nil {
+				t.Fatalf("failed to commit trie: %v", err)
+			}
+			db.Reference(root, common.Hash{})
+			roots = append(roots, root)
+		}
+	}
+	size := db.Size()
+	if err := db.Cap(size / 2); err != nil {
+		t.Fatalf("failed to cap database: %v", err)
+	}
+	if db.Size() > size/2 || diskdb.Len() == 0 {
+		t.Fatalf("database not capped: size %v, limit %v", db.Size(), size/2)
+	}
+	for _, root := range roots {
+		if _, err := New(root, db); err != nil {
+			t.Fatalf("failed to open trie %x: %v", root, err)
+		}
+	}
+	if err := db.Cap(0); err != nil {
+		t.Fatalf("failed to cap database: %v", err)
+	}
+	for _, root := range roots {
+		db.Dereference(root)
+	}
+	for _, root := range roots {
+		if _, err := New(root, NewDatabase(diskdb)); err != nil {
+			t.Fatalf("flushed trie %x missing on disk: %v", root, err)
+		}
+	}
+	if stats := db.GCStats(); stats.DirtyNodes != 0 {
+		t.Fatalf("dirty nodes left: %+v", stats)
+	}
+}
@@ -0,0 +1,102 @@
+package trie
+
+import (
+	"bytes"
+
+	"github.com/massnetorg/mass-core/trie/common"
+)
+
+// DiffKind is the kind of difference of a leaf between two tries.
+type DiffKind uint8
+
+const (
+	// LeafAdded means the leaf only exists in the new trie.
+	LeafAdded DiffKind = iota
+	// LeafRemoved means the leaf only exists in the old trie.
+	LeafRemoved
+	// LeafChanged means the leaf exists in both tries with different values.
+	LeafChanged
+)
+
+var diffKindStrings = map[DiffKind]string{
+	LeafAdded:   "added",
+	LeafRemoved: "removed",
+	LeafChanged: "changed",
+}
+
+// String returns the DiffKind in human-readable form.
+func (k DiffKind) String() string {
+	if s, ok := diffKindStrings[k]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// LeafDiff is a leaf that differs between two tries.
+type LeafDiff struct {
+	Kind DiffKind
+	Key  []byte
+	Old  []byte // value in the old trie, nil if added
+	New  []byte // value in the new trie, nil if removed
+}
+
+// Diff walks the old and new tries together with node iterators, and calls fn
+// for each leaf added, removed or changed from the old trie to the new one, in
+// the iteration order of NodeIterator, which is the order of keys if no key is
+// a prefix of another one. Subtrees having the same hash in both tries are skipped
+// without being resolved. The walk stops at the first error returned by fn.
+func Diff(oldIt, newIt NodeIterator, fn func(diff *LeafDiff) error) error {
+	oldOK, newOK := oldIt.Next(true), newIt.Next(true)
+	for oldOK || newOK {
+		var (
+			diff *LeafDiff
+			cmp  int
+		)
+		switch {
+		case !newOK:
+			cmp = -1
+		case !oldOK:
+			cmp = 1
+		default:
+			cmp = bytes.Compare(oldIt.Path(), newIt.Path())
+		}
+
+		switch {
+		case cmp < 0:
+			// Node only in the old trie.
+			if oldIt.Leaf() {
+				diff = &LeafDiff{Kind: LeafRemoved, Key: common.CopyBytes(oldIt.LeafKey()), Old: common.CopyBytes(oldIt.LeafBlob())}
+			}
+			oldOK = oldIt.Next(true)
+		case cmp > 0:
+			// Node only in the new trie.
+			if newIt.Leaf() {
+				diff = &LeafDiff{Kind: LeafAdded, Key: common.CopyBytes(newIt.LeafKey()), New: common.CopyBytes(newIt.LeafBlob())}
+			}
+			newOK = newIt.Next(true)
+		default:
+			// Nodes at the same path, same hashed subtrees are skipped.
+			// Embedded nodes and values have no hash.
+			descend := oldIt.Hash() != newIt.Hash() || oldIt.Hash() == (common.Hash{})
+			if oldIt.Leaf() && newIt.Leaf() && !bytes.Equal(oldIt.LeafBlob(), newIt.LeafBlob()) {
+				diff = &LeafDiff{
+					Kind: LeafChanged,
+					Key:  common.CopyBytes(oldIt.LeafKey()),
+					Old:  common.CopyBytes(oldIt.LeafBlob()),
+					New:  common.CopyBytes(newIt.LeafBlob()),
+				}
+			}
+			oldOK, newOK = oldIt.Next(descend), newIt.Next(descend)
+		}
+
+		if diff != nil {
+			if err := fn(diff); err != nil {
+				return err
+			}
+		}
+	}
+	if err := oldIt.Error(); err != nil {
+		return err
+	}
+	return newIt.Error()
+}
@@ -0,0 +1,95 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb/memorydb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	oldTrie, _ := New(common.Hash{}, db)
+	for i := 0; i < 300; i++ {
+		oldTrie.Update([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	oldRoot, err := oldTrie.Commit()
+	require.Nil(t, err)
+
+	newTrie, _ := New(oldRoot, db)
+	expect := make(map[string]*LeafDiff)
+	for i := 0; i < 300; i += 17 {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		newTrie.Delete(key)
+		expect[string(key)] = &LeafDiff{Kind: LeafRemoved, Key: key, Old: []byte(fmt.Sprintf("value-%d", i))}
+	}
+	for i := 5; i < 300; i += 23 {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		newTrie.Update(key, []byte("changed"))
+		expect[string(key)] = &LeafDiff{Kind: LeafChanged, Key: key, Old: []byte(fmt.Sprintf("value-%d", i)), New: []byte("changed")}
+	}
+	for _, key := range [][]byte{[]byte("kez"), []byte("key-9999"), []byte("a")} {
+		newTrie.Update(key, []byte("added"))
+		expect[string(key)] = &LeafDiff{Kind: LeafAdded, Key: key, New: []byte("added")}
+	}
+	newRoot, err := newTrie.Commit()
+	require.Nil(t, err)
+	oldTrie, _ = New(oldRoot, db)
+	newTrie, _ = New(newRoot, db)
+
+	var diffs []*LeafDiff
+	err = Diff(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil), func(diff *LeafDiff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, len(expect), len(diffs))
+	for i, diff := range diffs {
+		require.Equal(t, expect[string(diff.Key)], diff)
+		if i > 0 {
+			require.True(t, bytes.Compare(diffs[i-1].Key, diff.Key) < 0)
+		}
+	}
+
+	// reversed
+	count := 0
+	err = Diff(newTrie.NodeIterator(nil), oldTrie.NodeIterator(nil), func(diff *LeafDiff) error {
+		exp := expect[string(diff.Key)]
+		require.Equal(t, exp.Old, diff.New)
+		require.Equal(t, exp.New, diff.Old)
+		count++
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, len(expect), count)
+
+	// same trie and empty tries
+	err = Diff(newTrie.NodeIterator(nil), newTrie.NodeIterator(nil), func(diff *LeafDiff) error {
+		return errors.New("unexpected diff")
+	})
+	require.Nil(t, err)
+	empty := newEmpty()
+	count = 0
+	err = Diff(empty.NodeIterator(nil), newTrie.NodeIterator(nil), func(diff *LeafDiff) error {
+		require.Equal(t, LeafAdded, diff.Kind)
+		count++
+		return nil
+	})
+	require.Nil(t, err)
+	leaves := 0
+	for it := NewIterator(newTrie.NodeIterator(nil)); it.Next(); {
+		leaves++
+	}
+	require.Equal(t, leaves, count)
+
+	// error returned by fn stops the walk
+	stop := errors.New("stop")
+	err = Diff(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil), func(diff *LeafDiff) error {
+		return stop
+	})
+	require.Equal(t, stop, err)
+}
@@ -0,0 +1,172 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb"
+	"github.com/massnetorg/mass-core/trie/massdb/memorydb"
+)
+
+// Prove constructs a merkle proof for key. The result contains all encoded nodes
+// on the path to the value at key. The value itself is also included in the last
+// node and can be retrieved by verifying the proof.
+//
+// If the trie does not contain a value for key, the returned proof contains all
+// nodes of the longest existing prefix of the key (at least the root node), ending
+// with the node that proves the absence of the key.
+func (t *Trie) Prove(key []byte, fromLevel uint, proofDb massdb.KeyValueWriter) error {
+	// Collect all nodes on the path to key.
+	key = keybytesToHex(key)
+	var nodes []node
+	tn := t.root
+	for len(key) > 0 && tn != nil {
+		switch n := tn.(type) {
+		case *shortNode:
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				// The trie doesn't contain the key.
+				tn = nil
+			} else {
+				tn = n.Val
+				key = key[len(n.Key):]
+			}
+			nodes = append(nodes, n)
+		case *fullNode:
+			tn = n.Children[key[0]]
+			key = key[1:]
+			nodes = append(nodes, n)
+		case hashNode:
+			var err error
+			tn, err = t.resolveHash(n, nil)
+			if err != nil {
+				return err
+			}
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+		}
+	}
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+
+	for i, n := range nodes {
+		if fromLevel > 0 {
+			fromLevel--
+			continue
+		}
+		var hn node
+		n, hn = hasher.proofHash(n)
+		if hash, ok := hn.(hashNode); ok || i == 0 {
+			// If the node's database encoding is a hash (or is the
+			// root node), it becomes a proof element.
+			enc, err := encodeNode(n)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				hash = hasher.hashData(enc)
+			}
+			if err = proofDb.Put(hash, enc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyProof checks merkle proofs. The given proof must contain the value for
+// key in a trie with the given root hash. VerifyProof returns an error if the
+// proof contains invalid trie nodes or the wrong value.
+//
+// If the proof proves the absence of key, VerifyProof returns a nil value and
+// a nil error.
+func VerifyProof(rootHash common.Hash, key []byte, proofDb massdb.KeyValueReader) (value []byte, err error) {
+	if rootHash == (common.Hash{}) || rootHash == emptyRoot {
+		return nil, nil
+	}
+	key = keybytesToHex(key)
+	wantHash := rootHash
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+
+	for i := 0; ; i++ {
+		buf, _ := proofDb.Get(wantHash[:])
+		if buf == nil {
+			return nil, fmt.Errorf("proof node %d (hash %064x) missing", i, wantHash)
+		}
+		if !bytes.Equal(hasher.hashData(buf), wantHash[:]) {
+			return nil, fmt.Errorf("proof node %d (hash %064x) mismatched", i, wantHash)
+		}
+		n, err := decodeNode(wantHash[:], buf)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		keyrest, cld := get(n, key)
+		switch cld := cld.(type) {
+		case nil:
+			// The trie doesn't contain the key.
+			return nil, nil
+		case hashNode:
+			key = keyrest
+			copy(wantHash[:], cld)
+		case valueNode:
+			return cld, nil
+		}
+	}
+}
+
+// get returns the child of the given node. Return nil if the node with specified
+// key doesn't exist at all.
+func get(tn node, key []byte) ([]byte, node) {
+	for {
+		switch n := tn.(type) {
+		case *shortNode:
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				return nil, nil
+			}
+			tn = n.Val
+			key = key[len(n.Key):]
+		case *fullNode:
+			if len(key) == 0 {
+				return nil, nil
+			}
+			tn = n.Children[key[0]]
+			key = key[1:]
+		case hashNode:
+			return key, n
+		case nil:
+			return key, nil
+		case valueNode:
+			return nil, n
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+		}
+	}
+}
+
+// ProofList stores an ordered list of trie nodes. It implements
+// massdb.KeyValueWriter, so it can collect the nodes of a proof.
+type ProofList [][]byte
+
+// Put appends the node to the list.
+func (n *ProofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// Delete panics as there's no reason to remove a node from the list.
+func (n *ProofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// Store returns the nodes of the list keyed by their hashes, which can be
+// passed to VerifyProof.
+func (n ProofList) Store() massdb.KeyValueReader {
+	db := memorydb.New()
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+	for _, node := range n {
+		db.Put(hasher.hashData(node), node)
+	}
+	return db
+}
@@ -0,0 +1,84 @@
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/massnetorg/mass-core/trie/common"
+	"github.com/massnetorg/mass-core/trie/massdb/memorydb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProof(t *testing.T) {
+	addresses, accounts := makeAccounts(500)
+	trie := newEmpty()
+	for i := 0; i < len(addresses); i++ {
+		trie.Update(addresses[i][:], accounts[i])
+	}
+	root, err := trie.Commit()
+	require.Nil(t, err)
+
+	// prove from the committed trie as well as the one in memory
+	tr, err := New(root, trie.db)
+	require.Nil(t, err)
+	for _, prover := range []*Trie{trie, tr} {
+		for i := 0; i < len(addresses); i += 7 {
+			proof := memorydb.New()
+			require.Nil(t, prover.Prove(addresses[i][:], 0, proof))
+			val, err := VerifyProof(root, addresses[i][:], proof)
+			require.Nil(t, err)
+			require.Equal(t, accounts[i], val)
+		}
+	}
+
+	// absence proofs
+	for _, key := range [][]byte{{}, []byte("missing"), bytes.Repeat([]byte{0xff}, 20), append(addresses[0][:], 0x01)} {
+		proof := memorydb.New()
+		require.Nil(t, tr.Prove(key, 0, proof))
+		require.NotEqual(t, 0, proof.Len())
+		val, err := VerifyProof(root, key, proof)
+		require.Nil(t, err)
+		require.Nil(t, val)
+	}
+
+	// empty trie
+	empty := newEmpty()
+	proof := memorydb.New()
+	require.Nil(t, empty.Prove([]byte("k"), 0, proof))
+	val, err := VerifyProof(empty.Hash(), []byte("k"), proof)
+	require.Nil(t, err)
+	require.Nil(t, val)
+}
+
+func TestProofList(t *testing.T) {
+	trie := newEmpty()
+	trie.Update([]byte("doe"), []byte("reindeer"))
+	trie.Update([]byte("dog"), []byte("puppy"))
+	trie.Update([]byte("dogglesworth"), []byte("cat"))
+	root := trie.Hash()
+
+	var proof ProofList
+	require.Nil(t, trie.Prove([]byte("dog"), 0, &proof))
+	val, err := VerifyProof(root, []byte("dog"), proof.Store())
+	require.Nil(t, err)
+	require.Equal(t, []byte("puppy"), val)
+
+	// proof of a wrong root
+	_, err = VerifyProof(common.Hash{0x01}, []byte("dog"), proof.Store())
+	require.NotNil(t, err)
+
+	// tampered node
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+	for i := range proof {
+		bad := make(ProofList, len(proof))
+		copy(bad, proof)
+		bad[i] = append(common.CopyBytes(proof[i]), 0x00)
+		db := memorydb.New()
+		for j, enc := range bad {
+			db.Put(hasher.hashData(proof[j]), enc)
+		}
+		_, err = VerifyProof(root, []byte("dog"), db)
+		require.NotNil(t, err)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/massnetorg/mass-core/consensus"
 	"github.com/massnetorg/mass-core/interfaces"
 	"github.com/massnetorg/mass-core/poc"
 	"github.com/massnetorg/mass-core/poc/chiapos"
@@ -311,11 +310,17 @@ func NewBlockHeaderFromProto(pb *wirepb.BlockHeader) (*BlockHeader, error) {
 
 // ============ Methods below hide differences between MASS and Chia ===============
 
-// Quality
+// Quality returns QualityAt with MASSIP0002 active as on the main network.
 func (h *BlockHeader) Quality() *big.Int {
 	return h.Proof.Quality(uint64(h.Timestamp.Unix())/poc.PoCSlot, h.Height)
 }
 
+// QualityAt returns the quality of the proof, massip2 is whether MASSIP0002
+// is active at the height of the header on its chain.
+func (h *BlockHeader) QualityAt(massip2 bool) *big.Int {
+	return h.Proof.QualityAt(uint64(h.Timestamp.Unix())/poc.PoCSlot, h.Height, massip2)
+}
+
 func (h *BlockHeader) PublicKey() interfaces.PublicKey {
 	return h.PubKey
 }
@@ -399,6 +404,11 @@ func (h *BlockHeader) checkVersionConstraintV1() error {
 	return nil
 }
 
+// checkVersionConstraintV2 checks the key types of V2 headers.  Unlike V1, the
+// key types of BanList are not checked here, since only MASS keys may be
+// banned before MASSIP0002, whose activation depends on the chain.  It is
+// checked by blockchain, which rejects such headers with ErrBanList instead
+// of errMisusePubKeyType on decoding.
 func (h *BlockHeader) checkVersionConstraintV2() error {
 	switch h.Proof.Type() {
 	case poc.ProofTypeDefault:
@@ -418,13 +428,6 @@ func (h *BlockHeader) checkVersionConstraintV2() error {
 	default:
 		return errMisuseProofType
 	}
-	if h.Height < consensus.MASSIP0002Height {
-		for _, pub := range h.BanList {
-			if !isS256PublicKey(pub) {
-				return errMisusePubKeyType
-			}
-		}
-	}
 	return nil
 }
 
@@ -6,7 +6,9 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/massnetorg/mass-core/interfaces"
 	"github.com/massnetorg/mass-core/poc"
+	"github.com/massnetorg/mass-core/poc/chiapos"
 )
 
 // TestBlockHeader tests the BlockHeader API.
@@ -68,3 +70,21 @@ func TestBlockHeader_PoCHash(t *testing.T) {
 		t.Errorf("BlockHeader.BlockHash not equal, got = %v, want = %v", pocHash, tstGenesisPoCHash)
 	}
 }
+
+// TestBlockHeader_CheckVersionConstraintBanList ensures the key types of the
+// banList are only checked for V1 headers, as V2 headers are checked against
+// the deployments of the chain by blockchain.
+func TestBlockHeader_CheckVersionConstraintBanList(t *testing.T) {
+	header := mockHeader(1, poc.ProofTypeDefault)
+	header.BanList = []interfaces.PublicKey{chiapos.NewG1ElementGenerator()}
+	if err := header.CheckVersionConstraint(); err != errMisusePubKeyType {
+		t.Errorf("V1 BlockHeader.CheckVersionConstraint error, got = %v, want = %v", err, errMisusePubKeyType)
+	}
+
+	header = mockHeader(uint64(BlockVersionV2), poc.ProofTypeDefault)
+	header.Height = 1
+	header.BanList = []interfaces.PublicKey{chiapos.NewG1ElementGenerator()}
+	if err := header.CheckVersionConstraint(); err != nil {
+		t.Errorf("V2 BlockHeader.CheckVersionConstraint error, got = %v, want = %v", err, nil)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/massnetorg/mass-core/blockchain"
+	"github.com/massnetorg/mass-core/config"
 	"github.com/massnetorg/mass-core/massutil"
 	"github.com/massnetorg/mass-core/wire"
 )
@@ -29,7 +30,7 @@ func Test_CheckData(t *testing.T) {
 		if err != nil {
 			t.Fatalf("failed to new block from bytes, %v", err)
 		}
-		err = blockchain.CheckProofOfCapacity(block, big.NewInt(0))
+		err = blockchain.CheckProofOfCapacity(&config.ChainParams, block, big.NewInt(0))
 		if err != nil {
 			t.Fatalf("failed to check proof, %v", err)
 		}